@@ -0,0 +1,73 @@
+// Command dnsproxy is a caching DNS forwarder. It listens over UDP and TCP and
+// forwards the queries it cannot answer from its cache to upstream servers,
+// over plain DNS, DNS over TLS or DNS over HTTPS
+//
+//	dnsproxy -listen 127.0.0.1:53 -upstream tls://1.1.1.1 -upstream https://dns.google/dns-query
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+// upstreamsFlag collects the upstreams given with repeated flags or separated
+// by commas
+type upstreamsFlag []dns.Upstream
+
+func (f *upstreamsFlag) String() string {
+	addrs := make([]string, len(*f))
+	for i, u := range *f {
+		addrs[i] = u.String()
+	}
+
+	return strings.Join(addrs, ",")
+}
+
+func (f *upstreamsFlag) Set(value string) error {
+	for _, addr := range strings.Split(value, ",") {
+		u, err := dns.ParseUpstream(strings.TrimSpace(addr))
+		if err != nil {
+			return err
+		}
+		*f = append(*f, u)
+	}
+
+	return nil
+}
+
+func main() {
+	var upstreams upstreamsFlag
+	listen := flag.String("listen", "127.0.0.1:53", "address to listen on over UDP and TCP")
+	flag.Var(&upstreams, "upstream", "upstream server, tried in the order given (repeatable)")
+	cacheSize := flag.Int("cache-size", 10000, "maximum number of cached responses, 0 disables the cache")
+	maxStale := flag.Duration("serve-stale", 0, "time expired responses are served when upstreams fail")
+	prefetch := flag.Duration("prefetch", 0, "time before expiry popular responses are refreshed")
+	timeout := flag.Duration("timeout", 2*time.Second, "timeout of the queries sent to the upstreams")
+	fastest := flag.Bool("fastest", false, "prefer the upstreams with the lowest smoothed RTT over the given order")
+	race := flag.Bool("race", false, "send the queries to the first two upstreams at once")
+	flag.Parse()
+
+	if len(upstreams) == 0 {
+		log.Fatalf("at least one upstream is required")
+	}
+
+	f := &dns.Forwarder{Upstreams: upstreams, Client: dns.Client{Timeout: *timeout}, Race: *race}
+	if *fastest {
+		f.Selection = dns.FastestSelection
+	}
+	if *cacheSize > 0 {
+		f.Cache = &dns.Cache{Size: *cacheSize, Querier: f, MaxStale: *maxStale, PrefetchWindow: *prefetch}
+	}
+	f.Start()
+	defer f.Stop()
+
+	s := &dns.Server{Addr: *listen, Handler: f}
+	log.Printf("forwarding queries received on %s to %s", *listen, upstreams.String())
+	if err := s.ListenAndServe(); err != nil {
+		log.Fatalf("failed to serve. err=%s", err.Error())
+	}
+}
@@ -0,0 +1,180 @@
+package dns
+
+// maxCNAMEChain bounds the number of CNAME records followed inside a zone
+const maxCNAMEChain = 8
+
+// ZoneHandler answers queries authoritatively from the records of a zone:
+// answers, CNAME chains within the zone, referrals to delegated children,
+// NXDOMAIN and NODATA responses. AXFR and IXFR requests are served as done by
+// TransferHandler
+type ZoneHandler struct {
+	Zone *Zone
+	// Journal records the changes of the zone, for incremental transfers. It
+	// may be nil
+	Journal *Journal
+	// TransferKeys lists the TSIG keys zone transfers must be signed with.
+	// Transfers are allowed to anyone if empty
+	TransferKeys []string
+}
+
+// ServeDNS implements the Handler interface
+func (h *ZoneHandler) ServeDNS(w ResponseWriter, r *Message) {
+	if r.Header.Opcode == QueryOpcode && r.Header.QuestionCount == 1 &&
+		(r.Question.Type == AXFRQType || r.Question.Type == IXFRQType) {
+		t := TransferHandler{Zone: h.Zone, Journal: h.Journal, AllowKeys: h.TransferKeys}
+		t.ServeDNS(w, r)
+		return
+	}
+
+	w.WriteMessage(answerFromZone(h.Zone, r))
+}
+
+// answerFromZone builds the authoritative response to a query from the records
+// of the zone
+func answerFromZone(z *Zone, r *Message) *Message {
+	resp := NewResponse(r)
+	if r.Header.Opcode != QueryOpcode {
+		resp.Header.RCode = NotImplementedRCode
+		return resp
+	}
+
+	qname := r.Question.Name
+	if r.Header.QuestionCount != 1 || !qname.IsSubdomainOf(z.Origin()) {
+		resp.Header.RCode = RefusedRCode
+		return resp
+	}
+
+	records := z.Records()
+	referral := delegation(z.Origin(), records, qname)
+	if len(referral) > 0 && r.Question.Type == QType(DSType) && referral[0].Name.Equal(qname) {
+		// the DS records of a delegation belong to the parent zone (RFC 4035
+		// section 3.1.4.1)
+		referral = nil
+	}
+	if len(referral) > 0 {
+		resp.Authority = referral
+		resp.Additional = glue(records, referral)
+		return resp
+	}
+
+	resp.Header.AA = true
+	name := qname
+	for i := 0; i < maxCNAMEChain; i++ {
+		owned := ownedBy(records, name)
+		if len(owned) == 0 {
+			if i == 0 && !hasDescendant(records, name) {
+				resp.Header.RCode = NameErrorRCode
+			}
+			break
+		}
+
+		answers := make([]ResourceRecord, 0)
+		var cname *ResourceRecord
+		for j, rr := range owned {
+			if r.Question.Type == ANYQType || QType(rr.Type) == r.Question.Type {
+				answers = append(answers, rr)
+			}
+			if rr.Type == CNAMEType {
+				cname = &owned[j]
+			}
+		}
+
+		if len(answers) > 0 || cname == nil {
+			resp.Answers = append(resp.Answers, answers...)
+			break
+		}
+
+		resp.Answers = append(resp.Answers, *cname)
+		target := Name{}
+		if _, err := target.fromBytes(cname.Data, 0); err != nil || !target.IsSubdomainOf(z.Origin()) {
+			return resp
+		}
+		name = target
+	}
+
+	last := len(resp.Answers) - 1
+	if last < 0 || (resp.Answers[last].Type == CNAMEType &&
+		r.Question.Type != QType(CNAMEType) && r.Question.Type != ANYQType) {
+		resp.Authority = []ResourceRecord{negativeSOA(records[0])}
+	}
+
+	return resp
+}
+
+// delegation returns the NS records of the highest zone cut found between the
+// origin and qname, if any
+func delegation(origin Name, records []ResourceRecord, qname Name) []ResourceRecord {
+	var cut []ResourceRecord
+	cutLabels := 0
+
+	for _, rr := range records {
+		if rr.Type != NSType || rr.Name.Equal(origin) || !qname.IsSubdomainOf(rr.Name) {
+			continue
+		}
+
+		labels := rr.Name.LabelCount()
+		if len(cut) == 0 || labels < cutLabels {
+			cut = []ResourceRecord{rr}
+			cutLabels = labels
+		} else if labels == cutLabels {
+			cut = append(cut, rr)
+		}
+	}
+
+	return cut
+}
+
+// glue returns the address records of the name servers of a referral that are
+// found in the zone
+func glue(records []ResourceRecord, referral []ResourceRecord) []ResourceRecord {
+	additional := make([]ResourceRecord, 0)
+	for _, ns := range referral {
+		target := Name{}
+		if _, err := target.fromBytes(ns.Data, 0); err != nil {
+			continue
+		}
+
+		for _, rr := range records {
+			if (rr.Type == AType || rr.Type == AAAAType) && rr.Name.Equal(target) {
+				additional = append(additional, rr)
+			}
+		}
+	}
+
+	return additional
+}
+
+func ownedBy(records []ResourceRecord, name Name) []ResourceRecord {
+	owned := make([]ResourceRecord, 0)
+	for _, rr := range records {
+		if rr.Name.Equal(name) {
+			owned = append(owned, rr)
+		}
+	}
+
+	return owned
+}
+
+// hasDescendant reports whether a record is owned by a descendant of name, in
+// which case name is an empty non-terminal that exists
+func hasDescendant(records []ResourceRecord, name Name) bool {
+	for _, rr := range records {
+		if !rr.Name.Equal(name) && rr.Name.IsSubdomainOf(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// negativeSOA returns the SOA record put in the authority section of negative
+// responses, its TTL being the minimum of its own TTL and of its MINIMUM field
+// (RFC 2308 section 3)
+func negativeSOA(soa ResourceRecord) ResourceRecord {
+	data, err := soa.SOA()
+	if err == nil && int64(data.Minimum) < int64(soa.TTL) {
+		soa.TTL = int32(data.Minimum)
+	}
+
+	return soa
+}
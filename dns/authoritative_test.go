@@ -0,0 +1,57 @@
+package dns_test
+
+import (
+	"testing"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func nameRecord(t *testing.T, name string, rtype dns.Type, target string) dns.ResourceRecord {
+	n := mustName(t, target)
+	return dns.NewResourceRecord(mustName(t, name), rtype, dns.INClass, 300, n.ToBytes())
+}
+
+func TestZoneHandler(t *testing.T) {
+	z, err := dns.NewZone(mustName(t, "example.com"), []dns.ResourceRecord{
+		soaRecord(t, "example.com", 1),
+		nameRecord(t, "example.com", dns.NSType, "ns1.example.com"),
+		aRecord(t, "ns1.example.com", "192.0.2.53"),
+		aRecord(t, "www.example.com", "192.0.2.1"),
+		nameRecord(t, "alias.example.com", dns.CNAMEType, "www.example.com"),
+		aRecord(t, "host.internal.example.com", "192.0.2.2"),
+		nameRecord(t, "sub.example.com", dns.NSType, "ns.sub.example.com"),
+		aRecord(t, "ns.sub.example.com", "192.0.2.54"),
+	})
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+	addr := startServer(t, &dns.ZoneHandler{Zone: z})
+
+	var cases = []struct {
+		name       string
+		qtype      dns.QType
+		rcode      dns.RCode
+		aa         dns.AA
+		answers    int
+		authority  int
+		additional int
+	}{
+		{"www.example.com", dns.QType(dns.AType), dns.NoErrorRCode, true, 1, 0, 0},
+		{"alias.example.com", dns.QType(dns.AType), dns.NoErrorRCode, true, 2, 0, 0},
+		{"www.example.com", dns.QType(dns.MXType), dns.NoErrorRCode, true, 0, 1, 0},
+		{"internal.example.com", dns.QType(dns.AType), dns.NoErrorRCode, true, 0, 1, 0},
+		{"missing.example.com", dns.QType(dns.AType), dns.NameErrorRCode, true, 0, 1, 0},
+		{"www.sub.example.com", dns.QType(dns.AType), dns.NoErrorRCode, false, 0, 1, 1},
+		{"example.org", dns.QType(dns.AType), dns.RefusedRCode, false, 0, 0, 0},
+	}
+
+	for _, c := range cases {
+		resp := query(t, addr, c.name, c.qtype)
+		if resp.Header.RCode != c.rcode || resp.Header.AA != c.aa || len(resp.Answers) != c.answers ||
+			len(resp.Authority) != c.authority || len(resp.Additional) != c.additional {
+			t.Fatalf("unexpected response. name=%s qtype=%s rcode=%s aa=%v answers=%d authority=%d additional=%d",
+				c.name, c.qtype, resp.Header.RCode, resp.Header.AA, len(resp.Answers), len(resp.Authority),
+				len(resp.Additional))
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IssuerCriticalFlag marks a CAA property a CA must understand to issue a
+// certificate
+const IssuerCriticalFlag uint8 = 0x80
+
+const (
+	// IssueTag restricts the CAs allowed to issue certificates for the domain
+	IssueTag = "issue"
+	// IssueWildTag restricts the CAs allowed to issue wildcard certificates
+	// for the domain
+	IssueWildTag = "issuewild"
+	// IODEFTag gives the URL incident reports are sent to
+	IODEFTag = "iodef"
+)
+
+// CAA is the data of a CAA resource record (RFC 8659), a property of the
+// certification authority authorization policy of a domain
+type CAA struct {
+	Flags uint8
+	// Tag identifies the property, made of ASCII letters and digits only
+	Tag   string
+	Value string
+}
+
+// ToBytes returns the byte array form of the CAA data
+func (c *CAA) ToBytes() []byte {
+	data := make([]byte, 0, 2+len(c.Tag)+len(c.Value))
+
+	data = append(data, c.Flags, byte(len(c.Tag)))
+	data = append(data, c.Tag...)
+
+	return append(data, c.Value...)
+}
+
+func (c *CAA) String() string {
+	return fmt.Sprintf("%d %s %s", c.Flags, c.Tag, quoteString(c.Value))
+}
+
+// Critical reports whether the issuer critical flag is set
+func (c *CAA) Critical() bool {
+	return c.Flags&IssuerCriticalFlag != 0
+}
+
+// CAA returns the data of a CAA resource record
+func (rr ResourceRecord) CAA() (CAA, error) {
+	if rr.Type != CAAType {
+		return CAA{}, fmt.Errorf("resource record is not a CAA record. type=%s", rr.Type)
+	}
+
+	if len(rr.Data) < 2 || len(rr.Data) < 2+int(rr.Data[1]) {
+		return CAA{}, fmt.Errorf("failed to parse CAA data, invalid length %d", len(rr.Data))
+	}
+
+	c := CAA{
+		Flags: rr.Data[0],
+		Tag:   string(rr.Data[2 : 2+int(rr.Data[1])]),
+		Value: string(rr.Data[2+int(rr.Data[1]):]),
+	}
+	if err := validateCAATag(c.Tag); err != nil {
+		return CAA{}, err
+	}
+
+	return c, nil
+}
+
+// ParseCAA parses the presentation form of CAA data, ie:
+// `0 issue "ca.example.net; account=230123"`
+func ParseCAA(s string) (CAA, error) {
+	fields, err := presentationFields(s)
+	if err != nil {
+		return CAA{}, err
+	}
+
+	if len(fields) != 3 {
+		return CAA{}, fmt.Errorf("failed to parse CAA data, invalid field count %d", len(fields))
+	}
+
+	flags, err := strconv.ParseUint(fields[0], 10, 8)
+	if err != nil {
+		return CAA{}, fmt.Errorf("failed to parse CAA data, invalid flags %s", fields[0])
+	}
+
+	if err := validateCAATag(fields[1]); err != nil {
+		return CAA{}, err
+	}
+
+	return CAA{Flags: uint8(flags), Tag: fields[1], Value: fields[2]}, nil
+}
+
+// validateCAATag checks the tag is made of ASCII letters and digits, as
+// required by RFC 8659 section 4.1
+func validateCAATag(tag string) error {
+	if tag == "" || len(tag) > 255 {
+		return fmt.Errorf("invalid CAA tag, invalid length %d", len(tag))
+	}
+
+	for _, c := range tag {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return fmt.Errorf("invalid CAA tag, invalid character %q. tag=%s", c, tag)
+		}
+	}
+
+	return nil
+}
+
+// CAAIssueValue is the value of an issue or issuewild property
+type CAAIssueValue struct {
+	// IssuerDomainName identifies the CA allowed to issue. It is empty when
+	// the property forbids issuance
+	IssuerDomainName string
+	// Parameters are the CA specific parameters, ie: "accounturi"
+	Parameters map[string]string
+}
+
+// IssueValue parses the value of an issue or issuewild property (RFC 8659
+// section 4.2), ie: "ca.example.net; accounturi=https://ca.example.net/acct/1"
+func (c *CAA) IssueValue() (CAAIssueValue, error) {
+	if !strings.EqualFold(c.Tag, IssueTag) && !strings.EqualFold(c.Tag, IssueWildTag) {
+		return CAAIssueValue{}, fmt.Errorf("CAA property is not an issue property. tag=%s", c.Tag)
+	}
+
+	domain, params, _ := strings.Cut(c.Value, ";")
+	v := CAAIssueValue{IssuerDomainName: strings.Trim(domain, " \t"), Parameters: make(map[string]string)}
+	if v.IssuerDomainName != "" {
+		if _, err := NewName(v.IssuerDomainName); err != nil || strings.HasSuffix(v.IssuerDomainName, ".") {
+			return CAAIssueValue{}, fmt.Errorf("failed to parse CAA issue value, invalid issuer domain name %s", domain)
+		}
+	}
+
+	for _, param := range strings.Split(params, ";") {
+		if strings.Trim(param, " \t") == "" {
+			continue
+		}
+
+		tag, value, ok := strings.Cut(param, "=")
+		tag, value = strings.Trim(tag, " \t"), strings.Trim(value, " \t")
+		if !ok || validateCAATag(tag) != nil || strings.ContainsAny(value, " \t") {
+			return CAAIssueValue{}, fmt.Errorf("failed to parse CAA issue value, invalid parameter %s", param)
+		}
+		v.Parameters[tag] = value
+	}
+
+	return v, nil
+}
+
+// PermitsIssuance reports whether the relevant CAA RRset of a domain allows the
+// CA identified by its issuer domain name to issue a certificate, for a
+// wildcard domain name when wildcard is set (RFC 8659 section 4). An empty
+// RRset allows any CA. Properties with an unknown tag and the issuer critical
+// flag forbid any issuance
+func PermitsIssuance(records []CAA, issuer string, wildcard bool) bool {
+	tag := IssueTag
+	for _, c := range records {
+		switch {
+		case strings.EqualFold(c.Tag, IssueWildTag):
+			if wildcard {
+				tag = IssueWildTag
+			}
+		case strings.EqualFold(c.Tag, IssueTag), strings.EqualFold(c.Tag, IODEFTag):
+		case c.Critical():
+			return false
+		}
+	}
+
+	restricted := false
+	for _, c := range records {
+		if !strings.EqualFold(c.Tag, tag) {
+			continue
+		}
+
+		restricted = true
+		v, err := c.IssueValue()
+		// a malformed property forbids issuance, as an empty one does
+		if err == nil && v.IssuerDomainName != "" &&
+			strings.EqualFold(v.IssuerDomainName, strings.TrimSuffix(issuer, ".")) {
+			return true
+		}
+	}
+
+	return !restricted
+}
+
+// LookupCAA returns the relevant CAA RRset of the domain: the CAA records of
+// the domain, or else of its closest ancestor holding some, the root excluded
+// (RFC 8659 section 3). The RRset of a wildcard domain name *.X is the one of
+// X. An empty RRset is returned when no CAA record is found, and an error when
+// a lookup fails, in which case a CA must not issue
+func (r *Resolver) LookupCAA(ctx context.Context, domain string) ([]CAA, error) {
+	name := strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(domain), "*."), ".")
+	for name != "" {
+		records, _, err := r.lookupRecords(ctx, name+".", QType(CAAType))
+		if err != nil && !isNotFound(err) {
+			return nil, err
+		}
+
+		if len(records) > 0 {
+			caas := make([]CAA, 0, len(records))
+			for _, rr := range records {
+				c, err := rr.CAA()
+				if err != nil {
+					return nil, malformed(name, err)
+				}
+				caas = append(caas, c)
+			}
+			return caas, nil
+		}
+
+		_, name, _ = strings.Cut(name, ".")
+	}
+
+	return []CAA{}, nil
+}
+
+// CheckCAA reports whether the CAA policy of the domain allows the CA
+// identified by its issuer domain name to issue a certificate for it, the
+// domain being a wildcard domain name when it starts with "*."
+func (r *Resolver) CheckCAA(ctx context.Context, domain, issuer string) (bool, error) {
+	records, err := r.LookupCAA(ctx, domain)
+	if err != nil {
+		return false, err
+	}
+
+	return PermitsIssuance(records, issuer, strings.HasPrefix(domain, "*.")), nil
+}
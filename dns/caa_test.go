@@ -0,0 +1,191 @@
+package dns_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func caaRecord(t *testing.T, name string, presentation string) dns.ResourceRecord {
+	c, err := dns.ParseCAA(presentation)
+	if err != nil {
+		t.Fatalf("ParseCAA failed with error %s", err.Error())
+	}
+	return dns.NewResourceRecord(mustName(t, name), dns.CAAType, dns.INClass, 300, c.ToBytes())
+}
+
+func TestCAA(t *testing.T) {
+	var cases = []struct {
+		presentation string
+		expected     string
+		valid        bool
+	}{
+		{`0 issue "ca.example.net"`, `0 issue "ca.example.net"`, true},
+		{`128 tbs "Unknown"`, `128 tbs "Unknown"`, true},
+		{`0 issue ca.example.net`, `0 issue "ca.example.net"`, true},
+		{`0 iodef "mailto:security@example.com"`, `0 iodef "mailto:security@example.com"`, true},
+		{`0 issue ";"`, `0 issue ";"`, true},
+		{`0 issue "say \"hi\"\010"`, `0 issue "say \"hi\"\010"`, true},
+		{`0 is-sue "ca.example.net"`, "", false},
+		{`0 "" "ca.example.net"`, "", false},
+		{`256 issue "ca.example.net"`, "", false},
+		{`0 issue`, "", false},
+	}
+
+	for i, c := range cases {
+		caa, err := dns.ParseCAA(c.presentation)
+		if (err == nil) != c.valid {
+			t.Fatalf("unexpected ParseCAA result. case=%d err=%v", i, err)
+		}
+		if !c.valid {
+			continue
+		}
+
+		rr := dns.NewResourceRecord(mustName(t, "example.com"), dns.CAAType, dns.INClass, 300, caa.ToBytes())
+		parsed, err := rr.CAA()
+		if err != nil {
+			t.Fatalf("CAA failed. case=%d err=%s", i, err.Error())
+		}
+
+		if parsed.String() != c.expected {
+			t.Fatalf("unexpected CAA. case=%d actual=%s expected=%s", i, parsed.String(), c.expected)
+		}
+	}
+
+	rr := dns.NewResourceRecord(mustName(t, "example.com"), dns.CAAType, dns.INClass, 300, []byte{0, 3, 'a', '_'})
+	if _, err := rr.CAA(); err == nil {
+		t.Fatalf("expected an error for an invalid tag")
+	}
+}
+
+func TestCAAIssueValue(t *testing.T) {
+	var cases = []struct {
+		value  string
+		domain string
+		params map[string]string
+		valid  bool
+	}{
+		{"ca.example.net", "ca.example.net", map[string]string{}, true},
+		{" ca.example.net ; account=230123 ", "ca.example.net", map[string]string{"account": "230123"}, true},
+		{"ca.example.net; accounturi=https://ca.example.net/acct/1; validationmethods=dns-01",
+			"ca.example.net", map[string]string{"accounturi": "https://ca.example.net/acct/1", "validationmethods": "dns-01"}, true},
+		{";", "", map[string]string{}, true},
+		{"", "", map[string]string{}, true},
+		{"ca.example.net; account", "", nil, false},
+		{"ca.example.net.", "", nil, false},
+		{"ca.example.net; acc-ount=1", "", nil, false},
+	}
+
+	for i, c := range cases {
+		caa := dns.CAA{Tag: dns.IssueTag, Value: c.value}
+		v, err := caa.IssueValue()
+		if (err == nil) != c.valid {
+			t.Fatalf("unexpected IssueValue result. case=%d err=%v", i, err)
+		}
+		if !c.valid {
+			continue
+		}
+
+		if v.IssuerDomainName != c.domain || len(v.Parameters) != len(c.params) {
+			t.Fatalf("unexpected issue value. case=%d actual=%v", i, v)
+		}
+		for tag, value := range c.params {
+			if v.Parameters[tag] != value {
+				t.Fatalf("unexpected parameter. case=%d tag=%s actual=%s", i, tag, v.Parameters[tag])
+			}
+		}
+	}
+}
+
+func TestPermitsIssuance(t *testing.T) {
+	issue := dns.CAA{Tag: "issue", Value: "ca.example.net; account=1"}
+	other := dns.CAA{Tag: "ISSUE", Value: "other.example.org"}
+	forbid := dns.CAA{Tag: "issue", Value: ";"}
+	wild := dns.CAA{Tag: "issuewild", Value: "wild.example.org"}
+	iodef := dns.CAA{Tag: "iodef", Value: "mailto:security@example.com"}
+	critical := dns.CAA{Flags: dns.IssuerCriticalFlag, Tag: "tbs", Value: "unknown"}
+	unknown := dns.CAA{Tag: "tbs", Value: "unknown"}
+
+	var cases = []struct {
+		records  []dns.CAA
+		issuer   string
+		wildcard bool
+		expected bool
+	}{
+		{[]dns.CAA{}, "ca.example.net", false, true},
+		{[]dns.CAA{issue}, "ca.example.net", false, true},
+		{[]dns.CAA{issue}, "CA.example.net.", false, true},
+		{[]dns.CAA{issue}, "other.example.org", false, false},
+		{[]dns.CAA{issue, other}, "other.example.org", false, true},
+		{[]dns.CAA{forbid}, "ca.example.net", false, false},
+		{[]dns.CAA{iodef}, "ca.example.net", false, true},
+		{[]dns.CAA{issue, critical}, "ca.example.net", false, false},
+		{[]dns.CAA{issue, unknown}, "ca.example.net", false, true},
+		// issuewild takes precedence over issue for wildcard domain names only
+		{[]dns.CAA{issue, wild}, "ca.example.net", true, false},
+		{[]dns.CAA{issue, wild}, "wild.example.org", true, true},
+		{[]dns.CAA{issue, wild}, "wild.example.org", false, false},
+		{[]dns.CAA{issue}, "ca.example.net", true, true},
+	}
+
+	for i, c := range cases {
+		if actual := dns.PermitsIssuance(c.records, c.issuer, c.wildcard); actual != c.expected {
+			t.Fatalf("unexpected result. case=%d actual=%t expected=%t", i, actual, c.expected)
+		}
+	}
+}
+
+func TestLookupCAA(t *testing.T) {
+	z := mustZone(t, "example.com",
+		caaRecord(t, "example.com", `0 issue "ca.example.net"`),
+		caaRecord(t, "sub.example.com", `0 issue "other.example.org"`),
+		caaRecord(t, "sub.example.com", `0 issuewild ";"`),
+		aRecord(t, "www.example.com", "192.0.2.1"),
+		aRecord(t, "www.sub.example.com", "192.0.2.2"),
+		nameRecord(t, "alias.example.com", dns.CNAMEType, "www.sub.example.com"),
+	)
+	other := mustZone(t, "example.org", aRecord(t, "www.example.org", "192.0.2.3"))
+
+	addr := startServer(t, zonesHandler(mustZone(t, "."), z, other))
+	r := &dns.Resolver{Querier: &dns.Stub{Config: &dns.ResolvConf{
+		Servers:  []string{addr},
+		Timeout:  2 * time.Second,
+		Attempts: 1,
+	}}}
+
+	var cases = []struct {
+		domain   string
+		issuer   string
+		records  int
+		expected bool
+	}{
+		{"example.com", "ca.example.net", 1, true},
+		// the tree is climbed up to the closest ancestor holding CAA records
+		{"www.example.com", "ca.example.net", 1, true},
+		{"deep.missing.www.example.com", "ca.example.net", 1, true},
+		{"www.sub.example.com", "ca.example.net", 2, false},
+		{"www.sub.example.com", "other.example.org", 2, true},
+		{"*.sub.example.com", "other.example.org", 2, false},
+		{"*.example.com", "ca.example.net", 1, true},
+		// the climb starts from the alias, not from its target
+		{"alias.example.com", "ca.example.net", 1, true},
+		{"www.example.org", "ca.example.net", 0, true},
+	}
+
+	for i, c := range cases {
+		records, err := r.LookupCAA(context.Background(), c.domain)
+		if err != nil {
+			t.Fatalf("LookupCAA failed. case=%d err=%s", i, err.Error())
+		}
+		if len(records) != c.records {
+			t.Fatalf("unexpected CAA records. case=%d actual=%v", i, records)
+		}
+
+		permitted, err := r.CheckCAA(context.Background(), c.domain, c.issuer)
+		if err != nil || permitted != c.expected {
+			t.Fatalf("unexpected CheckCAA result. case=%d actual=%t err=%v", i, permitted, err)
+		}
+	}
+}
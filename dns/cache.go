@@ -0,0 +1,458 @@
+package dns
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCacheSize bounds the number of responses held by a Cache
+	defaultCacheSize = 10000
+	// defaultMaxCacheTTL caps the time positive responses are cached
+	defaultMaxCacheTTL = 24 * time.Hour
+	// defaultMaxNegativeCacheTTL caps the time negative responses are cached
+	// (RFC 2308 section 5)
+	defaultMaxNegativeCacheTTL = 3 * time.Hour
+	// defaultStaleAnswerTTL is the TTL of the records of stale answers (RFC
+	// 8767 section 4)
+	defaultStaleAnswerTTL = 30 * time.Second
+	// defaultStaleRefreshInterval is the time stale answers are served without
+	// trying to refresh them after a failed refresh (RFC 8767 section 5)
+	defaultStaleRefreshInterval = 30 * time.Second
+	// defaultPrefetchHits is the number of hits making an entry popular enough
+	// to be prefetched
+	defaultPrefetchHits = 3
+)
+
+// Cache holds responses until the expiry of their records. Responses are keyed
+// by the name, type and class of their question. NXDOMAIN and NODATA
+// responses are cached for the TTL of the SOA record of their authority
+// section (RFC 2308). The least recently used responses are evicted once the
+// cache is full. A Cache is safe for concurrent use
+//
+// A Cache with a Querier answers queries itself, querying on misses. Expired
+// responses can then be served when their refresh fails (RFC 8767), and
+// popular responses can be refreshed in the background before they expire
+type Cache struct {
+	// Size bounds the number of cached responses. Defaults to 10000
+	Size int
+	// MaxTTL caps the time positive responses are cached. Defaults to 1 day
+	MaxTTL time.Duration
+	// MaxNegativeTTL caps the time negative responses are cached. Defaults to
+	// 3 hours
+	MaxNegativeTTL time.Duration
+	// Now returns the current time. Defaults to time.Now
+	Now func() time.Time
+	// Querier answers the queries missing the cache, and refreshes the
+	// prefetched responses. It may be nil if the cache is only used through
+	// Get and Put
+	Querier Querier
+	// MaxStale is the time expired responses are kept to be served when their
+	// refresh fails. Stale responses are not served if zero
+	MaxStale time.Duration
+	// StaleAnswerTTL is the TTL of the records of stale responses. Defaults
+	// to 30 seconds
+	StaleAnswerTTL time.Duration
+	// StaleRefreshInterval is the time stale responses are served without
+	// trying to refresh them again after a failed refresh. Defaults to 30
+	// seconds
+	StaleRefreshInterval time.Duration
+	// PrefetchWindow is the time before their expiry popular responses are
+	// refreshed in the background when hit. Responses are not prefetched if
+	// zero
+	PrefetchWindow time.Duration
+	// PrefetchHits is the number of hits making a response popular enough to
+	// be prefetched. Defaults to 3
+	PrefetchHits int
+
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	// lru orders the entries from the most to the least recently used
+	lru   *list.List
+	stats CacheStats
+}
+
+// CacheStats holds the counters of a Cache
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	// StaleHits counts the stale responses served
+	StaleHits uint64
+	// Prefetches counts the responses refreshed before their expiry
+	Prefetches uint64
+	Entries    int
+}
+
+type cacheKey struct {
+	name  string
+	t     QType
+	class Class
+}
+
+type cacheEntry struct {
+	key      cacheKey
+	response Message
+	stored   time.Time
+	expires  time.Time
+	hits     int
+	// failed is the time of the last failed refresh of the expired response
+	failed      time.Time
+	prefetching bool
+}
+
+func (c *Cache) size() int {
+	if c.Size == 0 {
+		return defaultCacheSize
+	}
+
+	return c.Size
+}
+
+func (c *Cache) maxTTL() time.Duration {
+	if c.MaxTTL == 0 {
+		return defaultMaxCacheTTL
+	}
+
+	return c.MaxTTL
+}
+
+func (c *Cache) maxNegativeTTL() time.Duration {
+	if c.MaxNegativeTTL == 0 {
+		return defaultMaxNegativeCacheTTL
+	}
+
+	return c.MaxNegativeTTL
+}
+
+func (c *Cache) staleAnswerTTL() time.Duration {
+	if c.StaleAnswerTTL == 0 {
+		return defaultStaleAnswerTTL
+	}
+
+	return c.StaleAnswerTTL
+}
+
+func (c *Cache) staleRefreshInterval() time.Duration {
+	if c.StaleRefreshInterval == 0 {
+		return defaultStaleRefreshInterval
+	}
+
+	return c.StaleRefreshInterval
+}
+
+func (c *Cache) prefetchHits() int {
+	if c.PrefetchHits == 0 {
+		return defaultPrefetchHits
+	}
+
+	return c.PrefetchHits
+}
+
+func (c *Cache) now() time.Time {
+	if c.Now == nil {
+		return time.Now()
+	}
+
+	return c.Now()
+}
+
+// Get returns the cached response to the question, the TTLs of its records
+// decremented by the time spent in the cache. Popular responses close to their
+// expiry are refreshed in the background if the cache has a Querier
+func (c *Cache) Get(name Name, t QType, class Class) (Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cacheKey{name: name.GetName(), t: t, class: class}
+	elem, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return Message{}, false
+	}
+
+	e := elem.Value.(*cacheEntry)
+	now := c.now()
+	if !now.Before(e.expires) {
+		if !now.Before(e.expires.Add(c.MaxStale)) {
+			c.remove(elem)
+		}
+		c.stats.Misses++
+		return Message{}, false
+	}
+
+	c.lru.MoveToFront(elem)
+	c.stats.Hits++
+	e.hits++
+	if c.Querier != nil && c.PrefetchWindow > 0 && !e.prefetching && e.hits >= c.prefetchHits() &&
+		!now.Before(e.expires.Add(-c.PrefetchWindow)) {
+		e.prefetching = true
+		c.stats.Prefetches++
+		go c.prefetch(e, e.response.Question)
+	}
+
+	return e.aged(now), true
+}
+
+// Query answers the query from the cache, or from the Querier on a miss. A
+// stale response is served instead of a failure, and until the next refresh is
+// attempted. It implements the Querier interface
+func (c *Cache) Query(name Name, t QType) (Message, error) {
+	if c.Querier == nil {
+		return Message{}, fmt.Errorf("failed to query %s %s, the cache has no querier", name.GetName(), t)
+	}
+
+	q := Question{Name: name, Type: t, Class: INClass}
+	return c.resolve(q, func() (Message, error) { return c.Querier.Query(name, t) })
+}
+
+// resolve answers the question from the cache, or with query on a miss,
+// serving stale responses as done by Query
+func (c *Cache) resolve(q Question, query func() (Message, error)) (Message, error) {
+	if m, ok := c.Get(q.Name, q.Type, q.Class); ok {
+		return m, nil
+	}
+
+	key := cacheKey{name: q.Name.GetName(), t: q.Type, class: q.Class}
+	if m, ok := c.stale(key, false); ok {
+		return m, nil
+	}
+
+	resp, err := query()
+	if err == nil && (resp.Header.RCode == NoErrorRCode || resp.Header.RCode == NameErrorRCode) {
+		c.Put(&resp)
+		return resp, nil
+	}
+
+	if m, ok := c.stale(key, true); ok {
+		return m, nil
+	}
+
+	return resp, err
+}
+
+// stale returns the expired response to the question if it is still within
+// the stale window, its records given the stale answer TTL. It is returned
+// after a failed refresh, or while the next refresh is not due
+func (c *Cache) stale(key cacheKey, failed bool) (Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return Message{}, false
+	}
+
+	e := elem.Value.(*cacheEntry)
+	now := c.now()
+	if now.Before(e.expires) || !now.Before(e.expires.Add(c.MaxStale)) {
+		return Message{}, false
+	}
+
+	if failed {
+		e.failed = now
+	} else if e.failed.IsZero() || !now.Before(e.failed.Add(c.staleRefreshInterval())) {
+		return Message{}, false
+	}
+
+	c.stats.StaleHits++
+	return e.staleResponse(c.staleAnswerTTL()), true
+}
+
+// prefetch refreshes the response of the entry before its expiry. The entry is
+// prefetched again on a later hit if the refresh does not replace it
+func (c *Cache) prefetch(e *cacheEntry, q Question) {
+	resp, err := c.Querier.Query(q.Name, q.Type)
+	if err == nil && resp.Question.Class == q.Class {
+		c.Put(&resp)
+	}
+
+	c.mu.Lock()
+	e.prefetching = false
+	c.mu.Unlock()
+}
+
+// Put caches the response for the TTL of its answers, or for the negative TTL
+// of its SOA record when it denies the name or the type. Truncated responses,
+// responses of other rcodes and negative responses without SOA record are not
+// cached
+func (c *Cache) Put(m *Message) {
+	ttl, ok := c.ttl(m)
+	if !ok {
+		return
+	}
+
+	response := Message{
+		Header:     m.Header,
+		Question:   m.Question,
+		Answers:    cacheableRecords(m.Answers),
+		Authority:  cacheableRecords(m.Authority),
+		Additional: cacheableRecords(m.Additional),
+	}
+	response.Header.ID = 0
+	response.Header.AA = false
+	if i := indexOfType(response.Authority, SOAType); i >= 0 && isNegative(m) {
+		// the SOA record expires along with the denial
+		response.Authority[i] = negativeSOA(response.Authority[i])
+	}
+
+	now := c.now()
+	key := cacheKey{name: m.Question.Name.GetName(), t: m.Question.Type, class: m.Question.Class}
+	e := &cacheEntry{key: key, response: response, stored: now, expires: now.Add(ttl)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[cacheKey]*list.Element)
+		c.lru = list.New()
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(e)
+
+	for c.lru.Len() > c.size() {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Stats returns the counters of the cache
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	return stats
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// ttl returns the time the response may be cached for
+func (c *Cache) ttl(m *Message) (time.Duration, bool) {
+	if !bool(m.Header.QR) || bool(m.Header.TC) || m.Header.QuestionCount != 1 ||
+		(m.Header.RCode != NoErrorRCode && m.Header.RCode != NameErrorRCode) {
+		return 0, false
+	}
+
+	ttl := int64(-1)
+	for _, rr := range m.Answers {
+		if ttl < 0 || int64(rr.TTL) < ttl {
+			ttl = int64(rr.TTL)
+		}
+	}
+
+	limit := c.maxTTL()
+	if isNegative(m) {
+		i := indexOfType(m.Authority, SOAType)
+		if i < 0 {
+			return 0, false
+		}
+
+		soa := negativeSOA(m.Authority[i])
+		if ttl < 0 || int64(soa.TTL) < ttl {
+			ttl = int64(soa.TTL)
+		}
+		limit = c.maxNegativeTTL()
+	}
+
+	d := time.Duration(ttl) * time.Second
+	if d > limit {
+		d = limit
+	}
+
+	return d, d > 0
+}
+
+// isNegative reports whether the response denies the name, or the type by not
+// holding any record of it at the end of the CNAME chain
+func isNegative(m *Message) bool {
+	if m.Header.RCode == NameErrorRCode {
+		return true
+	}
+
+	for _, rr := range m.Answers {
+		if m.Question.Type == ANYQType || QType(rr.Type) == m.Question.Type {
+			return false
+		}
+	}
+
+	return true
+}
+
+func indexOfType(records []ResourceRecord, t Type) int {
+	for i, rr := range records {
+		if rr.Type == t {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// cacheableRecords returns the records without the pseudo records specific to
+// the transaction the response was received in
+func cacheableRecords(records []ResourceRecord) []ResourceRecord {
+	kept := make([]ResourceRecord, 0, len(records))
+	for _, rr := range records {
+		if rr.Type != OPTType && rr.Type != TSIGType && rr.Type != SIGType {
+			kept = append(kept, rr)
+		}
+	}
+
+	return kept
+}
+
+// aged returns a copy of the cached response, the TTLs of its records
+// decremented by the time spent in the cache
+func (e *cacheEntry) aged(now time.Time) Message {
+	elapsed := int64(now.Sub(e.stored) / time.Second)
+	m := e.response
+	m.Answers = agedRecords(m.Answers, elapsed)
+	m.Authority = agedRecords(m.Authority, elapsed)
+	m.Additional = agedRecords(m.Additional, elapsed)
+	return m
+}
+
+// staleResponse returns a copy of the expired response, its records given the
+// TTL
+func (e *cacheEntry) staleResponse(ttl time.Duration) Message {
+	m := e.response
+	m.Answers = staleRecords(m.Answers, ttl)
+	m.Authority = staleRecords(m.Authority, ttl)
+	m.Additional = staleRecords(m.Additional, ttl)
+	return m
+}
+
+func staleRecords(records []ResourceRecord, ttl time.Duration) []ResourceRecord {
+	stale := make([]ResourceRecord, len(records))
+	for i, rr := range records {
+		rr.TTL = int32(ttl / time.Second)
+		stale[i] = rr
+	}
+
+	return stale
+}
+
+func agedRecords(records []ResourceRecord, elapsed int64) []ResourceRecord {
+	aged := make([]ResourceRecord, len(records))
+	for i, rr := range records {
+		ttl := int64(rr.TTL) - elapsed
+		if ttl < 0 {
+			ttl = 0
+		}
+
+		rr.TTL = int32(ttl)
+		aged[i] = rr
+	}
+
+	return aged
+}
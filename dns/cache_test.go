@@ -0,0 +1,370 @@
+package dns_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+// cachedResponse returns a response to the query of the type for the name
+func cachedResponse(t *testing.T, name string, qtype dns.QType, rcode dns.RCode,
+	answers []dns.ResourceRecord, authority []dns.ResourceRecord) *dns.Message {
+	m, err := dns.NewQuestion(name)
+	if err != nil {
+		t.Fatalf("NewQuestion failed with error %s", err.Error())
+	}
+
+	m.Question.Type = qtype
+	resp := dns.NewResponse(m)
+	resp.Header.RCode = rcode
+	resp.Answers = answers
+	resp.Authority = authority
+	return resp
+}
+
+func TestCache(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := dns.Cache{Now: func() time.Time { return now }}
+	a := dns.QType(dns.AType)
+
+	c.Put(cachedResponse(t, "www.example.com", a, dns.NoErrorRCode,
+		[]dns.ResourceRecord{aRecord(t, "www.example.com", "192.0.2.1")}, nil))
+
+	var steps = []struct {
+		elapsed time.Duration
+		found   bool
+		ttl     int32
+	}{
+		{0, true, 300},
+		{100 * time.Second, true, 200},
+		{299*time.Second + 500*time.Millisecond, true, 1},
+		{300 * time.Second, false, 0},
+	}
+
+	for i, s := range steps {
+		now = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Add(s.elapsed)
+		resp, ok := c.Get(mustName(t, "www.example.com"), a, dns.INClass)
+		if ok != s.found {
+			t.Fatalf("unexpected cache result. step=%d actual=%t expected=%t", i, ok, s.found)
+		}
+
+		if ok && resp.Answers[0].TTL != s.ttl {
+			t.Fatalf("unexpected TTL. step=%d actual=%d expected=%d", i, resp.Answers[0].TTL, s.ttl)
+		}
+	}
+
+	// responses are keyed by type and class too
+	if _, ok := c.Get(mustName(t, "www.example.com"), dns.QType(dns.AAAAType), dns.INClass); ok {
+		t.Fatalf("responses should be cached per type")
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 3 || stats.Misses != 2 || stats.Entries != 0 {
+		t.Fatalf("unexpected stats. hits=%d misses=%d entries=%d", stats.Hits, stats.Misses, stats.Entries)
+	}
+}
+
+func TestCacheNegative(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := dns.QType(dns.AType)
+
+	// the negative TTL is the minimum of the TTL and MINIMUM of the SOA record
+	soa := soaRecord(t, "example.com", 1)
+	cname := nameRecord(t, "alias.example.com", dns.CNAMEType, "www.example.com")
+	cname.TTL = 60
+
+	var cases = []struct {
+		response *dns.Message
+		ttl      time.Duration
+	}{
+		{cachedResponse(t, "nothere.example.com", a, dns.NameErrorRCode, nil,
+			[]dns.ResourceRecord{soa}), 300 * time.Second},
+		{cachedResponse(t, "www.example.com", dns.QType(dns.AAAAType), dns.NoErrorRCode, nil,
+			[]dns.ResourceRecord{soa}), 300 * time.Second},
+		// the CNAME record expires first
+		{cachedResponse(t, "alias.example.com", dns.QType(dns.MXType), dns.NoErrorRCode,
+			[]dns.ResourceRecord{cname}, []dns.ResourceRecord{soa}), 60 * time.Second},
+		// negative responses without SOA record are not cached
+		{cachedResponse(t, "nosoa.example.com", a, dns.NameErrorRCode, nil, nil), 0},
+		{cachedResponse(t, "failure.example.com", a, dns.ServerFailureRCode, nil,
+			[]dns.ResourceRecord{soa}), 0},
+	}
+
+	for i, tc := range cases {
+		c := dns.Cache{Now: func() time.Time { return now }}
+		now = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		c.Put(tc.response)
+
+		q := tc.response.Question
+		resp, ok := c.Get(q.Name, q.Type, q.Class)
+		if ok != (tc.ttl > 0) {
+			t.Fatalf("unexpected cache result. case=%d actual=%t", i, ok)
+		}
+
+		if !ok {
+			continue
+		}
+
+		if resp.Header.RCode != tc.response.Header.RCode || len(resp.Authority) != 1 ||
+			resp.Authority[0].TTL != int32(300) {
+			t.Fatalf("unexpected cached response. case=%d rcode=%s", i, resp.Header.RCode)
+		}
+
+		now = now.Add(tc.ttl - time.Second)
+		if _, ok := c.Get(q.Name, q.Type, q.Class); !ok {
+			t.Fatalf("response should still be cached. case=%d", i)
+		}
+
+		now = now.Add(time.Second)
+		if _, ok := c.Get(q.Name, q.Type, q.Class); ok {
+			t.Fatalf("response should have expired. case=%d", i)
+		}
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := dns.Cache{Size: 2}
+	a := dns.QType(dns.AType)
+	names := []string{"a.example.com", "b.example.com", "c.example.com"}
+
+	put := func(name string) {
+		c.Put(cachedResponse(t, name, a, dns.NoErrorRCode, []dns.ResourceRecord{aRecord(t, name, "192.0.2.1")}, nil))
+	}
+
+	put(names[0])
+	put(names[1])
+	// a becomes the most recently used entry, b is evicted in its place
+	if _, ok := c.Get(mustName(t, names[0]), a, dns.INClass); !ok {
+		t.Fatalf("a.example.com should be cached")
+	}
+	put(names[2])
+
+	for i, expected := range []bool{true, false, true} {
+		if _, ok := c.Get(mustName(t, names[i]), a, dns.INClass); ok != expected {
+			t.Fatalf("unexpected cache result. name=%s actual=%t expected=%t", names[i], ok, expected)
+		}
+	}
+
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Entries != 2 {
+		t.Fatalf("unexpected stats. evictions=%d entries=%d", stats.Evictions, stats.Entries)
+	}
+
+	// concurrent use
+	responses := make([]*dns.Message, len(names))
+	for i, name := range names {
+		responses[i] = cachedResponse(t, name, a, dns.NoErrorRCode,
+			[]dns.ResourceRecord{aRecord(t, name, "192.0.2.1")}, nil)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				resp := responses[(i+j)%len(responses)]
+				c.Put(resp)
+				c.Get(resp.Question.Name, a, dns.INClass)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if stats := c.Stats(); stats.Entries != 2 {
+		t.Fatalf("the cache should stay bounded. entries=%d", stats.Entries)
+	}
+}
+
+func TestCacheServeStale(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	queries := 0
+	failing := false
+	c := dns.Cache{
+		Now:      func() time.Time { return now },
+		MaxStale: time.Hour,
+		Querier: dns.QuerierFunc(func(name dns.Name, qtype dns.QType) (dns.Message, error) {
+			queries++
+			if failing {
+				return *cachedResponse(t, name.GetName(), qtype, dns.ServerFailureRCode, nil, nil), nil
+			}
+
+			return *cachedResponse(t, name.GetName(), qtype, dns.NoErrorRCode,
+				[]dns.ResourceRecord{aRecord(t, name.GetName(), "192.0.2.1")}, nil), nil
+		}),
+	}
+
+	var steps = []struct {
+		elapsed time.Duration
+		failing bool
+		queries int
+		rcode   dns.RCode
+		ttl     int32
+	}{
+		{0, false, 1, dns.NoErrorRCode, 300},
+		{100 * time.Second, false, 1, dns.NoErrorRCode, 200},
+		// the refresh fails, the stale response is served
+		{301 * time.Second, true, 2, dns.NoErrorRCode, 30},
+		// the next refresh is not due yet
+		{320 * time.Second, true, 2, dns.NoErrorRCode, 30},
+		{332 * time.Second, true, 3, dns.NoErrorRCode, 30},
+		{340 * time.Second, false, 3, dns.NoErrorRCode, 30},
+		{370 * time.Second, false, 4, dns.NoErrorRCode, 300},
+		// the response is too old to be served
+		{370*time.Second + 2*time.Hour, true, 5, dns.ServerFailureRCode, 0},
+	}
+
+	for i, s := range steps {
+		now = start.Add(s.elapsed)
+		failing = s.failing
+		resp, err := c.Query(mustName(t, "www.example.com"), dns.QType(dns.AType))
+		if err != nil {
+			t.Fatalf("Query failed. step=%d err=%s", i, err.Error())
+		}
+
+		if queries != s.queries || resp.Header.RCode != s.rcode {
+			t.Fatalf("unexpected response. step=%d queries=%d rcode=%s", i, queries, resp.Header.RCode)
+		}
+
+		if s.ttl > 0 && resp.Answers[0].TTL != s.ttl {
+			t.Fatalf("unexpected TTL. step=%d actual=%d expected=%d", i, resp.Answers[0].TTL, s.ttl)
+		}
+	}
+
+	if stats := c.Stats(); stats.StaleHits != 4 {
+		t.Fatalf("unexpected stale hits. actual=%d", stats.StaleHits)
+	}
+}
+
+func TestCachePrefetch(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	now := start
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	setClock := func(elapsed time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = start.Add(elapsed)
+	}
+
+	responses := map[string]dns.Message{
+		"www.example.com": *cachedResponse(t, "www.example.com", dns.QType(dns.AType), dns.NoErrorRCode,
+			[]dns.ResourceRecord{aRecord(t, "www.example.com", "192.0.2.1")}, nil),
+	}
+	queried := make(chan struct{}, 10)
+	c := dns.Cache{
+		Now:            clock,
+		PrefetchWindow: time.Minute,
+		PrefetchHits:   2,
+		Querier: dns.QuerierFunc(func(name dns.Name, qtype dns.QType) (dns.Message, error) {
+			queried <- struct{}{}
+			return responses[name.GetName()], nil
+		}),
+	}
+
+	name := mustName(t, "www.example.com")
+	if _, err := c.Query(name, dns.QType(dns.AType)); err != nil {
+		t.Fatalf("Query failed with error %s", err.Error())
+	}
+	<-queried
+
+	// the first hit is neither popular enough nor close to the expiry
+	setClock(100 * time.Second)
+	c.Get(name, dns.QType(dns.AType), dns.INClass)
+	if len(queried) != 0 {
+		t.Fatalf("the response should not be prefetched yet")
+	}
+
+	// the second hit comes within the prefetch window
+	setClock(250 * time.Second)
+	resp, ok := c.Get(name, dns.QType(dns.AType), dns.INClass)
+	if !ok || resp.Answers[0].TTL != 50 {
+		t.Fatalf("the stored response should be served while prefetched")
+	}
+
+	select {
+	case <-queried:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the response should be prefetched")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, ok := c.Get(name, dns.QType(dns.AType), dns.INClass)
+		if ok && resp.Answers[0].TTL == 300 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("the prefetched response should replace the stored one")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if stats := c.Stats(); stats.Prefetches != 1 {
+		t.Fatalf("unexpected prefetch count. actual=%d", stats.Prefetches)
+	}
+}
+
+func TestCachePrefetch_failure(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	response := *cachedResponse(t, "www.example.com", dns.QType(dns.AType), dns.NoErrorRCode,
+		[]dns.ResourceRecord{aRecord(t, "www.example.com", "192.0.2.1")}, nil)
+
+	var mu sync.Mutex
+	now := start
+	queries := 0
+	c := dns.Cache{
+		Now: func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return now
+		},
+		PrefetchWindow: time.Minute,
+		PrefetchHits:   1,
+		Querier: dns.QuerierFunc(func(name dns.Name, qtype dns.QType) (dns.Message, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			queries++
+			// the first prefetch fails
+			if queries == 2 {
+				return dns.Message{}, fmt.Errorf("upstream unreachable")
+			}
+			return response, nil
+		}),
+	}
+
+	name := mustName(t, "www.example.com")
+	if _, err := c.Query(name, dns.QType(dns.AType)); err != nil {
+		t.Fatalf("Query failed with error %s", err.Error())
+	}
+
+	mu.Lock()
+	now = start.Add(250 * time.Second)
+	mu.Unlock()
+
+	// the hits following the failed prefetch trigger another one
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, ok := c.Get(name, dns.QType(dns.AType), dns.INClass)
+		if ok && resp.Answers[0].TTL == 300 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("the response should be prefetched again after a failed prefetch")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if stats := c.Stats(); stats.Prefetches < 2 {
+		t.Fatalf("unexpected prefetch count. actual=%d", stats.Prefetches)
+	}
+}
@@ -0,0 +1,455 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// dnsMessageMediaType is the media type of DNS messages exchanged over HTTPS
+// (RFC 8484 section 6)
+const dnsMessageMediaType = "application/dns-message"
+
+// Client sends messages to DNS servers
+type Client struct {
+	// Timeout bounds each exchange. Defaults to 5 seconds
+	Timeout time.Duration
+	// TSIGKey signs the requests when set. The responses must then be signed
+	// with the same key
+	TSIGKey *TSIGKey
+	// SIG0Key signs the requests with SIG(0) when set and TSIGKey is not. The
+	// responses are not verified
+	SIG0Key *SIG0Key
+	// TLSConfig configures the TLS connections of ExchangeTLS and
+	// ExchangeHTTPS. The server name defaults to the host of the address
+	TLSConfig *tls.Config
+	// HTTPClient sends the requests of ExchangeHTTPS. Defaults to a client
+	// using TLSConfig, whose connections are reused by the exchanges of the
+	// client and of its copies made after its first exchange
+	HTTPClient *http.Client
+
+	// transport is the HTTP transport of ExchangeHTTPS when HTTPClient is nil
+	transport *http.Transport
+}
+
+// transportMu guards the transport of the clients, which cannot hold a mutex
+// as they are copied
+var transportMu sync.Mutex
+
+func (c *Client) timeout() time.Duration {
+	if c.Timeout == 0 {
+		return 5 * time.Second
+	}
+
+	return c.Timeout
+}
+
+// Exchange sends the message to the server at addr over UDP and returns its
+// response. The exchange is retried over TCP if the response is truncated. The
+// ID of the message is replaced by a random one
+func (c *Client) Exchange(m *Message, addr string) (Message, error) {
+	m.Header.ID = randomID()
+
+	conn, err := net.DialTimeout("udp", addr, c.timeout())
+	if err != nil {
+		return Message{}, err
+	}
+	defer conn.Close()
+
+	data, mac, err := c.encode(m)
+	if err != nil {
+		return Message{}, err
+	}
+
+	conn.SetDeadline(time.Now().Add(c.timeout()))
+	if _, err := conn.Write(data); err != nil {
+		return Message{}, err
+	}
+
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return Message{}, err
+		}
+
+		resp, _, err := MessageFromBytes(buf[:n])
+		if err != nil || !isResponseTo(&resp, m) {
+			// ignore the datagrams that do not answer the request
+			continue
+		}
+
+		if resp.Header.TC {
+			return c.ExchangeTCP(m, addr)
+		}
+
+		if err := c.verify(buf[:n], mac, &resp); err != nil {
+			return Message{}, err
+		}
+
+		return resp, nil
+	}
+}
+
+// ExchangeTCP sends the message to the server at addr over TCP and returns its
+// response
+func (c *Client) ExchangeTCP(m *Message, addr string) (Message, error) {
+	if m.Header.ID == 0 {
+		m.Header.ID = randomID()
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, c.timeout())
+	if err != nil {
+		return Message{}, err
+	}
+	defer conn.Close()
+
+	return c.exchangeStream(conn, m)
+}
+
+// ExchangeTLS sends the message to the server at addr over TLS and returns its
+// response (RFC 7858)
+func (c *Client) ExchangeTLS(m *Message, addr string) (Message, error) {
+	if m.Header.ID == 0 {
+		m.Header.ID = randomID()
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return Message{}, err
+	}
+
+	dialer := &net.Dialer{Timeout: c.timeout()}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, c.tlsConfig(host))
+	if err != nil {
+		return Message{}, err
+	}
+	defer conn.Close()
+
+	return c.exchangeStream(conn, m)
+}
+
+// ExchangeHTTPS sends the message to the server at url with a POST request
+// and returns its response (RFC 8484). The ID of the message is set to zero
+func (c *Client) ExchangeHTTPS(m *Message, url string) (Message, error) {
+	m.Header.ID = 0
+
+	data, mac, err := c.encode(m)
+	if err != nil {
+		return Message{}, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return Message{}, err
+	}
+	req.Header.Set("Content-Type", dnsMessageMediaType)
+	req.Header.Set("Accept", dnsMessageMediaType)
+
+	client := c.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: c.timeout(), Transport: c.httpTransport()}
+	}
+
+	httpResp, err := client.Do(req)
+	if err != nil {
+		return Message{}, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return Message{}, fmt.Errorf("unexpected HTTP status. status=%d", httpResp.StatusCode)
+	}
+
+	if httpResp.Header.Get("Content-Type") != dnsMessageMediaType {
+		return Message{}, fmt.Errorf("unexpected content type. type=%s", httpResp.Header.Get("Content-Type"))
+	}
+
+	data, err = io.ReadAll(io.LimitReader(httpResp.Body, 65535))
+	if err != nil {
+		return Message{}, err
+	}
+
+	return c.readResponse(data, mac, m)
+}
+
+// exchangeStream sends the message over a stream connection, framed as done
+// over TCP, and returns its response
+func (c *Client) exchangeStream(conn net.Conn, m *Message) (Message, error) {
+	data, mac, err := c.encode(m)
+	if err != nil {
+		return Message{}, err
+	}
+
+	conn.SetDeadline(time.Now().Add(c.timeout()))
+	if err := writeTCPMessage(conn, data); err != nil {
+		return Message{}, err
+	}
+
+	data, err = readTCPMessage(conn)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return c.readResponse(data, mac, m)
+}
+
+// readResponse parses the response to the request and verifies its signature
+func (c *Client) readResponse(data []byte, mac []byte, m *Message) (Message, error) {
+	resp, _, err := MessageFromBytes(data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	if !isResponseTo(&resp, m) {
+		return Message{}, fmt.Errorf("received message does not answer the request. id=%d", resp.Header.ID)
+	}
+
+	if err := c.verify(data, mac, &resp); err != nil {
+		return Message{}, err
+	}
+
+	return resp, nil
+}
+
+// httpTransport returns the HTTP transport of the exchanges over HTTPS,
+// created on the first exchange with the settings of http.DefaultTransport. The
+// transport sets the server name to the host of the URL when TLSConfig does not
+func (c *Client) httpTransport() *http.Transport {
+	transportMu.Lock()
+	defer transportMu.Unlock()
+
+	if c.transport == nil {
+		if t, ok := http.DefaultTransport.(*http.Transport); ok {
+			c.transport = t.Clone()
+		} else {
+			c.transport = &http.Transport{Proxy: http.ProxyFromEnvironment, ForceAttemptHTTP2: true,
+				IdleConnTimeout: 90 * time.Second, TLSHandshakeTimeout: 10 * time.Second}
+		}
+		c.transport.TLSClientConfig = c.TLSConfig
+	}
+
+	return c.transport
+}
+
+func (c *Client) tlsConfig(host string) *tls.Config {
+	if c.TLSConfig == nil {
+		return &tls.Config{ServerName: host}
+	}
+
+	if c.TLSConfig.ServerName != "" {
+		return c.TLSConfig
+	}
+
+	config := c.TLSConfig.Clone()
+	config.ServerName = host
+	return config
+}
+
+// Transfer sends an AXFR or IXFR request to the server at addr over TCP and
+// returns the answer records of the response, which may span several messages.
+// When the request is signed, every message of the response must be signed
+// but those that are followed by a signed message (RFC 8945 section 5.3.1)
+func (c *Client) Transfer(m *Message, addr string) ([]ResourceRecord, error) {
+	m.Header.ID = randomID()
+
+	conn, err := net.DialTimeout("tcp", addr, c.timeout())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	request, mac, err := c.encode(m)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(c.timeout()))
+	if err := writeTCPMessage(conn, request); err != nil {
+		return nil, err
+	}
+
+	unsigned := make([]byte, 0)
+	unsignedCount := 0
+	records := make([]ResourceRecord, 0)
+	for first := true; ; first = false {
+		conn.SetDeadline(time.Now().Add(c.timeout()))
+		data, err := readTCPMessage(conn)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, _, err := MessageFromBytes(data)
+		if err != nil {
+			return nil, err
+		}
+
+		answers := isResponseTo(&resp, m)
+		if !first && resp.Header.QuestionCount == 0 {
+			// the messages following the first one may omit the question
+			answers = hasResponseID(&resp, m)
+		}
+		if !answers {
+			return nil, fmt.Errorf("received message does not answer the request. id=%d", resp.Header.ID)
+		}
+
+		if c.TSIGKey != nil {
+			if !first && !hasTSIG(data) {
+				unsigned = append(unsigned, data...)
+				unsignedCount++
+				if unsignedCount > maxUnsignedMessages {
+					return nil, fmt.Errorf("failed to verify zone transfer, too many unsigned messages")
+				}
+			} else {
+				t, _, err := verifyTSIG(data, NewKeyring(*c.TSIGKey), mac, unsigned, !first, time.Now())
+				if err != nil {
+					return nil, fmt.Errorf("failed to verify zone transfer. %s", err.Error())
+				}
+				mac = t.MAC
+				unsigned = unsigned[:0]
+				unsignedCount = 0
+				stripTSIG(&resp)
+			}
+		}
+
+		if resp.Header.RCode != NoErrorRCode {
+			return nil, fmt.Errorf("zone transfer failed. rcode=%s", resp.Header.RCode)
+		}
+
+		records = append(records, resp.Answers...)
+		if first && len(resp.Answers) == 1 && m.Question.Type == IXFRQType {
+			// the server holds no newer version of the zone
+			return records, nil
+		}
+
+		if transferComplete(records, m.Question.Type) {
+			if unsignedCount > 0 {
+				return nil, fmt.Errorf("failed to verify zone transfer, last message is not signed")
+			}
+			return records, nil
+		}
+	}
+}
+
+// AXFR retrieves the whole zone named origin from the server at addr
+func (c *Client) AXFR(origin Name, addr string) (*Zone, error) {
+	m := &Message{
+		Header:   Header{Opcode: QueryOpcode, QuestionCount: 1},
+		Question: Question{Name: origin, Type: AXFRQType, Class: INClass},
+	}
+
+	records, err := c.Transfer(m, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewZone(origin, records[:len(records)-1])
+}
+
+// IXFR brings the zone up to date with the server at addr using an incremental
+// zone transfer (RFC 1995). The server may answer with a full transfer
+func (c *Client) IXFR(z *Zone, addr string) error {
+	m := &Message{
+		Header:    Header{Opcode: QueryOpcode, QuestionCount: 1},
+		Question:  Question{Name: z.Origin(), Type: IXFRQType, Class: INClass},
+		Authority: []ResourceRecord{z.SOA()},
+	}
+
+	records, err := c.Transfer(m, addr)
+	if err != nil {
+		return err
+	}
+
+	return z.ApplyTransfer(records)
+}
+
+// transferComplete reports whether the records received so far form a complete
+// zone transfer. An AXFR ends with the second occurrence of the SOA, so does an
+// IXFR answered with a full transfer. An IXFR made of difference sequences ends
+// with the third occurrence of the SOA of the new version of the zone
+func transferComplete(records []ResourceRecord, t QType) bool {
+	if len(records) < 2 || records[0].Type != SOAType {
+		return false
+	}
+
+	last := records[len(records)-1]
+	serial := soaSerial(records[0])
+	if last.Type != SOAType || soaSerial(last) != serial {
+		return false
+	}
+
+	if t != IXFRQType || records[1].Type != SOAType || len(records) == 2 {
+		return true
+	}
+
+	count := 0
+	for _, rr := range records {
+		if rr.Type == SOAType && soaSerial(rr) == serial {
+			count++
+		}
+	}
+
+	return count >= 3
+}
+
+// encode returns the byte array form of the request, signed if the client holds
+// a key, along with its TSIG MAC
+func (c *Client) encode(m *Message) ([]byte, []byte, error) {
+	data := m.ToBytes()
+	if c.TSIGKey != nil {
+		return SignTSIG(data, *c.TSIGKey, nil, time.Now())
+	}
+
+	if c.SIG0Key != nil {
+		signed, err := SignSIG0(data, *c.SIG0Key, nil, time.Now())
+		return signed, nil, err
+	}
+
+	return data, nil, nil
+}
+
+// verify verifies the signature of the response to a signed request and
+// removes its TSIG record
+func (c *Client) verify(data []byte, requestMAC []byte, resp *Message) error {
+	if c.TSIGKey == nil {
+		return nil
+	}
+
+	if _, err := VerifyTSIG(data, NewKeyring(*c.TSIGKey), requestMAC, time.Now()); err != nil {
+		return fmt.Errorf("failed to verify response signature. %s", err.Error())
+	}
+
+	stripTSIG(resp)
+	return nil
+}
+
+// isResponseTo reports whether the message answers the request, holding its ID
+// and question as RFC 5452 section 9.1 requires
+func isResponseTo(resp *Message, m *Message) bool {
+	if !hasResponseID(resp, m) || resp.Header.QuestionCount != m.Header.QuestionCount {
+		return false
+	}
+
+	return m.Header.QuestionCount == 0 || (resp.Question.Name.Equal(m.Question.Name) &&
+		resp.Question.Type == m.Question.Type && resp.Question.Class == m.Question.Class)
+}
+
+func hasResponseID(resp *Message, m *Message) bool {
+	return bool(resp.Header.QR) && resp.Header.ID == m.Header.ID
+}
+
+// randomID returns a random message ID, making responses harder to spoof
+func randomID() uint16 {
+	b := make([]byte, 2)
+	if _, err := rand.Read(b); err != nil {
+		return 1
+	}
+
+	return catBytes(b[0], b[1])
+}
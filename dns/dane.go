@@ -0,0 +1,484 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// PKIXTAUsage requires the chain to be valid and to hold the certificate
+	// of the TLSA record as a trust anchor
+	PKIXTAUsage TLSAUsage = 0
+	// PKIXEEUsage requires the chain to be valid and the server certificate
+	// to match the TLSA record
+	PKIXEEUsage TLSAUsage = 1
+	// DANETAUsage makes the certificate of the TLSA record the trust anchor
+	// the chain must be valid up to
+	DANETAUsage TLSAUsage = 2
+	// DANEEEUsage requires the server certificate to match the TLSA record,
+	// disregarding its validity
+	DANEEEUsage TLSAUsage = 3
+)
+
+const (
+	// CertSelector matches the whole certificate
+	CertSelector TLSASelector = 0
+	// SPKISelector matches the subject public key info of the certificate
+	SPKISelector TLSASelector = 1
+)
+
+const (
+	// FullMatchingType compares the selected content as is
+	FullMatchingType TLSAMatchingType = 0
+	// SHA256MatchingType compares the SHA-256 digest of the selected content
+	SHA256MatchingType TLSAMatchingType = 1
+	// SHA512MatchingType compares the SHA-512 digest of the selected content
+	SHA512MatchingType TLSAMatchingType = 2
+)
+
+const (
+	// RSASSHAlgorithm is the SSHFP algorithm of RSA keys
+	RSASSHAlgorithm SSHAlgorithm = 1
+	// DSASSHAlgorithm is the SSHFP algorithm of DSA keys
+	DSASSHAlgorithm SSHAlgorithm = 2
+	// ECDSASSHAlgorithm is the SSHFP algorithm of ECDSA keys
+	ECDSASSHAlgorithm SSHAlgorithm = 3
+	// Ed25519SSHAlgorithm is the SSHFP algorithm of Ed25519 keys
+	Ed25519SSHAlgorithm SSHAlgorithm = 4
+	// Ed448SSHAlgorithm is the SSHFP algorithm of Ed448 keys
+	Ed448SSHAlgorithm SSHAlgorithm = 6
+)
+
+const (
+	// SHA1FingerprintType is the SSHFP fingerprint using SHA-1
+	SHA1FingerprintType SSHFingerprintType = 1
+	// SHA256FingerprintType is the SSHFP fingerprint using SHA-256
+	SHA256FingerprintType SSHFingerprintType = 2
+)
+
+// TLSAUsage tells how a TLSA record constrains the certificate chain
+type TLSAUsage uint8
+
+// TLSASelector is the part of a certificate a TLSA record matches
+type TLSASelector uint8
+
+// TLSAMatchingType is how the selected part of a certificate is compared
+type TLSAMatchingType uint8
+
+// SSHAlgorithm is the algorithm of the key of a SSHFP record
+type SSHAlgorithm uint8
+
+// SSHFingerprintType is the digest algorithm of the fingerprint of a SSHFP
+// record
+type SSHFingerprintType uint8
+
+// TLSA is the data of a TLSA resource record (RFC 6698), associating a TLS
+// server certificate or trust anchor with the domain
+type TLSA struct {
+	Usage        TLSAUsage
+	Selector     TLSASelector
+	MatchingType TLSAMatchingType
+	// Data is the certificate association data, the selected content or its
+	// digest
+	Data []byte
+}
+
+// NewTLSA returns the TLSA data associating the certificate with the usage,
+// the selector and the matching type
+func NewTLSA(usage TLSAUsage, selector TLSASelector, matchingType TLSAMatchingType, cert *x509.Certificate) (TLSA, error) {
+	data, err := associationData(cert, selector, matchingType)
+	if err != nil {
+		return TLSA{}, err
+	}
+
+	return TLSA{Usage: usage, Selector: selector, MatchingType: matchingType, Data: data}, nil
+}
+
+// ToBytes returns the byte array form of the TLSA data
+func (t *TLSA) ToBytes() []byte {
+	return append([]byte{byte(t.Usage), byte(t.Selector), byte(t.MatchingType)}, t.Data...)
+}
+
+func (t *TLSA) String() string {
+	return fmt.Sprintf("%d %d %d %s", t.Usage, t.Selector, t.MatchingType, strings.ToUpper(hex.EncodeToString(t.Data)))
+}
+
+// Matches reports whether the certificate matches the selector, the matching
+// type and the association data of the record
+func (t *TLSA) Matches(cert *x509.Certificate) bool {
+	data, err := associationData(cert, t.Selector, t.MatchingType)
+	return err == nil && bytes.Equal(data, t.Data)
+}
+
+// TLSA returns the data of a TLSA resource record
+func (rr ResourceRecord) TLSA() (TLSA, error) {
+	if rr.Type != TLSAType {
+		return TLSA{}, fmt.Errorf("resource record is not a TLSA record. type=%s", rr.Type)
+	}
+
+	if len(rr.Data) < 3 {
+		return TLSA{}, fmt.Errorf("failed to parse TLSA data, invalid length %d", len(rr.Data))
+	}
+
+	return TLSA{
+		Usage:        TLSAUsage(rr.Data[0]),
+		Selector:     TLSASelector(rr.Data[1]),
+		MatchingType: TLSAMatchingType(rr.Data[2]),
+		Data:         rr.Data[3:],
+	}, nil
+}
+
+// ParseTLSA parses the presentation form of TLSA data, ie: "3 1 1 0C72AC70...".
+// The hexadecimal data may be split in several fields
+func ParseTLSA(s string) (TLSA, error) {
+	values, data, err := parseDigestFields("TLSA", s, 3)
+	if err != nil {
+		return TLSA{}, err
+	}
+
+	return TLSA{
+		Usage:        TLSAUsage(values[0]),
+		Selector:     TLSASelector(values[1]),
+		MatchingType: TLSAMatchingType(values[2]),
+		Data:         data,
+	}, nil
+}
+
+// associationData returns the content of the certificate selected by the
+// selector, digested as told by the matching type
+func associationData(cert *x509.Certificate, selector TLSASelector, matchingType TLSAMatchingType) ([]byte, error) {
+	var content []byte
+	switch selector {
+	case CertSelector:
+		content = cert.Raw
+	case SPKISelector:
+		content = cert.RawSubjectPublicKeyInfo
+	default:
+		return nil, fmt.Errorf("unsupported TLSA selector %d", selector)
+	}
+
+	switch matchingType {
+	case FullMatchingType:
+		return content, nil
+	case SHA256MatchingType:
+		digest := sha256.Sum256(content)
+		return digest[:], nil
+	case SHA512MatchingType:
+		digest := sha512.Sum512(content)
+		return digest[:], nil
+	default:
+		return nil, fmt.Errorf("unsupported TLSA matching type %d", matchingType)
+	}
+}
+
+// usable reports whether the parameters of the record are known
+func (t *TLSA) usable() bool {
+	return t.Usage <= DANEEEUsage && t.Selector <= SPKISelector && t.MatchingType <= SHA512MatchingType
+}
+
+// VerifyTLSA checks the certificate chain presented by a TLS server, the server
+// certificate first, against the TLSA records of the server (RFC 6698 and RFC
+// 7671). The chain is accepted if one of the usable records is satisfied:
+//   - PKIX-TA and PKIX-EE records require the chain to be valid from the roots
+//     of opts, with the matching certificate in the path
+//   - DANE-TA records require the chain to be valid up to the matching
+//     certificate of the chain, for the name of opts
+//   - DANE-EE records require the server certificate to match, disregarding
+//     its name and validity period
+//
+// The records must come from a secure answer, which is not checked here
+func VerifyTLSA(records []TLSA, chain []*x509.Certificate, opts x509.VerifyOptions) error {
+	if len(chain) == 0 {
+		return fmt.Errorf("failed to verify TLSA records, empty certificate chain")
+	}
+
+	leaf := chain[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	opts.Intermediates = intermediates
+
+	usable := 0
+	var lastErr error
+	for _, t := range records {
+		if !t.usable() {
+			continue
+		}
+		usable++
+
+		switch t.Usage {
+		case DANEEEUsage:
+			if t.Matches(leaf) {
+				return nil
+			}
+		case PKIXEEUsage:
+			if !t.Matches(leaf) {
+				continue
+			}
+			if _, err := leaf.Verify(opts); err != nil {
+				lastErr = err
+				continue
+			}
+			return nil
+		case PKIXTAUsage:
+			paths, err := leaf.Verify(opts)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			for _, path := range paths {
+				for _, cert := range path[1:] {
+					if t.Matches(cert) {
+						return nil
+					}
+				}
+			}
+		case DANETAUsage:
+			anchors := chain[1:]
+			// a trust anchor given in full may not be part of the chain
+			if t.Selector == CertSelector && t.MatchingType == FullMatchingType {
+				if cert, err := x509.ParseCertificate(t.Data); err == nil {
+					anchors = append([]*x509.Certificate{cert}, anchors...)
+				}
+			}
+
+			for _, cert := range anchors {
+				if !t.Matches(cert) {
+					continue
+				}
+
+				roots := x509.NewCertPool()
+				roots.AddCert(cert)
+				daneOpts := opts
+				daneOpts.Roots = roots
+				if _, err := leaf.Verify(daneOpts); err != nil {
+					lastErr = err
+					continue
+				}
+				return nil
+			}
+		}
+	}
+
+	switch {
+	case usable == 0:
+		return fmt.Errorf("failed to verify TLSA records, no usable record")
+	case lastErr != nil:
+		return fmt.Errorf("failed to verify TLSA records, no record matches the chain. err=%s", lastErr.Error())
+	default:
+		return fmt.Errorf("failed to verify TLSA records, no record matches the chain")
+	}
+}
+
+// LookupTLSA returns the TLSA records of the TLS service on the port and
+// transport protocol of the host, found at _port._proto.host. The records are
+// returned whether they are secure or not
+func (r *Resolver) LookupTLSA(ctx context.Context, port uint16, proto, host string) ([]TLSA, error) {
+	tlsas, _, err := r.lookupTLSA(ctx, port, proto, host)
+	return tlsas, err
+}
+
+// lookupTLSA returns the TLSA records of the TLS service along with the
+// response holding them
+func (r *Resolver) lookupTLSA(ctx context.Context, port uint16, proto, host string) ([]TLSA, Message, error) {
+	// the name is absolute, the search list must not be applied to it
+	name := fmt.Sprintf("_%d._%s.%s.", port, proto, strings.TrimSuffix(host, "."))
+	m, err := r.lookup(ctx, name, QType(TLSAType))
+	if err != nil {
+		return nil, Message{}, err
+	}
+
+	records := rrset(m.Answers, cnameTarget(m.Question.Name, m.Answers), TLSAType)
+	if len(records) == 0 {
+		return nil, Message{}, notFound(name)
+	}
+
+	tlsas := make([]TLSA, 0, len(records))
+	for _, rr := range records {
+		t, err := rr.TLSA()
+		if err != nil {
+			return nil, Message{}, malformed(name, err)
+		}
+		tlsas = append(tlsas, t)
+	}
+
+	return tlsas, m, nil
+}
+
+// VerifyTLSA looks up the TLSA records of the TLS service on the port and
+// transport protocol of the host, and checks the certificate chain presented
+// by the server against them, as done by the VerifyTLSA function. The name
+// checked by the DANE-TA and PKIX records is the host. As TLSA records that are
+// not secure are unusable (RFC 6698 section 4.1), the response must be
+// validated as secure by the Validator of the resolver, which is required
+func (r *Resolver) VerifyTLSA(ctx context.Context, port uint16, proto, host string, chain []*x509.Certificate) error {
+	if r.Validator == nil {
+		return fmt.Errorf("failed to verify TLSA records of %s, no validator", host)
+	}
+
+	records, m, err := r.lookupTLSA(ctx, port, proto, host)
+	if err != nil {
+		return err
+	}
+
+	if status, err := r.Validator.Validate(&m); status != SecureStatus {
+		return fmt.Errorf("failed to verify TLSA records of %s, records are not secure. status=%s err=%v",
+			host, status, err)
+	}
+
+	return VerifyTLSA(records, chain, x509.VerifyOptions{DNSName: strings.TrimSuffix(host, ".")})
+}
+
+// SSHFP is the data of a SSHFP resource record (RFC 4255), the fingerprint of
+// a SSH host key
+type SSHFP struct {
+	Algorithm   SSHAlgorithm
+	Type        SSHFingerprintType
+	Fingerprint []byte
+}
+
+// NewSSHFP returns the SSHFP data of the host key, given in the wire format of
+// SSH public keys (RFC 4253 section 6.6)
+func NewSSHFP(algorithm SSHAlgorithm, fingerprintType SSHFingerprintType, key []byte) (SSHFP, error) {
+	var fingerprint []byte
+	switch fingerprintType {
+	case SHA1FingerprintType:
+		digest := sha1.Sum(key)
+		fingerprint = digest[:]
+	case SHA256FingerprintType:
+		digest := sha256.Sum256(key)
+		fingerprint = digest[:]
+	default:
+		return SSHFP{}, fmt.Errorf("unsupported SSHFP fingerprint type %d", fingerprintType)
+	}
+
+	return SSHFP{Algorithm: algorithm, Type: fingerprintType, Fingerprint: fingerprint}, nil
+}
+
+// ToBytes returns the byte array form of the SSHFP data
+func (s *SSHFP) ToBytes() []byte {
+	return append([]byte{byte(s.Algorithm), byte(s.Type)}, s.Fingerprint...)
+}
+
+func (s *SSHFP) String() string {
+	return fmt.Sprintf("%d %d %s", s.Algorithm, s.Type, strings.ToUpper(hex.EncodeToString(s.Fingerprint)))
+}
+
+// SSHFP returns the data of a SSHFP resource record
+func (rr ResourceRecord) SSHFP() (SSHFP, error) {
+	if rr.Type != SSHFPType {
+		return SSHFP{}, fmt.Errorf("resource record is not a SSHFP record. type=%s", rr.Type)
+	}
+
+	if len(rr.Data) < 2 {
+		return SSHFP{}, fmt.Errorf("failed to parse SSHFP data, invalid length %d", len(rr.Data))
+	}
+
+	return SSHFP{
+		Algorithm:   SSHAlgorithm(rr.Data[0]),
+		Type:        SSHFingerprintType(rr.Data[1]),
+		Fingerprint: rr.Data[2:],
+	}, nil
+}
+
+// ParseSSHFP parses the presentation form of SSHFP data, ie: "4 2 A3F5...". The
+// hexadecimal fingerprint may be split in several fields
+func ParseSSHFP(s string) (SSHFP, error) {
+	values, fingerprint, err := parseDigestFields("SSHFP", s, 2)
+	if err != nil {
+		return SSHFP{}, err
+	}
+
+	return SSHFP{
+		Algorithm:   SSHAlgorithm(values[0]),
+		Type:        SSHFingerprintType(values[1]),
+		Fingerprint: fingerprint,
+	}, nil
+}
+
+// OPENPGPKEY is the data of an OPENPGPKEY resource record (RFC 7929), an
+// OpenPGP transferable public key
+type OPENPGPKEY struct {
+	PublicKey []byte
+}
+
+// ToBytes returns the byte array form of the OPENPGPKEY data
+func (k *OPENPGPKEY) ToBytes() []byte {
+	return k.PublicKey
+}
+
+func (k *OPENPGPKEY) String() string {
+	return base64.StdEncoding.EncodeToString(k.PublicKey)
+}
+
+// OPENPGPKEY returns the data of an OPENPGPKEY resource record
+func (rr ResourceRecord) OPENPGPKEY() (OPENPGPKEY, error) {
+	if rr.Type != OPENPGPKEYType {
+		return OPENPGPKEY{}, fmt.Errorf("resource record is not an OPENPGPKEY record. type=%s", rr.Type)
+	}
+
+	if len(rr.Data) == 0 {
+		return OPENPGPKEY{}, fmt.Errorf("failed to parse OPENPGPKEY data, invalid length %d", len(rr.Data))
+	}
+
+	return OPENPGPKEY{PublicKey: rr.Data}, nil
+}
+
+// ParseOPENPGPKEY parses the presentation form of OPENPGPKEY data, the base64
+// encoding of the key, which may be split in several fields
+func ParseOPENPGPKEY(s string) (OPENPGPKEY, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil || len(key) == 0 {
+		return OPENPGPKEY{}, fmt.Errorf("failed to parse OPENPGPKEY data, invalid base64 key")
+	}
+
+	return OPENPGPKEY{PublicKey: key}, nil
+}
+
+// OPENPGPKEYName returns the name of the OPENPGPKEY records of the email
+// address: the SHA-256 digest of its local part truncated to 28 bytes, under
+// the _openpgpkey subdomain of its domain (RFC 7929 section 3)
+func OPENPGPKEYName(email string) (Name, error) {
+	i := strings.LastIndex(email, "@")
+	if i <= 0 || i == len(email)-1 {
+		return Name{}, fmt.Errorf("failed to build OPENPGPKEY name, invalid email address %s", email)
+	}
+
+	digest := sha256.Sum256([]byte(email[:i]))
+	return NewName(hex.EncodeToString(digest[:28]) + "._openpgpkey." + email[i+1:])
+}
+
+// parseDigestFields parses the presentation form of data made of 8 bits
+// integer fields followed by hexadecimal data
+func parseDigestFields(t string, s string, count int) ([]uint8, []byte, error) {
+	fields := strings.Fields(s)
+	if len(fields) < count+1 {
+		return nil, nil, fmt.Errorf("failed to parse %s data, invalid field count %d", t, len(fields))
+	}
+
+	values := make([]uint8, 0, count)
+	for _, field := range fields[:count] {
+		value, err := strconv.ParseUint(field, 10, 8)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s data, invalid integer %s", t, field)
+		}
+		values = append(values, uint8(value))
+	}
+
+	data, err := hex.DecodeString(strings.Join(fields[count:], ""))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s data, invalid hexadecimal data", t)
+	}
+
+	return values, data, nil
+}
@@ -0,0 +1,249 @@
+package dns_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+// certificate issues a certificate for the name, self signed when parent is
+// nil
+func certificate(t *testing.T, name string, ca bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed with error %s", err.Error())
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  ca,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if !ca {
+		template.DNSNames = []string{name}
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed with error %s", err.Error())
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate failed with error %s", err.Error())
+	}
+
+	return cert, key
+}
+
+func tlsa(t *testing.T, usage dns.TLSAUsage, selector dns.TLSASelector, matching dns.TLSAMatchingType, cert *x509.Certificate) dns.TLSA {
+	record, err := dns.NewTLSA(usage, selector, matching, cert)
+	if err != nil {
+		t.Fatalf("NewTLSA failed with error %s", err.Error())
+	}
+	return record
+}
+
+func TestVerifyTLSA(t *testing.T) {
+	root, rootKey := certificate(t, "Root CA", true, nil, nil)
+	intermediate, intermediateKey := certificate(t, "Intermediate CA", true, root, rootKey)
+	leaf, _ := certificate(t, "www.example.com", false, intermediate, intermediateKey)
+	other, _ := certificate(t, "other.example.com", false, intermediate, intermediateKey)
+	chain := []*x509.Certificate{leaf, intermediate}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	var cases = []struct {
+		records  []dns.TLSA
+		name     string
+		roots    *x509.CertPool
+		expected bool
+	}{
+		{[]dns.TLSA{tlsa(t, dns.DANEEEUsage, dns.SPKISelector, dns.SHA256MatchingType, leaf)}, "www.example.com", nil, true},
+		// the name is not checked for DANE-EE records
+		{[]dns.TLSA{tlsa(t, dns.DANEEEUsage, dns.CertSelector, dns.SHA512MatchingType, leaf)}, "mail.example.com", nil, true},
+		{[]dns.TLSA{tlsa(t, dns.DANEEEUsage, dns.SPKISelector, dns.SHA256MatchingType, other)}, "www.example.com", nil, false},
+		{[]dns.TLSA{tlsa(t, dns.DANETAUsage, dns.SPKISelector, dns.SHA256MatchingType, intermediate)}, "www.example.com", nil, true},
+		{[]dns.TLSA{tlsa(t, dns.DANETAUsage, dns.SPKISelector, dns.SHA256MatchingType, intermediate)}, "mail.example.com", nil, false},
+		{[]dns.TLSA{tlsa(t, dns.DANETAUsage, dns.SPKISelector, dns.SHA256MatchingType, root)}, "www.example.com", nil, false},
+		// a trust anchor given in full may be missing from the chain
+		{[]dns.TLSA{tlsa(t, dns.DANETAUsage, dns.CertSelector, dns.FullMatchingType, root)}, "www.example.com", nil, true},
+		{[]dns.TLSA{tlsa(t, dns.PKIXTAUsage, dns.CertSelector, dns.SHA256MatchingType, root)}, "www.example.com", roots, true},
+		{[]dns.TLSA{tlsa(t, dns.PKIXTAUsage, dns.CertSelector, dns.SHA256MatchingType, root)}, "www.example.com", x509.NewCertPool(), false},
+		{[]dns.TLSA{tlsa(t, dns.PKIXTAUsage, dns.CertSelector, dns.SHA256MatchingType, leaf)}, "www.example.com", roots, false},
+		{[]dns.TLSA{tlsa(t, dns.PKIXEEUsage, dns.SPKISelector, dns.FullMatchingType, leaf)}, "www.example.com", roots, true},
+		{[]dns.TLSA{tlsa(t, dns.PKIXEEUsage, dns.SPKISelector, dns.FullMatchingType, leaf)}, "www.example.com", x509.NewCertPool(), false},
+		// unusable records are ignored
+		{[]dns.TLSA{{Usage: 4, Data: []byte{1}}}, "www.example.com", nil, false},
+		{[]dns.TLSA{{Usage: 3, Selector: 1, MatchingType: 9}, tlsa(t, dns.DANEEEUsage, dns.SPKISelector, dns.SHA256MatchingType, leaf)},
+			"www.example.com", nil, true},
+	}
+
+	for i, c := range cases {
+		err := dns.VerifyTLSA(c.records, chain, x509.VerifyOptions{DNSName: c.name, Roots: c.roots})
+		if (err == nil) != c.expected {
+			t.Fatalf("unexpected result. case=%d err=%v", i, err)
+		}
+	}
+}
+
+func TestTLSA(t *testing.T) {
+	var cases = []struct {
+		presentation string
+		expected     string
+		valid        bool
+	}{
+		{"3 1 1 0c72ac70b745ac19998811b131d662c9ac69dbdbe7cb23e5b514b56664c5d3d6",
+			"3 1 1 0C72AC70B745AC19998811B131D662C9AC69DBDBE7CB23E5B514B56664C5D3D6", true},
+		{"3 1 1 0C72AC70B745AC19998811B131D662C9 AC69DBDBE7CB23E5B514B56664C5D3D6",
+			"3 1 1 0C72AC70B745AC19998811B131D662C9AC69DBDBE7CB23E5B514B56664C5D3D6", true},
+		{"3 1 1", "", false},
+		{"3 1 256 00", "", false},
+		{"3 1 1 0G", "", false},
+	}
+
+	for i, c := range cases {
+		record, err := dns.ParseTLSA(c.presentation)
+		if (err == nil) != c.valid {
+			t.Fatalf("unexpected ParseTLSA result. case=%d err=%v", i, err)
+		}
+		if !c.valid {
+			continue
+		}
+
+		rr := dns.NewResourceRecord(mustName(t, "_443._tcp.www.example.com"), dns.TLSAType, dns.INClass, 300, record.ToBytes())
+		parsed, err := rr.TLSA()
+		if err != nil || parsed.String() != c.expected {
+			t.Fatalf("unexpected TLSA. case=%d actual=%s err=%v", i, parsed.String(), err)
+		}
+	}
+}
+
+func TestResolverVerifyTLSA(t *testing.T) {
+	root, rootKey := certificate(t, "Root CA", true, nil, nil)
+	leaf, _ := certificate(t, "www.example.com", false, root, rootKey)
+	record := tlsa(t, dns.DANEEEUsage, dns.SPKISelector, dns.SHA256MatchingType, leaf)
+
+	key := signingKey(t, "example.com", dns.ED25519Algorithm)
+	z := mustZone(t, "example.com",
+		dnskeyRecord(t, key),
+		aRecord(t, "www.example.com", "192.0.2.1"),
+		dns.NewResourceRecord(mustName(t, "_443._tcp.www.example.com"), dns.TLSAType, dns.INClass, 300, record.ToBytes()))
+
+	signed := startServer(t, &dns.OnlineSigner{Handler: &dns.ZoneHandler{Zone: z}, Zone: z, Keys: []dns.SigningKey{key}})
+	unsigned := startServer(t, zonesHandler(mustZone(t, "."), z))
+	querier := func(addr string) dns.Querier {
+		client := dns.Client{}
+		return dns.QuerierFunc(func(name dns.Name, qtype dns.QType) (dns.Message, error) {
+			return client.Exchange(dnssecQuery(t, name.GetName(), qtype, true), addr)
+		})
+	}
+	validator := &dns.Validator{TrustAnchors: []dns.ResourceRecord{dsRecord(t, key)}, Querier: querier(signed)}
+
+	var cases = []struct {
+		resolver *dns.Resolver
+		port     uint16
+		chain    []*x509.Certificate
+		valid    bool
+	}{
+		{&dns.Resolver{Querier: querier(signed), Validator: validator}, 443, []*x509.Certificate{leaf}, true},
+		{&dns.Resolver{Querier: querier(signed), Validator: validator}, 443, []*x509.Certificate{root}, false},
+		{&dns.Resolver{Querier: querier(signed), Validator: validator}, 25, []*x509.Certificate{leaf}, false},
+		// records that are not validated as secure are unusable
+		{&dns.Resolver{Querier: querier(unsigned)}, 443, []*x509.Certificate{leaf}, false},
+		{&dns.Resolver{Querier: querier(unsigned), Validator: validator}, 443, []*x509.Certificate{leaf}, false},
+	}
+
+	for i, c := range cases {
+		err := c.resolver.VerifyTLSA(context.Background(), c.port, "tcp", "www.example.com", c.chain)
+		if (err == nil) != c.valid {
+			t.Fatalf("unexpected VerifyTLSA result. case=%d err=%v", i, err)
+		}
+	}
+
+	// the name of the records is absolute, the search list is not applied
+	r := &dns.Resolver{Querier: &dns.Stub{Config: &dns.ResolvConf{
+		Servers:  []string{unsigned},
+		Search:   []string{"example.com"},
+		NDots:    5,
+		Timeout:  2 * time.Second,
+		Attempts: 1,
+	}}}
+	if _, err := r.LookupTLSA(context.Background(), 443, "tcp", "www"); err == nil {
+		t.Fatalf("expected an error for a relative host name")
+	}
+
+	records, err := r.LookupTLSA(context.Background(), 443, "tcp", "www.example.com")
+	if err != nil || len(records) != 1 {
+		t.Fatalf("unexpected TLSA records. actual=%v err=%v", records, err)
+	}
+}
+
+func TestSSHFP(t *testing.T) {
+	key := []byte("\x00\x00\x00\x0bssh-ed25519\x00\x00\x00\x20" + string(make([]byte, 32)))
+	fp, err := dns.NewSSHFP(dns.Ed25519SSHAlgorithm, dns.SHA256FingerprintType, key)
+	if err != nil {
+		t.Fatalf("NewSSHFP failed with error %s", err.Error())
+	}
+
+	rr := dns.NewResourceRecord(mustName(t, "host.example.com"), dns.SSHFPType, dns.INClass, 300, fp.ToBytes())
+	parsed, err := rr.SSHFP()
+	if err != nil {
+		t.Fatalf("SSHFP failed with error %s", err.Error())
+	}
+
+	reparsed, err := dns.ParseSSHFP(parsed.String())
+	if err != nil || reparsed.String() != fp.String() || len(reparsed.Fingerprint) != 32 {
+		t.Fatalf("unexpected SSHFP. actual=%s expected=%s err=%v", reparsed.String(), fp.String(), err)
+	}
+
+	if _, err := dns.NewSSHFP(dns.Ed25519SSHAlgorithm, 3, key); err == nil {
+		t.Fatalf("expected an error for an unknown fingerprint type")
+	}
+}
+
+func TestOPENPGPKEY(t *testing.T) {
+	// example of RFC 7929 section 3
+	n, err := dns.OPENPGPKEYName("hugh@example.com")
+	if err != nil {
+		t.Fatalf("OPENPGPKEYName failed with error %s", err.Error())
+	}
+
+	expected := "c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._openpgpkey.example.com"
+	if n.GetName() != expected {
+		t.Fatalf("unexpected name. actual=%s expected=%s", n.GetName(), expected)
+	}
+
+	key, err := dns.ParseOPENPGPKEY("mQINBFit2jsBEADrbl5vjVxYeAE0g0IDYCBpHirv1Sjlqxx5gjtPhb2YhvyDMXjq \n kLEnCn+4Pjpa")
+	if err != nil {
+		t.Fatalf("ParseOPENPGPKEY failed with error %s", err.Error())
+	}
+
+	rr := dns.NewResourceRecord(n, dns.OPENPGPKEYType, dns.INClass, 300, key.ToBytes())
+	parsed, err := rr.OPENPGPKEY()
+	if err != nil || hex.EncodeToString(parsed.PublicKey) != hex.EncodeToString(key.PublicKey) {
+		t.Fatalf("unexpected OPENPGPKEY. err=%v", err)
+	}
+
+	if _, err := dns.OPENPGPKEYName("example.com"); err == nil {
+		t.Fatalf("expected an error for an invalid email address")
+	}
+}
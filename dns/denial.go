@@ -0,0 +1,487 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CanonicalCompare compares two names in the canonical order of DNSSEC (RFC
+// 4034 section 6.1), the labels being compared from the rightmost one. It
+// returns -1, 0 or 1
+func CanonicalCompare(a, b Name) int {
+	la, lb := nameLabels(a), nameLabels(b)
+	for i := 1; i <= len(la) && i <= len(lb); i++ {
+		if c := bytes.Compare([]byte(la[len(la)-i]), []byte(lb[len(lb)-i])); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case len(la) < len(lb):
+		return -1
+	case len(la) > len(lb):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// MaxNSEC3Iterations is the highest number of additional NSEC3 hash iterations
+// the denial proofs compute. Proofs made of NSEC3 records with more iterations
+// fail with ErrNSEC3Iterations without hashing, the data they deny being
+// treated as insecure (RFC 9276 section 3.2)
+const MaxNSEC3Iterations = 150
+
+// ErrNSEC3Iterations is the error of the denial proofs relying on NSEC3 records
+// with more than MaxNSEC3Iterations iterations
+var ErrNSEC3Iterations = errors.New("NSEC3 iterations exceed the limit")
+
+// NSEC3Hash returns the hash of a name used as the owner of its NSEC3 record
+// (RFC 5155 section 5)
+func NSEC3Hash(name Name, iterations uint16, salt []byte) []byte {
+	h := sha1.New()
+	h.Write(name.ToBytes())
+	h.Write(salt)
+	digest := h.Sum(nil)
+
+	for i := 0; i < int(iterations); i++ {
+		h.Reset()
+		h.Write(digest)
+		h.Write(salt)
+		digest = h.Sum(nil)
+	}
+
+	return digest
+}
+
+// ProveNameError checks the NSEC or NSEC3 records of the authority section
+// prove that qname does not exist, and that no wildcard could have been
+// expanded to answer it
+func ProveNameError(qname Name, authority []ResourceRecord) error {
+	if err := checkNSEC3Iterations(authority); err != nil {
+		return err
+	}
+
+	if nsecs := nsecRecords(authority); len(nsecs) > 0 {
+		covering, ok := coveringNSEC(nsecs, qname)
+		if !ok {
+			return fmt.Errorf("no NSEC record proves %s does not exist", qname.GetName())
+		}
+
+		wildcard := wildcardOf(closestEncloserNSEC(qname, covering))
+		if _, ok := coveringNSEC(nsecs, wildcard); !ok {
+			return fmt.Errorf("no NSEC record proves wildcard %s does not exist", wildcard.GetName())
+		}
+		return nil
+	}
+
+	if nsec3s := nsec3Records(authority); len(nsec3s) > 0 {
+		ce, _, err := closestEncloserProof(nsec3s, qname)
+		if err != nil {
+			return err
+		}
+
+		wildcard := wildcardOf(ce)
+		if _, ok := coveringNSEC3(nsec3s, wildcard); !ok {
+			return fmt.Errorf("no NSEC3 record proves wildcard %s does not exist", wildcard.GetName())
+		}
+		return nil
+	}
+
+	return fmt.Errorf("no NSEC or NSEC3 record proves %s does not exist", qname.GetName())
+}
+
+// ProveNoData checks the NSEC or NSEC3 records of the authority section prove
+// that qname, or the wildcard matching it, owns no record of type t. It reports
+// whether the proof relies on an opt-out NSEC3 record, which only happens for
+// DS queries: an insecure delegation may then exist at qname
+func ProveNoData(qname Name, t Type, authority []ResourceRecord) (bool, error) {
+	if err := checkNSEC3Iterations(authority); err != nil {
+		return false, err
+	}
+
+	if nsecs := nsecRecords(authority); len(nsecs) > 0 {
+		if r, ok := matchingNSEC(nsecs, qname); ok {
+			return false, checkNoDataTypes(qname, t, r.nsec.Types)
+		}
+
+		covering, ok := coveringNSEC(nsecs, qname)
+		if !ok {
+			return false, fmt.Errorf("no NSEC record proves %s owns no %s record", qname.GetName(), t)
+		}
+
+		if covering.nsec.NextDomain.IsSubdomainOf(qname) {
+			// qname is an empty non-terminal
+			return false, nil
+		}
+
+		wildcard := wildcardOf(closestEncloserNSEC(qname, covering))
+		if r, ok := matchingNSEC(nsecs, wildcard); ok {
+			return false, checkNoDataTypes(wildcard, t, r.nsec.Types)
+		}
+
+		return false, fmt.Errorf("no NSEC record proves %s owns no %s record", qname.GetName(), t)
+	}
+
+	if nsec3s := nsec3Records(authority); len(nsec3s) > 0 {
+		if r, ok := matchingNSEC3(nsec3s, qname); ok {
+			return false, checkNoDataTypes(qname, t, r.nsec3.Types)
+		}
+
+		ce, nextCloser, err := closestEncloserProof(nsec3s, qname)
+		if err != nil {
+			return false, err
+		}
+
+		if t == DSType && nextCloser.nsec3.Flags&OptOutFlag != 0 {
+			return true, nil
+		}
+
+		wildcard := wildcardOf(ce)
+		if r, ok := matchingNSEC3(nsec3s, wildcard); ok {
+			return false, checkNoDataTypes(wildcard, t, r.nsec3.Types)
+		}
+
+		return false, fmt.Errorf("no NSEC3 record proves %s owns no %s record", qname.GetName(), t)
+	}
+
+	return false, fmt.Errorf("no NSEC or NSEC3 record proves %s owns no %s record", qname.GetName(), t)
+}
+
+// ProveInsecureDelegation checks the NSEC or NSEC3 records of the authority
+// section prove that qname is a delegation without DS records, making the child
+// zone insecure (RFC 4035 section 5.2, RFC 6840 section 4.4). The record of
+// qname must list NS but neither DS, SOA nor CNAME, unless an opt-out NSEC3
+// record covers it
+func ProveInsecureDelegation(qname Name, authority []ResourceRecord) error {
+	if err := checkNSEC3Iterations(authority); err != nil {
+		return err
+	}
+
+	if nsecs := nsecRecords(authority); len(nsecs) > 0 {
+		r, ok := matchingNSEC(nsecs, qname)
+		if !ok {
+			return fmt.Errorf("no NSEC record proves %s is an insecure delegation", qname.GetName())
+		}
+		return checkDelegationTypes(qname, r.nsec.Types)
+	}
+
+	if nsec3s := nsec3Records(authority); len(nsec3s) > 0 {
+		if r, ok := matchingNSEC3(nsec3s, qname); ok {
+			return checkDelegationTypes(qname, r.nsec3.Types)
+		}
+
+		_, nextCloser, err := closestEncloserProof(nsec3s, qname)
+		if err != nil {
+			return err
+		}
+
+		if nextCloser.nsec3.Flags&OptOutFlag == 0 {
+			return fmt.Errorf("NSEC3 record covering %s does not opt out", qname.GetName())
+		}
+		return nil
+	}
+
+	return fmt.Errorf("no NSEC or NSEC3 record proves %s is an insecure delegation", qname.GetName())
+}
+
+// ProveWildcardAnswer checks the NSEC or NSEC3 records of the authority section
+// prove that qname does not exist, as required when its records were expanded
+// from a wildcard. labels is the label count of the RRSIG covering the answer
+func ProveWildcardAnswer(qname Name, labels uint8, authority []ResourceRecord) error {
+	if int(labels) >= qname.LabelCount() {
+		return fmt.Errorf("answer for %s was not expanded from a wildcard", qname.GetName())
+	}
+
+	if err := checkNSEC3Iterations(authority); err != nil {
+		return err
+	}
+
+	if nsecs := nsecRecords(authority); len(nsecs) > 0 {
+		if _, ok := coveringNSEC(nsecs, qname); !ok {
+			return fmt.Errorf("no NSEC record proves %s does not exist", qname.GetName())
+		}
+		return nil
+	}
+
+	if nsec3s := nsec3Records(authority); len(nsec3s) > 0 {
+		l := nameLabels(qname)
+		nextCloser, _ := NewName(strings.Join(l[len(l)-int(labels)-1:], "."))
+		if _, ok := coveringNSEC3(nsec3s, nextCloser); !ok {
+			return fmt.Errorf("no NSEC3 record proves %s does not exist", nextCloser.GetName())
+		}
+		return nil
+	}
+
+	return fmt.Errorf("no NSEC or NSEC3 record proves %s does not exist", qname.GetName())
+}
+
+// checkNoDataTypes checks the types of a NSEC or NSEC3 record matching name
+// prove the absence of records of type t
+func checkNoDataTypes(name Name, t Type, types []Type) error {
+	if hasType(types, t) || hasType(types, CNAMEType) {
+		return fmt.Errorf("NSEC record of %s lists type %s or CNAME", name.GetName(), t)
+	}
+
+	if t != DSType && hasType(types, NSType) && !hasType(types, SOAType) {
+		// the record belongs to the parent side of a delegation, which cannot
+		// prove anything about the data of the child zone
+		return fmt.Errorf("NSEC record of %s comes from the parent side of a delegation", name.GetName())
+	}
+
+	return nil
+}
+
+// checkDelegationTypes checks the types of a NSEC or NSEC3 record matching name
+// are the ones of a delegation without DS records
+func checkDelegationTypes(name Name, types []Type) error {
+	if !hasType(types, NSType) || hasType(types, SOAType) {
+		return fmt.Errorf("NSEC record of %s does not prove a zone cut", name.GetName())
+	}
+
+	if hasType(types, DSType) || hasType(types, CNAMEType) {
+		return fmt.Errorf("NSEC record of %s lists type DS or CNAME", name.GetName())
+	}
+
+	return nil
+}
+
+type nsecRecord struct {
+	owner Name
+	nsec  NSEC
+}
+
+type nsec3Record struct {
+	owner Name
+	// hash is the decoded hash the owner name starts with
+	hash  []byte
+	zone  Name
+	nsec3 NSEC3
+}
+
+func nsecRecords(records []ResourceRecord) []nsecRecord {
+	nsecs := make([]nsecRecord, 0)
+	for _, rr := range records {
+		if rr.Type != NSECType {
+			continue
+		}
+
+		if nsec, err := rr.NSEC(); err == nil {
+			nsecs = append(nsecs, nsecRecord{owner: rr.Name, nsec: nsec})
+		}
+	}
+
+	return nsecs
+}
+
+// checkNSEC3Iterations checks the NSEC3 records among records are cheap enough
+// to be hashed
+func checkNSEC3Iterations(records []ResourceRecord) error {
+	for _, rr := range records {
+		if rr.Type != NSEC3Type {
+			continue
+		}
+
+		if nsec3, err := rr.NSEC3(); err == nil && nsec3.Iterations > MaxNSEC3Iterations {
+			return fmt.Errorf("%w. owner=%s iterations=%d", ErrNSEC3Iterations, rr.Name.GetName(), nsec3.Iterations)
+		}
+	}
+
+	return nil
+}
+
+func nsec3Records(records []ResourceRecord) []nsec3Record {
+	nsec3s := make([]nsec3Record, 0)
+	for _, rr := range records {
+		if rr.Type != NSEC3Type {
+			continue
+		}
+
+		nsec3, err := rr.NSEC3()
+		if err != nil || nsec3.HashAlgorithm != SHA1NSEC3Hash {
+			continue
+		}
+
+		// the first label is the hash, the rest of the owner is the zone
+		label, zone := rr.Name.GetName(), "."
+		if i := strings.Index(label, "."); i >= 0 {
+			label, zone = label[:i], label[i+1:]
+		}
+
+		hash, err := base32Hex.DecodeString(strings.ToUpper(label))
+		zoneName, zoneErr := NewName(zone)
+		if err != nil || zoneErr != nil {
+			continue
+		}
+
+		nsec3s = append(nsec3s, nsec3Record{owner: rr.Name, hash: hash, zone: zoneName, nsec3: nsec3})
+	}
+
+	return nsec3s
+}
+
+func matchingNSEC(nsecs []nsecRecord, name Name) (nsecRecord, bool) {
+	for _, r := range nsecs {
+		if r.owner.Equal(name) {
+			return r, true
+		}
+	}
+
+	return nsecRecord{}, false
+}
+
+// coveringNSEC returns the NSEC record whose owner and next name surround name
+func coveringNSEC(nsecs []nsecRecord, name Name) (nsecRecord, bool) {
+	for _, r := range nsecs {
+		// the chain of the zone holding the record cannot cover names out of it
+		if !name.IsSubdomainOf(commonAncestor(r.owner, r.nsec.NextDomain)) {
+			continue
+		}
+
+		if covers(CanonicalCompare(r.owner, name), CanonicalCompare(name, r.nsec.NextDomain),
+			CanonicalCompare(r.owner, r.nsec.NextDomain)) {
+			return r, true
+		}
+	}
+
+	return nsecRecord{}, false
+}
+
+func matchingNSEC3(nsec3s []nsec3Record, name Name) (nsec3Record, bool) {
+	for _, r := range nsec3s {
+		if !name.IsSubdomainOf(r.zone) {
+			continue
+		}
+
+		if bytes.Equal(r.hash, NSEC3Hash(name, r.nsec3.Iterations, r.nsec3.Salt)) {
+			return r, true
+		}
+	}
+
+	return nsec3Record{}, false
+}
+
+// coveringNSEC3 returns the NSEC3 record whose owner and next hashes surround
+// the hash of name
+func coveringNSEC3(nsec3s []nsec3Record, name Name) (nsec3Record, bool) {
+	for _, r := range nsec3s {
+		if !name.IsSubdomainOf(r.zone) {
+			continue
+		}
+
+		h := NSEC3Hash(name, r.nsec3.Iterations, r.nsec3.Salt)
+		if covers(bytes.Compare(r.hash, h), bytes.Compare(h, r.nsec3.NextHashedOwner),
+			bytes.Compare(r.hash, r.nsec3.NextHashedOwner)) {
+			return r, true
+		}
+	}
+
+	return nsec3Record{}, false
+}
+
+// covers tells from the comparisons of the owner, the name and the next name
+// whether the name falls strictly between the owner and the next name, the
+// last record of a chain wrapping around to the first one
+func covers(ownerToName, nameToNext, ownerToNext int) bool {
+	if ownerToNext < 0 {
+		return ownerToName < 0 && nameToNext < 0
+	}
+
+	return ownerToName < 0 || nameToNext < 0
+}
+
+// closestEncloserProof finds the closest encloser of qname, the longest of its
+// ancestors that exists, and the NSEC3 record covering the next closer name,
+// proving qname does not exist (RFC 5155 section 8.3)
+func closestEncloserProof(nsec3s []nsec3Record, qname Name) (Name, nsec3Record, error) {
+	nextCloser := qname
+	for candidate, ok := parentName(qname); ok; candidate, ok = parentName(candidate) {
+		if _, ok := matchingNSEC3(nsec3s, candidate); ok {
+			r, ok := coveringNSEC3(nsec3s, nextCloser)
+			if !ok {
+				return Name{}, nsec3Record{}, fmt.Errorf("no NSEC3 record covers the next closer name %s",
+					nextCloser.GetName())
+			}
+			return candidate, r, nil
+		}
+		nextCloser = candidate
+	}
+
+	return Name{}, nsec3Record{}, fmt.Errorf("no NSEC3 record proves the closest encloser of %s", qname.GetName())
+}
+
+// closestEncloserNSEC returns the closest encloser of qname according to the
+// NSEC record covering it
+func closestEncloserNSEC(qname Name, covering nsecRecord) Name {
+	a := commonAncestor(qname, covering.owner)
+	b := commonAncestor(qname, covering.nsec.NextDomain)
+	if a.LabelCount() >= b.LabelCount() {
+		return a
+	}
+
+	return b
+}
+
+// commonAncestor returns the longest name both names are subdomains of
+func commonAncestor(a, b Name) Name {
+	la, lb := nameLabels(a), nameLabels(b)
+	common := make([]string, 0)
+	for i := 1; i <= len(la) && i <= len(lb) && la[len(la)-i] == lb[len(lb)-i]; i++ {
+		common = append([]string{la[len(la)-i]}, common...)
+	}
+
+	if len(common) == 0 {
+		root, _ := NewName(".")
+		return root
+	}
+
+	n, _ := NewName(strings.Join(common, "."))
+	return n
+}
+
+// parentName returns the name stripped of its first label
+func parentName(n Name) (Name, bool) {
+	labels := nameLabels(n)
+	if len(labels) == 0 {
+		return Name{}, false
+	}
+
+	if len(labels) == 1 {
+		root, _ := NewName(".")
+		return root, true
+	}
+
+	parent, err := NewName(strings.Join(labels[1:], "."))
+	return parent, err == nil
+}
+
+func wildcardOf(n Name) Name {
+	if n.GetName() == "." {
+		w, _ := NewName("*")
+		return w
+	}
+
+	w, _ := NewName("*." + n.GetName())
+	return w
+}
+
+func nameLabels(n Name) []string {
+	if n.LabelCount() == 0 {
+		return []string{}
+	}
+
+	return strings.Split(n.GetName(), ".")
+}
+
+func hasType(types []Type, t Type) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,259 @@
+package dns_test
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+// zoneNames are the names of the example zone of the denial tests with the
+// types they own. w.example is an empty non-terminal
+var zoneNames = map[string][]dns.Type{
+	"example":     {dns.SOAType, dns.NSType, dns.RRSIGType, dns.DNSKEYType},
+	"a.example":   {dns.NSType, dns.DSType, dns.RRSIGType},
+	"ns1.example": {dns.AType, dns.RRSIGType},
+	"*.w.example": {dns.MXType, dns.RRSIGType},
+	"x.w.example": {dns.MXType, dns.RRSIGType},
+}
+
+// nsecChain returns the NSEC records of the example zone
+func nsecChain(t *testing.T) []dns.ResourceRecord {
+	names := make([]dns.Name, 0, len(zoneNames))
+	for name := range zoneNames {
+		names = append(names, mustName(t, name))
+	}
+	sort.Slice(names, func(i, j int) bool { return dns.CanonicalCompare(names[i], names[j]) < 0 })
+
+	records := make([]dns.ResourceRecord, 0, len(names))
+	for i, name := range names {
+		nsec := dns.NSEC{
+			NextDomain: names[(i+1)%len(names)],
+			Types:      append(zoneNames[name.GetName()], dns.NSECType),
+		}
+		records = append(records, dns.NewResourceRecord(name, dns.NSECType, dns.INClass, 3600, nsec.ToBytes()))
+	}
+
+	return records
+}
+
+// nsec3Chain returns the NSEC3 records of the example zone, hashed as in RFC
+// 5155 appendix A
+func nsec3Chain(t *testing.T, flags uint8) []dns.ResourceRecord {
+	salt, _ := hex.DecodeString("aabbccdd")
+	type hashed struct {
+		hash  []byte
+		types []dns.Type
+	}
+
+	hashes := make([]hashed, 0, len(zoneNames)+1)
+	for name, types := range zoneNames {
+		hashes = append(hashes, hashed{dns.NSEC3Hash(mustName(t, name), 12, salt), types})
+	}
+	hashes = append(hashes, hashed{dns.NSEC3Hash(mustName(t, "w.example"), 12, salt), nil})
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i].hash, hashes[j].hash) < 0 })
+
+	encoding := base32.HexEncoding.WithPadding(base32.NoPadding)
+	records := make([]dns.ResourceRecord, 0, len(hashes))
+	for i, h := range hashes {
+		nsec3 := dns.NSEC3{
+			HashAlgorithm:   dns.SHA1NSEC3Hash,
+			Flags:           flags,
+			Iterations:      12,
+			Salt:            salt,
+			NextHashedOwner: hashes[(i+1)%len(hashes)].hash,
+			Types:           h.types,
+		}
+		owner := mustName(t, strings.ToLower(encoding.EncodeToString(h.hash))+".example")
+		records = append(records, dns.NewResourceRecord(owner, dns.NSEC3Type, dns.INClass, 3600, nsec3.ToBytes()))
+	}
+
+	return records
+}
+
+func TestNSEC3Hash(t *testing.T) {
+	var cases = []struct {
+		name string
+		hash string
+	}{
+		{"example", "0p9mhaveqvm6t7vbl5lop2u3t2rp3tom"},
+		{"a.example", "35mthgpgcu1qg68fab165klnsnk3dpvl"},
+		{"*.w.example", "r53bq7cc2uvmubfu5ocmm6pers9tk9en"},
+	}
+
+	salt, _ := hex.DecodeString("aabbccdd")
+	encoding := base32.HexEncoding.WithPadding(base32.NoPadding)
+	for _, c := range cases {
+		hash := strings.ToLower(encoding.EncodeToString(dns.NSEC3Hash(mustName(t, c.name), 12, salt)))
+		if hash != c.hash {
+			t.Fatalf("unexpected hash. name=%s actual=%s expected=%s", c.name, hash, c.hash)
+		}
+	}
+}
+
+func TestCanonicalCompare(t *testing.T) {
+	ordered := []string{"example", "a.example", "yljkjljk.a.example", "z.a.example", "zabc.a.example",
+		"z.example", "*.z.example", "a.z.example"}
+
+	for i := range ordered {
+		for j := range ordered {
+			expected := 0
+			if i < j {
+				expected = -1
+			} else if i > j {
+				expected = 1
+			}
+
+			if c := dns.CanonicalCompare(mustName(t, ordered[i]), mustName(t, ordered[j])); c != expected {
+				t.Fatalf("unexpected order. a=%s b=%s actual=%d expected=%d", ordered[i], ordered[j], c, expected)
+			}
+		}
+	}
+}
+
+func TestProveNameError(t *testing.T) {
+	var cases = []struct {
+		qname     string
+		authority []dns.ResourceRecord
+		valid     bool
+	}{
+		{"b.example", nsecChain(t), true},
+		{"a.b.c.example", nsecChain(t), true},
+		{"ns1.example", nsecChain(t), false},
+		{"z.w.example", nsecChain(t), false},
+		{"b.example", nil, false},
+		{"a.c.x.w.example", nsec3Chain(t, 0), true},
+		{"b.example", nsec3Chain(t, 0), true},
+		{"x.w.example", nsec3Chain(t, 0), false},
+		{"z.w.example", nsec3Chain(t, 0), false},
+	}
+
+	for i, c := range cases {
+		err := dns.ProveNameError(mustName(t, c.qname), c.authority)
+		if (err == nil) != c.valid {
+			t.Fatalf("unexpected proof result. case=%d qname=%s err=%v", i, c.qname, err)
+		}
+	}
+}
+
+func TestProveNoData(t *testing.T) {
+	var cases = []struct {
+		qname     string
+		t         dns.Type
+		authority []dns.ResourceRecord
+		valid     bool
+		optOut    bool
+	}{
+		{"ns1.example", dns.MXType, nsecChain(t), true, false},
+		{"ns1.example", dns.AType, nsecChain(t), false, false},
+		{"w.example", dns.AType, nsecChain(t), true, false},
+		{"z.w.example", dns.AAAAType, nsecChain(t), true, false},
+		{"z.w.example", dns.MXType, nsecChain(t), false, false},
+		{"a.example", dns.AType, nsecChain(t), false, false},
+		{"b.example", dns.AType, nsecChain(t), false, false},
+		{"ns1.example", dns.MXType, nsec3Chain(t, 0), true, false},
+		{"ns1.example", dns.AType, nsec3Chain(t, 0), false, false},
+		{"w.example", dns.AType, nsec3Chain(t, 0), true, false},
+		{"z.w.example", dns.AAAAType, nsec3Chain(t, 0), true, false},
+		{"z.w.example", dns.MXType, nsec3Chain(t, 0), false, false},
+		{"b.example", dns.DSType, nsec3Chain(t, 0), false, false},
+		{"b.example", dns.DSType, nsec3Chain(t, dns.OptOutFlag), true, true},
+		{"b.example", dns.AType, nsec3Chain(t, dns.OptOutFlag), false, false},
+	}
+
+	for i, c := range cases {
+		optOut, err := dns.ProveNoData(mustName(t, c.qname), c.t, c.authority)
+		if (err == nil) != c.valid {
+			t.Fatalf("unexpected proof result. case=%d qname=%s type=%s err=%v", i, c.qname, c.t, err)
+		}
+
+		if optOut != c.optOut {
+			t.Fatalf("unexpected opt-out. case=%d actual=%t expected=%t", i, optOut, c.optOut)
+		}
+	}
+}
+
+func TestProveWildcardAnswer(t *testing.T) {
+	var cases = []struct {
+		qname     string
+		labels    uint8
+		authority []dns.ResourceRecord
+		valid     bool
+	}{
+		{"z.w.example", 2, nsecChain(t), true},
+		{"x.w.example", 2, nsecChain(t), false},
+		{"z.w.example", 3, nsecChain(t), false},
+		{"z.w.example", 2, nsec3Chain(t, 0), true},
+		{"x.w.example", 2, nsec3Chain(t, 0), false},
+	}
+
+	for i, c := range cases {
+		err := dns.ProveWildcardAnswer(mustName(t, c.qname), c.labels, c.authority)
+		if (err == nil) != c.valid {
+			t.Fatalf("unexpected proof result. case=%d qname=%s err=%v", i, c.qname, err)
+		}
+	}
+}
+
+func TestProveInsecureDelegation(t *testing.T) {
+	unsigned := dns.NSEC{NextDomain: mustName(t, "ns1.example"), Types: []dns.Type{dns.NSType, dns.RRSIGType, dns.NSECType}}
+	delegation := []dns.ResourceRecord{
+		dns.NewResourceRecord(mustName(t, "c.example"), dns.NSECType, dns.INClass, 3600, unsigned.ToBytes()),
+	}
+
+	var cases = []struct {
+		qname     string
+		authority []dns.ResourceRecord
+		valid     bool
+	}{
+		{"c.example", delegation, true},
+		// a secure delegation, a name that is not a zone cut and the apex
+		{"a.example", nsecChain(t), false},
+		{"ns1.example", nsecChain(t), false},
+		{"example", nsecChain(t), false},
+		{"w.example", nsecChain(t), false},
+		{"b.example", nsecChain(t), false},
+		{"a.example", nsec3Chain(t, 0), false},
+		{"ns1.example", nsec3Chain(t, 0), false},
+		{"b.example", nsec3Chain(t, 0), false},
+		{"b.example", nsec3Chain(t, dns.OptOutFlag), true},
+	}
+
+	for i, c := range cases {
+		err := dns.ProveInsecureDelegation(mustName(t, c.qname), c.authority)
+		if (err == nil) != c.valid {
+			t.Fatalf("unexpected proof result. case=%d qname=%s err=%v", i, c.qname, err)
+		}
+	}
+}
+
+func TestProveNSEC3IterationsLimit(t *testing.T) {
+	nsec3 := dns.NSEC3{
+		HashAlgorithm:   dns.SHA1NSEC3Hash,
+		Iterations:      dns.MaxNSEC3Iterations + 1,
+		NextHashedOwner: make([]byte, 20),
+		Types:           []dns.Type{dns.AType},
+	}
+	authority := []dns.ResourceRecord{dns.NewResourceRecord(mustName(t, "0p9mhaveqvm6t7vbl5lop2u3t2rp3tom.example"),
+		dns.NSEC3Type, dns.INClass, 3600, nsec3.ToBytes())}
+	qname := mustName(t, "b.example")
+
+	_, noData := dns.ProveNoData(qname, dns.AType, authority)
+	var errs = []error{
+		dns.ProveNameError(qname, authority),
+		noData,
+		dns.ProveInsecureDelegation(qname, authority),
+		dns.ProveWildcardAnswer(mustName(t, "a.b.example"), 2, authority),
+	}
+
+	for i, err := range errs {
+		if !errors.Is(err, dns.ErrNSEC3Iterations) {
+			t.Fatalf("unexpected error. case=%d err=%v", i, err)
+		}
+	}
+}
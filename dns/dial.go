@@ -0,0 +1,205 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// pipeQueueSize is the number of datagrams an in-memory packet connection
+// holds before its writes block
+const pipeQueueSize = 16
+
+// Dialer connects the pure Go resolver of the net package to this package. The
+// connections it dials are in memory, the queries written on them being
+// answered by the Handler as a Server would:
+//
+//	d := &dns.Dialer{Handler: forwarder}
+//	r := &net.Resolver{PreferGo: true, Dial: d.Dial}
+type Dialer struct {
+	// Handler answers the queries. When nil, the queries are forwarded with
+	// the Client to the address the resolver dialed, one of the name servers
+	// of /etc/resolv.conf
+	Handler Handler
+	// Client sends the queries when Handler is nil
+	Client Client
+}
+
+// Dial returns an in-memory connection to the handler for the network, a
+// packet connection for "udp" and a stream connection for "tcp". It has the
+// signature of the Dial field of net.Resolver
+func (d *Dialer) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+
+	s := &Server{Handler: d.Handler}
+	if s.Handler == nil {
+		s.Handler = &Forwarder{Upstreams: []Upstream{{Protocol: PlainProtocol, Addr: address}}, Client: d.Client}
+	}
+
+	switch network {
+	case "udp", "udp4", "udp6":
+		client, server := packetPipe()
+		go s.servePacketPipe(server)
+		return client, nil
+	case "tcp", "tcp4", "tcp6":
+		client, server := net.Pipe()
+		go s.serveTCPConn(server)
+		return client, nil
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+}
+
+// servePacketPipe serves the requests received on pc until it is closed
+func (s *Server) servePacketPipe(pc *pipePacketConn) {
+	for {
+		buf := make([]byte, 65535)
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		go s.serveUDPRequest(pc, addr, buf[:n])
+	}
+}
+
+// pipeAddr is the address of both ends of an in-memory connection
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+// pipePacketConn is an end of an in-memory connection that keeps the boundaries
+// of the datagrams written on it. It implements both net.Conn and
+// net.PacketConn
+type pipePacketConn struct {
+	in     chan []byte
+	out    chan []byte
+	closed chan struct{}
+	once   *sync.Once
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+// packetPipe returns both ends of an in-memory packet connection. Closing an
+// end closes the other
+func packetPipe() (*pipePacketConn, *pipePacketConn) {
+	a := make(chan []byte, pipeQueueSize)
+	b := make(chan []byte, pipeQueueSize)
+	closed := make(chan struct{})
+	once := &sync.Once{}
+
+	return &pipePacketConn{in: a, out: b, closed: closed, once: once},
+		&pipePacketConn{in: b, out: a, closed: closed, once: once}
+}
+
+// Read reads a datagram, the bytes that do not fit in b being discarded
+func (c *pipePacketConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	deadline := c.readDeadline
+	c.mu.Unlock()
+
+	expired, stop := deadlineTimer(deadline)
+	defer stop()
+
+	select {
+	case data := <-c.in:
+		return copy(b, data), nil
+	case <-c.closed:
+		return 0, net.ErrClosed
+	case <-expired:
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+// Write writes b as a single datagram
+func (c *pipePacketConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	deadline := c.writeDeadline
+	c.mu.Unlock()
+
+	expired, stop := deadlineTimer(deadline)
+	defer stop()
+
+	data := make([]byte, len(b))
+	copy(data, b)
+
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	select {
+	case c.out <- data:
+		return len(b), nil
+	case <-c.closed:
+		return 0, net.ErrClosed
+	case <-expired:
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+func (c *pipePacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := c.Read(b)
+	return n, pipeAddr{}, err
+}
+
+func (c *pipePacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return c.Write(b)
+}
+
+func (c *pipePacketConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *pipePacketConn) LocalAddr() net.Addr {
+	return pipeAddr{}
+}
+
+func (c *pipePacketConn) RemoteAddr() net.Addr {
+	return pipeAddr{}
+}
+
+func (c *pipePacketConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.readDeadline = t
+	c.writeDeadline = t
+	return nil
+}
+
+func (c *pipePacketConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.readDeadline = t
+	return nil
+}
+
+func (c *pipePacketConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writeDeadline = t
+	return nil
+}
+
+// deadlineTimer returns a channel receiving once the deadline is reached, and a
+// function releasing the timer. The channel never receives for a zero deadline
+func deadlineTimer(deadline time.Time) (<-chan time.Time, func()) {
+	if deadline.IsZero() {
+		return nil, func() {}
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	return timer.C, func() { timer.Stop() }
+}
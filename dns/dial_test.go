@@ -0,0 +1,106 @@
+package dns_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func TestDialerNetResolver(t *testing.T) {
+	// the strings of the TXT record do not fit in a UDP response, so that the
+	// resolver retries over TCP
+	long := strings.Repeat("a", 250)
+	txt := make([]byte, 0)
+	for i := 0; i < 8; i++ {
+		txt = append(append(txt, byte(len(long))), long...)
+	}
+
+	z := mustZone(t, "example.com",
+		aRecord(t, "www.example.com", "192.0.2.1"),
+		mxRecord(t, "example.com", 10, "mx1.example.com"),
+		dns.NewResourceRecord(mustName(t, "example.com"), dns.TXTType, dns.INClass, 300, txt),
+	)
+
+	var queries int32
+	d := &dns.Dialer{Handler: countingHandler(zonesHandler(mustZone(t, "."), z), &queries)}
+	r := &net.Resolver{PreferGo: true, Dial: d.Dial}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ips, err := r.LookupIP(ctx, "ip4", "www.example.com.")
+	if err != nil || len(ips) != 1 || ips[0].String() != "192.0.2.1" {
+		t.Fatalf("unexpected addresses. actual=%v err=%v", ips, err)
+	}
+
+	mxs, err := r.LookupMX(ctx, "example.com.")
+	if err != nil || len(mxs) != 1 || mxs[0].Host != "mx1.example.com." {
+		t.Fatalf("unexpected mail exchanges. actual=%v err=%v", mxs, err)
+	}
+
+	txts, err := r.LookupTXT(ctx, "example.com.")
+	if err != nil || len(txts) != 1 || len(txts[0]) != 8*len(long) {
+		t.Fatalf("unexpected texts. count=%d err=%v", len(txts), err)
+	}
+
+	_, err = r.LookupIP(ctx, "ip4", "nothere.example.com.")
+	if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+		t.Fatalf("expected a not found error. err=%v", err)
+	}
+
+	if atomic.LoadInt32(&queries) == 0 {
+		t.Fatalf("the queries were not answered by the handler")
+	}
+}
+
+func TestDialerClient(t *testing.T) {
+	addr := startServer(t, zonesHandler(mustZone(t, "."),
+		mustZone(t, "example.com", aRecord(t, "www.example.com", "192.0.2.1"))))
+
+	d := &dns.Dialer{Client: dns.Client{Timeout: time.Second}}
+	for _, network := range []string{"udp", "tcp"} {
+		conn, err := d.Dial(context.Background(), network, addr)
+		if err != nil {
+			t.Fatalf("Dial failed. network=%s err=%s", network, err.Error())
+		}
+
+		q := &dns.Message{
+			Header:   dns.Header{ID: 1234, Opcode: dns.QueryOpcode, RD: true, QuestionCount: 1},
+			Question: dns.Question{Name: mustName(t, "www.example.com"), Type: dns.QType(dns.AType), Class: dns.INClass},
+		}
+		data := q.ToBytes()
+		if network == "tcp" {
+			data = append([]byte{byte(len(data) >> 8), byte(len(data))}, data...)
+		}
+
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err := conn.Write(data); err != nil {
+			t.Fatalf("Write failed. network=%s err=%s", network, err.Error())
+		}
+
+		buf := make([]byte, 65535)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("Read failed. network=%s err=%s", network, err.Error())
+		}
+		if network == "tcp" {
+			buf = buf[2:n]
+		} else {
+			buf = buf[:n]
+		}
+
+		resp, _, err := dns.MessageFromBytes(buf)
+		if err != nil {
+			t.Fatalf("MessageFromBytes failed. network=%s err=%s", network, err.Error())
+		}
+
+		if resp.Header.ID != 1234 || len(resp.Answers) != 1 || net.IP(resp.Answers[0].Data).String() != "192.0.2.1" {
+			t.Fatalf("unexpected response. network=%s id=%d answers=%d", network, resp.Header.ID, len(resp.Answers))
+		}
+		conn.Close()
+	}
+}
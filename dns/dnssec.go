@@ -0,0 +1,412 @@
+package dns
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// ZoneKeyFlag marks a DNSKEY as a key of the zone, able to sign its RRsets
+	ZoneKeyFlag uint16 = 0x0100
+	// RevokeFlag marks a DNSKEY as revoked (RFC 5011)
+	RevokeFlag uint16 = 0x0080
+	// SEPFlag marks a DNSKEY as a secure entry point, usually a key signing key
+	SEPFlag uint16 = 0x0001
+)
+
+const (
+	// SHA1DigestType is the DS digest algorithm using SHA-1
+	SHA1DigestType DigestType = 1
+	// SHA256DigestType is the DS digest algorithm using SHA-256
+	SHA256DigestType DigestType = 2
+	// SHA384DigestType is the DS digest algorithm using SHA-384
+	SHA384DigestType DigestType = 4
+)
+
+// SHA1NSEC3Hash is the only NSEC3 hash algorithm, SHA-1
+const SHA1NSEC3Hash uint8 = 1
+
+// OptOutFlag marks a NSEC3 record as possibly covering unsigned delegations
+const OptOutFlag uint8 = 0x01
+
+// base32Hex encodes the NSEC3 hashes (RFC 5155 section 3.3)
+var base32Hex = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// DigestType is the algorithm of the digest of a DS record
+type DigestType uint8
+
+// DNSKEY is the data of a DNSKEY resource record (RFC 4034 section 2). It has
+// the layout of KEY data
+type DNSKEY KEY
+
+// ToBytes returns the byte array form of the DNSKEY data
+func (k *DNSKEY) ToBytes() []byte {
+	return (*KEY)(k).ToBytes()
+}
+
+// KeyTag returns the tag identifying the key in RRSIG and DS records
+func (k *DNSKEY) KeyTag() uint16 {
+	return keyTag(k.ToBytes())
+}
+
+func (k *DNSKEY) String() string {
+	return fmt.Sprintf("%d %d %d %s", k.Flags, k.Protocol, uint8(k.Algorithm),
+		base64.StdEncoding.EncodeToString(k.PublicKey))
+}
+
+// DNSKEY returns the data of a DNSKEY or CDNSKEY resource record
+func (rr ResourceRecord) DNSKEY() (DNSKEY, error) {
+	if rr.Type != DNSKEYType && rr.Type != CDNSKEYType {
+		return DNSKEY{}, fmt.Errorf("resource record is not a DNSKEY record. type=%s", rr.Type)
+	}
+
+	k, err := keyFromBytes(rr.Data)
+	return DNSKEY(k), err
+}
+
+// RRSIG is the data of a RRSIG resource record (RFC 4034 section 3). It has the
+// layout of SIG data
+type RRSIG SIG
+
+// ToBytes returns the byte array form of the RRSIG data
+func (s *RRSIG) ToBytes() []byte {
+	return (*SIG)(s).ToBytes()
+}
+
+func (s *RRSIG) String() string {
+	fields := []string{
+		typeToString(s.TypeCovered),
+		fmt.Sprintf("%d", uint8(s.Algorithm)),
+		fmt.Sprintf("%d", s.Labels),
+		fmt.Sprintf("%d", s.OriginalTTL),
+		timeToString(s.Expiration),
+		timeToString(s.Inception),
+		fmt.Sprintf("%d", s.KeyTag),
+		nameToString(s.SignerName),
+		base64.StdEncoding.EncodeToString(s.Signature),
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// RRSIG returns the data of a RRSIG resource record
+func (rr ResourceRecord) RRSIG() (RRSIG, error) {
+	if rr.Type != RRSIGType {
+		return RRSIG{}, fmt.Errorf("resource record is not a RRSIG record. type=%s", rr.Type)
+	}
+
+	s, err := sigFromBytes(rr.Data)
+	return RRSIG(s), err
+}
+
+// DS is the data of a DS resource record (RFC 4034 section 5), holding the
+// digest of a DNSKEY of the child zone
+type DS struct {
+	KeyTag     uint16
+	Algorithm  Algorithm
+	DigestType DigestType
+	Digest     []byte
+}
+
+// ToBytes returns the byte array form of the DS data
+func (d *DS) ToBytes() []byte {
+	data := make([]byte, 0, 4+len(d.Digest))
+
+	data = appendUint16(data, d.KeyTag)
+	data = append(data, byte(d.Algorithm), byte(d.DigestType))
+	data = append(data, d.Digest...)
+
+	return data
+}
+
+func (d *DS) String() string {
+	return fmt.Sprintf("%d %d %d %s", d.KeyTag, uint8(d.Algorithm), uint8(d.DigestType),
+		strings.ToUpper(hex.EncodeToString(d.Digest)))
+}
+
+// DS returns the data of a DS or CDS resource record
+func (rr ResourceRecord) DS() (DS, error) {
+	if rr.Type != DSType && rr.Type != CDSType {
+		return DS{}, fmt.Errorf("resource record is not a DS record. type=%s", rr.Type)
+	}
+
+	if len(rr.Data) < 4 {
+		return DS{}, fmt.Errorf("failed to parse DS data, invalid length %d", len(rr.Data))
+	}
+
+	return DS{
+		KeyTag:     catBytes(rr.Data[0], rr.Data[1]),
+		Algorithm:  Algorithm(rr.Data[2]),
+		DigestType: DigestType(rr.Data[3]),
+		Digest:     rr.Data[4:],
+	}, nil
+}
+
+// NSEC is the data of a NSEC resource record (RFC 4034 section 4), linking a
+// name to the next name of the zone in canonical order
+type NSEC struct {
+	NextDomain Name
+	// Types lists the types of the records owned by the name
+	Types []Type
+}
+
+// ToBytes returns the byte array form of the NSEC data
+func (n *NSEC) ToBytes() []byte {
+	return append(n.NextDomain.ToBytes(), typeBitmapToBytes(n.Types)...)
+}
+
+func (n *NSEC) String() string {
+	return strings.Join(append([]string{nameToString(n.NextDomain)}, typesToStrings(n.Types)...), " ")
+}
+
+// NSEC returns the data of a NSEC resource record
+func (rr ResourceRecord) NSEC() (NSEC, error) {
+	if rr.Type != NSECType {
+		return NSEC{}, fmt.Errorf("resource record is not a NSEC record. type=%s", rr.Type)
+	}
+
+	next := Name{}
+	bytesRead, err := next.fromBytes(rr.Data, 0)
+	if err != nil {
+		return NSEC{}, err
+	}
+
+	types, err := typeBitmapFromBytes(rr.Data[bytesRead:])
+	if err != nil {
+		return NSEC{}, err
+	}
+
+	return NSEC{NextDomain: next, Types: types}, nil
+}
+
+// NSEC3 is the data of a NSEC3 resource record (RFC 5155 section 3), linking the
+// hash of a name to the next hash of the zone
+type NSEC3 struct {
+	HashAlgorithm uint8
+	Flags         uint8
+	Iterations    uint16
+	Salt          []byte
+	// NextHashedOwner is the raw hash of the next name, its base32hex form
+	// being the first label of the owner of the next NSEC3 record
+	NextHashedOwner []byte
+	// Types lists the types of the records owned by the name
+	Types []Type
+}
+
+// ToBytes returns the byte array form of the NSEC3 data
+func (n *NSEC3) ToBytes() []byte {
+	data := nsec3ParamsToBytes(n.HashAlgorithm, n.Flags, n.Iterations, n.Salt)
+	data = append(data, byte(len(n.NextHashedOwner)))
+	data = append(data, n.NextHashedOwner...)
+	data = append(data, typeBitmapToBytes(n.Types)...)
+
+	return data
+}
+
+func (n *NSEC3) String() string {
+	fields := []string{
+		fmt.Sprintf("%d", n.HashAlgorithm),
+		fmt.Sprintf("%d", n.Flags),
+		fmt.Sprintf("%d", n.Iterations),
+		saltToString(n.Salt),
+		strings.ToLower(base32Hex.EncodeToString(n.NextHashedOwner)),
+	}
+
+	return strings.Join(append(fields, typesToStrings(n.Types)...), " ")
+}
+
+// NSEC3 returns the data of a NSEC3 resource record
+func (rr ResourceRecord) NSEC3() (NSEC3, error) {
+	if rr.Type != NSEC3Type {
+		return NSEC3{}, fmt.Errorf("resource record is not a NSEC3 record. type=%s", rr.Type)
+	}
+
+	params, offset, err := nsec3ParamsFromBytes(rr.Data)
+	if err != nil {
+		return NSEC3{}, err
+	}
+
+	if offset >= len(rr.Data) || offset+1+int(rr.Data[offset]) > len(rr.Data) {
+		return NSEC3{}, fmt.Errorf("failed to parse NSEC3 data, invalid length %d", len(rr.Data))
+	}
+	hashLength := int(rr.Data[offset])
+	offset++
+
+	types, err := typeBitmapFromBytes(rr.Data[offset+hashLength:])
+	if err != nil {
+		return NSEC3{}, err
+	}
+
+	return NSEC3{
+		HashAlgorithm:   params.HashAlgorithm,
+		Flags:           params.Flags,
+		Iterations:      params.Iterations,
+		Salt:            params.Salt,
+		NextHashedOwner: rr.Data[offset : offset+hashLength],
+		Types:           types,
+	}, nil
+}
+
+// NSEC3PARAM is the data of a NSEC3PARAM resource record (RFC 5155 section 4),
+// holding the parameters used to hash the names of the zone
+type NSEC3PARAM struct {
+	HashAlgorithm uint8
+	Flags         uint8
+	Iterations    uint16
+	Salt          []byte
+}
+
+// ToBytes returns the byte array form of the NSEC3PARAM data
+func (p *NSEC3PARAM) ToBytes() []byte {
+	return nsec3ParamsToBytes(p.HashAlgorithm, p.Flags, p.Iterations, p.Salt)
+}
+
+func (p *NSEC3PARAM) String() string {
+	return fmt.Sprintf("%d %d %d %s", p.HashAlgorithm, p.Flags, p.Iterations, saltToString(p.Salt))
+}
+
+// NSEC3PARAM returns the data of a NSEC3PARAM resource record
+func (rr ResourceRecord) NSEC3PARAM() (NSEC3PARAM, error) {
+	if rr.Type != NSEC3PARAMType {
+		return NSEC3PARAM{}, fmt.Errorf("resource record is not a NSEC3PARAM record. type=%s", rr.Type)
+	}
+
+	params, offset, err := nsec3ParamsFromBytes(rr.Data)
+	if err != nil {
+		return NSEC3PARAM{}, err
+	}
+
+	if offset != len(rr.Data) {
+		return NSEC3PARAM{}, fmt.Errorf("failed to parse NSEC3PARAM data, invalid length %d", len(rr.Data))
+	}
+
+	return params, nil
+}
+
+func nsec3ParamsToBytes(hashAlgorithm uint8, flags uint8, iterations uint16, salt []byte) []byte {
+	data := make([]byte, 0, 5+len(salt))
+
+	data = append(data, hashAlgorithm, flags)
+	data = appendUint16(data, iterations)
+	data = append(data, byte(len(salt)))
+	data = append(data, salt...)
+
+	return data
+}
+
+// nsec3ParamsFromBytes parses the fields NSEC3 and NSEC3PARAM data start with,
+// returning the number of bytes read
+func nsec3ParamsFromBytes(data []byte) (NSEC3PARAM, int, error) {
+	if len(data) < 5 || len(data) < 5+int(data[4]) {
+		return NSEC3PARAM{}, 0, fmt.Errorf("failed to parse NSEC3 parameters, invalid length %d", len(data))
+	}
+
+	saltLength := int(data[4])
+	return NSEC3PARAM{
+		HashAlgorithm: data[0],
+		Flags:         data[1],
+		Iterations:    catBytes(data[2], data[3]),
+		Salt:          data[5 : 5+saltLength],
+	}, 5 + saltLength, nil
+}
+
+// typeBitmapToBytes encodes the types as the windowed bitmap of NSEC and NSEC3
+// records (RFC 4034 section 4.1.2)
+func typeBitmapToBytes(types []Type) []byte {
+	sorted := make([]Type, len(types))
+	copy(sorted, types)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	data := make([]byte, 0)
+	var bitmap []byte
+	window := -1
+	flush := func() {
+		if window >= 0 {
+			data = append(data, byte(window), byte(len(bitmap)))
+			data = append(data, bitmap...)
+		}
+	}
+
+	for _, t := range sorted {
+		if int(t>>8) != window {
+			flush()
+			window = int(t >> 8)
+			bitmap = make([]byte, 0, 32)
+		}
+
+		index := int(t&0xFF) / 8
+		for len(bitmap) <= index {
+			bitmap = append(bitmap, 0)
+		}
+		bitmap[index] |= 0x80 >> (t & 0x7)
+	}
+	flush()
+
+	return data
+}
+
+func typeBitmapFromBytes(data []byte) ([]Type, error) {
+	types := make([]Type, 0)
+	previous := -1
+
+	for offset := 0; offset < len(data); {
+		if offset+2 > len(data) {
+			return nil, fmt.Errorf("failed to parse type bitmap, unexpected end of data. offset=%d", offset)
+		}
+
+		window, length := int(data[offset]), int(data[offset+1])
+		offset += 2
+		if window <= previous || length == 0 || length > 32 || offset+length > len(data) {
+			return nil, fmt.Errorf("failed to parse type bitmap, invalid window %d of length %d", window, length)
+		}
+		previous = window
+
+		for i, b := range data[offset : offset+length] {
+			for bit := 0; bit < 8; bit++ {
+				if b&(0x80>>bit) != 0 {
+					types = append(types, Type(window<<8|i*8+bit))
+				}
+			}
+		}
+		offset += length
+	}
+
+	return types, nil
+}
+
+// typeToString returns the presentation form of a type, using the generic
+// TYPE notation of RFC 3597 for unknown types
+func typeToString(t Type) string {
+	if s := t.String(); s != "Unknown" {
+		return s
+	}
+
+	return fmt.Sprintf("TYPE%d", uint16(t))
+}
+
+func typesToStrings(types []Type) []string {
+	s := make([]string, 0, len(types))
+	for _, t := range types {
+		s = append(s, typeToString(t))
+	}
+
+	return s
+}
+
+// timeToString returns the presentation form of a signature time
+func timeToString(t uint32) string {
+	return time.Unix(int64(t), 0).UTC().Format("20060102150405")
+}
+
+func saltToString(salt []byte) string {
+	if len(salt) == 0 {
+		return "-"
+	}
+
+	return strings.ToUpper(hex.EncodeToString(salt))
+}
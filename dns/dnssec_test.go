@@ -0,0 +1,129 @@
+package dns_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+// rfc4034Key is the DNSKEY of the example of RFC 4034 section 5.4
+const rfc4034Key = "AQOeiiR0GOMYkDshWoSKz9XzfwJr1AYtsmx3TGkJaNXVbfi/2pHm822aJ5iI9BMzNXxeYCmZDRD99WYwYqUSdjMm" +
+	"mAphXdvxegXd/M5+X7OrzKBaMbCVdFLUUh6DhweJBjEVv5f2wwjM9XzcnOf+EPbtG9DMBmADjFDc2w/rljwvFw=="
+
+func TestDNSKEY(t *testing.T) {
+	publicKey, err := base64.StdEncoding.DecodeString(rfc4034Key)
+	if err != nil {
+		t.Fatalf("DecodeString failed with error %s", err.Error())
+	}
+
+	key := dns.DNSKEY{Flags: dns.ZoneKeyFlag, Protocol: 3, Algorithm: 5, PublicKey: publicKey}
+	if key.KeyTag() != 60485 {
+		t.Fatalf("unexpected key tag. actual=%d expected=%d", key.KeyTag(), 60485)
+	}
+
+	rr := dns.NewResourceRecord(mustName(t, "dskey.example.com"), dns.DNSKEYType, dns.INClass, 86400, key.ToBytes())
+	parsed, err := rr.DNSKEY()
+	if err != nil {
+		t.Fatalf("DNSKEY failed with error %s", err.Error())
+	}
+
+	if parsed.String() != "256 3 5 "+rfc4034Key {
+		t.Fatalf("unexpected presentation format. actual=%s", parsed.String())
+	}
+}
+
+func TestNSEC(t *testing.T) {
+	// RFC 4034 section 4.3
+	nsec := dns.NSEC{
+		NextDomain: mustName(t, "host.example.com"),
+		Types:      []dns.Type{dns.AType, dns.MXType, dns.RRSIGType, dns.NSECType, dns.Type(1234)},
+	}
+
+	expected := []byte{
+		0x04, 'h', 'o', 's', 't', 0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x03, 'c', 'o', 'm', 0x00,
+		0x00, 0x06, 0x40, 0x01, 0x00, 0x00, 0x00, 0x03,
+		0x04, 0x1b, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20,
+	}
+	if !bytes.Equal(nsec.ToBytes(), expected) {
+		t.Fatalf("unexpected NSEC data. actual=%v", nsec.ToBytes())
+	}
+
+	rr := dns.NewResourceRecord(mustName(t, "alfa.example.com"), dns.NSECType, dns.INClass, 86400, expected)
+	parsed, err := rr.NSEC()
+	if err != nil {
+		t.Fatalf("NSEC failed with error %s", err.Error())
+	}
+
+	if parsed.String() != "host.example.com. A MX RRSIG NSEC TYPE1234" {
+		t.Fatalf("unexpected presentation format. actual=%s", parsed.String())
+	}
+}
+
+func TestDNSSECPresentationFormat(t *testing.T) {
+	var cases = []struct {
+		rr       dns.ResourceRecord
+		expected string
+	}{
+		{
+			dns.NewResourceRecord(mustName(t, "example.com"), dns.DSType, dns.INClass, 3600,
+				[]byte{0xEC, 0x45, 5, 1, 0x2B, 0xB1, 0x83, 0xAF}),
+			"60485 5 1 2BB183AF",
+		},
+		{
+			dns.NewResourceRecord(mustName(t, "example.com"), dns.NSEC3PARAMType, dns.INClass, 0,
+				[]byte{1, 0, 0, 12, 4, 0xAA, 0xBB, 0xCC, 0xDD}),
+			"1 0 12 AABBCCDD",
+		},
+		{
+			dns.NewResourceRecord(mustName(t, "example.com"), dns.NSEC3Type, dns.INClass, 3600,
+				[]byte{1, 1, 0, 12, 0, 5, 0x16, 0x6C, 0xC9, 0x8D, 0x4E, 0, 1, 0x40}),
+			"1 1 12 - 2pmcj3ae A",
+		},
+		{
+			dns.NewResourceRecord(mustName(t, "example.com"), dns.RRSIGType, dns.INClass, 3600,
+				append([]byte{0, 1, 13, 2, 0, 0, 0x0E, 0x10, 0x6B, 0xD5, 0x20, 0x80, 0x69, 0xCC, 0x60, 0x00,
+					0x30, 0x39, 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}, 0xAB, 0xCD)),
+			"A 13 2 3600 20270501000000 20260401000000 12345 example.com. q80=",
+		},
+	}
+
+	for _, c := range cases {
+		var actual string
+		switch c.rr.Type {
+		case dns.DSType:
+			data, err := c.rr.DS()
+			if err != nil {
+				t.Fatalf("DS failed with error %s", err.Error())
+			}
+			actual = data.String()
+		case dns.NSEC3PARAMType:
+			data, err := c.rr.NSEC3PARAM()
+			if err != nil {
+				t.Fatalf("NSEC3PARAM failed with error %s", err.Error())
+			}
+			actual = data.String()
+		case dns.NSEC3Type:
+			data, err := c.rr.NSEC3()
+			if err != nil {
+				t.Fatalf("NSEC3 failed with error %s", err.Error())
+			}
+			actual = data.String()
+			if !bytes.Equal(data.ToBytes(), c.rr.Data) {
+				t.Fatalf("unexpected NSEC3 data. actual=%v", data.ToBytes())
+			}
+		case dns.RRSIGType:
+			data, err := c.rr.RRSIG()
+			if err != nil {
+				t.Fatalf("RRSIG failed with error %s", err.Error())
+			}
+			actual = data.String()
+		}
+
+		if actual != c.expected {
+			t.Fatalf("unexpected presentation format. type=%s actual=%s expected=%s", c.rr.Type, actual, c.expected)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package dns
+
+import "fmt"
+
+// defaultEDNSUDPSize is the UDP payload size advertised by the OPT records
+// built by the package, small enough to avoid IP fragmentation
+const defaultEDNSUDPSize = 1232
+
+// doFlag is the DNSSEC OK bit of the flags of an OPT record (RFC 3225)
+const doFlag uint32 = 0x8000
+
+// EDNS holds the EDNS parameters carried by the OPT pseudo record of a message
+// (RFC 6891 section 6.1)
+type EDNS struct {
+	// UDPSize is the largest UDP payload the sender can receive
+	UDPSize uint16
+	// ExtendedRCode holds the upper 8 bits of the response code
+	ExtendedRCode uint8
+	Version       uint8
+	// DO tells the sender wants the DNSSEC records of the answers
+	DO bool
+	// Options holds the raw options of the record
+	Options []byte
+}
+
+// ToRecord returns the OPT record carrying the EDNS parameters
+func (e *EDNS) ToRecord() ResourceRecord {
+	ttl := uint32(e.ExtendedRCode)<<24 | uint32(e.Version)<<16
+	if e.DO {
+		ttl |= doFlag
+	}
+
+	root, _ := NewName(".")
+	return NewResourceRecord(root, OPTType, Class(e.UDPSize), int32(ttl), e.Options)
+}
+
+// EDNS returns the EDNS parameters of an OPT record
+func (rr ResourceRecord) EDNS() (EDNS, error) {
+	if rr.Type != OPTType {
+		return EDNS{}, fmt.Errorf("resource record is not a OPT record. type=%s", rr.Type)
+	}
+
+	ttl := uint32(rr.TTL)
+	return EDNS{
+		UDPSize:       uint16(rr.Class),
+		ExtendedRCode: uint8(ttl >> 24),
+		Version:       uint8(ttl >> 16),
+		DO:            ttl&doFlag != 0,
+		Options:       rr.Data,
+	}, nil
+}
+
+// EDNS returns the EDNS parameters of the message, and false if the message has
+// no OPT record
+func (m *Message) EDNS() (EDNS, bool) {
+	for _, rr := range m.Additional {
+		if rr.Type == OPTType {
+			e, err := rr.EDNS()
+			return e, err == nil
+		}
+	}
+
+	return EDNS{}, false
+}
+
+// maxUDPSize returns the largest response the sender of the request can receive
+// over UDP
+func maxUDPSize(r *Message) int {
+	e, ok := r.EDNS()
+	switch {
+	case !ok || int(e.UDPSize) < maxUDPMessageSize:
+		return maxUDPMessageSize
+	case e.UDPSize > defaultEDNSUDPSize:
+		return defaultEDNSUDPSize
+	default:
+		return int(e.UDPSize)
+	}
+}
@@ -0,0 +1,607 @@
+package dns
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMaxFailures is the number of consecutive failures after which an
+	// upstream is considered down
+	defaultMaxFailures = 3
+	// defaultHealthCheckInterval is the delay between two probes of the
+	// upstreams considered down
+	defaultHealthCheckInterval = 10 * time.Second
+	// defaultPenaltyHalfLife is the time it takes for the failure rate of an
+	// upstream to halve
+	defaultPenaltyHalfLife = 30 * time.Second
+	// movingAverageWeight is the weight of a new sample in the smoothed RTT
+	// and failure rate of an upstream, as done for the SRTT of TCP (RFC 6298)
+	movingAverageWeight = 0.125
+)
+
+// Protocol is the transport used to send queries to an upstream
+type Protocol int
+
+const (
+	// PlainProtocol sends queries over UDP, retrying over TCP when the
+	// response is truncated
+	PlainProtocol Protocol = iota
+	// TLSProtocol sends queries over TLS (RFC 7858)
+	TLSProtocol
+	// HTTPSProtocol sends queries over HTTPS (RFC 8484)
+	HTTPSProtocol
+)
+
+func (p Protocol) String() string {
+	switch p {
+	case PlainProtocol:
+		return "udp"
+	case TLSProtocol:
+		return "tls"
+	case HTTPSProtocol:
+		return "https"
+	default:
+		return fmt.Sprintf("%d", p)
+	}
+}
+
+// SelectionPolicy is the order upstreams are tried in
+type SelectionPolicy int
+
+const (
+	// OrderedSelection tries the upstreams in the configured order
+	OrderedSelection SelectionPolicy = iota
+	// FastestSelection tries first the upstreams with the lowest smoothed RTT,
+	// each failure rate point costing a timeout. Upstreams not measured yet
+	// are tried first
+	FastestSelection
+)
+
+func (p SelectionPolicy) String() string {
+	switch p {
+	case OrderedSelection:
+		return "ordered"
+	case FastestSelection:
+		return "fastest"
+	default:
+		return fmt.Sprintf("%d", p)
+	}
+}
+
+// Upstream is a server queries are forwarded to
+type Upstream struct {
+	Protocol Protocol
+	// Addr is the address of the server, ie: "192.0.2.1:53", or the URL of
+	// its DNS over HTTPS endpoint
+	Addr string
+}
+
+// ParseUpstream parses an upstream from an address, ie: "192.0.2.1",
+// "udp://192.0.2.1:53", "tls://192.0.2.1:853" or
+// "https://dns.example/dns-query". The port defaults to 53, or 853 over TLS
+func ParseUpstream(s string) (Upstream, error) {
+	if strings.HasPrefix(s, "https://") {
+		if _, err := url.Parse(s); err != nil {
+			return Upstream{}, fmt.Errorf("failed to parse upstream %s. err=%s", s, err.Error())
+		}
+		return Upstream{Protocol: HTTPSProtocol, Addr: s}, nil
+	}
+
+	u := Upstream{Protocol: PlainProtocol}
+	port := "53"
+	if i := strings.Index(s, "://"); i >= 0 {
+		switch s[:i] {
+		case "udp":
+		case "tls":
+			u.Protocol = TLSProtocol
+			port = "853"
+		default:
+			return Upstream{}, fmt.Errorf("failed to parse upstream %s, unknown scheme", s)
+		}
+		s = s[i+3:]
+	}
+
+	if s == "" {
+		return Upstream{}, fmt.Errorf("failed to parse upstream, missing address")
+	}
+
+	if host, p, err := net.SplitHostPort(s); err == nil {
+		u.Addr = net.JoinHostPort(host, p)
+	} else {
+		u.Addr = net.JoinHostPort(strings.Trim(s, "[]"), port)
+	}
+
+	return u, nil
+}
+
+func (u Upstream) String() string {
+	if u.Protocol == HTTPSProtocol {
+		return u.Addr
+	}
+
+	return u.Protocol.String() + "://" + u.Addr
+}
+
+// ExchangeUpstream sends the message to the upstream over its protocol and
+// returns its response
+func (c *Client) ExchangeUpstream(m *Message, u Upstream) (Message, error) {
+	switch u.Protocol {
+	case TLSProtocol:
+		return c.ExchangeTLS(m, u.Addr)
+	case HTTPSProtocol:
+		return c.ExchangeHTTPS(m, u.Addr)
+	default:
+		return c.Exchange(m, u.Addr)
+	}
+}
+
+// Forwarder answers queries by forwarding them to upstream servers, from its
+// cache when it has one. Upstreams are tried in the order of the selection
+// policy until one of them gives a response other than SERVFAIL or REFUSED.
+// Upstreams failing MaxFailures times in a row are considered down: they are
+// tried last, and probed in the background once the forwarder is started,
+// until they answer again
+type Forwarder struct {
+	Upstreams []Upstream
+	Selection SelectionPolicy
+	// Race sends the queries to the first two upstreams at once, using the
+	// first response other than SERVFAIL or REFUSED
+	Race bool
+	// PenaltyHalfLife is the time it takes for the failure rate of an
+	// upstream to halve, so that recovering upstreams are tried again.
+	// Defaults to 30 seconds
+	PenaltyHalfLife time.Duration
+	// Client sends the queries to the upstreams
+	Client Client
+	// Cache answers the queries it holds a response to and stores the
+	// responses of the upstreams. It may be nil
+	Cache *Cache
+	// MaxFailures is the number of consecutive failures after which an
+	// upstream is considered down. Defaults to 3
+	MaxFailures int
+	// HealthCheckInterval is the delay between two probes of the upstreams
+	// considered down. Defaults to 10 seconds
+	HealthCheckInterval time.Duration
+	// Now returns the current time, against which penalties decay. Defaults
+	// to time.Now
+	Now func() time.Time
+
+	mu sync.Mutex
+	// health is indexed like Upstreams
+	health []upstreamHealth
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// UpstreamStatus describes the health of an upstream
+type UpstreamStatus struct {
+	Upstream Upstream
+	// Failures is the number of consecutive failures of the upstream
+	Failures int
+	// TotalFailures is the number of failures of the upstream
+	TotalFailures uint64
+	Down          bool
+	// LastError describes the last failure of the upstream
+	LastError string
+	// SRTT is the smoothed round-trip time of the upstream, zero until
+	// measured
+	SRTT time.Duration
+	// FailureRate is the moving average of the failures of the upstream,
+	// between 0 and 1
+	FailureRate float64
+}
+
+type upstreamHealth struct {
+	failures      int
+	totalFailures uint64
+	lastError     string
+	srtt          time.Duration
+	// failureRate is the moving average of the failures as of updated
+	failureRate float64
+	updated     time.Time
+}
+
+// decay returns the failure rate decayed from its last update to now
+func (h *upstreamHealth) decay(now time.Time, halfLife time.Duration) float64 {
+	if h.updated.IsZero() || !now.After(h.updated) {
+		return h.failureRate
+	}
+
+	return h.failureRate * math.Exp2(-float64(now.Sub(h.updated))/float64(halfLife))
+}
+
+func (f *Forwarder) maxFailures() int {
+	if f.MaxFailures == 0 {
+		return defaultMaxFailures
+	}
+
+	return f.MaxFailures
+}
+
+func (f *Forwarder) penaltyHalfLife() time.Duration {
+	if f.PenaltyHalfLife == 0 {
+		return defaultPenaltyHalfLife
+	}
+
+	return f.PenaltyHalfLife
+}
+
+func (f *Forwarder) now() time.Time {
+	if f.Now == nil {
+		return time.Now()
+	}
+
+	return f.Now()
+}
+
+func (f *Forwarder) healthCheckInterval() time.Duration {
+	if f.HealthCheckInterval == 0 {
+		return defaultHealthCheckInterval
+	}
+
+	return f.HealthCheckInterval
+}
+
+// ServeDNS implements the Handler interface
+func (f *Forwarder) ServeDNS(w ResponseWriter, r *Message) {
+	if r.Header.Opcode != QueryOpcode || r.Header.QuestionCount != 1 {
+		resp := NewResponse(r)
+		resp.Header.RCode = NotImplementedRCode
+		w.WriteMessage(resp)
+		return
+	}
+
+	// the responses are cached whatever the DO bit of the client, so they are
+	// always requested with their DNSSEC records, stripped for the clients that
+	// did not ask for them
+	q := dnssecRequest(r)
+	var resp Message
+	var err error
+	if f.Cache != nil && r.Question.Type != AXFRQType && r.Question.Type != IXFRQType {
+		resp, err = f.Cache.resolve(r.Question, func() (Message, error) { return f.Forward(&q) })
+	} else {
+		resp, err = f.Forward(&q)
+	}
+
+	if err != nil {
+		failure := NewResponse(r)
+		failure.Header.RA = true
+		failure.Header.RCode = ServerFailureRCode
+		w.WriteMessage(failure)
+		return
+	}
+
+	resp.Header.ID = r.Header.ID
+	resp.Header.RD = r.Header.RD
+	resp.Header.RA = true
+	resp.Question = r.Question
+
+	e, edns := r.EDNS()
+	upstream, _ := resp.EDNS()
+	if !e.DO {
+		resp.Answers = withoutDNSSEC(resp.Answers, Type(r.Question.Type))
+		resp.Authority = withoutDNSSEC(resp.Authority, 0)
+		resp.Additional = withoutDNSSEC(resp.Additional, 0)
+	}
+
+	// the OPT record of the upstream answered the DO bit of the forwarder
+	additional := make([]ResourceRecord, 0, len(resp.Additional)+1)
+	for _, rr := range resp.Additional {
+		if rr.Type != OPTType {
+			additional = append(additional, rr)
+		}
+	}
+	if edns {
+		opt := EDNS{UDPSize: defaultEDNSUDPSize, ExtendedRCode: upstream.ExtendedRCode, DO: e.DO}
+		additional = append(additional, opt.ToRecord())
+	}
+	resp.Additional = additional
+
+	w.WriteMessage(&resp)
+}
+
+// dnssecRequest returns a copy of the request asking for the DNSSEC records of
+// the answers (RFC 3225), the other EDNS parameters of the client being kept
+func dnssecRequest(r *Message) Message {
+	q := *r
+	e, _ := r.EDNS()
+	e.UDPSize, e.DO = defaultEDNSUDPSize, true
+
+	q.Additional = make([]ResourceRecord, 0, len(r.Additional)+1)
+	for _, rr := range r.Additional {
+		if rr.Type != OPTType {
+			q.Additional = append(q.Additional, rr)
+		}
+	}
+	q.Additional = append(q.Additional, e.ToRecord())
+	return q
+}
+
+// withoutDNSSEC returns the records but the RRSIG, NSEC and NSEC3 records, which
+// are only sent to the clients setting the DO bit unless they asked for that
+// type (RFC 4035 section 3.2.1)
+func withoutDNSSEC(records []ResourceRecord, queried Type) []ResourceRecord {
+	kept := make([]ResourceRecord, 0, len(records))
+	for _, rr := range records {
+		switch rr.Type {
+		case RRSIGType, NSECType, NSEC3Type:
+			if rr.Type != queried {
+				continue
+			}
+		}
+		kept = append(kept, rr)
+	}
+
+	return kept
+}
+
+// Forward sends the request to the upstreams and returns the first response
+// other than SERVFAIL or REFUSED, holding the ID of the request. The last
+// response is returned if all the upstreams failed to answer
+func (f *Forwarder) Forward(r *Message) (Message, error) {
+	q := *r
+	q.Header.QR = false
+	q.Additional = make([]ResourceRecord, 0, len(r.Additional))
+	for _, rr := range r.Additional {
+		// the signatures of the request are specific to the client
+		if rr.Type != TSIGType && rr.Type != SIGType {
+			q.Additional = append(q.Additional, rr)
+		}
+	}
+
+	var last *Message
+	var lastErr error
+	order := f.order()
+	if f.Race && len(order) >= 2 {
+		resp, err := f.race(q, order[:2])
+		if err == nil {
+			resp.Header.ID = r.Header.ID
+			return resp, nil
+		}
+
+		if resp.Header.QR {
+			last = &resp
+		}
+		lastErr = err
+		order = order[2:]
+	}
+
+	for _, i := range order {
+		resp, err := f.exchange(q, i)
+		if err == nil {
+			resp.Header.ID = r.Header.ID
+			return resp, nil
+		}
+
+		if resp.Header.QR {
+			last = &resp
+		}
+		lastErr = err
+	}
+
+	if last != nil {
+		last.Header.ID = r.Header.ID
+		return *last, nil
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no upstream configured")
+	}
+	return Message{}, fmt.Errorf("failed to forward %s %s. err=%s", r.Question.Name.GetName(), r.Question.Type,
+		lastErr.Error())
+}
+
+// race sends the query to the upstreams at once and returns the first response
+// other than SERVFAIL or REFUSED. The slower exchanges still update the health
+// of their upstream once done
+func (f *Forwarder) race(q Message, upstreams []int) (Message, error) {
+	type result struct {
+		resp Message
+		err  error
+	}
+
+	results := make(chan result, len(upstreams))
+	for _, i := range upstreams {
+		go func(i int) {
+			resp, err := f.exchange(q, i)
+			results <- result{resp: resp, err: err}
+		}(i)
+	}
+
+	var last result
+	for range upstreams {
+		last = <-results
+		if last.err == nil {
+			return last.resp, nil
+		}
+	}
+
+	return last.resp, last.err
+}
+
+// exchange sends the query to the upstream under a new random ID and records
+// the outcome in its health. Responses other than SERVFAIL or REFUSED are
+// returned along with the error
+func (f *Forwarder) exchange(q Message, i int) (Message, error) {
+	q.Header.ID = 0
+	start := time.Now()
+	resp, err := f.Client.ExchangeUpstream(&q, f.Upstreams[i])
+	if err == nil && (resp.Header.RCode == ServerFailureRCode || resp.Header.RCode == RefusedRCode) {
+		err = fmt.Errorf("upstream failed. rcode=%s", resp.Header.RCode)
+	}
+
+	if err != nil {
+		f.failed(i, err)
+		return resp, err
+	}
+
+	f.succeeded(i, time.Since(start))
+	return resp, nil
+}
+
+// Query forwards a recursive query for the name and type. It implements the
+// Querier interface, so that the forwarder can refresh its cache
+func (f *Forwarder) Query(name Name, t QType) (Message, error) {
+	opt := EDNS{UDPSize: defaultEDNSUDPSize}
+	q := &Message{
+		Header:     Header{Opcode: QueryOpcode, RD: true, QuestionCount: 1},
+		Question:   Question{Name: name, Type: t, Class: INClass},
+		Additional: []ResourceRecord{opt.ToRecord()},
+	}
+
+	return f.Forward(q)
+}
+
+// Status returns the health of the upstreams
+func (f *Forwarder) Status() []UpstreamStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.initHealth()
+	now := f.now()
+	status := make([]UpstreamStatus, len(f.Upstreams))
+	for i, u := range f.Upstreams {
+		h := f.health[i]
+		status[i] = UpstreamStatus{
+			Upstream:      u,
+			Failures:      h.failures,
+			TotalFailures: h.totalFailures,
+			Down:          h.failures >= f.maxFailures(),
+			LastError:     h.lastError,
+			SRTT:          h.srtt,
+			FailureRate:   h.decay(now, f.penaltyHalfLife()),
+		}
+	}
+
+	return status
+}
+
+// Start starts probing the upstreams considered down in the background
+func (f *Forwarder) Start() {
+	f.stop = make(chan struct{})
+	f.done = make(chan struct{})
+	go f.run()
+}
+
+// Stop stops probing the upstreams
+func (f *Forwarder) Stop() {
+	close(f.stop)
+	<-f.done
+}
+
+func (f *Forwarder) run() {
+	defer close(f.done)
+
+	for {
+		select {
+		case <-time.After(f.healthCheckInterval()):
+			f.CheckHealth()
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// CheckHealth probes the upstreams considered down with a query for the NS
+// records of the root zone. The upstreams answering it are considered up again
+func (f *Forwarder) CheckHealth() {
+	root, _ := NewName(".")
+	for i, status := range f.Status() {
+		if !status.Down {
+			continue
+		}
+
+		q := &Message{
+			Header:   Header{Opcode: QueryOpcode, RD: true, QuestionCount: 1},
+			Question: Question{Name: root, Type: QType(NSType), Class: INClass},
+		}
+		start := time.Now()
+		resp, err := f.Client.ExchangeUpstream(q, status.Upstream)
+		if err == nil && resp.Header.RCode != ServerFailureRCode && resp.Header.RCode != RefusedRCode {
+			f.succeeded(i, time.Since(start))
+		}
+	}
+}
+
+// order returns the indexes of the upstreams in the order they are tried: the
+// upstreams considered up first, in the order of the selection policy, then
+// the others in the configured order
+func (f *Forwarder) order() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.initHealth()
+	up := make([]int, 0, len(f.Upstreams))
+	down := make([]int, 0)
+	for i := range f.Upstreams {
+		if f.health[i].failures >= f.maxFailures() {
+			down = append(down, i)
+		} else {
+			up = append(up, i)
+		}
+	}
+
+	if f.Selection == FastestSelection {
+		now := f.now()
+		scores := make(map[int]time.Duration, len(up))
+		for _, i := range up {
+			h := &f.health[i]
+			penalty := h.decay(now, f.penaltyHalfLife()) * float64(f.Client.timeout())
+			scores[i] = h.srtt + time.Duration(penalty)
+		}
+		sort.SliceStable(up, func(a, b int) bool { return scores[up[a]] < scores[up[b]] })
+	}
+
+	return append(up, down...)
+}
+
+func (f *Forwarder) succeeded(i int, rtt time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.initHealth()
+	h := &f.health[i]
+	h.failures = 0
+	if h.srtt == 0 {
+		h.srtt = rtt
+	} else {
+		h.srtt += time.Duration(movingAverageWeight * float64(rtt-h.srtt))
+	}
+	f.sample(h, 0)
+}
+
+func (f *Forwarder) failed(i int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.initHealth()
+	h := &f.health[i]
+	h.failures++
+	h.totalFailures++
+	h.lastError = err.Error()
+	f.sample(h, 1)
+}
+
+// sample adds the outcome of an exchange, 1 for a failure, to the decayed
+// failure rate of the upstream
+func (f *Forwarder) sample(h *upstreamHealth, failure float64) {
+	now := f.now()
+	h.failureRate = h.decay(now, f.penaltyHalfLife())
+	h.failureRate += movingAverageWeight * (failure - h.failureRate)
+	h.updated = now
+}
+
+// initHealth sizes the health of the upstreams after the upstreams
+func (f *Forwarder) initHealth() {
+	if len(f.health) != len(f.Upstreams) {
+		f.health = make([]upstreamHealth, len(f.Upstreams))
+	}
+}
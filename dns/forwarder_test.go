@@ -0,0 +1,440 @@
+package dns_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func TestParseUpstream(t *testing.T) {
+	var cases = []struct {
+		input    string
+		protocol dns.Protocol
+		addr     string
+		fails    bool
+	}{
+		{"192.0.2.1", dns.PlainProtocol, "192.0.2.1:53", false},
+		{"192.0.2.1:5353", dns.PlainProtocol, "192.0.2.1:5353", false},
+		{"udp://192.0.2.1", dns.PlainProtocol, "192.0.2.1:53", false},
+		{"tls://192.0.2.1", dns.TLSProtocol, "192.0.2.1:853", false},
+		{"tls://[2001:db8::1]:8853", dns.TLSProtocol, "[2001:db8::1]:8853", false},
+		{"2001:db8::1", dns.PlainProtocol, "[2001:db8::1]:53", false},
+		{"https://dns.example/dns-query", dns.HTTPSProtocol, "https://dns.example/dns-query", false},
+		{"quic://192.0.2.1", 0, "", true},
+		{"tls://", 0, "", true},
+	}
+
+	for i, c := range cases {
+		u, err := dns.ParseUpstream(c.input)
+		if c.fails {
+			if err == nil {
+				t.Fatalf("ParseUpstream should fail. case=%d", i)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("ParseUpstream failed. case=%d err=%s", i, err.Error())
+		}
+
+		if u.Protocol != c.protocol || u.Addr != c.addr {
+			t.Fatalf("unexpected upstream. case=%d actual=%s expected=%s://%s", i, u, c.protocol, c.addr)
+		}
+	}
+}
+
+// countingHandler counts the requests served by the handler
+func countingHandler(h dns.Handler, count *int32) dns.Handler {
+	return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		atomic.AddInt32(count, 1)
+		h.ServeDNS(w, r)
+	})
+}
+
+func TestForwarder(t *testing.T) {
+	z, err := dns.NewZone(mustName(t, "example.com"), []dns.ResourceRecord{
+		soaRecord(t, "example.com", 1),
+		nameRecord(t, "example.com", dns.NSType, "ns1.example.com"),
+		aRecord(t, "ns1.example.com", "192.0.2.53"),
+		aRecord(t, "www.example.com", "192.0.2.1"),
+	})
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+
+	var good, bad int32
+	var broken int32 = 1
+	goodAddr := startServer(t, countingHandler(&dns.ZoneHandler{Zone: z}, &good))
+	badAddr := startServer(t, countingHandler(dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		resp := dns.NewResponse(r)
+		if atomic.LoadInt32(&broken) == 1 {
+			resp.Header.RCode = dns.ServerFailureRCode
+		}
+		w.WriteMessage(resp)
+	}), &bad))
+
+	f := &dns.Forwarder{
+		Upstreams: []dns.Upstream{
+			{Protocol: dns.PlainProtocol, Addr: badAddr},
+			{Protocol: dns.PlainProtocol, Addr: goodAddr},
+		},
+		Cache:               &dns.Cache{},
+		MaxFailures:         2,
+		HealthCheckInterval: 10 * time.Millisecond,
+	}
+	addr := startServer(t, f)
+	client := dns.Client{}
+
+	var steps = []struct {
+		name  string
+		rcode dns.RCode
+		good  int32
+		bad   int32
+		down  bool
+	}{
+		{"www.example.com", dns.NoErrorRCode, 1, 1, false},
+		// the failing upstream is now considered down and tried last
+		{"ns1.example.com", dns.NoErrorRCode, 2, 2, true},
+		{"nothere.example.com", dns.NameErrorRCode, 3, 2, true},
+		// answered from the cache
+		{"www.example.com", dns.NoErrorRCode, 3, 2, true},
+		{"nothere.example.com", dns.NameErrorRCode, 3, 2, true},
+	}
+
+	for i, s := range steps {
+		q, err := dns.NewQuestion(s.name)
+		if err != nil {
+			t.Fatalf("NewQuestion failed with error %s", err.Error())
+		}
+		q.Question.Type = dns.QType(dns.AType)
+
+		// the response must hold the ID of the query
+		resp, err := client.Exchange(q, addr)
+		if err != nil {
+			t.Fatalf("Exchange failed. step=%d err=%s", i, err.Error())
+		}
+
+		if resp.Header.RCode != s.rcode || !bool(resp.Header.RA) {
+			t.Fatalf("unexpected response. step=%d rcode=%s ra=%t", i, resp.Header.RCode, bool(resp.Header.RA))
+		}
+
+		status := f.Status()
+		if atomic.LoadInt32(&good) != s.good || atomic.LoadInt32(&bad) != s.bad || status[0].Down != s.down {
+			t.Fatalf("unexpected upstream use. step=%d good=%d bad=%d down=%t", i, atomic.LoadInt32(&good),
+				atomic.LoadInt32(&bad), status[0].Down)
+		}
+	}
+
+	// the upstream recovers and is found up by the health checks
+	atomic.StoreInt32(&broken, 0)
+	f.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for f.Status()[0].Down {
+		if time.Now().After(deadline) {
+			t.Fatalf("the upstream should be considered up again")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	f.Stop()
+
+	if status := f.Status(); status[0].TotalFailures != 2 {
+		t.Fatalf("unexpected failure count. actual=%d", status[0].TotalFailures)
+	}
+
+	// SERVFAIL once all the upstreams fail
+	atomic.StoreInt32(&broken, 1)
+	addr = startServer(t, &dns.Forwarder{Upstreams: f.Upstreams[:1]})
+	q, _ := dns.NewQuestion("mail.example.com")
+	resp, err := client.Exchange(q, addr)
+	if err != nil {
+		t.Fatalf("Exchange failed with error %s", err.Error())
+	}
+
+	if resp.Header.RCode != dns.ServerFailureRCode {
+		t.Fatalf("unexpected rcode. actual=%s expected=%s", resp.Header.RCode, dns.ServerFailureRCode)
+	}
+}
+
+// dohResponseWriter answers a DNS over HTTPS request
+type dohResponseWriter struct {
+	w http.ResponseWriter
+}
+
+func (w dohResponseWriter) WriteMessage(m *dns.Message) error {
+	w.w.Header().Set("Content-Type", "application/dns-message")
+	_, err := w.w.Write(m.ToBytes())
+	return err
+}
+
+func (w dohResponseWriter) RemoteAddr() net.Addr   { return nil }
+func (w dohResponseWriter) Network() string        { return "https" }
+func (w dohResponseWriter) TSIGKeyName() string    { return "" }
+func (w dohResponseWriter) SIG0SignerName() string { return "" }
+
+// dohHandler serves the DNS over HTTPS requests with the handler
+func dohHandler(handler dns.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		m, _, err := dns.MessageFromBytes(data)
+		if err != nil || m.Header.ID != 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		handler.ServeDNS(dohResponseWriter{w: w}, &m)
+	})
+}
+
+func TestForwarderTransports(t *testing.T) {
+	z, err := dns.NewZone(mustName(t, "example.com"), []dns.ResourceRecord{
+		soaRecord(t, "example.com", 1),
+		aRecord(t, "www.example.com", "192.0.2.1"),
+	})
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+	handler := &dns.ZoneHandler{Zone: z}
+
+	doh := httptest.NewTLSServer(dohHandler(handler))
+	defer doh.Close()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", doh.TLS)
+	if err != nil {
+		t.Fatalf("failed to listen on tls. err=%s", err.Error())
+	}
+	dot := &dns.Server{Handler: handler}
+	go dot.ServeTCP(ln)
+	defer dot.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(doh.Certificate())
+
+	upstreams := []dns.Upstream{
+		{Protocol: dns.TLSProtocol, Addr: ln.Addr().String()},
+		{Protocol: dns.HTTPSProtocol, Addr: doh.URL + "/dns-query"},
+	}
+
+	for i, u := range upstreams {
+		f := &dns.Forwarder{Upstreams: []dns.Upstream{u}, Client: dns.Client{TLSConfig: &tls.Config{RootCAs: roots}}}
+		addr := startServer(t, f)
+
+		client := dns.Client{}
+		q, _ := dns.NewQuestion("www.example.com")
+		q.Question.Type = dns.QType(dns.AType)
+		resp, err := client.Exchange(q, addr)
+		if err != nil {
+			t.Fatalf("Exchange failed. case=%d err=%s", i, err.Error())
+		}
+
+		if resp.Header.RCode != dns.NoErrorRCode || len(resp.Answers) != 1 {
+			t.Fatalf("unexpected response. case=%d rcode=%s answers=%d status=%v", i, resp.Header.RCode,
+				len(resp.Answers), f.Status())
+		}
+	}
+}
+
+// delayedHandler answers after the delay, with SERVFAIL while failing is set
+func delayedHandler(delay time.Duration, failing *int32, count *int32) dns.Handler {
+	return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		atomic.AddInt32(count, 1)
+		time.Sleep(delay)
+		resp := dns.NewResponse(r)
+		if atomic.LoadInt32(failing) == 1 {
+			resp.Header.RCode = dns.ServerFailureRCode
+		}
+		w.WriteMessage(resp)
+	})
+}
+
+func TestForwarderSelection(t *testing.T) {
+	var slow, fast, fastFailing int32
+	var never int32
+	slowAddr := startServer(t, delayedHandler(50*time.Millisecond, &never, &slow))
+	fastAddr := startServer(t, delayedHandler(0, &fastFailing, &fast))
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := &dns.Forwarder{
+		Upstreams: []dns.Upstream{
+			{Protocol: dns.PlainProtocol, Addr: slowAddr},
+			{Protocol: dns.PlainProtocol, Addr: fastAddr},
+		},
+		Selection:       dns.FastestSelection,
+		Client:          dns.Client{Timeout: time.Second},
+		PenaltyHalfLife: time.Minute,
+		Now:             func() time.Time { return now },
+	}
+
+	var steps = []struct {
+		elapsed time.Duration
+		failing bool
+		slow    int32
+		fast    int32
+	}{
+		// the upstreams are first tried in order, until measured
+		{0, false, 1, 0},
+		{0, false, 1, 1},
+		{0, false, 1, 2},
+		// the fast upstream fails, its penalty makes it slower than the other
+		{0, true, 2, 3},
+		{0, false, 3, 3},
+		// the penalty decays
+		{10 * time.Minute, false, 3, 4},
+	}
+
+	for i, s := range steps {
+		now = now.Add(s.elapsed)
+		atomic.StoreInt32(&fastFailing, 0)
+		if s.failing {
+			atomic.StoreInt32(&fastFailing, 1)
+		}
+
+		if _, err := f.Query(mustName(t, "www.example.com"), dns.QType(dns.AType)); err != nil {
+			t.Fatalf("Query failed. step=%d err=%s", i, err.Error())
+		}
+
+		if atomic.LoadInt32(&slow) != s.slow || atomic.LoadInt32(&fast) != s.fast {
+			t.Fatalf("unexpected upstream use. step=%d slow=%d fast=%d", i, atomic.LoadInt32(&slow),
+				atomic.LoadInt32(&fast))
+		}
+	}
+
+	status := f.Status()
+	if status[0].SRTT < 50*time.Millisecond || status[1].SRTT >= 50*time.Millisecond || status[1].FailureRate <= 0 ||
+		status[1].FailureRate >= 0.01 {
+		t.Fatalf("unexpected status. slow=%s fast=%s rate=%f", status[0].SRTT, status[1].SRTT, status[1].FailureRate)
+	}
+}
+
+func TestForwarderRace(t *testing.T) {
+	var slow, fast, never int32
+	slowAddr := startServer(t, delayedHandler(500*time.Millisecond, &never, &slow))
+	fastAddr := startServer(t, delayedHandler(0, &never, &fast))
+
+	f := &dns.Forwarder{
+		Upstreams: []dns.Upstream{
+			{Protocol: dns.PlainProtocol, Addr: slowAddr},
+			{Protocol: dns.PlainProtocol, Addr: fastAddr},
+		},
+		Race: true,
+	}
+
+	start := time.Now()
+	if _, err := f.Query(mustName(t, "www.example.com"), dns.QType(dns.AType)); err != nil {
+		t.Fatalf("Query failed with error %s", err.Error())
+	}
+
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Fatalf("the fastest response should be used. elapsed=%s", elapsed)
+	}
+
+	// the query to the slow upstream may still be on its way
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&slow) != 1 || atomic.LoadInt32(&fast) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("both upstreams should be queried. slow=%d fast=%d", atomic.LoadInt32(&slow),
+				atomic.LoadInt32(&fast))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestExchangeHTTPSReusesConnections(t *testing.T) {
+	z := mustZone(t, "example.com", aRecord(t, "www.example.com", "192.0.2.1"))
+
+	var conns int32
+	doh := httptest.NewUnstartedServer(dohHandler(&dns.ZoneHandler{Zone: z}))
+	doh.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	doh.StartTLS()
+	defer doh.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(doh.Certificate())
+	config := &tls.Config{RootCAs: roots}
+
+	// the copies of a client made after its first exchange share its transport
+	client := &dns.Client{TLSConfig: config}
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			copied := *client
+			client = &copied
+		}
+		q, _ := dns.NewQuestion("www.example.com")
+		q.Question.Type = dns.QType(dns.AType)
+		resp, err := client.ExchangeHTTPS(q, doh.URL+"/dns-query")
+		if err != nil || len(resp.Answers) != 1 {
+			t.Fatalf("unexpected response. exchange=%d answers=%d err=%v", i, len(resp.Answers), err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Fatalf("unexpected connection count. actual=%d expected=1", n)
+	}
+}
+
+func TestForwarderDNSSECOK(t *testing.T) {
+	key := signingKey(t, "example.com", dns.ED25519Algorithm)
+	z := mustZone(t, "example.com", dnskeyRecord(t, key), aRecord(t, "www.example.com", "192.0.2.1"))
+	upstream := startServer(t, &dns.OnlineSigner{Handler: &dns.ZoneHandler{Zone: z}, Zone: z, Keys: []dns.SigningKey{key}})
+
+	f := &dns.Forwarder{Upstreams: []dns.Upstream{{Protocol: dns.PlainProtocol, Addr: upstream}}, Cache: &dns.Cache{}}
+	addr := startServer(t, f)
+	client := dns.Client{}
+
+	// the cached response is served to the clients whatever their DO bit
+	var steps = []struct {
+		name string
+		do   bool
+		edns bool
+	}{
+		{"www.example.com", false, true},
+		{"www.example.com", true, true},
+		{"nothere.example.com", true, true},
+		{"nothere.example.com", false, true},
+		{"nothere.example.com", false, false},
+	}
+
+	for i, s := range steps {
+		q := dnssecQuery(t, s.name, dns.QType(dns.AType), s.do)
+		if !s.edns {
+			q.Additional = nil
+		}
+
+		resp, err := client.Exchange(q, addr)
+		if err != nil {
+			t.Fatalf("Exchange failed. step=%d err=%s", i, err.Error())
+		}
+
+		signatures := countType(resp.Answers, dns.RRSIGType) + countType(resp.Authority, dns.RRSIGType)
+		denials := countType(resp.Authority, dns.NSECType)
+		if (signatures > 0) != s.do || (denials > 0 && !s.do) {
+			t.Fatalf("unexpected DNSSEC records. step=%d do=%t signatures=%d denials=%d", i, s.do, signatures, denials)
+		}
+
+		e, ok := resp.EDNS()
+		if ok != s.edns || e.DO != s.do || countType(resp.Additional, dns.OPTType) > 1 {
+			t.Fatalf("unexpected OPT record. step=%d edns=%t do=%t", i, ok, e.DO)
+		}
+	}
+}
@@ -9,6 +9,8 @@ const (
 	QueryOpcode  Opcode = 0
 	IQueryOpcode Opcode = 1
 	StatusOpcode Opcode = 2
+	NotifyOpcode Opcode = 4
+	UpdateOpcode Opcode = 5
 )
 
 const (
@@ -18,6 +20,11 @@ const (
 	NameErrorRCode      RCode = 3
 	NotImplementedRCode RCode = 4
 	RefusedRCode        RCode = 5
+	YXDomainRCode       RCode = 6
+	YXRRSetRCode        RCode = 7
+	NXRRSetRCode        RCode = 8
+	NotAuthRCode        RCode = 9
+	NotZoneRCode        RCode = 10
 )
 
 // QR is a flag specifing if the message is a query(0) or a response(1)
@@ -55,6 +62,16 @@ func (r RCode) String() string {
 		return "Not Implemented Rcode"
 	case RefusedRCode:
 		return "Refused Rcode"
+	case YXDomainRCode:
+		return "YXDomain Rcode"
+	case YXRRSetRCode:
+		return "YXRRSet Rcode"
+	case NXRRSetRCode:
+		return "NXRRSet Rcode"
+	case NotAuthRCode:
+		return "Not Auth Rcode"
+	case NotZoneRCode:
+		return "Not Zone Rcode"
 	default:
 		return "Unknown Rcode"
 	}
@@ -71,6 +88,10 @@ func (o Opcode) String() string {
 		return "IQuery Opcode"
 	case StatusOpcode:
 		return "Status Opcode"
+	case NotifyOpcode:
+		return "Notify Opcode"
+	case UpdateOpcode:
+		return "Update Opcode"
 	default:
 		return "Unkown Opcode"
 	}
@@ -212,6 +233,10 @@ func extractOpcode(data byte) (Opcode, error) {
 		return IQueryOpcode, nil
 	case 2:
 		return StatusOpcode, nil
+	case 4:
+		return NotifyOpcode, nil
+	case 5:
+		return UpdateOpcode, nil
 	default:
 		return QueryOpcode, fmt.Errorf("failed to parse opcode, unknown value 0x%x", data)
 	}
@@ -263,6 +288,16 @@ func extractRCode(data byte) (RCode, error) {
 		return NotImplementedRCode, nil
 	case 5:
 		return RefusedRCode, nil
+	case 6:
+		return YXDomainRCode, nil
+	case 7:
+		return YXRRSetRCode, nil
+	case 8:
+		return NXRRSetRCode, nil
+	case 9:
+		return NotAuthRCode, nil
+	case 10:
+		return NotZoneRCode, nil
 	default:
 		return NoErrorRCode, fmt.Errorf("failed to parse rcode, unknown value 0x%x", data)
 	}
@@ -0,0 +1,118 @@
+package dns
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+)
+
+// Hosts holds the static mappings between names and addresses of a hosts
+// file, ie: /etc/hosts (see hosts(5))
+type Hosts struct {
+	addrs map[string][]net.IP
+	names map[string][]string
+}
+
+// ReadHosts parses the hosts file at path. Lines holding an invalid address
+// are ignored
+func ReadHosts(path string) (*Hosts, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := &Hosts{addrs: make(map[string][]net.IP), names: make(map[string][]string)}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		ip := net.ParseIP(strings.SplitN(fields[0], "%", 2)[0])
+		if ip == nil {
+			continue
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+
+		for _, field := range fields[1:] {
+			name := strings.ToLower(strings.TrimSuffix(field, "."))
+			h.addrs[name] = append(h.addrs[name], ip)
+			h.names[ip.String()] = append(h.names[ip.String()], name)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Lookup returns the addresses of the name, in the order of the file
+func (h *Hosts) Lookup(name string) []net.IP {
+	return h.addrs[strings.ToLower(strings.TrimSuffix(name, "."))]
+}
+
+// LookupAddr returns the names of the address, the canonical name first
+func (h *Hosts) LookupAddr(ip net.IP) []string {
+	return h.names[ip.String()]
+}
+
+// records returns the A, AAAA or PTR records answering the query for the
+// name and type from the hosts file
+func (h *Hosts) records(name Name, t QType) []ResourceRecord {
+	records := make([]ResourceRecord, 0)
+	switch t {
+	case QType(AType), QType(AAAAType):
+		for _, ip := range h.Lookup(name.GetName()) {
+			if ip4 := ip.To4(); ip4 != nil && t == QType(AType) {
+				records = append(records, NewResourceRecord(name, AType, INClass, 0, ip4))
+			} else if ip4 == nil && t == QType(AAAAType) {
+				records = append(records, NewResourceRecord(name, AAAAType, INClass, 0, ip))
+			}
+		}
+	case QType(PTRType):
+		ip := reverseAddr(name)
+		if ip == nil {
+			return records
+		}
+
+		for _, host := range h.LookupAddr(ip) {
+			target, err := NewName(host)
+			if err != nil {
+				continue
+			}
+			records = append(records, NewResourceRecord(name, PTRType, INClass, 0, target.ToBytes()))
+		}
+	}
+
+	return records
+}
+
+// reverseAddr returns the address of a name of the in-addr.arpa or ip6.arpa
+// domains, or nil
+func reverseAddr(name Name) net.IP {
+	labels := strings.Split(name.GetName(), ".")
+	switch {
+	case strings.HasSuffix(name.GetName(), ".in-addr.arpa") && len(labels) == 6:
+		ip := net.ParseIP(labels[3] + "." + labels[2] + "." + labels[1] + "." + labels[0])
+		return ip.To4()
+	case strings.HasSuffix(name.GetName(), ".ip6.arpa") && len(labels) == 34:
+		var b strings.Builder
+		for i := 31; i >= 0; i-- {
+			b.WriteString(labels[i])
+			if i%4 == 0 && i > 0 {
+				b.WriteString(":")
+			}
+		}
+		return net.ParseIP(b.String())
+	default:
+		return nil
+	}
+}
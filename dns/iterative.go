@@ -0,0 +1,403 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultMaxDepth bounds the nesting of the resolutions made to find the
+	// addresses of name servers without glue
+	defaultMaxDepth = 8
+	// defaultMaxQueries bounds the number of queries sent to resolve a name
+	defaultMaxQueries = 100
+)
+
+// rootHints holds the names and the addresses of the root servers
+var rootHints = []struct {
+	name string
+	ipv4 string
+	ipv6 string
+}{
+	{"a.root-servers.net", "198.41.0.4", "2001:503:ba3e::2:30"},
+	{"b.root-servers.net", "170.247.170.2", "2801:1b8:10::b"},
+	{"c.root-servers.net", "192.33.4.12", "2001:500:2::c"},
+	{"d.root-servers.net", "199.7.91.13", "2001:500:2d::d"},
+	{"e.root-servers.net", "192.203.230.10", "2001:500:a8::e"},
+	{"f.root-servers.net", "192.5.5.241", "2001:500:2f::f"},
+	{"g.root-servers.net", "192.112.36.4", "2001:500:12::d0d"},
+	{"h.root-servers.net", "198.97.190.53", "2001:500:1::53"},
+	{"i.root-servers.net", "192.36.148.17", "2001:7fe::53"},
+	{"j.root-servers.net", "192.58.128.30", "2001:503:c27::2:30"},
+	{"k.root-servers.net", "193.0.14.129", "2001:7fd::1"},
+	{"l.root-servers.net", "199.7.83.42", "2001:500:9f::42"},
+	{"m.root-servers.net", "202.12.27.33", "2001:dc3::35"},
+}
+
+// RootHints returns the NS records of the root zone and the A and AAAA
+// records of the root servers
+func RootHints() []ResourceRecord {
+	root, _ := NewName(".")
+	records := make([]ResourceRecord, 0, 3*len(rootHints))
+	for _, hint := range rootHints {
+		name, _ := NewName(hint.name)
+		records = append(records,
+			NewResourceRecord(root, NSType, INClass, 518400, name.ToBytes()),
+			NewResourceRecord(name, AType, INClass, 518400, net.ParseIP(hint.ipv4).To4()),
+			NewResourceRecord(name, AAAAType, INClass, 518400, net.ParseIP(hint.ipv6)))
+	}
+
+	return records
+}
+
+// IterativeResolver resolves names by itself, starting from the root servers
+// and following the referrals down to the authoritative servers of the names.
+// It implements the Querier interface
+type IterativeResolver struct {
+	// Hints are the NS records of the root zone and the address records of
+	// the root servers. Defaults to RootHints()
+	Hints []ResourceRecord
+	// Client sends the queries to the servers
+	Client Client
+	// Port is the port the servers listen on. Defaults to 53
+	Port int
+	// MaxDepth bounds the nesting of the resolutions of the addresses of name
+	// servers without glue. Defaults to 8
+	MaxDepth int
+	// MaxQueries bounds the number of queries sent to resolve a name.
+	// Defaults to 100
+	MaxQueries int
+}
+
+func (r *IterativeResolver) hints() []ResourceRecord {
+	if r.Hints == nil {
+		return RootHints()
+	}
+
+	return r.Hints
+}
+
+func (r *IterativeResolver) port() string {
+	if r.Port == 0 {
+		return "53"
+	}
+
+	return strconv.Itoa(r.Port)
+}
+
+func (r *IterativeResolver) maxDepth() int {
+	if r.MaxDepth == 0 {
+		return defaultMaxDepth
+	}
+
+	return r.MaxDepth
+}
+
+func (r *IterativeResolver) maxQueries() int {
+	if r.MaxQueries == 0 {
+		return defaultMaxQueries
+	}
+
+	return r.MaxQueries
+}
+
+// Query resolves the records of the name and type. The returned message holds
+// the answers, the CNAME and DNAME records followed to reach them included,
+// and the authority section of the last response
+func (r *IterativeResolver) Query(name Name, t QType) (Message, error) {
+	res := &resolution{r: r, resolving: make(map[string]bool)}
+	return res.resolve(name, t, 0)
+}
+
+// resolution holds the state of the resolution of a name, shared with the
+// resolutions of the addresses of the name servers met along the way
+type resolution struct {
+	r       *IterativeResolver
+	queries int
+	// resolving holds the names of the servers whose addresses are being
+	// resolved, breaking the loops of delegations without glue
+	resolving map[string]bool
+}
+
+// nameServer is a server of a zone along with its known addresses
+type nameServer struct {
+	name  Name
+	addrs []net.IP
+}
+
+func (res *resolution) resolve(qname Name, t QType, depth int) (Message, error) {
+	if depth > res.r.maxDepth() {
+		return Message{}, fmt.Errorf("failed to resolve %s %s, maximum depth reached", qname.GetName(), t)
+	}
+
+	answers := make([]ResourceRecord, 0)
+	seen := map[string]bool{qname.GetName(): true}
+	name := qname
+	for {
+		resp, zone, err := res.lookup(name, t, depth)
+		if err != nil {
+			return Message{}, err
+		}
+
+		// a server is only trusted for the records of its zone, the targets of
+		// the aliases out of it are resolved again from the root
+		chain, target, final := followAliases(name, t, inZone(resp.Answers, zone))
+		answers = append(answers, chain...)
+		if final || resp.Header.RCode != NoErrorRCode {
+			m := Message{
+				Header:    Header{QR: true, RA: true, RD: true, RCode: resp.Header.RCode, QuestionCount: 1},
+				Question:  Question{Name: qname, Type: t, Class: INClass},
+				Answers:   answers,
+				Authority: resp.Authority,
+			}
+			return m, nil
+		}
+
+		if seen[target.GetName()] || len(seen) > maxCNAMEChain {
+			return Message{}, fmt.Errorf("failed to resolve %s %s, CNAME loop at %s", qname.GetName(), t,
+				target.GetName())
+		}
+		seen[target.GetName()] = true
+		name = target
+	}
+}
+
+// followAliases follows the CNAME and DNAME records of the answers from name.
+// It returns the records of the chain and the name it ends with, and reports
+// whether the answers are final: they hold the records of the type or do not
+// hold any alias
+func followAliases(name Name, t QType, answers []ResourceRecord) ([]ResourceRecord, Name, bool) {
+	chain := make([]ResourceRecord, 0)
+	for i := 0; i <= maxCNAMEChain; i++ {
+		if t == ANYQType || t == QType(CNAMEType) {
+			if owned := ownedBy(answers, name); len(owned) > 0 {
+				return append(chain, owned...), name, true
+			}
+		} else if set := rrset(answers, name, Type(t)); len(set) > 0 {
+			return append(chain, set...), name, true
+		}
+
+		if cname := rrset(answers, name, CNAMEType); len(cname) > 0 {
+			target := Name{}
+			if _, err := target.fromBytes(cname[0].Data, 0); err != nil {
+				return chain, name, true
+			}
+			chain = append(chain, cname[0])
+			name = target
+			continue
+		}
+
+		if dname, target, ok := substituteDNAME(name, answers); ok {
+			chain = append(chain, dname)
+			name = target
+			continue
+		}
+
+		break
+	}
+
+	return chain, name, len(chain) == 0
+}
+
+// inZone returns the records owned by the zone or its descendants
+func inZone(records []ResourceRecord, zone Name) []ResourceRecord {
+	in := make([]ResourceRecord, 0, len(records))
+	for _, rr := range records {
+		if rr.Name.IsSubdomainOf(zone) {
+			in = append(in, rr)
+		}
+	}
+
+	return in
+}
+
+// substituteDNAME returns the DNAME record of the answers owned by an ancestor
+// of name and the name it redirects name to (RFC 6672 section 2.2)
+func substituteDNAME(name Name, answers []ResourceRecord) (ResourceRecord, Name, bool) {
+	for _, rr := range answers {
+		if rr.Type != DNAMEType || rr.Name.Equal(name) || !name.IsSubdomainOf(rr.Name) {
+			continue
+		}
+
+		target := Name{}
+		if _, err := target.fromBytes(rr.Data, 0); err != nil {
+			continue
+		}
+
+		prefix := strings.TrimSuffix(name.GetName(), rr.Name.GetName())
+		if rr.Name.GetName() == "." {
+			prefix = name.GetName() + "."
+		}
+
+		substituted, err := childName(strings.TrimSuffix(prefix, "."), target)
+		if err != nil {
+			continue
+		}
+		return rr, substituted, true
+	}
+
+	return ResourceRecord{}, Name{}, false
+}
+
+// lookup queries the servers of the zones from the root down to the zone of
+// name, returning the first response that is not a referral along with the zone
+// of the servers that gave it
+func (res *resolution) lookup(name Name, t QType, depth int) (Message, Name, error) {
+	zone, _ := NewName(".")
+	servers := nameServers(zone, res.r.hints(), res.r.hints())
+	for {
+		resp, err := res.queryServers(zone, servers, name, t, depth)
+		if err != nil {
+			return Message{}, Name{}, err
+		}
+
+		cut, ok := referral(&resp, zone, name)
+		if !ok {
+			return resp, zone, nil
+		}
+
+		servers = nameServers(cut, resp.Authority, resp.Additional)
+		// glue is only trusted from the servers of an ancestor of its name
+		for i := range servers {
+			if !servers[i].name.IsSubdomainOf(zone) {
+				servers[i].addrs = nil
+			}
+		}
+		zone = cut
+	}
+}
+
+// referral returns the zone a response refers the resolver to, if any. Only
+// referrals to a descendant of the zone of the server leading to name are
+// followed, the others being lame
+func referral(resp *Message, zone, name Name) (Name, bool) {
+	if resp.Header.AA || len(resp.Answers) > 0 || resp.Header.RCode != NoErrorRCode {
+		return Name{}, false
+	}
+
+	for _, rr := range resp.Authority {
+		if rr.Type == NSType && !rr.Name.Equal(zone) && rr.Name.IsSubdomainOf(zone) && name.IsSubdomainOf(rr.Name) {
+			return rr.Name, true
+		}
+	}
+
+	return Name{}, false
+}
+
+// usable reports whether a response of a server of the zone answers the query
+// or refers to a server closer to name. The other responses are lame
+func usable(resp *Message, zone, name Name) bool {
+	switch {
+	case resp.Header.RCode != NoErrorRCode && resp.Header.RCode != NameErrorRCode:
+		return false
+	case bool(resp.Header.AA) || len(resp.Answers) > 0 || hasSOA(resp.Authority):
+		return true
+	default:
+		_, ok := referral(resp, zone, name)
+		return ok
+	}
+}
+
+// nameServers returns the servers of the zone listed by the NS records, along
+// with their addresses found in the address records
+func nameServers(zone Name, nsRecords []ResourceRecord, addrRecords []ResourceRecord) []nameServer {
+	servers := make([]nameServer, 0)
+	for _, rr := range nsRecords {
+		if rr.Type != NSType || !rr.Name.Equal(zone) {
+			continue
+		}
+
+		ns := nameServer{}
+		if _, err := ns.name.fromBytes(rr.Data, 0); err != nil {
+			continue
+		}
+
+		// IPv4 addresses are tried first
+		for _, t := range []Type{AType, AAAAType} {
+			for _, addr := range rrset(addrRecords, ns.name, t) {
+				ns.addrs = append(ns.addrs, net.IP(addr.Data))
+			}
+		}
+		servers = append(servers, ns)
+	}
+
+	return servers
+}
+
+// queryServers sends the query to the servers of the zone until one of them
+// gives a usable response. The addresses of the servers without glue are
+// resolved first
+func (res *resolution) queryServers(zone Name, servers []nameServer, name Name, t QType, depth int) (Message, error) {
+	q := &Message{
+		Header:   Header{Opcode: QueryOpcode, QuestionCount: 1},
+		Question: Question{Name: name, Type: t, Class: INClass},
+	}
+
+	var lastErr error
+	for _, ns := range servers {
+		addrs := ns.addrs
+		if len(addrs) == 0 {
+			addrs = res.serverAddresses(ns.name, depth)
+		}
+
+		for _, addr := range addrs {
+			if res.queries >= res.r.maxQueries() {
+				return Message{}, fmt.Errorf("failed to resolve %s %s, maximum number of queries reached",
+					name.GetName(), t)
+			}
+			res.queries++
+
+			resp, err := res.r.Client.Exchange(q, net.JoinHostPort(addr.String(), res.r.port()))
+			if err != nil {
+				lastErr = err
+				continue
+			}
+
+			if !usable(&resp, zone, name) {
+				lastErr = fmt.Errorf("lame response from %s for zone %s. rcode=%s", ns.name.GetName(),
+					zone.GetName(), resp.Header.RCode)
+				continue
+			}
+
+			return resp, nil
+		}
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no reachable server for zone %s", zone.GetName())
+	}
+	return Message{}, fmt.Errorf("failed to resolve %s %s. err=%s", name.GetName(), t, lastErr.Error())
+}
+
+// serverAddresses resolves the addresses of a name server whose NS record
+// came without glue
+func (res *resolution) serverAddresses(name Name, depth int) []net.IP {
+	if res.resolving[name.GetName()] {
+		return nil
+	}
+
+	res.resolving[name.GetName()] = true
+	defer delete(res.resolving, name.GetName())
+
+	addrs := make([]net.IP, 0)
+	for _, t := range []Type{AType, AAAAType} {
+		resp, err := res.resolve(name, QType(t), depth+1)
+		if err != nil {
+			continue
+		}
+
+		for _, rr := range resp.Answers {
+			if rr.Type == t {
+				addrs = append(addrs, net.IP(rr.Data))
+			}
+		}
+
+		if len(addrs) > 0 {
+			break
+		}
+	}
+
+	return addrs
+}
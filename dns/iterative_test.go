@@ -0,0 +1,234 @@
+package dns_test
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+// zonesHandler answers from the deepest of the zones holding the queried name,
+// as a server authoritative for several zones does
+func zonesHandler(zones ...*dns.Zone) dns.Handler {
+	return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		var best *dns.Zone
+		labels := -1
+		for _, z := range zones {
+			origin := z.Origin()
+			if r.Question.Name.IsSubdomainOf(origin) && origin.LabelCount() > labels {
+				best = z
+				labels = origin.LabelCount()
+			}
+		}
+
+		if best == nil {
+			resp := dns.NewResponse(r)
+			resp.Header.RCode = dns.RefusedRCode
+			w.WriteMessage(resp)
+			return
+		}
+
+		h := dns.ZoneHandler{Zone: best}
+		h.ServeDNS(w, r)
+	})
+}
+
+func mustZone(t *testing.T, origin string, records ...dns.ResourceRecord) *dns.Zone {
+	soa := rootSOA(t)
+	if origin != "." {
+		soa = soaRecord(t, origin, 1)
+	}
+
+	records = append([]dns.ResourceRecord{soa}, records...)
+	z, err := dns.NewZone(mustName(t, origin), records)
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+
+	return z
+}
+
+// startServers starts a server for each handler, listening on the same port
+// of the addresses 127.0.0.1, 127.0.0.2 and so on. It returns the port
+func startServers(t *testing.T, handlers ...dns.Handler) int {
+	port := 0
+	for i, h := range handlers {
+		addr := net.JoinHostPort("127.0.0."+strconv.Itoa(i+1), strconv.Itoa(port))
+		pc, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			t.Skipf("failed to listen on %s. err=%s", addr, err.Error())
+		}
+		port = pc.LocalAddr().(*net.UDPAddr).Port
+
+		ln, err := net.Listen("tcp", pc.LocalAddr().String())
+		if err != nil {
+			pc.Close()
+			t.Skipf("failed to listen on tcp %s. err=%s", addr, err.Error())
+		}
+
+		s := &dns.Server{Handler: h}
+		go s.ServeUDP(pc)
+		go s.ServeTCP(ln)
+		t.Cleanup(func() { s.Close() })
+	}
+
+	return port
+}
+
+func TestIterativeResolver(t *testing.T) {
+	root := mustZone(t, ".",
+		nameRecord(t, ".", dns.NSType, "a.root-servers.net"),
+		nameRecord(t, "com", dns.NSType, "a.gtld.com"),
+		nameRecord(t, "net", dns.NSType, "a.gtld.com"),
+		aRecord(t, "a.gtld.com", "127.0.0.2"))
+	com := mustZone(t, "com",
+		nameRecord(t, "com", dns.NSType, "a.gtld.com"),
+		aRecord(t, "a.gtld.com", "127.0.0.2"),
+		nameRecord(t, "example.com", dns.NSType, "ns1.example.com"),
+		aRecord(t, "ns1.example.com", "127.0.0.3"),
+		nameRecord(t, "glueless.com", dns.NSType, "ns.example.net"),
+		nameRecord(t, "lame.com", dns.NSType, "ns.lame.com"),
+		nameRecord(t, "lame.com", dns.NSType, "ns2.lame.com"),
+		aRecord(t, "ns.lame.com", "127.0.0.4"),
+		aRecord(t, "ns2.lame.com", "127.0.0.3"),
+		nameRecord(t, "dname.com", dns.NSType, "ns.dname.com"),
+		aRecord(t, "ns.dname.com", "127.0.0.5"),
+		nameRecord(t, "loop1.com", dns.NSType, "ns.loop2.com"),
+		nameRecord(t, "loop2.com", dns.NSType, "ns.loop1.com"),
+		nameRecord(t, "evil.com", dns.NSType, "ns.evil.com"),
+		aRecord(t, "ns.evil.com", "127.0.0.6"))
+	net_ := mustZone(t, "net",
+		nameRecord(t, "net", dns.NSType, "a.gtld.com"),
+		nameRecord(t, "example.net", dns.NSType, "ns1.example.com"))
+	exampleCom := mustZone(t, "example.com",
+		nameRecord(t, "example.com", dns.NSType, "ns1.example.com"),
+		aRecord(t, "ns1.example.com", "127.0.0.3"),
+		aRecord(t, "www.example.com", "192.0.2.1"),
+		nameRecord(t, "alias.example.com", dns.CNAMEType, "www.example.com"),
+		nameRecord(t, "ext.example.com", dns.CNAMEType, "www.example.net"),
+		nameRecord(t, "loop1.example.com", dns.CNAMEType, "loop2.example.com"),
+		nameRecord(t, "loop2.example.com", dns.CNAMEType, "loop1.example.com"))
+	exampleNet := mustZone(t, "example.net",
+		nameRecord(t, "example.net", dns.NSType, "ns1.example.com"),
+		aRecord(t, "ns.example.net", "127.0.0.3"),
+		aRecord(t, "www.example.net", "192.0.2.2"),
+		aRecord(t, "a.example.net", "192.0.2.5"))
+	glueless := mustZone(t, "glueless.com",
+		nameRecord(t, "glueless.com", dns.NSType, "ns.example.net"),
+		aRecord(t, "www.glueless.com", "192.0.2.3"))
+	lame := mustZone(t, "lame.com",
+		nameRecord(t, "lame.com", dns.NSType, "ns.lame.com"),
+		nameRecord(t, "lame.com", dns.NSType, "ns2.lame.com"),
+		aRecord(t, "www.lame.com", "192.0.2.4"))
+
+	refused := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		resp := dns.NewResponse(r)
+		resp.Header.RCode = dns.RefusedRCode
+		w.WriteMessage(resp)
+	})
+	// the server of dname.com redirects its subtree to example.net, without
+	// synthesizing the CNAME records
+	dname := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		resp := dns.NewResponse(r)
+		resp.Header.AA = true
+		resp.Answers = []dns.ResourceRecord{nameRecord(t, "dname.com", dns.DNAMEType, "example.net")}
+		w.WriteMessage(resp)
+	})
+
+	// the server of evil.com aliases its names to example.com, giving a forged
+	// address for the target along
+	evil := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		resp := dns.NewResponse(r)
+		resp.Header.AA = true
+		resp.Answers = []dns.ResourceRecord{
+			nameRecord(t, r.Question.Name.GetName(), dns.CNAMEType, "www.example.com"),
+			aRecord(t, "www.example.com", "198.51.100.66"),
+		}
+		w.WriteMessage(resp)
+	})
+
+	port := startServers(t,
+		zonesHandler(root),
+		zonesHandler(com, net_),
+		zonesHandler(exampleCom, exampleNet, glueless, lame),
+		refused,
+		dname,
+		evil)
+	hints := []dns.ResourceRecord{
+		nameRecord(t, ".", dns.NSType, "a.root-servers.net"),
+		aRecord(t, "a.root-servers.net", "127.0.0.1"),
+	}
+
+	var cases = []struct {
+		name       string
+		maxQueries int
+		rcode      dns.RCode
+		answers    []dns.Type
+		address    string
+		fails      bool
+	}{
+		{"www.example.com", 0, dns.NoErrorRCode, []dns.Type{dns.AType}, "192.0.2.1", false},
+		{"alias.example.com", 0, dns.NoErrorRCode, []dns.Type{dns.CNAMEType, dns.AType}, "192.0.2.1", false},
+		// the CNAME chain crosses zones
+		{"ext.example.com", 0, dns.NoErrorRCode, []dns.Type{dns.CNAMEType, dns.AType}, "192.0.2.2", false},
+		// the address of the target is resolved from the servers of its zone
+		{"www.evil.com", 0, dns.NoErrorRCode, []dns.Type{dns.CNAMEType, dns.AType}, "192.0.2.1", false},
+		{"a.dname.com", 0, dns.NoErrorRCode, []dns.Type{dns.DNAMEType, dns.AType}, "192.0.2.5", false},
+		// the addresses of ns.example.net are not given along the referral
+		{"www.glueless.com", 0, dns.NoErrorRCode, []dns.Type{dns.AType}, "192.0.2.3", false},
+		// ns.lame.com refuses the queries, ns2.lame.com answers them
+		{"www.lame.com", 0, dns.NoErrorRCode, []dns.Type{dns.AType}, "192.0.2.4", false},
+		{"nothere.example.com", 0, dns.NameErrorRCode, []dns.Type{}, "", false},
+		{"loop1.example.com", 0, 0, nil, "", true},
+		{"www.loop1.com", 0, 0, nil, "", true},
+		{"www.example.com", 2, 0, nil, "", true},
+	}
+
+	for i, c := range cases {
+		r := dns.IterativeResolver{Hints: hints, Port: port, MaxQueries: c.maxQueries}
+		resp, err := r.Query(mustName(t, c.name), dns.QType(dns.AType))
+		if c.fails {
+			if err == nil {
+				t.Fatalf("Query should fail. case=%d", i)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Query failed. case=%d err=%s", i, err.Error())
+		}
+
+		if resp.Header.RCode != c.rcode {
+			t.Fatalf("unexpected rcode. case=%d actual=%s expected=%s", i, resp.Header.RCode, c.rcode)
+		}
+
+		if len(resp.Answers) != len(c.answers) {
+			t.Fatalf("unexpected answer count. case=%d actual=%d expected=%d", i, len(resp.Answers), len(c.answers))
+		}
+
+		for j, rtype := range c.answers {
+			if resp.Answers[j].Type != rtype {
+				t.Fatalf("unexpected answer type. case=%d index=%d actual=%s expected=%s", i, j,
+					dns.QType(resp.Answers[j].Type), dns.QType(rtype))
+			}
+		}
+
+		if c.address != "" && net.IP(resp.Answers[len(resp.Answers)-1].Data).String() != c.address {
+			t.Fatalf("unexpected address. case=%d actual=%s expected=%s", i,
+				net.IP(resp.Answers[len(resp.Answers)-1].Data), c.address)
+		}
+
+		if c.rcode == dns.NameErrorRCode && countType(resp.Authority, dns.SOAType) != 1 {
+			t.Fatalf("negative responses should carry the SOA record. case=%d", i)
+		}
+	}
+}
+
+func TestRootHints(t *testing.T) {
+	hints := dns.RootHints()
+	if countType(hints, dns.NSType) != 13 || countType(hints, dns.AType) != 13 ||
+		countType(hints, dns.AAAAType) != 13 {
+		t.Fatalf("unexpected root hints. count=%d", len(hints))
+	}
+}
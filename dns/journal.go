@@ -0,0 +1,122 @@
+package dns
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Diff describes the changes that moved a zone from one serial to the next
+type Diff struct {
+	// From is the SOA record of the zone before the change
+	From ResourceRecord
+	// To is the SOA record of the zone after the change
+	To ResourceRecord
+	// Deleted lists the records removed from the zone, SOA excluded
+	Deleted []ResourceRecord
+	// Added lists the records added to the zone, SOA excluded
+	Added []ResourceRecord
+}
+
+// Journal keeps the history of the changes of a zone, keyed by SOA serial, so
+// that incremental transfers can be served. It is safe for concurrent use
+type Journal struct {
+	mu       sync.Mutex
+	diffs    []Diff
+	maxDiffs int
+}
+
+// NewJournal builds an empty journal keeping at most maxDiffs differences. The
+// oldest differences are dropped first. A zero maxDiffs keeps every difference
+func NewJournal(maxDiffs int) *Journal {
+	return &Journal{maxDiffs: maxDiffs}
+}
+
+// Append records a difference. It must start from the serial the last recorded
+// difference ended with
+func (j *Journal) Append(d Diff) error {
+	from := soaSerial(d.From)
+	to := soaSerial(d.To)
+	if !SerialLess(from, to) {
+		return fmt.Errorf("failed to append diff, serial must increase. from=%d to=%d", from, to)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if len(j.diffs) > 0 {
+		last := soaSerial(j.diffs[len(j.diffs)-1].To)
+		if last != from {
+			return fmt.Errorf("failed to append diff, serial discontinuity. last=%d from=%d", last, from)
+		}
+	}
+
+	j.diffs = append(j.diffs, d)
+	if j.maxDiffs > 0 && len(j.diffs) > j.maxDiffs {
+		j.diffs = j.diffs[len(j.diffs)-j.maxDiffs:]
+	}
+
+	return nil
+}
+
+// Reset drops the recorded differences, so that the transfers following a
+// change the journal missed are full ones
+func (j *Journal) Reset() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.diffs = nil
+}
+
+// Since returns the differences recorded after serial, oldest first. It returns
+// false if the journal does not hold the history starting at serial
+func (j *Journal) Since(serial uint32) ([]Diff, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i, d := range j.diffs {
+		if soaSerial(d.From) == serial {
+			diffs := make([]Diff, len(j.diffs)-i)
+			copy(diffs, j.diffs[i:])
+			return diffs, true
+		}
+	}
+
+	return nil, false
+}
+
+// condense merges consecutive differences into a single one holding their net
+// effect, as allowed by RFC 1995 section 6
+func condense(diffs []Diff) Diff {
+	if len(diffs) == 0 {
+		return Diff{}
+	}
+
+	result := Diff{
+		From:    diffs[0].From,
+		To:      diffs[len(diffs)-1].To,
+		Deleted: make([]ResourceRecord, 0),
+		Added:   make([]ResourceRecord, 0),
+	}
+
+	for _, d := range diffs {
+		for _, rr := range d.Deleted {
+			if i := indexOfRecord(result.Added, rr); i >= 0 {
+				result.Added = append(result.Added[:i], result.Added[i+1:]...)
+				continue
+			}
+			result.Deleted = append(result.Deleted, rr)
+		}
+
+		for _, rr := range d.Added {
+			// a record deleted then added back with another TTL is kept in both
+			// lists so that the TTL change is transferred
+			if i := indexOfRecord(result.Deleted, rr); i >= 0 && result.Deleted[i].TTL == rr.TTL {
+				result.Deleted = append(result.Deleted[:i], result.Deleted[i+1:]...)
+				continue
+			}
+			result.Added = append(result.Added, rr)
+		}
+	}
+
+	return result
+}
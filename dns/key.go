@@ -0,0 +1,271 @@
+package dns
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+)
+
+const (
+	// RSASHA256Algorithm is the RSA algorithm using SHA-256 (RFC 5702)
+	RSASHA256Algorithm Algorithm = 8
+	// ECDSAP256SHA256Algorithm is the ECDSA algorithm using the P-256 curve and
+	// SHA-256 (RFC 6605)
+	ECDSAP256SHA256Algorithm Algorithm = 13
+	// ECDSAP384SHA384Algorithm is the ECDSA algorithm using the P-384 curve and
+	// SHA-384 (RFC 6605)
+	ECDSAP384SHA384Algorithm Algorithm = 14
+	// ED25519Algorithm is the Edwards-curve algorithm using Ed25519 (RFC 8080)
+	ED25519Algorithm Algorithm = 15
+)
+
+// Algorithm is the number of a public key algorithm, shared by KEY, SIG and the
+// DNSSEC records
+type Algorithm uint8
+
+func (a Algorithm) String() string {
+	switch a {
+	case RSASHA256Algorithm:
+		return "RSASHA256"
+	case ECDSAP256SHA256Algorithm:
+		return "ECDSAP256SHA256"
+	case ECDSAP384SHA384Algorithm:
+		return "ECDSAP384SHA384"
+	case ED25519Algorithm:
+		return "ED25519"
+	default:
+		return fmt.Sprintf("%d", uint8(a))
+	}
+}
+
+// KEY is the data of a KEY resource record, publishing the public key of the
+// owner name (RFC 2535 section 3)
+type KEY struct {
+	Flags uint16
+	// Protocol is always 3
+	Protocol  uint8
+	Algorithm Algorithm
+	PublicKey []byte
+}
+
+// ToBytes returns the byte array form of the KEY data
+func (k *KEY) ToBytes() []byte {
+	data := make([]byte, 0, 4+len(k.PublicKey))
+
+	data = appendUint16(data, k.Flags)
+	data = append(data, k.Protocol, byte(k.Algorithm))
+	data = append(data, k.PublicKey...)
+
+	return data
+}
+
+// KeyTag returns the tag identifying the key in signatures (RFC 4034 appendix B)
+func (k *KEY) KeyTag() uint16 {
+	return keyTag(k.ToBytes())
+}
+
+// KEY returns the data of a KEY resource record
+func (rr ResourceRecord) KEY() (KEY, error) {
+	if rr.Type != KEYType {
+		return KEY{}, fmt.Errorf("resource record is not a KEY record. type=%s", rr.Type)
+	}
+
+	return keyFromBytes(rr.Data)
+}
+
+func keyFromBytes(data []byte) (KEY, error) {
+	if len(data) < 4 {
+		return KEY{}, fmt.Errorf("failed to parse KEY data, invalid length %d", len(data))
+	}
+
+	return KEY{
+		Flags:     catBytes(data[0], data[1]),
+		Protocol:  data[2],
+		Algorithm: Algorithm(data[3]),
+		PublicKey: data[4:],
+	}, nil
+}
+
+func keyTag(rdata []byte) uint16 {
+	var ac uint32
+	for i, b := range rdata {
+		if i&1 == 0 {
+			ac += uint32(b) << 8
+		} else {
+			ac += uint32(b)
+		}
+	}
+	ac += ac >> 16
+
+	return uint16(ac & 0xFFFF)
+}
+
+// publicKey decodes the public key held by the KEY data
+func (k *KEY) publicKey() (crypto.PublicKey, error) {
+	switch k.Algorithm {
+	case RSASHA256Algorithm:
+		return rsaPublicKey(k.PublicKey)
+	case ECDSAP256SHA256Algorithm, ECDSAP384SHA384Algorithm:
+		curve, size := elliptic.P256(), 64
+		if k.Algorithm == ECDSAP384SHA384Algorithm {
+			curve, size = elliptic.P384(), 96
+		}
+		if len(k.PublicKey) != size {
+			return nil, fmt.Errorf("failed to parse ECDSA public key, invalid length %d", len(k.PublicKey))
+		}
+		return ecdsa.ParseUncompressedPublicKey(curve, append([]byte{4}, k.PublicKey...))
+	case ED25519Algorithm:
+		if len(k.PublicKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("failed to parse Ed25519 public key, invalid length %d", len(k.PublicKey))
+		}
+		return ed25519.PublicKey(k.PublicKey), nil
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %s", k.Algorithm)
+	}
+}
+
+// rsaPublicKey decodes a RSA public key made of the length of the exponent, the
+// exponent and the modulus (RFC 3110 section 2)
+func rsaPublicKey(data []byte) (*rsa.PublicKey, error) {
+	if len(data) < 3 {
+		return nil, fmt.Errorf("failed to parse RSA public key, invalid length %d", len(data))
+	}
+
+	offset, exponentLength := 1, int(data[0])
+	if exponentLength == 0 {
+		offset, exponentLength = 3, int(catBytes(data[1], data[2]))
+	}
+
+	if exponentLength == 0 || exponentLength > 4 || offset+exponentLength >= len(data) {
+		return nil, fmt.Errorf("failed to parse RSA public key, invalid exponent length %d", exponentLength)
+	}
+
+	exponent := 0
+	for _, b := range data[offset : offset+exponentLength] {
+		exponent = exponent<<8 | int(b)
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(data[offset+exponentLength:]),
+		E: exponent,
+	}, nil
+}
+
+// encodePublicKey returns the algorithm and the wire form of a public key
+func encodePublicKey(pub crypto.PublicKey) (Algorithm, []byte, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		exponent := big.NewInt(int64(pub.E)).Bytes()
+		data := make([]byte, 0, 3+len(exponent)+pub.Size())
+		if len(exponent) < 256 {
+			data = append(data, byte(len(exponent)))
+		} else {
+			data = append(data, 0)
+			data = appendUint16(data, uint16(len(exponent)))
+		}
+		data = append(data, exponent...)
+		data = append(data, pub.N.Bytes()...)
+		return RSASHA256Algorithm, data, nil
+	case *ecdsa.PublicKey:
+		algorithm := ECDSAP256SHA256Algorithm
+		switch pub.Curve {
+		case elliptic.P256():
+		case elliptic.P384():
+			algorithm = ECDSAP384SHA384Algorithm
+		default:
+			return 0, nil, fmt.Errorf("unsupported ECDSA curve %s", pub.Curve.Params().Name)
+		}
+		data, err := pub.Bytes()
+		if err != nil {
+			return 0, nil, err
+		}
+		return algorithm, data[1:], nil
+	case ed25519.PublicKey:
+		return ED25519Algorithm, []byte(pub), nil
+	default:
+		return 0, nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// sign signs the data, encoding the signature as described by the RFC of the
+// algorithm
+func sign(signer crypto.Signer, algorithm Algorithm, data []byte) ([]byte, error) {
+	switch algorithm {
+	case RSASHA256Algorithm:
+		digest := sha256.Sum256(data)
+		return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	case ECDSAP256SHA256Algorithm, ECDSAP384SHA384Algorithm:
+		var digest []byte
+		var opts crypto.Hash
+		size := 32
+		if algorithm == ECDSAP256SHA256Algorithm {
+			sum := sha256.Sum256(data)
+			digest, opts = sum[:], crypto.SHA256
+		} else {
+			sum := sha512.Sum384(data)
+			digest, opts, size = sum[:], crypto.SHA384, 48
+		}
+
+		der, err := signer.Sign(rand.Reader, digest, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		// RFC 6605 section 4: the signature is the concatenation of r and s
+		var rs struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(der, &rs); err != nil {
+			return nil, err
+		}
+		signature := make([]byte, 2*size)
+		rs.R.FillBytes(signature[:size])
+		rs.S.FillBytes(signature[size:])
+		return signature, nil
+	case ED25519Algorithm:
+		return signer.Sign(rand.Reader, data, crypto.Hash(0))
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %s", algorithm)
+	}
+}
+
+// verify reports whether signature is a valid signature of the data made with
+// the algorithm
+func verify(pub crypto.PublicKey, algorithm Algorithm, data []byte, signature []byte) bool {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if algorithm != RSASHA256Algorithm {
+			return false
+		}
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+	case *ecdsa.PublicKey:
+		var digest []byte
+		switch algorithm {
+		case ECDSAP256SHA256Algorithm:
+			sum := sha256.Sum256(data)
+			digest = sum[:]
+		case ECDSAP384SHA384Algorithm:
+			sum := sha512.Sum384(data)
+			digest = sum[:]
+		default:
+			return false
+		}
+		if len(signature) != 2*len(digest) {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:len(digest)])
+		s := new(big.Int).SetBytes(signature[len(digest):])
+		return ecdsa.Verify(pub, digest, r, s)
+	case ed25519.PublicKey:
+		return algorithm == ED25519Algorithm && ed25519.Verify(pub, data, signature)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,274 @@
+package dns_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func TestKeyManager(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	m := dns.KeyManager{
+		Dir:              t.TempDir(),
+		Zone:             mustName(t, "example.com"),
+		Algorithm:        dns.ED25519Algorithm,
+		ZSKLifetime:      10 * day,
+		KSKLifetime:      30 * day,
+		PropagationDelay: day,
+		Now:              func() time.Time { return now },
+	}
+
+	var steps = []struct {
+		day     int
+		files   int
+		dnskeys int
+		signing int
+		ds      int
+	}{
+		{0, 2, 2, 2, 1},
+		// the next ZSK is published
+		{9, 3, 3, 2, 1},
+		// the next ZSK signs, the previous one stays published
+		{10, 3, 3, 2, 1},
+		{11, 2, 2, 2, 1},
+		{19, 3, 3, 2, 1},
+		// the next KSK signs along with the current one, both DS are needed
+		{29, 4, 4, 3, 2},
+		{30, 4, 4, 2, 1},
+		{31, 2, 2, 2, 1},
+	}
+
+	for _, s := range steps {
+		now = start.Add(time.Duration(s.day) * day)
+		if _, err := m.Rollover(); err != nil {
+			t.Fatalf("Rollover failed. day=%d err=%s", s.day, err.Error())
+		}
+
+		entries, err := os.ReadDir(m.Dir)
+		if err != nil {
+			t.Fatalf("ReadDir failed with error %s", err.Error())
+		}
+
+		dnskeys, err := m.DNSKEYRecords(3600)
+		if err != nil {
+			t.Fatalf("DNSKEYRecords failed. day=%d err=%s", s.day, err.Error())
+		}
+
+		signing, err := m.SigningKeys()
+		if err != nil {
+			t.Fatalf("SigningKeys failed. day=%d err=%s", s.day, err.Error())
+		}
+
+		ds, err := m.DSRecords(3600, dns.SHA256DigestType)
+		if err != nil {
+			t.Fatalf("DSRecords failed. day=%d err=%s", s.day, err.Error())
+		}
+
+		if len(entries) != s.files || len(dnskeys) != s.dnskeys || len(signing) != s.signing || len(ds) != s.ds {
+			t.Fatalf("unexpected keys. day=%d files=%d dnskeys=%d signing=%d ds=%d", s.day, len(entries),
+				len(dnskeys), len(signing), len(ds))
+		}
+
+		records := append([]dns.ResourceRecord{soaRecord(t, "example.com", 1)}, dnskeys...)
+		z, err := dns.NewZone(mustName(t, "example.com"), records)
+		if err != nil {
+			t.Fatalf("NewZone failed with error %s", err.Error())
+		}
+
+		signer := dns.ZoneSigner{Keys: signing, Inception: now.Add(-time.Hour), Expiration: now.Add(day)}
+		if _, err := signer.Sign(z); err != nil {
+			t.Fatalf("Sign failed. day=%d err=%s", s.day, err.Error())
+		}
+	}
+}
+
+func TestKeyManagerKeyFile(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 30, 15, 0, time.UTC)
+	m := dns.KeyManager{Dir: t.TempDir(), Zone: mustName(t, "example.com"), Now: func() time.Time { return now }}
+
+	generated, err := m.Rollover()
+	if err != nil {
+		t.Fatalf("Rollover failed with error %s", err.Error())
+	}
+
+	loaded, err := m.Keys()
+	if err != nil {
+		t.Fatalf("Keys failed with error %s", err.Error())
+	}
+
+	if len(loaded) != 2 || len(generated) != 2 {
+		t.Fatalf("unexpected key count. generated=%d loaded=%d", len(generated), len(loaded))
+	}
+
+	for _, g := range generated {
+		found := false
+		for _, l := range loaded {
+			gk, _ := g.DNSKEY()
+			lk, _ := l.DNSKEY()
+			if gk.KeyTag() != lk.KeyTag() {
+				continue
+			}
+
+			found = true
+			if !l.Zone.Equal(g.Zone) || l.Flags != g.Flags || !l.Publish.Equal(g.Publish) ||
+				!l.Activate.Equal(g.Activate) || !l.Retire.Equal(g.Retire) || !l.Remove.Equal(g.Remove) {
+				t.Fatalf("loaded key differs from the generated one. tag=%d", gk.KeyTag())
+			}
+
+			if l.State(now) != dns.ActiveKeyState {
+				t.Fatalf("unexpected state. actual=%s expected=%s", l.State(now), dns.ActiveKeyState)
+			}
+		}
+
+		if !found {
+			t.Fatalf("generated key missing from the directory")
+		}
+	}
+}
+
+func TestKeyManagerLateRollover(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	m := dns.KeyManager{
+		Dir:              t.TempDir(),
+		Zone:             mustName(t, "example.com"),
+		Algorithm:        dns.ED25519Algorithm,
+		ZSKLifetime:      10 * day,
+		KSKLifetime:      30 * day,
+		PropagationDelay: day,
+		Now:              func() time.Time { return now },
+	}
+
+	zsk := func() uint16 {
+		signing, err := m.SigningKeys()
+		if err != nil {
+			t.Fatalf("SigningKeys failed with error %s", err.Error())
+		}
+
+		var tags []uint16
+		for _, key := range signing {
+			if k, _ := key.DNSKEY(); k.Flags&dns.SEPFlag == 0 {
+				tags = append(tags, k.KeyTag())
+			}
+		}
+		if len(tags) != 1 {
+			t.Fatalf("unexpected signing ZSKs. actual=%v", tags)
+		}
+
+		return tags[0]
+	}
+
+	if _, err := m.Rollover(); err != nil {
+		t.Fatalf("Rollover failed with error %s", err.Error())
+	}
+	current := zsk()
+
+	// the rollover runs after the current ZSK should have retired: it keeps
+	// signing until its successor is published for a propagation delay
+	var steps = []struct {
+		hours int
+		files int
+		next  bool
+	}{
+		{252, 3, false},
+		{264, 3, false},
+		{275, 3, false},
+		{276, 3, true},
+		{299, 3, true},
+		{300, 2, true},
+	}
+
+	for _, s := range steps {
+		now = start.Add(time.Duration(s.hours) * time.Hour)
+		if _, err := m.Rollover(); err != nil {
+			t.Fatalf("Rollover failed. hours=%d err=%s", s.hours, err.Error())
+		}
+
+		entries, err := os.ReadDir(m.Dir)
+		if err != nil {
+			t.Fatalf("ReadDir failed with error %s", err.Error())
+		}
+
+		if tag := zsk(); len(entries) != s.files || (tag != current) != s.next {
+			t.Fatalf("unexpected keys. hours=%d files=%d zsk=%d current=%d", s.hours, len(entries), tag, current)
+		}
+	}
+}
+
+func TestKeyManagerLateKSKRollover(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	m := dns.KeyManager{
+		Dir:              t.TempDir(),
+		Zone:             mustName(t, "example.com"),
+		Algorithm:        dns.ED25519Algorithm,
+		ZSKLifetime:      100 * day,
+		KSKLifetime:      30 * day,
+		PropagationDelay: day,
+		Now:              func() time.Time { return now },
+	}
+
+	ksks := func() []uint16 {
+		signing, err := m.SigningKeys()
+		if err != nil {
+			t.Fatalf("SigningKeys failed with error %s", err.Error())
+		}
+
+		var tags []uint16
+		for _, key := range signing {
+			if k, _ := key.DNSKEY(); k.Flags&dns.SEPFlag != 0 {
+				tags = append(tags, k.KeyTag())
+			}
+		}
+
+		return tags
+	}
+
+	if _, err := m.Rollover(); err != nil {
+		t.Fatalf("Rollover failed with error %s", err.Error())
+	}
+	current := ksks()[0]
+
+	// the rollover runs after the current KSK should have retired: it keeps
+	// signing along with its successor until the DS records of the successor
+	// propagated to the resolvers
+	var steps = []struct {
+		hours   int
+		files   int
+		signing int
+		current bool
+	}{
+		{732, 3, 2, true},
+		{755, 3, 2, true},
+		{756, 3, 1, false},
+		{779, 3, 1, false},
+		{780, 2, 1, false},
+	}
+
+	for _, s := range steps {
+		now = start.Add(time.Duration(s.hours) * time.Hour)
+		if _, err := m.Rollover(); err != nil {
+			t.Fatalf("Rollover failed. hours=%d err=%s", s.hours, err.Error())
+		}
+
+		entries, err := os.ReadDir(m.Dir)
+		if err != nil {
+			t.Fatalf("ReadDir failed with error %s", err.Error())
+		}
+
+		tags := ksks()
+		signing := false
+		for _, tag := range tags {
+			signing = signing || tag == current
+		}
+		if len(entries) != s.files || len(tags) != s.signing || signing != s.current {
+			t.Fatalf("unexpected keys. hours=%d files=%d ksks=%v current=%d", s.hours, len(entries), tags, current)
+		}
+	}
+}
@@ -0,0 +1,597 @@
+package dns
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// PassQualifier makes a matching SPF mechanism authorize the sender
+	PassQualifier SPFQualifier = '+'
+	// FailQualifier makes a matching SPF mechanism reject the sender
+	FailQualifier SPFQualifier = '-'
+	// SoftFailQualifier makes a matching SPF mechanism discourage the sender
+	SoftFailQualifier SPFQualifier = '~'
+	// NeutralQualifier makes a matching SPF mechanism state nothing
+	NeutralQualifier SPFQualifier = '?'
+)
+
+// SPFQualifier is the result of a SPF mechanism when it matches
+type SPFQualifier byte
+
+// SPFMechanism is a mechanism of a SPF record, ie: "-ip4:192.0.2.0/24"
+type SPFMechanism struct {
+	Qualifier SPFQualifier
+	// Kind is the lowercase name of the mechanism, ie: "include"
+	Kind string
+	// Domain is the domain spec of the a, mx, ptr, include and exists
+	// mechanisms, possibly holding macros. It is empty when omitted
+	Domain string
+	// Network is the network of the ip4 and ip6 mechanisms
+	Network *net.IPNet
+	// Prefix4 and Prefix6 are the prefix lengths of the a and mx mechanisms,
+	// 32 and 128 when omitted
+	Prefix4 int
+	Prefix6 int
+}
+
+// SPF is a SPF record (RFC 7208), the policy listing the hosts allowed to send
+// mail for a domain
+type SPF struct {
+	Mechanisms []SPFMechanism
+	// Redirect is the domain spec of the redirect modifier, empty when absent
+	Redirect string
+	// Explanation is the domain spec of the exp modifier, empty when absent
+	Explanation string
+}
+
+// DNSLookups returns the number of mechanisms and modifiers of the record
+// requiring a DNS lookup, limited to 10 during an evaluation (RFC 7208 section
+// 4.6.4)
+func (s *SPF) DNSLookups() int {
+	count := 0
+	for _, m := range s.Mechanisms {
+		switch m.Kind {
+		case "a", "mx", "ptr", "include", "exists":
+			count++
+		}
+	}
+
+	if s.Redirect != "" {
+		count++
+	}
+
+	return count
+}
+
+// IsSPF reports whether the TXT value is a SPF record
+func IsSPF(value string) bool {
+	version, _, _ := strings.Cut(value, " ")
+	return strings.EqualFold(version, "v=spf1")
+}
+
+// ParseSPF parses a SPF record, ie: "v=spf1 mx include:_spf.example.net -all".
+// Unknown modifiers are ignored as required by RFC 7208 section 6
+func ParseSPF(s string) (SPF, error) {
+	if !IsSPF(s) {
+		return SPF{}, fmt.Errorf("failed to parse SPF record, invalid version")
+	}
+
+	spf := SPF{Mechanisms: make([]SPFMechanism, 0)}
+	for _, term := range strings.Fields(s)[1:] {
+		name, value, sep := cutSPFTerm(term)
+		if sep != '=' {
+			m, err := parseSPFMechanism(term)
+			if err != nil {
+				return SPF{}, err
+			}
+			spf.Mechanisms = append(spf.Mechanisms, m)
+			continue
+		}
+
+		if !validSPFName(name) {
+			return SPF{}, fmt.Errorf("failed to parse SPF record, invalid modifier %s", term)
+		}
+
+		var modifier *string
+		switch strings.ToLower(name) {
+		case "redirect":
+			modifier = &spf.Redirect
+		case "exp":
+			modifier = &spf.Explanation
+		default:
+			continue
+		}
+		if value == "" {
+			return SPF{}, fmt.Errorf("failed to parse SPF record, invalid modifier %s", term)
+		}
+		if *modifier != "" {
+			return SPF{}, fmt.Errorf("failed to parse SPF record, duplicate modifier %s", name)
+		}
+		*modifier = value
+	}
+
+	return spf, nil
+}
+
+// cutSPFTerm splits a SPF term around the first separator of its name, returning
+// the separator as well
+func cutSPFTerm(term string) (string, string, byte) {
+	i := strings.IndexAny(term, ":/=")
+	if i < 0 {
+		return term, "", 0
+	}
+
+	return term[:i], term[i+1:], term[i]
+}
+
+func parseSPFMechanism(term string) (SPFMechanism, error) {
+	m := SPFMechanism{Qualifier: PassQualifier}
+	mechanism := term
+	switch SPFQualifier(term[0]) {
+	case PassQualifier, FailQualifier, SoftFailQualifier, NeutralQualifier:
+		m.Qualifier = SPFQualifier(term[0])
+		term = term[1:]
+	}
+
+	i := strings.IndexAny(term, ":/")
+	if i < 0 {
+		i = len(term)
+	}
+	m.Kind, term = strings.ToLower(term[:i]), term[i:]
+
+	var err error
+	switch m.Kind {
+	case "all":
+		if term != "" {
+			err = fmt.Errorf("unexpected argument %s", term)
+		}
+	case "include", "exists":
+		m.Domain = strings.TrimPrefix(term, ":")
+		if m.Domain == "" || m.Domain == term {
+			err = fmt.Errorf("missing domain spec")
+		}
+	case "ptr":
+		m.Domain, err = spfDomain(term)
+	case "a", "mx":
+		term, m.Prefix6, err = cutSPFPrefix(term, "//", 8*net.IPv6len)
+		if err == nil {
+			term, m.Prefix4, err = cutSPFPrefix(term, "/", 8*net.IPv4len)
+		}
+		if err == nil {
+			m.Domain, err = spfDomain(term)
+		}
+	case "ip4", "ip6":
+		m.Network, err = spfNetwork(m.Kind, term)
+	default:
+		err = fmt.Errorf("unknown mechanism")
+	}
+
+	if err != nil {
+		return SPFMechanism{}, fmt.Errorf("failed to parse SPF mechanism %s, %s", mechanism, err.Error())
+	}
+
+	return m, nil
+}
+
+// spfDomain returns the optional domain spec of a mechanism argument
+func spfDomain(term string) (string, error) {
+	if term == "" {
+		return "", nil
+	}
+
+	if term == ":" || term[0] != ':' {
+		return "", fmt.Errorf("invalid domain spec %s", term)
+	}
+
+	return term[1:], nil
+}
+
+// cutSPFPrefix removes the prefix length following the separator at the end of
+// a mechanism argument, returning the maximum when there is none. A suffix not
+// made of digits belongs to the domain spec, which may hold macros
+func cutSPFPrefix(term, sep string, max int) (string, int, error) {
+	i := strings.LastIndex(term, sep)
+	if i < 0 || strings.Trim(term[i+len(sep):], "0123456789") != "" || i+len(sep) == len(term) {
+		return term, max, nil
+	}
+
+	prefix, err := strconv.Atoi(term[i+len(sep):])
+	if err != nil || prefix > max {
+		return "", 0, fmt.Errorf("invalid prefix length %s", term[i:])
+	}
+
+	return term[:i], prefix, nil
+}
+
+// spfNetwork parses the network of an ip4 or ip6 mechanism argument
+func spfNetwork(kind string, term string) (*net.IPNet, error) {
+	address, prefix, hasPrefix := strings.Cut(strings.TrimPrefix(term, ":"), "/")
+	ip := net.ParseIP(address)
+	if term == "" || term[0] != ':' || ip == nil || (kind == "ip4") == strings.Contains(address, ":") {
+		return nil, fmt.Errorf("invalid address %s", term)
+	}
+
+	bits := 8 * net.IPv6len
+	if kind == "ip4" {
+		ip, bits = ip.To4(), 8*net.IPv4len
+	}
+
+	length := bits
+	if hasPrefix {
+		var err error
+		if length, err = strconv.Atoi(prefix); err != nil || length < 0 || length > bits {
+			return nil, fmt.Errorf("invalid prefix length %s", prefix)
+		}
+	}
+
+	mask := net.CIDRMask(length, bits)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}, nil
+}
+
+// validSPFName checks the name of a SPF modifier is a letter followed by
+// letters, digits, "-", "_" and "."
+func validSPFName(name string) bool {
+	for i, c := range name {
+		letter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !letter && (i == 0 || (c < '0' || c > '9') && c != '-' && c != '_' && c != '.') {
+			return false
+		}
+	}
+
+	return name != ""
+}
+
+// DMARC is a DMARC record (RFC 7489), the policy applied to the mail failing
+// the authentication checks of a domain
+type DMARC struct {
+	// Policy is the requested policy: "none", "quarantine" or "reject"
+	Policy string
+	// SubdomainPolicy is the policy of the subdomains, the policy by default
+	SubdomainPolicy string
+	// DKIMAlignment is the DKIM identifier alignment mode, "r" for relaxed by
+	// default or "s" for strict
+	DKIMAlignment string
+	// SPFAlignment is the SPF identifier alignment mode, "r" or "s"
+	SPFAlignment string
+	// Percent is the percentage of mail the policy applies to
+	Percent int
+	// AggregateReportURIs are the URIs aggregate reports are sent to
+	AggregateReportURIs []string
+	// FailureReportURIs are the URIs failure reports are sent to
+	FailureReportURIs []string
+	// FailureOptions are the failure reporting options, "0" by default
+	FailureOptions []string
+	// ReportFormats are the failure report formats, "afrf" by default
+	ReportFormats []string
+	// ReportInterval is the interval in seconds between aggregate reports
+	ReportInterval uint32
+}
+
+// ParseDMARC parses a DMARC record, ie: "v=DMARC1; p=reject; rua=mailto:d@example.com".
+// Unknown tags are ignored as required by RFC 7489 section 6.3
+func ParseDMARC(s string) (DMARC, error) {
+	tags, names, err := parseTagList("DMARC", s)
+	if err != nil {
+		return DMARC{}, err
+	}
+
+	if len(names) == 0 || names[0] != "v" || tags["v"] != "DMARC1" {
+		return DMARC{}, fmt.Errorf("failed to parse DMARC record, invalid version")
+	}
+
+	d := DMARC{
+		Policy:         tags["p"],
+		DKIMAlignment:  "r",
+		SPFAlignment:   "r",
+		Percent:        100,
+		FailureOptions: []string{"0"},
+		ReportFormats:  []string{"afrf"},
+		ReportInterval: 86400,
+	}
+	if !validDMARCPolicy(d.Policy) {
+		return DMARC{}, fmt.Errorf("failed to parse DMARC record, invalid policy %s", d.Policy)
+	}
+
+	d.SubdomainPolicy = d.Policy
+	if sp, ok := tags["sp"]; ok {
+		if !validDMARCPolicy(sp) {
+			return DMARC{}, fmt.Errorf("failed to parse DMARC record, invalid subdomain policy %s", sp)
+		}
+		d.SubdomainPolicy = sp
+	}
+
+	for tag, mode := range map[string]*string{"adkim": &d.DKIMAlignment, "aspf": &d.SPFAlignment} {
+		if value, ok := tags[tag]; ok {
+			if value != "r" && value != "s" {
+				return DMARC{}, fmt.Errorf("failed to parse DMARC record, invalid alignment mode %s=%s", tag, value)
+			}
+			*mode = value
+		}
+	}
+
+	if pct, ok := tags["pct"]; ok {
+		if d.Percent, err = strconv.Atoi(pct); err != nil || d.Percent < 0 || d.Percent > 100 {
+			return DMARC{}, fmt.Errorf("failed to parse DMARC record, invalid percentage %s", pct)
+		}
+	}
+
+	if ri, ok := tags["ri"]; ok {
+		interval, err := strconv.ParseUint(ri, 10, 32)
+		if err != nil {
+			return DMARC{}, fmt.Errorf("failed to parse DMARC record, invalid report interval %s", ri)
+		}
+		d.ReportInterval = uint32(interval)
+	}
+
+	lists := map[string]struct {
+		values    *[]string
+		separator string
+	}{
+		"rua": {&d.AggregateReportURIs, ","},
+		"ruf": {&d.FailureReportURIs, ","},
+		"fo":  {&d.FailureOptions, ":"},
+		"rf":  {&d.ReportFormats, ":"},
+	}
+	for tag, list := range lists {
+		value, ok := tags[tag]
+		if !ok {
+			continue
+		}
+
+		*list.values = make([]string, 0)
+		for _, v := range strings.Split(value, list.separator) {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				return DMARC{}, fmt.Errorf("failed to parse DMARC record, invalid %s %s", tag, value)
+			}
+			*list.values = append(*list.values, v)
+		}
+	}
+
+	return d, nil
+}
+
+func validDMARCPolicy(policy string) bool {
+	return policy == "none" || policy == "quarantine" || policy == "reject"
+}
+
+// DKIM is a DKIM key record (RFC 6376 section 3.6.1), the public key of a
+// selector signing the mail of a domain
+type DKIM struct {
+	// KeyType is the key type, "rsa" by default or "ed25519"
+	KeyType string
+	// HashAlgorithms are the acceptable hash algorithms, nil meaning all
+	HashAlgorithms []string
+	// PublicKey is the public key data, empty when the key is revoked
+	PublicKey []byte
+	// ServiceTypes are the service types the key applies to, "*" by default
+	ServiceTypes []string
+	// Flags are the flags of the key: "y" when the domain is testing DKIM, "s"
+	// when the signing domain must not be a subdomain of the identity domain
+	Flags []string
+	Notes string
+}
+
+// Revoked reports whether the key has been revoked
+func (d *DKIM) Revoked() bool {
+	return len(d.PublicKey) == 0
+}
+
+// Testing reports whether the domain is testing DKIM, in which case a failed
+// verification must not be treated differently
+func (d *DKIM) Testing() bool {
+	for _, flag := range d.Flags {
+		if flag == "y" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Key returns the public key, a *rsa.PublicKey or an ed25519.PublicKey
+// (RFC 8463)
+func (d *DKIM) Key() (crypto.PublicKey, error) {
+	if d.Revoked() {
+		return nil, fmt.Errorf("DKIM key is revoked")
+	}
+
+	switch d.KeyType {
+	case "rsa":
+		key, err := x509.ParsePKIXPublicKey(d.PublicKey)
+		if err != nil {
+			// some signers publish the PKCS #1 form of the key
+			return x509.ParsePKCS1PublicKey(d.PublicKey)
+		}
+		return key, nil
+	case "ed25519":
+		if len(d.PublicKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("failed to parse DKIM key, invalid length %d", len(d.PublicKey))
+		}
+		return ed25519.PublicKey(d.PublicKey), nil
+	default:
+		return nil, fmt.Errorf("unsupported DKIM key type %s", d.KeyType)
+	}
+}
+
+// ParseDKIM parses a DKIM key record, ie: "v=DKIM1; k=ed25519; p=11qYAYKxCrf..."
+func ParseDKIM(s string) (DKIM, error) {
+	tags, names, err := parseTagList("DKIM", s)
+	if err != nil {
+		return DKIM{}, err
+	}
+
+	if v, ok := tags["v"]; ok && (names[0] != "v" || v != "DKIM1") {
+		return DKIM{}, fmt.Errorf("failed to parse DKIM record, invalid version")
+	}
+
+	p, ok := tags["p"]
+	if !ok {
+		return DKIM{}, fmt.Errorf("failed to parse DKIM record, missing public key")
+	}
+
+	// the base64 value may be folded with white spaces
+	key, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(p), ""))
+	if err != nil {
+		return DKIM{}, fmt.Errorf("failed to parse DKIM record, invalid public key %s", err.Error())
+	}
+
+	d := DKIM{KeyType: "rsa", PublicKey: key, ServiceTypes: []string{"*"}, Flags: []string{}, Notes: tags["n"]}
+	if k, ok := tags["k"]; ok {
+		d.KeyType = k
+	}
+
+	lists := map[string]*[]string{"h": &d.HashAlgorithms, "s": &d.ServiceTypes, "t": &d.Flags}
+	for tag, values := range lists {
+		value, ok := tags[tag]
+		if !ok {
+			continue
+		}
+
+		*values = make([]string, 0)
+		for _, v := range strings.Split(value, ":") {
+			if v = strings.TrimSpace(v); v == "" {
+				return DKIM{}, fmt.Errorf("failed to parse DKIM record, invalid %s %s", tag, value)
+			}
+			*values = append(*values, v)
+		}
+	}
+
+	return d, nil
+}
+
+// parseTagList parses the tag=value list of a DKIM or DMARC record (RFC 6376
+// section 3.2), returning the values by tag and the tags in order
+func parseTagList(t string, s string) (map[string]string, []string, error) {
+	tags := make(map[string]string)
+	names := make([]string, 0)
+	for i, spec := range strings.Split(s, ";") {
+		if strings.TrimSpace(spec) == "" && i == strings.Count(s, ";") {
+			// the last tag may be followed by a semicolon
+			break
+		}
+
+		name, value, ok := strings.Cut(spec, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || !validTagName(name) {
+			return nil, nil, fmt.Errorf("failed to parse %s record, invalid tag %s", t, spec)
+		}
+
+		if _, ok := tags[name]; ok {
+			return nil, nil, fmt.Errorf("failed to parse %s record, duplicate tag %s", t, name)
+		}
+		tags[name] = value
+		names = append(names, name)
+	}
+
+	return tags, names, nil
+}
+
+// validTagName checks the tag is a letter followed by letters, digits and "_"
+func validTagName(name string) bool {
+	for i, c := range name {
+		letter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !letter && (i == 0 || (c < '0' || c > '9') && c != '_') {
+			return false
+		}
+	}
+
+	return name != ""
+}
+
+// LookupSPF returns the SPF record of the domain, which must hold a single one
+// (RFC 7208 section 4.5)
+func (r *Resolver) LookupSPF(ctx context.Context, domain string) (SPF, error) {
+	txts, err := r.LookupTXT(ctx, domain)
+	if err != nil {
+		return SPF{}, err
+	}
+
+	spfs := make([]string, 0, 1)
+	for _, txt := range txts {
+		if IsSPF(txt) {
+			spfs = append(spfs, txt)
+		}
+	}
+
+	switch len(spfs) {
+	case 0:
+		return SPF{}, notFound(domain)
+	case 1:
+	default:
+		return SPF{}, malformed(domain, fmt.Errorf("invalid SPF record count %d", len(spfs)))
+	}
+
+	spf, err := ParseSPF(spfs[0])
+	if err != nil {
+		return SPF{}, malformed(domain, err)
+	}
+
+	return spf, nil
+}
+
+// LookupDMARC returns the DMARC record of the domain, found at _dmarc.domain.
+// It does not fall back to the organizational domain
+func (r *Resolver) LookupDMARC(ctx context.Context, domain string) (DMARC, error) {
+	name := "_dmarc." + domain
+	txts, err := r.LookupTXT(ctx, name)
+	if err != nil {
+		return DMARC{}, err
+	}
+
+	records := make([]string, 0, 1)
+	for _, txt := range txts {
+		if isDMARC(txt) {
+			records = append(records, txt)
+		}
+	}
+
+	// multiple records are discarded as if there were none (RFC 7489 section
+	// 6.6.3)
+	if len(records) != 1 {
+		return DMARC{}, notFound(name)
+	}
+
+	d, err := ParseDMARC(records[0])
+	if err != nil {
+		return DMARC{}, malformed(name, err)
+	}
+
+	return d, nil
+}
+
+// isDMARC reports whether the TXT value starts with the DMARC version tag (RFC
+// 7489 section 6.6.3)
+func isDMARC(value string) bool {
+	rest, ok := strings.CutPrefix(value, "v=DMARC1")
+	return ok && (rest == "" || rest[0] == ';' || rest[0] == ' ' || rest[0] == '\t')
+}
+
+// LookupDKIM returns the DKIM key of the selector of the domain, found at
+// selector._domainkey.domain
+func (r *Resolver) LookupDKIM(ctx context.Context, selector, domain string) (DKIM, error) {
+	name := selector + "._domainkey." + domain
+	txts, err := r.LookupTXT(ctx, name)
+	if err != nil {
+		return DKIM{}, err
+	}
+
+	if len(txts) != 1 {
+		return DKIM{}, malformed(name, fmt.Errorf("invalid DKIM record count %d", len(txts)))
+	}
+
+	d, err := ParseDKIM(txts[0])
+	if err != nil {
+		return DKIM{}, malformed(name, err)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,249 @@
+package dns_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func TestParseSPF(t *testing.T) {
+	var cases = []struct {
+		record      string
+		mechanisms  []string
+		redirect    string
+		explanation string
+		lookups     int
+		valid       bool
+	}{
+		{"v=spf1 -all", []string{"-all"}, "", "", 0, true},
+		{"V=SPF1 MX include:_spf.example.net ~all", []string{"+mx/32//128", "+include:_spf.example.net", "~all"}, "", "", 2, true},
+		{"v=spf1 ip4:192.0.2.1/24 ip6:2001:DB8::1 ?ip4:192.0.2.7",
+			[]string{"+ip4:192.0.2.0/24", "+ip6:2001:db8::1/128", "?ip4:192.0.2.7/32"}, "", "", 0, true},
+		{"v=spf1 a/24 mx:mail.example.com//64 a:example.org/28//96 ptr exists:%{ir}.%{l1r+-}._spf.%{d}",
+			[]string{"+a/24//128", "+mx:mail.example.com/32//64", "+a:example.org/28//96", "+ptr", "+exists:%{ir}.%{l1r+-}._spf.%{d}"},
+			"", "", 5, true},
+		{"v=spf1 a:%{ir/}.example.com -all", []string{"+a:%{ir/}.example.com/32//128", "-all"}, "", "", 1, true},
+		{"v=spf1 redirect=_spf.example.net exp=explain.example.com unknown=value",
+			[]string{}, "_spf.example.net", "explain.example.com", 1, true},
+		{"v=spf1", []string{}, "", "", 0, true},
+		{"v=spf10 -all", nil, "", "", 0, false},
+		{"spf1 -all", nil, "", "", 0, false},
+		{"v=spf1 all:example.com", nil, "", "", 0, false},
+		{"v=spf1 include", nil, "", "", 0, false},
+		{"v=spf1 ip4:2001:db8::1", nil, "", "", 0, false},
+		{"v=spf1 ip6:192.0.2.1", nil, "", "", 0, false},
+		{"v=spf1 ip4:192.0.2.1/33", nil, "", "", 0, false},
+		{"v=spf1 a/33", nil, "", "", 0, false},
+		{"v=spf1 mx//129", nil, "", "", 0, false},
+		{"v=spf1 foo:example.com", nil, "", "", 0, false},
+		{"v=spf1 redirect=a.example.com redirect=b.example.com", nil, "", "", 0, false},
+		{"v=spf1 redirect=", nil, "", "", 0, false},
+		{"v=spf1 1foo=bar", nil, "", "", 0, false},
+	}
+
+	for i, c := range cases {
+		spf, err := dns.ParseSPF(c.record)
+		if (err == nil) != c.valid {
+			t.Fatalf("unexpected ParseSPF result. case=%d err=%v", i, err)
+		}
+		if !c.valid {
+			continue
+		}
+
+		mechanisms := make([]string, 0, len(spf.Mechanisms))
+		for _, m := range spf.Mechanisms {
+			s := string(m.Qualifier) + m.Kind
+			if m.Domain != "" {
+				s += ":" + m.Domain
+			}
+			switch m.Kind {
+			case "ip4", "ip6":
+				s += ":" + m.Network.String()
+			case "a", "mx":
+				s += "/" + strconv.Itoa(m.Prefix4) + "//" + strconv.Itoa(m.Prefix6)
+			}
+			mechanisms = append(mechanisms, s)
+		}
+
+		if strings.Join(mechanisms, " ") != strings.Join(c.mechanisms, " ") {
+			t.Fatalf("unexpected mechanisms. case=%d actual=%v expected=%v", i, mechanisms, c.mechanisms)
+		}
+
+		if spf.Redirect != c.redirect || spf.Explanation != c.explanation || spf.DNSLookups() != c.lookups {
+			t.Fatalf("unexpected SPF record. case=%d actual=%+v lookups=%d", i, spf, spf.DNSLookups())
+		}
+	}
+}
+
+func TestParseDMARC(t *testing.T) {
+	d, err := dns.ParseDMARC("v=DMARC1; p=quarantine; sp=reject; adkim=s; pct=20; " +
+		"rua=mailto:dmarc@example.com,mailto:reports@example.net!10m; fo=0:d:s; ri=3600;")
+	if err != nil {
+		t.Fatalf("ParseDMARC failed with error %s", err.Error())
+	}
+
+	if d.Policy != "quarantine" || d.SubdomainPolicy != "reject" || d.DKIMAlignment != "s" ||
+		d.SPFAlignment != "r" || d.Percent != 20 || d.ReportInterval != 3600 {
+		t.Fatalf("unexpected DMARC record. actual=%+v", d)
+	}
+
+	if len(d.AggregateReportURIs) != 2 || d.AggregateReportURIs[1] != "mailto:reports@example.net!10m" ||
+		len(d.FailureReportURIs) != 0 || strings.Join(d.FailureOptions, ":") != "0:d:s" ||
+		strings.Join(d.ReportFormats, ":") != "afrf" {
+		t.Fatalf("unexpected DMARC reporting. actual=%+v", d)
+	}
+
+	d, err = dns.ParseDMARC("v=DMARC1;p=none")
+	if err != nil || d.SubdomainPolicy != "none" || d.Percent != 100 || d.ReportInterval != 86400 {
+		t.Fatalf("unexpected DMARC defaults. actual=%+v err=%v", d, err)
+	}
+
+	var invalid = []string{
+		"p=reject; v=DMARC1",
+		"v=DMARC2; p=reject",
+		"v=DMARC1",
+		"v=DMARC1; p=deny",
+		"v=DMARC1; p=reject; sp=deny",
+		"v=DMARC1; p=reject; aspf=x",
+		"v=DMARC1; p=reject; pct=101",
+		"v=DMARC1; p=reject; ri=-1",
+		"v=DMARC1; p=reject; rua=",
+		"v=DMARC1; p=reject; p=none",
+		"v=DMARC1; p=reject;; pct=10",
+		"v=DMARC1; p=reject; 1=2",
+	}
+
+	for i, c := range invalid {
+		if _, err := dns.ParseDMARC(c); err == nil {
+			t.Fatalf("expected an error. case=%d record=%s", i, c)
+		}
+	}
+}
+
+func TestParseDKIM(t *testing.T) {
+	// example of RFC 8463 appendix A.2
+	d, err := dns.ParseDKIM("v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo=")
+	if err != nil {
+		t.Fatalf("ParseDKIM failed with error %s", err.Error())
+	}
+
+	key, err := d.Key()
+	if _, ok := key.(ed25519.PublicKey); err != nil || !ok || d.Revoked() || d.Testing() {
+		t.Fatalf("unexpected DKIM key. actual=%+v err=%v", d, err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey failed with error %s", err.Error())
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	p := base64.StdEncoding.EncodeToString(der)
+
+	d, err = dns.ParseDKIM("h=sha256; t=y:s; s=email; n=key of; p=" + p[:40] + " \t" + p[40:])
+	if err != nil {
+		t.Fatalf("ParseDKIM failed with error %s", err.Error())
+	}
+
+	key, err = d.Key()
+	if _, ok := key.(*rsa.PublicKey); err != nil || !ok || d.KeyType != "rsa" || !d.Testing() || d.Notes != "key of" ||
+		strings.Join(d.HashAlgorithms, ":") != "sha256" || strings.Join(d.ServiceTypes, ":") != "email" {
+		t.Fatalf("unexpected DKIM key. actual=%+v err=%v", d, err)
+	}
+
+	d, err = dns.ParseDKIM("v=DKIM1; p=")
+	if err != nil || !d.Revoked() || d.HashAlgorithms != nil || strings.Join(d.ServiceTypes, ":") != "*" {
+		t.Fatalf("unexpected revoked DKIM key. actual=%+v err=%v", d, err)
+	}
+	if _, err := d.Key(); err == nil {
+		t.Fatalf("expected an error for a revoked key")
+	}
+
+	var invalid = []string{
+		"v=DKIM1; k=rsa",
+		"k=rsa; v=DKIM1; p=",
+		"v=DKIM2; p=",
+		"v=DKIM1; p=!!",
+		"v=DKIM1; h=sha256:; p=",
+		"v=DKIM1; p=; p=",
+	}
+
+	for i, c := range invalid {
+		if _, err := dns.ParseDKIM(c); err == nil {
+			t.Fatalf("expected an error. case=%d record=%s", i, c)
+		}
+	}
+}
+
+func TestLookupMailRecords(t *testing.T) {
+	dkim := "v=DKIM1; k=rsa; p=" + strings.Repeat("MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8A", 12)
+	z := mustZone(t, "example.com",
+		txtRecord(t, "example.com", "v=spf1 mx -all"),
+		txtRecord(t, "example.com", "google-site-verification=abc"),
+		txtRecord(t, "_dmarc.example.com", "v=DMARC1; p=reject"),
+		txtRecord(t, "sel._domainkey.example.com", dkim),
+		txtRecord(t, "twice.example.com", "v=spf1 -all"),
+		txtRecord(t, "twice.example.com", "v=spf1 +all"),
+		txtRecord(t, "_dmarc.twice.example.com", "v=DMARC1; p=reject"),
+		txtRecord(t, "_dmarc.twice.example.com", "v=DMARC1; p=none"),
+		txtRecord(t, "nospf.example.com", "google-site-verification=abc"),
+		txtRecord(t, "_dmarc.nospf.example.com", "v=DMARC10; p=reject"),
+	)
+
+	addr := startServer(t, zonesHandler(mustZone(t, "."), z))
+	r := &dns.Resolver{Querier: &dns.Stub{Config: &dns.ResolvConf{
+		Servers:  []string{addr},
+		Timeout:  2 * time.Second,
+		Attempts: 1,
+	}}}
+
+	spf, err := r.LookupSPF(context.Background(), "example.com")
+	if err != nil || len(spf.Mechanisms) != 2 || spf.Mechanisms[1].Qualifier != dns.FailQualifier {
+		t.Fatalf("unexpected SPF record. actual=%+v err=%v", spf, err)
+	}
+
+	if _, err := r.LookupSPF(context.Background(), "twice.example.com"); err == nil {
+		t.Fatalf("expected an error for multiple SPF records")
+	}
+
+	_, err = r.LookupSPF(context.Background(), "nospf.example.com")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Fatalf("expected a not found error for a domain without SPF record. err=%v", err)
+	}
+
+	dmarc, err := r.LookupDMARC(context.Background(), "example.com")
+	if err != nil || dmarc.Policy != "reject" {
+		t.Fatalf("unexpected DMARC record. actual=%+v err=%v", dmarc, err)
+	}
+
+	if _, err := r.LookupDMARC(context.Background(), "twice.example.com"); err == nil {
+		t.Fatalf("expected an error for multiple DMARC records")
+	}
+
+	// the version tag is followed by a semicolon
+	_, err = r.LookupDMARC(context.Background(), "nospf.example.com")
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Fatalf("expected a not found error for an invalid DMARC version. err=%v", err)
+	}
+
+	// the key is longer than a single character string
+	key, err := r.LookupDKIM(context.Background(), "sel", "example.com")
+	if err != nil || len(key.PublicKey) != 12*24 {
+		t.Fatalf("unexpected DKIM key. actual=%+v err=%v", key, err)
+	}
+
+	if _, err := r.LookupDKIM(context.Background(), "missing", "example.com"); err == nil {
+		t.Fatalf("expected an error for a missing DKIM key")
+	}
+}
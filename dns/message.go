@@ -1,6 +1,7 @@
 package dns
 
 import (
+	"fmt"
 	"strings"
 )
 
@@ -28,16 +29,24 @@ func (m Message) String() string {
 	}
 
 	lines = append(lines, m.answersToString()...)
+	lines = append(lines, "[authority]")
+	lines = append(lines, sectionToString("[authority record]", m.Authority)...)
+	lines = append(lines, "[additional]")
+	lines = append(lines, sectionToString("[additional record]", m.Additional)...)
 
 	return strings.Join(lines, "\n")
 }
 
 func (m Message) answersToString() []string {
+	return sectionToString("[answer]", m.Answers)
+}
+
+func sectionToString(title string, records []ResourceRecord) []string {
 	lines := make([]string, 0)
 
-	for _, a := range m.Answers {
-		lines = append(lines, "[answer]")
-		lines = append(lines, a.stringLines()...)
+	for _, rr := range records {
+		lines = append(lines, title)
+		lines = append(lines, rr.stringLines()...)
 		lines = append(lines, "")
 	}
 
@@ -45,12 +54,23 @@ func (m Message) answersToString() []string {
 }
 
 // ToBytes returns the byte array form of the message to be transmitted over
-// the wire
+// the wire. The section counts of the header are derived from the content of
+// the message, the question being written only if QuestionCount is not zero
 func (m *Message) ToBytes() []byte {
 	data := make([]byte, 0, 0)
 
-	data = append(data, m.Header.ToBytes()...)
-	data = append(data, m.Question.ToBytes()...)
+	header := m.Header
+	if header.QuestionCount > 0 {
+		header.QuestionCount = 1
+	}
+	header.AnswerCount = uint16(len(m.Answers))
+	header.AuthorityCount = uint16(len(m.Authority))
+	header.AdditionalCount = uint16(len(m.Additional))
+	data = append(data, header.ToBytes()...)
+
+	if header.QuestionCount > 0 {
+		data = append(data, m.Question.ToBytes()...)
+	}
 
 	for _, answer := range m.Answers {
 		data = append(data, answer.ToBytes()...)
@@ -92,7 +112,23 @@ func NewQuestion(name string) (*Message, error) {
 	}, nil
 }
 
-// MessageFromBytes .
+// NewResponse builds a response to the request, holding the same ID and
+// question
+func NewResponse(request *Message) *Message {
+	return &Message{
+		Header: Header{
+			ID:            request.Header.ID,
+			QR:            true,
+			Opcode:        request.Header.Opcode,
+			RD:            request.Header.RD,
+			QuestionCount: request.Header.QuestionCount,
+		},
+		Question: request.Question,
+	}
+}
+
+// MessageFromBytes parses a message from its wire form. It returns the number
+// of bytes read
 func MessageFromBytes(data []byte) (Message, int, error) {
 	n := 0
 	header, bytesRead, err := headerFromBytes(data)
@@ -101,26 +137,59 @@ func MessageFromBytes(data []byte) (Message, int, error) {
 	}
 	n += bytesRead
 
-	question, bytesRead, err := questionFromBytes(data, n)
+	if header.QuestionCount > 1 {
+		return Message{}, n, fmt.Errorf("failed to parse message, unsupported question count %d",
+			header.QuestionCount)
+	}
+
+	question := Question{}
+	if header.QuestionCount == 1 {
+		question, bytesRead, err = questionFromBytes(data, n)
+		if err != nil {
+			return Message{}, n, err
+		}
+		n += bytesRead
+	}
+
+	answers, bytesRead, err := sectionFromBytes(data, n, header.AnswerCount)
 	if err != nil {
 		return Message{}, n, err
 	}
 	n += bytesRead
 
-	answers := make([]ResourceRecord, header.AnswerCount)
-	for i := 0; i < int(header.AnswerCount); i++ {
-		rr, bytesRead, err := resourceRecordFromBytes(data, n)
+	authority, bytesRead, err := sectionFromBytes(data, n, header.AuthorityCount)
+	if err != nil {
+		return Message{}, n, err
+	}
+	n += bytesRead
+
+	additional, bytesRead, err := sectionFromBytes(data, n, header.AdditionalCount)
+	if err != nil {
+		return Message{}, n, err
+	}
+	n += bytesRead
+
+	return Message{
+		Header:     header,
+		Question:   question,
+		Answers:    answers,
+		Authority:  authority,
+		Additional: additional,
+	}, n, nil
+}
+
+func sectionFromBytes(data []byte, offset int, count uint16) ([]ResourceRecord, int, error) {
+	n := 0
+	records := make([]ResourceRecord, count)
+	for i := 0; i < int(count); i++ {
+		rr, bytesRead, err := resourceRecordFromBytes(data, offset+n)
 		if err != nil {
-			return Message{}, n, err
+			return nil, n, err
 		}
 
-		answers[i] = rr
+		records[i] = rr
 		n += bytesRead
 	}
 
-	return Message{
-		Header:   header,
-		Question: question,
-		Answers:  answers,
-	}, n, nil
+	return records, n, nil
 }
@@ -0,0 +1,69 @@
+package dns_test
+
+import (
+	"testing"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func TestMessageFromBytes_compressedNames(t *testing.T) {
+	data := []byte{
+		0, 1, 129, 128, 0, 1, 0, 1, 0, 0, 0, 0, // header
+		3, 'w', 'w', 'w', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 0, 5, 0, 1, // question
+		192, 12, 0, 5, 0, 1, 0, 0, 0, 60, 0, 6, 3, 'w', 'e', 'b', 192, 16, // www.example.com CNAME web.example.com
+	}
+
+	m, _, err := dns.MessageFromBytes(data)
+	if err != nil {
+		t.Fatalf("MessageFromBytes failed with error %s", err.Error())
+	}
+
+	if m.Answers[0].Name.GetName() != "www.example.com" {
+		t.Fatalf("unexpected owner name. actual=%s", m.Answers[0].Name.GetName())
+	}
+
+	expected := []byte{3, 'w', 'e', 'b', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}
+	if string(m.Answers[0].Data) != string(expected) {
+		t.Fatalf("data was not decompressed. actual=%v expected=%v", m.Answers[0].Data, expected)
+	}
+}
+
+func TestMessageFromBytes_malformed(t *testing.T) {
+	var cases = [][]byte{
+		{0, 1, 129, 128, 0, 1, 0, 0, 0, 0, 0, 0, 3, 'w', 'w'},
+		{0, 1, 129, 128, 0, 1, 0, 0, 0, 0, 0, 0, 192, 12, 0, 1, 0, 1},
+		{0, 1, 129, 128, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 1},
+	}
+
+	for _, data := range cases {
+		if _, _, err := dns.MessageFromBytes(data); err == nil {
+			t.Fatalf("MessageFromBytes should return an error for malformed data. data=%v", data)
+		}
+	}
+}
+
+func TestMessageToBytes_roundTrip(t *testing.T) {
+	m, err := dns.NewQuestion("example.com")
+	if err != nil {
+		t.Fatalf("NewQuestion failed with error %s", err.Error())
+	}
+	m.Authority = []dns.ResourceRecord{soaRecord(t, "example.com", 42)}
+
+	parsed, _, err := dns.MessageFromBytes(m.ToBytes())
+	if err != nil {
+		t.Fatalf("MessageFromBytes failed with error %s", err.Error())
+	}
+
+	if parsed.Header.AuthorityCount != 1 || len(parsed.Authority) != 1 {
+		t.Fatalf("authority section was not parsed. count=%d", parsed.Header.AuthorityCount)
+	}
+
+	soa, err := parsed.Authority[0].SOA()
+	if err != nil {
+		t.Fatalf("SOA failed with error %s", err.Error())
+	}
+
+	if soa.Serial != 42 || soa.MName.GetName() != "ns1.example.com" {
+		t.Fatalf("unexpected SOA data. soa=%s", soa.String())
+	}
+}
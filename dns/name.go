@@ -7,6 +7,10 @@ import (
 
 const labelLengthMask byte = 0x3F // 0b00111111
 
+// maxPointers bounds the number of compression pointers followed while reading
+// a name, so that pointer loops cannot hang the parser
+const maxPointers = 126
+
 // Name is the name of the owner of the resource record. ie: "www.google.com."
 // Must be at most 255 bytes long.
 type Name struct {
@@ -14,7 +18,17 @@ type Name struct {
 	data []byte
 }
 
-// SetName set the name
+// NewName returns a Name set to the given domain name
+func NewName(name string) (Name, error) {
+	n := Name{}
+	if err := n.SetName(name); err != nil {
+		return Name{}, err
+	}
+
+	return n, nil
+}
+
+// SetName set the name. The root name is represented by "."
 func (n *Name) SetName(name string) error {
 	if name == "" {
 		return fmt.Errorf("domain name cannot be empty")
@@ -24,6 +38,12 @@ func (n *Name) SetName(name string) error {
 		return fmt.Errorf("domain name cannot exceed 255 bytes. %s", name)
 	}
 
+	if name == "." {
+		n.data = []byte{0}
+		n.name = "."
+		return nil
+	}
+
 	name = strings.TrimSuffix(name, ".")
 	name = strings.ToLower(name)
 	labels := strings.Split(name, ".")
@@ -49,6 +69,9 @@ func (n *Name) SetName(name string) error {
 	}
 
 	data = append(data, 0)
+	if len(data) > 255 {
+		return fmt.Errorf("domain name cannot exceed 255 bytes. %s", name)
+	}
 
 	n.data = data
 	n.name = name
@@ -65,43 +88,100 @@ func (n *Name) ToBytes() []byte {
 	return n.data
 }
 
+// Equal reports whether both names are the same domain name
+func (n *Name) Equal(other Name) bool {
+	return n.name == other.name
+}
+
+// IsSubdomainOf reports whether the name is parent or one of its descendants
+func (n *Name) IsSubdomainOf(parent Name) bool {
+	if parent.name == "." || n.name == parent.name {
+		return n.name != ""
+	}
+
+	return strings.HasSuffix(n.name, "."+parent.name)
+}
+
+// LabelCount returns the number of labels of the name, the root label excluded
+func (n *Name) LabelCount() int {
+	if n.name == "." || n.name == "" {
+		return 0
+	}
+
+	return strings.Count(n.name, ".") + 1
+}
+
 func (n *Name) fromBytes(data []byte, offset int) (int, error) {
-	name := ""
-	i := 0
+	labels := make([]string, 0)
+	raw := make([]byte, 0)
+	bytesRead := 0
+	jumps := 0
 
 	for {
-		name += "."
+		if offset >= len(data) {
+			return 0, fmt.Errorf("failed to parse name, unexpected end of data. offset=%d", offset)
+		}
+
 		labelLengthByte := data[offset]
-		i++
 		offset++
+		if jumps == 0 {
+			bytesRead++
+		}
 
 		if labelLengthByte == 0 {
 			break
 		}
 
 		if isPointer(labelLengthByte) {
-			left := int(labelLengthByte & 63) // & 0b00111111
+			if offset >= len(data) {
+				return 0, fmt.Errorf("failed to parse name, unexpected end of data. offset=%d", offset)
+			}
+
+			left := int(labelLengthByte & labelLengthMask)
 			right := int(data[offset])
-			i++
-			offset++
+			if jumps == 0 {
+				bytesRead++
+			}
 
-			location := left<<8 | right
-			pointedLabelLength := int(data[location])
-			// FIXME: read the entire name, not only first label
-			name += string(data[location+1 : location+1+pointedLabelLength])
-			break
+			jumps++
+			if jumps > maxPointers {
+				return 0, fmt.Errorf("failed to parse name, too many compression pointers")
+			}
+
+			offset = left<<8 | right
+			continue
+		}
+
+		if labelLengthByte&^labelLengthMask != 0 {
+			return 0, fmt.Errorf("failed to parse name, unknown label type 0x%x", labelLengthByte)
 		}
 
 		labelLength := int(labelLengthByte)
-		label := string(data[offset : offset+labelLength])
-		name += label
+		if offset+labelLength > len(data) {
+			return 0, fmt.Errorf("failed to parse name, label exceeds data. offset=%d length=%d",
+				offset, labelLength)
+		}
+
+		label := strings.ToLower(string(data[offset : offset+labelLength]))
+		labels = append(labels, label)
+		raw = append(raw, labelLengthByte)
+		raw = append(raw, label...)
+		if len(raw)+1 > 255 {
+			return 0, fmt.Errorf("failed to parse name, name exceeds 255 bytes")
+		}
+
 		offset += labelLength
-		i += labelLength
+		if jumps == 0 {
+			bytesRead += labelLength
+		}
 	}
 
-	n.name = name
-	n.data = data[offset : offset+i]
-	return i, nil
+	n.name = strings.Join(labels, ".")
+	if len(labels) == 0 {
+		n.name = "."
+	}
+	n.data = append(raw, 0)
+	return bytesRead, nil
 }
 
 func isPointer(labelLength byte) bool {
@@ -0,0 +1,283 @@
+package dns
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notifier sends NOTIFY messages (RFC 1996) to the secondaries of a zone when
+// it changes, retrying until each of them acknowledges the notification
+type Notifier struct {
+	// Secondaries are the addresses of the secondaries to notify, ie:
+	// "192.0.2.1:53"
+	Secondaries []string
+	// Client sends the notifications. Its timeout bounds the wait for each
+	// acknowledgement
+	Client Client
+	// RetryInterval is the delay between two attempts. Defaults to 60 seconds
+	RetryInterval time.Duration
+	// MaxAttempts is the number of notifications sent to a secondary before
+	// giving up. Defaults to 5
+	MaxAttempts int
+	// ErrorLog logs the secondaries that never acknowledged the retried
+	// notifications. Defaults to the standard logger of the log package
+	ErrorLog *log.Logger
+}
+
+func (n *Notifier) retryInterval() time.Duration {
+	if n.RetryInterval == 0 {
+		return 60 * time.Second
+	}
+
+	return n.RetryInterval
+}
+
+func (n *Notifier) maxAttempts() int {
+	if n.MaxAttempts == 0 {
+		return 5
+	}
+
+	return n.MaxAttempts
+}
+
+// Notify notifies every secondary concurrently that the zone changed, and waits
+// for their first acknowledgements. The secondaries that did not answer are
+// notified again in the background. It returns an error naming the
+// secondaries that did not acknowledge the first notification
+func (n *Notifier) Notify(z *Zone) error {
+	failures := make([]string, 0)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, addr := range n.Secondaries {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			retry, err := n.notify(z, addr)
+			if err == nil {
+				return
+			}
+
+			mu.Lock()
+			failures = append(failures, fmt.Sprintf("%s: %s", addr, err.Error()))
+			mu.Unlock()
+			if retry {
+				n.retry(z, addr, 1, err)
+			}
+		}(addr)
+	}
+	wg.Wait()
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to notify secondaries. %s", strings.Join(failures, ", "))
+	}
+
+	return nil
+}
+
+// retry notifies the secondary again after the retry interval, once the
+// previous attempts all went unanswered
+func (n *Notifier) retry(z *Zone, addr string, attempts int, err error) {
+	if attempts >= n.maxAttempts() {
+		if attempts > 1 {
+			logf(n.ErrorLog, "failed to notify %s of zone %s after %d attempts. %s", addr,
+				nameToString(z.Origin()), attempts, err.Error())
+		}
+		return
+	}
+
+	time.AfterFunc(n.retryInterval(), func() {
+		retry, err := n.notify(z, addr)
+		if retry {
+			n.retry(z, addr, attempts+1, err)
+		} else if err != nil {
+			logf(n.ErrorLog, "failed to notify %s of zone %s. %s", addr, nameToString(z.Origin()), err.Error())
+		}
+	})
+}
+
+// notify sends a notification to the secondary. It reports whether the
+// notification should be sent again, which is the case when it went unanswered
+func (n *Notifier) notify(z *Zone, addr string) (bool, error) {
+	resp, err := n.Client.Exchange(NewNotify(z), addr)
+	if err != nil {
+		return true, err
+	}
+
+	if resp.Header.Opcode != NotifyOpcode {
+		return false, fmt.Errorf("notification acknowledged with opcode %s", resp.Header.Opcode)
+	}
+
+	if resp.Header.RCode != NoErrorRCode {
+		return false, fmt.Errorf("notification rejected. rcode=%s", resp.Header.RCode)
+	}
+
+	return false, nil
+}
+
+// NewNotify builds a NOTIFY message announcing the current SOA of the zone
+func NewNotify(z *Zone) *Message {
+	return &Message{
+		Header: Header{
+			Opcode:        NotifyOpcode,
+			AA:            true,
+			QuestionCount: 1,
+		},
+		Question: Question{Name: z.Origin(), Type: QType(SOAType), Class: INClass},
+		Answers:  []ResourceRecord{z.SOA()},
+	}
+}
+
+// NotifyHandler accepts the NOTIFY messages sent for a zone by its primaries.
+// An accepted notification is acknowledged, then the serial of the zone is
+// checked against the primaries and the zone is transferred when it changed.
+// Other requests are passed to the next handler
+type NotifyHandler struct {
+	Zone *Zone
+	// Primaries are the addresses of the primaries of the zone, ie:
+	// "192.0.2.1:53". Refreshes are made against them in order
+	Primaries []string
+	// AllowFrom lists the addresses NOTIFY messages are accepted from. The
+	// addresses of the primaries are always allowed
+	AllowFrom []net.IP
+	// Client is used to refresh the zone
+	Client Client
+	// Next handles the requests that are not NOTIFY messages. If nil, they are
+	// answered with a NotImplemented rcode
+	Next Handler
+
+	mu         sync.Mutex
+	refreshing bool
+	pending    bool
+}
+
+// ServeDNS implements the Handler interface
+func (h *NotifyHandler) ServeDNS(w ResponseWriter, r *Message) {
+	if r.Header.Opcode != NotifyOpcode {
+		if h.Next != nil {
+			h.Next.ServeDNS(w, r)
+			return
+		}
+
+		resp := NewResponse(r)
+		resp.Header.RCode = NotImplementedRCode
+		w.WriteMessage(resp)
+		return
+	}
+
+	resp := NewResponse(r)
+	if r.Header.QuestionCount == 0 || r.Question.Type != QType(SOAType) ||
+		!r.Question.Name.Equal(h.Zone.Origin()) {
+		resp.Header.RCode = FormatErrorRCode
+		w.WriteMessage(resp)
+		return
+	}
+
+	if !sourceAllowed(w.RemoteAddr(), h.AllowFrom, h.Primaries) {
+		resp.Header.RCode = RefusedRCode
+		w.WriteMessage(resp)
+		return
+	}
+
+	w.WriteMessage(resp)
+	go h.refresh()
+}
+
+// sourceAllowed reports whether a NOTIFY message sent from addr is accepted,
+// the address being either listed in allowFrom or the one of a primary
+func sourceAllowed(addr net.Addr, allowFrom []net.IP, primaries []string) bool {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+	for _, allowed := range allowFrom {
+		if allowed.Equal(ip) {
+			return true
+		}
+	}
+
+	for _, primary := range primaries {
+		primaryHost, _, err := net.SplitHostPort(primary)
+		if err == nil && net.ParseIP(primaryHost).Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// refresh checks the zone against its primaries. Notifications received while
+// a refresh is running cause another refresh once it is done
+func (h *NotifyHandler) refresh() {
+	h.mu.Lock()
+	if h.refreshing {
+		h.pending = true
+		h.mu.Unlock()
+		return
+	}
+	h.refreshing = true
+	h.mu.Unlock()
+
+	for {
+		for _, primary := range h.Primaries {
+			if _, err := h.Client.Refresh(h.Zone, primary); err == nil {
+				break
+			}
+		}
+
+		h.mu.Lock()
+		if !h.pending {
+			h.refreshing = false
+			h.mu.Unlock()
+			return
+		}
+		h.pending = false
+		h.mu.Unlock()
+	}
+}
+
+// Refresh checks the serial of the zone on the primary at addr and brings the
+// zone up to date with an incremental transfer when the primary holds a newer
+// version. It reports whether the zone was updated
+func (c *Client) Refresh(z *Zone, addr string) (bool, error) {
+	m := &Message{
+		Header:   Header{Opcode: QueryOpcode, QuestionCount: 1},
+		Question: Question{Name: z.Origin(), Type: QType(SOAType), Class: INClass},
+	}
+
+	resp, err := c.Exchange(m, addr)
+	if err != nil {
+		return false, err
+	}
+
+	if resp.Header.RCode != NoErrorRCode {
+		return false, fmt.Errorf("SOA query failed. rcode=%s", resp.Header.RCode)
+	}
+
+	serial, ok := uint32(0), false
+	for _, rr := range resp.Answers {
+		if rr.Type == SOAType && rr.Name.Equal(z.Origin()) {
+			serial, ok = soaSerial(rr), true
+		}
+	}
+
+	if !ok {
+		return false, fmt.Errorf("SOA query answered without SOA record")
+	}
+
+	if !SerialLess(z.Serial(), serial) {
+		return false, nil
+	}
+
+	if err := c.IXFR(z, addr); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
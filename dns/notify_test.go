@@ -0,0 +1,139 @@
+package dns_test
+
+import (
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func TestNotify(t *testing.T) {
+	primary, j := primaryZone(t)
+	primaryAddr := startServer(t, &dns.TransferHandler{Zone: primary, Journal: j})
+
+	secondary, err := dns.NewZone(mustName(t, "example.com"), []dns.ResourceRecord{
+		soaRecord(t, "example.com", 1),
+		aRecord(t, "www.example.com", "192.0.2.1"),
+		aRecord(t, "mail.example.com", "192.0.2.2"),
+	})
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+
+	secondaryAddr := startServer(t, &dns.NotifyHandler{
+		Zone:      secondary,
+		Primaries: []string{primaryAddr},
+	})
+
+	n := dns.Notifier{
+		Secondaries: []string{secondaryAddr},
+		Client:      dns.Client{Timeout: time.Second},
+		MaxAttempts: 1,
+	}
+	if err := n.Notify(primary); err != nil {
+		t.Fatalf("Notify failed with error %s", err.Error())
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for secondary.Serial() != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("secondary was not refreshed. serial=%d", secondary.Serial())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assertSameRecords(t, secondary.Records(), primary.Records())
+}
+
+func TestNotify_refused(t *testing.T) {
+	primary, _ := primaryZone(t)
+	secondaryAddr := startServer(t, &dns.NotifyHandler{
+		Zone:      primary,
+		Primaries: []string{"192.0.2.53:53"},
+	})
+
+	n := dns.Notifier{
+		Secondaries: []string{secondaryAddr},
+		Client:      dns.Client{Timeout: time.Second},
+		MaxAttempts: 1,
+	}
+
+	err := n.Notify(primary)
+	if err == nil {
+		t.Fatal("Notify should return an error if the secondary refuses the notification")
+	}
+
+	if !strings.Contains(err.Error(), "Refused") {
+		t.Fatalf("Notify returned unexpected error %s", err.Error())
+	}
+}
+
+func TestNotify_retry(t *testing.T) {
+	primary, _ := primaryZone(t)
+
+	attempts := make(chan struct{}, 10)
+	addr := startServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		attempts <- struct{}{}
+		if len(attempts) < 2 {
+			// drop the first notification
+			return
+		}
+		w.WriteMessage(dns.NewResponse(r))
+	}))
+
+	n := dns.Notifier{
+		Secondaries:   []string{addr},
+		Client:        dns.Client{Timeout: 200 * time.Millisecond},
+		RetryInterval: 10 * time.Millisecond,
+	}
+	if err := n.Notify(primary); err == nil || !strings.Contains(err.Error(), addr) {
+		t.Fatalf("Notify should name the secondary that did not answer. err=%v", err)
+	}
+
+	// the secondary is notified again in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for len(attempts) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("notification was not retried")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if len(attempts) != 2 {
+		t.Fatalf("unexpected attempt count. actual=%d expected=2", len(attempts))
+	}
+}
+
+func TestNotify_unanswered(t *testing.T) {
+	primary, _ := primaryZone(t)
+	addr := startServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {}))
+
+	var logs lockedBuffer
+	n := dns.Notifier{
+		Secondaries:   []string{addr},
+		Client:        dns.Client{Timeout: 100 * time.Millisecond},
+		RetryInterval: 500 * time.Millisecond,
+		MaxAttempts:   3,
+		ErrorLog:      log.New(&logs, "", 0),
+	}
+
+	// Notify does not wait for the retries
+	start := time.Now()
+	if err := n.Notify(primary); err == nil {
+		t.Fatal("Notify should return an error if the secondary does not answer")
+	}
+	if elapsed := time.Since(start); elapsed >= n.RetryInterval {
+		t.Fatalf("Notify waited for the retries. elapsed=%s", elapsed)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(logs.String(), "after 3 attempts") {
+		if time.Now().After(deadline) {
+			t.Fatalf("unanswered notifications were not logged. logs=%q", logs.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,437 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultOnlineSignatureValidity is the validity of the signatures made by
+	// an OnlineSigner without an explicit validity
+	defaultOnlineSignatureValidity = 7 * 24 * time.Hour
+	// maxCachedSignatures bounds the number of RRsets whose signatures are
+	// cached by an OnlineSigner
+	maxCachedSignatures = 10000
+	// maxLabelLength is the largest length of a label (RFC 1035 section 2.3.4)
+	maxLabelLength = 63
+)
+
+// OnlineSigner is a Handler signing the responses of another handler at
+// response time, for zones changing too often to be signed beforehand. Names
+// are proven not to exist by NSEC records made up for each response: records
+// covering nothing but the missing name (RFC 4470) or, with CompactDenial, a
+// NSEC record owned by the missing name (RFC 9824). Only the responses to
+// requests with the DO bit set are signed
+type OnlineSigner struct {
+	// Handler answers the requests from the records of Zone, usually a
+	// ZoneHandler
+	Handler Handler
+	// Zone is the zone being served. It must publish the DNSKEY records of
+	// the keys
+	Zone *Zone
+	// Keys sign the responses, as done by ZoneSigner
+	Keys []SigningKey
+	// CompactDenial answers the queries for missing names with NODATA
+	// responses rather than NXDOMAIN responses
+	CompactDenial bool
+	// Validity is the validity of the signatures. Cached signatures are made
+	// again once half of it has passed. Defaults to 7 days
+	Validity time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedSignatures
+	// zd describes the zone as of the serial zdSerial
+	zd       *zoneData
+	zdSerial uint32
+}
+
+type cachedSignatures struct {
+	records []ResourceRecord
+	renewal time.Time
+}
+
+func (s *OnlineSigner) validity() time.Duration {
+	if s.Validity == 0 {
+		return defaultOnlineSignatureValidity
+	}
+
+	return s.Validity
+}
+
+// ServeDNS implements the Handler interface
+func (s *OnlineSigner) ServeDNS(w ResponseWriter, r *Message) {
+	e, ok := r.EDNS()
+	if !ok || r.Header.Opcode != QueryOpcode || r.Header.QuestionCount != 1 ||
+		r.Question.Type == AXFRQType || r.Question.Type == IXFRQType {
+		s.Handler.ServeDNS(w, r)
+		return
+	}
+
+	s.Handler.ServeDNS(&onlineSigningWriter{ResponseWriter: w, s: s, request: r, do: e.DO}, r)
+}
+
+// onlineSigningWriter signs the responses written by the handler of an
+// OnlineSigner
+type onlineSigningWriter struct {
+	ResponseWriter
+	s       *OnlineSigner
+	request *Message
+	do      bool
+}
+
+func (w *onlineSigningWriter) WriteMessage(m *Message) error {
+	resp := *m
+	if w.do {
+		if err := w.s.sign(&resp); err != nil {
+			resp = *NewResponse(w.request)
+			resp.Header.RCode = ServerFailureRCode
+		}
+	}
+
+	// the OPT record of the handler, if any, is replaced
+	additional := make([]ResourceRecord, 0, len(resp.Additional)+1)
+	for _, rr := range resp.Additional {
+		if rr.Type != OPTType {
+			additional = append(additional, rr)
+		}
+	}
+
+	opt := EDNS{UDPSize: defaultEDNSUDPSize, DO: w.do}
+	resp.Additional = append(additional, opt.ToRecord())
+	return w.ResponseWriter.WriteMessage(&resp)
+}
+
+// sign adds the RRSIG records of the authoritative RRsets of the response, and
+// the NSEC records proving the absence of the data it denies
+func (s *OnlineSigner) sign(m *Message) error {
+	zd := s.zoneData()
+	ttl := negativeSOA(s.Zone.SOA()).TTL
+
+	authority := append([]ResourceRecord{}, m.Authority...)
+	switch {
+	case !bool(m.Header.AA) && len(authority) > 0 && authority[0].Type == NSType:
+		// a referral: the DS records of the delegation or the proof there are none
+		cut := authority[0].Name
+		if ds := s.Zone.Lookup(cut, DSType); len(ds) > 0 {
+			authority = append(authority, ds...)
+		} else {
+			authority = append(authority, s.nsecAt(zd, cut, ttl))
+		}
+	case bool(m.Header.AA) && (m.Header.RCode == NameErrorRCode || hasSOA(authority)):
+		denial, exists, err := s.denial(zd, deniedName(m), ttl)
+		if err != nil {
+			return err
+		}
+		authority = append(authority, denial...)
+
+		// the response code reflects the last name of the CNAME chain (RFC 6604)
+		m.Header.RCode = NameErrorRCode
+		if exists || s.CompactDenial {
+			m.Header.RCode = NoErrorRCode
+		}
+	}
+
+	answers, err := s.signSection(zd, m.Answers)
+	if err != nil {
+		return err
+	}
+
+	authority, err = s.signSection(zd, authority)
+	if err != nil {
+		return err
+	}
+
+	m.Answers, m.Authority = answers, authority
+	return nil
+}
+
+// zoneData returns the names and types of the zone, described again when its
+// serial changes
+func (s *OnlineSigner) zoneData() *zoneData {
+	serial := s.Zone.Serial()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.zd == nil || s.zdSerial != serial {
+		records := s.Zone.Records()
+		s.zd, s.zdSerial = newZoneData(s.Zone.Origin(), records), soaSerial(records[0])
+	}
+
+	return s.zd
+}
+
+// deniedName returns the name a negative response denies the data of: the
+// name of the question, or the target the CNAME chain of the answer ends at
+func deniedName(m *Message) Name {
+	last := len(m.Answers) - 1
+	if last < 0 || m.Answers[last].Type != CNAMEType {
+		return m.Question.Name
+	}
+
+	target := Name{}
+	if _, err := target.fromBytes(m.Answers[last].Data, 0); err != nil {
+		return m.Question.Name
+	}
+
+	return target
+}
+
+func hasSOA(records []ResourceRecord) bool {
+	for _, rr := range records {
+		if rr.Type == SOAType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// denial returns the NSEC records proving the absence of the records of name.
+// It reports whether name exists, the response then being a NODATA response
+func (s *OnlineSigner) denial(zd *zoneData, name Name, ttl int32) ([]ResourceRecord, bool, error) {
+	if !name.IsSubdomainOf(zd.origin) {
+		return nil, false, fmt.Errorf("%s is out of zone %s", name.GetName(), zd.origin.GetName())
+	}
+
+	if zd.exists(name) {
+		return []ResourceRecord{s.nsecAt(zd, name, ttl)}, true, nil
+	}
+
+	if s.CompactDenial {
+		next, err := childName("\x00", name)
+		if err != nil {
+			return nil, false, err
+		}
+
+		nsec := NSEC{NextDomain: next, Types: []Type{RRSIGType, NSECType, NXNAMEType}}
+		return []ResourceRecord{NewResourceRecord(name, NSECType, INClass, ttl, nsec.ToBytes())}, false, nil
+	}
+
+	// the next closer name is the child of the closest encloser leading to name
+	nextCloser := name
+	encloser, _ := parentName(name)
+	for !zd.exists(encloser) {
+		nextCloser = encloser
+		encloser, _ = parentName(encloser)
+	}
+
+	denial := make([]ResourceRecord, 0, 2)
+	for _, n := range []Name{nextCloser, wildcardOf(encloser)} {
+		if zd.exists(n) {
+			continue
+		}
+
+		nsec, err := s.whiteLie(zd, n, encloser, ttl)
+		if err != nil {
+			return nil, false, err
+		}
+		denial = append(denial, nsec)
+	}
+
+	return denial, false, nil
+}
+
+// nsecAt returns the NSEC record owned by an existing name, covering no other
+// name
+func (s *OnlineSigner) nsecAt(zd *zoneData, name Name, ttl int32) ResourceRecord {
+	types := zd.chainTypes(name)
+	if !hasType(types, RRSIGType) {
+		types = append(types, RRSIGType)
+	}
+
+	next, err := childName("\x00", name)
+	if err != nil {
+		// the name is too long to have children
+		next = name
+	}
+
+	nsec := NSEC{NextDomain: next, Types: append(types, NSECType)}
+	return NewResourceRecord(name, NSECType, INClass, ttl, nsec.ToBytes())
+}
+
+// whiteLie returns a NSEC record covering the missing name, a child of parent,
+// and its descendants only (RFC 4470 section 3)
+func (s *OnlineSigner) whiteLie(zd *zoneData, name, parent Name, ttl int32) (ResourceRecord, error) {
+	label := nameLabels(name)[0]
+	next, err := childName(label+"\x00", parent)
+	if err != nil {
+		// the label cannot grow, the next name is the next sibling label
+		next, err = childName(label[:len(label)-1]+string(label[len(label)-1]+1), parent)
+		if err != nil {
+			return ResourceRecord{}, err
+		}
+	}
+
+	previous, ok := labelPredecessor(label, len(parent.ToBytes()))
+	if !ok {
+		// nothing sorts between the parent and name, the parent owns the record
+		nsec := NSEC{NextDomain: next, Types: append(zd.chainTypes(parent), NSECType)}
+		return NewResourceRecord(parent, NSECType, INClass, ttl, nsec.ToBytes()), nil
+	}
+
+	owner, err := childName(previous, parent)
+	if err != nil {
+		return ResourceRecord{}, err
+	}
+
+	nsec := NSEC{NextDomain: next, Types: []Type{RRSIGType, NSECType}}
+	return NewResourceRecord(owner, NSECType, INClass, ttl, nsec.ToBytes()), nil
+}
+
+// labelPredecessor returns the largest label sorting before label, bounded so
+// that the name it makes with a parent of parentLength bytes stays valid. The
+// labels being lowercase, 0x7F is the largest octet they hold in practice
+func labelPredecessor(label string, parentLength int) (string, bool) {
+	last := label[len(label)-1]
+	if last == 0 {
+		return label[:len(label)-1], len(label) > 1
+	}
+
+	previous := last - 1
+	if previous >= 'A' && previous <= 'Z' {
+		// uppercase octets never appear in names
+		previous = 'A' - 1
+	}
+
+	predecessor := []byte(label[:len(label)-1] + string(previous))
+	for len(predecessor) < maxLabelLength && 1+len(predecessor)+parentLength < 255 {
+		predecessor = append(predecessor, 0x7F)
+	}
+
+	return string(predecessor), true
+}
+
+// childName returns the name made of the label followed by the parent
+func childName(label string, parent Name) (Name, error) {
+	if parent.GetName() == "." {
+		return NewName(label)
+	}
+
+	return NewName(label + "." + parent.GetName())
+}
+
+// exists reports whether the name owns authoritative records or is an empty
+// non-terminal
+func (zd *zoneData) exists(name Name) bool {
+	if zd.isGlue(name) {
+		return false
+	}
+
+	if _, ok := zd.types[name.GetName()]; ok {
+		return true
+	}
+
+	for _, n := range zd.names {
+		if n.IsSubdomainOf(name) && !zd.isGlue(n) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// signSection returns the records of a section followed by the signatures of
+// its authoritative RRsets
+func (s *OnlineSigner) signSection(zd *zoneData, section []ResourceRecord) ([]ResourceRecord, error) {
+	ksks, zsks, err := (&ZoneSigner{Keys: s.Keys}).splitKeys(zd.origin)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := append([]ResourceRecord{}, section...)
+	for _, set := range groupRRsets(section) {
+		if set[0].Type == RRSIGType || !zd.signs(set[0]) {
+			continue
+		}
+
+		keys := zsks
+		if set[0].Name.Equal(zd.origin) && isKeyType(set[0].Type) {
+			keys = ksks
+		}
+
+		sigs, err := s.signatures(set, keys)
+		if err != nil {
+			return nil, err
+		}
+		signed = append(signed, sigs...)
+	}
+
+	return signed, nil
+}
+
+// signatures returns the signatures of the RRset made with the keys, from the
+// cache when they are recent enough
+func (s *OnlineSigner) signatures(rrs []ResourceRecord, keys []SigningKey) ([]ResourceRecord, error) {
+	// the signatures of keys no longer in use must not be served from the cache
+	key := rrsetKey(rrs)
+	for _, k := range keys {
+		dnskey, err := k.DNSKEY()
+		if err != nil {
+			return nil, err
+		}
+		key += fmt.Sprintf("/%d-%d", dnskey.Algorithm, dnskey.KeyTag())
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	cached, ok := s.cache[key]
+	s.mu.Unlock()
+	if ok && now.Before(cached.renewal) {
+		return cached.records, nil
+	}
+
+	sigs := make([]ResourceRecord, 0, len(keys))
+	for _, k := range keys {
+		sig, err := SignRRset(rrs, k, now.Add(-defaultInceptionOffset), now.Add(s.validity()))
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, sig)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cache == nil {
+		s.cache = make(map[string]cachedSignatures)
+	}
+
+	if len(s.cache) >= maxCachedSignatures {
+		for k, c := range s.cache {
+			if !now.Before(c.renewal) {
+				delete(s.cache, k)
+			}
+		}
+		if len(s.cache) >= maxCachedSignatures {
+			s.cache = make(map[string]cachedSignatures)
+		}
+	}
+
+	s.cache[key] = cachedSignatures{records: sigs, renewal: now.Add(s.validity() / 2)}
+	return sigs, nil
+}
+
+// rrsetKey identifies the RRset in the signature cache by its owner, type, TTL
+// and data
+func rrsetKey(rrs []ResourceRecord) string {
+	rdatas := make([][]byte, 0, len(rrs))
+	for _, rr := range rrs {
+		rdatas = append(rdatas, rr.Data)
+	}
+	sort.Slice(rdatas, func(i, j int) bool { return bytes.Compare(rdatas[i], rdatas[j]) < 0 })
+
+	h := sha256.New()
+	for _, rdata := range rdatas {
+		h.Write(appendUint16(nil, uint16(len(rdata))))
+		h.Write(rdata)
+	}
+
+	return fmt.Sprintf("%s/%d/%d/%d/%s", rrs[0].Name.GetName(), rrs[0].Type, rrs[0].Class, rrs[0].TTL,
+		hex.EncodeToString(h.Sum(nil)))
+}
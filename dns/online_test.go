@@ -0,0 +1,252 @@
+package dns_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+// dnssecQuery returns a query for the name and type carrying an OPT record,
+// with the DO bit set when do is true
+func dnssecQuery(t *testing.T, name string, qtype dns.QType, do bool) *dns.Message {
+	m, err := dns.NewQuestion(name)
+	if err != nil {
+		t.Fatalf("NewQuestion failed with error %s", err.Error())
+	}
+
+	m.Question.Type = qtype
+	opt := dns.EDNS{UDPSize: 1232, DO: do}
+	m.Additional = []dns.ResourceRecord{opt.ToRecord()}
+	return m
+}
+
+func countType(records []dns.ResourceRecord, rtype dns.Type) int {
+	count := 0
+	for _, rr := range records {
+		if rr.Type == rtype {
+			count++
+		}
+	}
+
+	return count
+}
+
+func TestOnlineSigner(t *testing.T) {
+	ksk := signingKey(t, "example.com", dns.ECDSAP256SHA256Algorithm)
+	zsk := signingKey(t, "example.com", dns.ED25519Algorithm)
+	zsk.Flags = dns.ZoneKeyFlag
+
+	z, err := dns.NewZone(mustName(t, "example.com"), []dns.ResourceRecord{
+		soaRecord(t, "example.com", 1),
+		nameRecord(t, "example.com", dns.NSType, "ns1.example.com"),
+		dnskeyRecord(t, ksk),
+		dnskeyRecord(t, zsk),
+		aRecord(t, "ns1.example.com", "192.0.2.1"),
+		aRecord(t, "www.example.com", "192.0.2.2"),
+		aRecord(t, "a.b.example.com", "192.0.2.3"),
+		nameRecord(t, "alias.example.com", dns.CNAMEType, "missing.example.com"),
+		nameRecord(t, "insecure.example.com", dns.NSType, "ns.insecure.example.com"),
+		aRecord(t, "ns.insecure.example.com", "192.0.2.4"),
+	})
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+
+	var cases = []struct {
+		name          string
+		qtype         dns.QType
+		compactDenial bool
+		rcode         dns.RCode
+	}{
+		{"www.example.com", dns.QType(dns.AType), false, dns.NoErrorRCode},
+		{"www.example.com", dns.QType(dns.AAAAType), false, dns.NoErrorRCode},
+		{"b.example.com", dns.QType(dns.AType), false, dns.NoErrorRCode},
+		{"nothere.example.com", dns.QType(dns.AType), false, dns.NameErrorRCode},
+		{"a.nothere.b.example.com", dns.QType(dns.AType), false, dns.NameErrorRCode},
+		{"alias.example.com", dns.QType(dns.AType), false, dns.NameErrorRCode},
+		{"insecure.example.com", dns.QType(dns.DSType), false, dns.NoErrorRCode},
+		{"www.insecure.example.com", dns.QType(dns.AType), false, dns.NoErrorRCode},
+		{"nothere.example.com", dns.QType(dns.AType), true, dns.NoErrorRCode},
+		{"www.example.com", dns.QType(dns.AAAAType), true, dns.NoErrorRCode},
+	}
+
+	for i, c := range cases {
+		signer := &dns.OnlineSigner{
+			Handler:       &dns.ZoneHandler{Zone: z},
+			Zone:          z,
+			Keys:          []dns.SigningKey{ksk, zsk},
+			CompactDenial: c.compactDenial,
+		}
+		addr := startServer(t, signer)
+		client := dns.Client{}
+		querier := dns.QuerierFunc(func(name dns.Name, qtype dns.QType) (dns.Message, error) {
+			return client.Exchange(dnssecQuery(t, name.GetName(), qtype, true), addr)
+		})
+
+		resp, err := querier.Query(mustName(t, c.name), c.qtype)
+		if err != nil {
+			t.Fatalf("Query failed. case=%d err=%s", i, err.Error())
+		}
+
+		if resp.Header.RCode != c.rcode {
+			t.Fatalf("unexpected rcode. case=%d actual=%s expected=%s", i, resp.Header.RCode, c.rcode)
+		}
+
+		if e, ok := resp.EDNS(); !ok || !e.DO {
+			t.Fatalf("response should echo the DO bit. case=%d", i)
+		}
+
+		v := dns.Validator{TrustAnchors: []dns.ResourceRecord{dsRecord(t, ksk)}, Querier: querier}
+		status, err := v.Validate(&resp)
+		if status != dns.SecureStatus {
+			t.Fatalf("unexpected status. case=%d actual=%s err=%v", i, status, err)
+		}
+	}
+}
+
+func TestOnlineSignerUnsigned(t *testing.T) {
+	key := signingKey(t, "example.com", dns.ED25519Algorithm)
+	z, err := dns.NewZone(mustName(t, "example.com"), []dns.ResourceRecord{
+		soaRecord(t, "example.com", 1),
+		dnskeyRecord(t, key),
+		aRecord(t, "www.example.com", "192.0.2.1"),
+	})
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+
+	signer := &dns.OnlineSigner{Handler: &dns.ZoneHandler{Zone: z}, Zone: z, Keys: []dns.SigningKey{key}}
+	addr := startServer(t, signer)
+	client := dns.Client{}
+
+	resp, err := client.Exchange(dnssecQuery(t, "www.example.com", dns.QType(dns.AType), false), addr)
+	if err != nil {
+		t.Fatalf("Exchange failed with error %s", err.Error())
+	}
+
+	if countType(resp.Answers, dns.RRSIGType) != 0 {
+		t.Fatalf("responses to requests without the DO bit should not be signed")
+	}
+
+	if e, ok := resp.EDNS(); !ok || e.DO {
+		t.Fatalf("response should carry an OPT record without the DO bit")
+	}
+
+	// signatures are cached
+	var signatures [][]byte
+	for i := 0; i < 2; i++ {
+		resp, err := client.Exchange(dnssecQuery(t, "www.example.com", dns.QType(dns.AType), true), addr)
+		if err != nil {
+			t.Fatalf("Exchange failed with error %s", err.Error())
+		}
+
+		for _, rr := range resp.Answers {
+			if rr.Type == dns.RRSIGType {
+				signatures = append(signatures, rr.Data)
+			}
+		}
+	}
+
+	if len(signatures) != 2 || !bytes.Equal(signatures[0], signatures[1]) {
+		t.Fatalf("signatures should be cached. count=%d", len(signatures))
+	}
+}
+
+// messageRecorder keeps the last message written by a handler
+type messageRecorder struct {
+	m *dns.Message
+}
+
+func (w *messageRecorder) WriteMessage(m *dns.Message) error {
+	w.m = m
+	return nil
+}
+
+func (w *messageRecorder) RemoteAddr() net.Addr   { return nil }
+func (w *messageRecorder) Network() string        { return "udp" }
+func (w *messageRecorder) TSIGKeyName() string    { return "" }
+func (w *messageRecorder) SIG0SignerName() string { return "" }
+
+func TestOnlineSignerChanges(t *testing.T) {
+	zsk := signingKey(t, "example.com", dns.ED25519Algorithm)
+	zsk.Flags = dns.ZoneKeyFlag
+	next := signingKey(t, "example.com", dns.ED25519Algorithm)
+	next.Flags = dns.ZoneKeyFlag
+
+	z, err := dns.NewZone(mustName(t, "example.com"), []dns.ResourceRecord{
+		soaRecord(t, "example.com", 1),
+		dnskeyRecord(t, zsk),
+		aRecord(t, "www.example.com", "192.0.2.1"),
+	})
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+
+	// the handler adds an OPT record of its own, as a Forwarder does
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		(&dns.ZoneHandler{Zone: z}).ServeDNS(&optWriter{w}, r)
+	})
+	signer := &dns.OnlineSigner{Handler: handler, Zone: z, Keys: []dns.SigningKey{zsk}}
+	query := func(name string, qtype dns.Type) *dns.Message {
+		w := &messageRecorder{}
+		signer.ServeDNS(w, dnssecQuery(t, name, dns.QType(qtype), true))
+		if w.m == nil {
+			t.Fatalf("no response written for %s %s", name, dns.QType(qtype))
+		}
+		if countType(w.m.Additional, dns.OPTType) != 1 {
+			t.Fatalf("response should carry a single OPT record. count=%d", countType(w.m.Additional, dns.OPTType))
+		}
+		return w.m
+	}
+
+	signerTag := func(m *dns.Message) uint16 {
+		for _, rr := range m.Answers {
+			if sig, err := rr.RRSIG(); err == nil {
+				return sig.KeyTag
+			}
+		}
+		t.Fatalf("response holds no signature")
+		return 0
+	}
+
+	tag := func(key dns.SigningKey) uint16 {
+		k, _ := key.DNSKEY()
+		return k.KeyTag()
+	}
+
+	if actual := signerTag(query("www.example.com", dns.AType)); actual != tag(zsk) {
+		t.Fatalf("unexpected signer. actual=%d expected=%d", actual, tag(zsk))
+	}
+
+	// the signatures of a retired key are not served from the cache
+	signer.Keys = []dns.SigningKey{next}
+	if actual := signerTag(query("www.example.com", dns.AType)); actual != tag(next) {
+		t.Fatalf("unexpected signer after the key change. actual=%d expected=%d", actual, tag(next))
+	}
+
+	if resp := query("new.example.com", dns.AAAAType); resp.Header.RCode != dns.NameErrorRCode {
+		t.Fatalf("unexpected rcode. actual=%s", resp.Header.RCode)
+	}
+
+	// the names of the zone are described again once its serial changes
+	records := append(z.Records()[1:], soaRecord(t, "example.com", 2), aRecord(t, "new.example.com", "192.0.2.2"))
+	if err := z.Replace(records); err != nil {
+		t.Fatalf("Replace failed with error %s", err.Error())
+	}
+	if resp := query("new.example.com", dns.AAAAType); resp.Header.RCode != dns.NoErrorRCode {
+		t.Fatalf("unexpected rcode after the zone change. actual=%s", resp.Header.RCode)
+	}
+}
+
+// optWriter adds an OPT record to the responses it writes
+type optWriter struct {
+	dns.ResponseWriter
+}
+
+func (w *optWriter) WriteMessage(m *dns.Message) error {
+	opt := dns.EDNS{UDPSize: 4096}
+	m.Additional = append(m.Additional, opt.ToRecord())
+	return w.ResponseWriter.WriteMessage(m)
+}
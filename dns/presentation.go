@@ -0,0 +1,103 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+)
+
+// presentationFields splits the presentation form of record data into its
+// fields. Quoted character strings, possibly following a key= prefix, are a
+// single field stripped of their quotes, and the escapes of RFC 1035 section
+// 5.1, \X and \DDD, are decoded
+func presentationFields(s string) ([]string, error) {
+	fields := make([]string, 0)
+	for i := 0; i < len(s); {
+		if s[i] == ' ' || s[i] == '\t' {
+			i++
+			continue
+		}
+
+		var b strings.Builder
+		quoted, closed := false, false
+		for i < len(s) && !closed {
+			c := s[i]
+			switch {
+			case c == '"':
+				// a quoted string may follow the key= of a SVCB parameter
+				quoted, closed = !quoted, quoted
+				i++
+			case !quoted && (c == ' ' || c == '\t'):
+				closed = true
+			case c != '\\':
+				b.WriteByte(c)
+				i++
+			default:
+				decoded, n, err := unescape(s[i:])
+				if err != nil {
+					return nil, err
+				}
+				b.WriteByte(decoded)
+				i += n
+			}
+		}
+
+		if quoted {
+			return nil, fmt.Errorf("failed to parse presentation data, unterminated quoted string")
+		}
+		fields = append(fields, b.String())
+	}
+
+	return fields, nil
+}
+
+// unescape decodes the escape at the start of s, returning the byte it stands
+// for and the length of the escape
+func unescape(s string) (byte, int, error) {
+	if len(s) < 2 {
+		return 0, 0, fmt.Errorf("failed to parse presentation data, trailing backslash")
+	}
+
+	if s[1] < '0' || s[1] > '9' {
+		return s[1], 2, nil
+	}
+
+	if len(s) < 4 {
+		return 0, 0, fmt.Errorf("failed to parse presentation data, invalid escape %s", s)
+	}
+
+	value := 0
+	for _, c := range s[1:4] {
+		if c < '0' || c > '9' {
+			return 0, 0, fmt.Errorf("failed to parse presentation data, invalid escape %s", s[:4])
+		}
+		value = value*10 + int(c-'0')
+	}
+	if value > 255 {
+		return 0, 0, fmt.Errorf("failed to parse presentation data, invalid escape %s", s[:4])
+	}
+
+	return byte(value), 4, nil
+}
+
+// quoteString returns the presentation form of a character string: quoted,
+// with quotes and backslashes escaped and the non printable bytes written as
+// \DDD
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7F:
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
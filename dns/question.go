@@ -47,6 +47,10 @@ func questionFromBytes(data []byte, offset int) (Question, int, error) {
 	n += bytesRead
 	offset += bytesRead
 
+	if offset+4 > len(data) {
+		return Question{}, 0, fmt.Errorf("failed to parse question, unexpected end of data. offset=%d", offset)
+	}
+
 	qtype, err := extractQType(data[offset], data[offset+1])
 	if err != nil {
 		return Question{}, 0, err
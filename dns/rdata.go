@@ -0,0 +1,168 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SOA is the data of a SOA resource record, marking the start of a zone of
+// authority
+type SOA struct {
+	// MName is the name server that was the original source of data for the zone
+	MName Name
+	// RName is the mailbox of the person responsible for the zone
+	RName Name
+	// Serial is the version number of the zone
+	Serial uint32
+	// Refresh is the interval in seconds before the zone should be refreshed
+	Refresh uint32
+	// Retry is the interval in seconds before a failed refresh should be retried
+	Retry uint32
+	// Expire is the number of seconds after which the zone is no longer
+	// authoritative if it could not be refreshed
+	Expire uint32
+	// Minimum is the TTL used for negative responses
+	Minimum uint32
+}
+
+// ToBytes returns the byte array form of the SOA data
+func (s *SOA) ToBytes() []byte {
+	data := make([]byte, 0, 0)
+
+	data = append(data, s.MName.ToBytes()...)
+	data = append(data, s.RName.ToBytes()...)
+	data = appendUint32(data, s.Serial)
+	data = appendUint32(data, s.Refresh)
+	data = appendUint32(data, s.Retry)
+	data = appendUint32(data, s.Expire)
+	data = appendUint32(data, s.Minimum)
+
+	return data
+}
+
+func (s *SOA) String() string {
+	fields := []string{
+		nameToString(s.MName),
+		nameToString(s.RName),
+		fmt.Sprintf("%d", s.Serial),
+		fmt.Sprintf("%d", s.Refresh),
+		fmt.Sprintf("%d", s.Retry),
+		fmt.Sprintf("%d", s.Expire),
+		fmt.Sprintf("%d", s.Minimum),
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// SOA returns the data of a SOA resource record
+func (rr ResourceRecord) SOA() (SOA, error) {
+	if rr.Type != SOAType {
+		return SOA{}, fmt.Errorf("resource record is not a SOA record. type=%s", rr.Type)
+	}
+
+	return soaFromBytes(rr.Data)
+}
+
+func soaFromBytes(data []byte) (SOA, error) {
+	offset := 0
+	mname := Name{}
+	bytesRead, err := mname.fromBytes(data, offset)
+	if err != nil {
+		return SOA{}, err
+	}
+	offset += bytesRead
+
+	rname := Name{}
+	bytesRead, err = rname.fromBytes(data, offset)
+	if err != nil {
+		return SOA{}, err
+	}
+	offset += bytesRead
+
+	if len(data)-offset != 20 {
+		return SOA{}, fmt.Errorf("failed to parse SOA data, invalid length %d", len(data))
+	}
+
+	return SOA{
+		MName:   mname,
+		RName:   rname,
+		Serial:  readUint32(data, offset),
+		Refresh: readUint32(data, offset+4),
+		Retry:   readUint32(data, offset+8),
+		Expire:  readUint32(data, offset+12),
+		Minimum: readUint32(data, offset+16),
+	}, nil
+}
+
+// MX is the data of a MX resource record, naming a host willing to act as a
+// mail exchange for the owner name
+type MX struct {
+	// Preference orders the mail exchanges, lower values being preferred
+	Preference uint16
+	Exchange   Name
+}
+
+// ToBytes returns the byte array form of the MX data
+func (m *MX) ToBytes() []byte {
+	return append(appendUint16(nil, m.Preference), m.Exchange.ToBytes()...)
+}
+
+func (m *MX) String() string {
+	return fmt.Sprintf("%d %s", m.Preference, nameToString(m.Exchange))
+}
+
+// MX returns the data of a MX resource record
+func (rr ResourceRecord) MX() (MX, error) {
+	if rr.Type != MXType {
+		return MX{}, fmt.Errorf("resource record is not a MX record. type=%s", rr.Type)
+	}
+
+	if len(rr.Data) < 3 {
+		return MX{}, fmt.Errorf("failed to parse MX data, invalid length %d", len(rr.Data))
+	}
+
+	exchange := Name{}
+	if _, err := exchange.fromBytes(rr.Data, 2); err != nil {
+		return MX{}, err
+	}
+
+	return MX{Preference: catBytes(rr.Data[0], rr.Data[1]), Exchange: exchange}, nil
+}
+
+// txtStrings returns the character strings of TXT data
+func txtStrings(data []byte) ([]string, error) {
+	strs := make([]string, 0, 1)
+	for offset := 0; offset < len(data); {
+		length := int(data[offset])
+		if offset+1+length > len(data) {
+			return nil, fmt.Errorf("failed to parse TXT data, invalid length %d", len(data))
+		}
+		strs = append(strs, string(data[offset+1:offset+1+length]))
+		offset += 1 + length
+	}
+
+	return strs, nil
+}
+
+// nameToString returns the fully qualified presentation form of a name
+func nameToString(n Name) string {
+	name := n.GetName()
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+
+	return name + "."
+}
+
+func appendUint16(data []byte, value uint16) []byte {
+	return append(data, byte(value>>8), byte(value&0xFF))
+}
+
+func appendUint32(data []byte, value uint32) []byte {
+	return append(data, byte(value>>24), byte(value>>16), byte(value>>8), byte(value&0xFF))
+}
+
+func readUint32(data []byte, offset int) uint32 {
+	return uint32(data[offset])<<24 | uint32(data[offset+1])<<16 |
+		uint32(data[offset+2])<<8 | uint32(data[offset+3])
+}
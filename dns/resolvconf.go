@@ -0,0 +1,167 @@
+package dns
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxNameservers is the number of name servers of resolv.conf that are
+	// used, the others being ignored as done by the C library
+	maxNameservers = 3
+	// maxNDots, maxResolvTimeout and maxAttempts cap the options of
+	// resolv.conf as done by the C library
+	maxNDots         = 15
+	maxResolvTimeout = 30
+	maxAttempts      = 5
+)
+
+// ResolvConf is the configuration of a stub resolver, as found in
+// /etc/resolv.conf (see resolv.conf(5))
+type ResolvConf struct {
+	// Servers are the addresses of the name servers, ie: "192.0.2.1:53"
+	Servers []string
+	// Search is the list of domains appended to relative names
+	Search []string
+	// NDots is the number of dots from which a name is tried as is before
+	// the search list
+	NDots int
+	// Timeout bounds each query sent to a name server
+	Timeout time.Duration
+	// Attempts is the number of times the name servers are tried
+	Attempts int
+	// Rotate spreads the queries over the name servers rather than always
+	// trying them in order
+	Rotate bool
+	// EDNS0 adds an OPT record to the queries
+	EDNS0 bool
+}
+
+// DefaultResolvConf returns the configuration used when resolv.conf is
+// missing: the local name server, the domain of the host name as search
+// list, and the default options
+func DefaultResolvConf() *ResolvConf {
+	c := &ResolvConf{
+		Servers:  []string{"127.0.0.1:53", "[::1]:53"},
+		NDots:    1,
+		Timeout:  5 * time.Second,
+		Attempts: 2,
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		if i := strings.Index(hostname, "."); i >= 0 && i < len(hostname)-1 {
+			c.Search = []string{strings.ToLower(strings.TrimSuffix(hostname[i+1:], "."))}
+		}
+	}
+
+	return c
+}
+
+// ReadResolvConf parses the resolv.conf file at path. The settings missing
+// from the file keep the values of DefaultResolvConf
+func ReadResolvConf(path string) (*ResolvConf, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := DefaultResolvConf()
+	servers := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+
+		switch fields[0] {
+		case "nameserver":
+			if len(fields) < 2 || len(servers) == maxNameservers {
+				continue
+			}
+
+			// IPv6 addresses may hold a zone
+			ip := net.ParseIP(strings.SplitN(fields[1], "%", 2)[0])
+			if ip == nil {
+				return nil, fmt.Errorf("failed to parse resolv.conf, invalid name server. line=%d", line)
+			}
+			servers = append(servers, net.JoinHostPort(fields[1], "53"))
+		case "domain":
+			if len(fields) > 1 {
+				c.Search = []string{searchDomain(fields[1])}
+			}
+		case "search":
+			// the last of the domain and search lines wins
+			c.Search = make([]string, 0, len(fields)-1)
+			for _, domain := range fields[1:] {
+				c.Search = append(c.Search, searchDomain(domain))
+			}
+		case "options":
+			for _, option := range fields[1:] {
+				c.setOption(option)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(servers) > 0 {
+		c.Servers = servers
+	}
+
+	return c, nil
+}
+
+func searchDomain(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(domain, "."))
+}
+
+// setOption applies an option of an options line. Unknown options are ignored
+func (c *ResolvConf) setOption(option string) {
+	name, value, _ := strings.Cut(option, ":")
+	n, err := strconv.Atoi(value)
+	switch {
+	case name == "ndots" && err == nil && n >= 0:
+		c.NDots = min(n, maxNDots)
+	case name == "timeout" && err == nil && n >= 1:
+		c.Timeout = time.Duration(min(n, maxResolvTimeout)) * time.Second
+	case name == "attempts" && err == nil && n >= 1:
+		c.Attempts = min(n, maxAttempts)
+	case name == "rotate":
+		c.Rotate = true
+	case name == "edns0":
+		c.EDNS0 = true
+	}
+}
+
+// NameList returns the names tried in order to resolve name, following the
+// C library: a name ending with a dot is only tried as is. Otherwise, a name
+// holding at least NDots dots is tried as is and then with the search
+// domains appended, and other names the other way around
+func (c *ResolvConf) NameList(name string) []string {
+	if strings.HasSuffix(name, ".") {
+		return []string{strings.TrimSuffix(name, ".")}
+	}
+
+	names := make([]string, 0, len(c.Search)+1)
+	for _, domain := range c.Search {
+		if domain == "" {
+			continue
+		}
+		names = append(names, name+"."+domain)
+	}
+
+	if strings.Count(name, ".") >= c.NDots {
+		return append([]string{name}, names...)
+	}
+
+	return append(names, name)
+}
@@ -0,0 +1,91 @@
+package dns_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+// writeFile writes the content to a file of a temporary directory and returns
+// its path
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile failed with error %s", err.Error())
+	}
+
+	return path
+}
+
+func TestReadResolvConf(t *testing.T) {
+	path := writeFile(t, "resolv.conf", `# generated
+; comment
+domain ignored.example
+search Example.com. corp.example.net
+nameserver 192.0.2.1
+nameserver 2001:db8::1
+nameserver fe80::1%eth0
+nameserver 192.0.2.4
+options ndots:2 timeout:3 attempts:9 rotate edns0 unknown
+`)
+
+	c, err := dns.ReadResolvConf(path)
+	if err != nil {
+		t.Fatalf("ReadResolvConf failed with error %s", err.Error())
+	}
+
+	expected := &dns.ResolvConf{
+		// only the first three name servers are used
+		Servers:  []string{"192.0.2.1:53", "[2001:db8::1]:53", "[fe80::1%eth0]:53"},
+		Search:   []string{"example.com", "corp.example.net"},
+		NDots:    2,
+		Timeout:  3 * time.Second,
+		Attempts: 5,
+		Rotate:   true,
+		EDNS0:    true,
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Fatalf("unexpected configuration. actual=%+v expected=%+v", c, expected)
+	}
+
+	// the settings missing from the file keep their default
+	c, err = dns.ReadResolvConf(writeFile(t, "resolv.conf", "search example.com\n"))
+	if err != nil {
+		t.Fatalf("ReadResolvConf failed with error %s", err.Error())
+	}
+
+	if len(c.Servers) != 2 || c.NDots != 1 || c.Timeout != 5*time.Second || c.Attempts != 2 || c.Rotate || c.EDNS0 {
+		t.Fatalf("unexpected default configuration. actual=%+v", c)
+	}
+
+	if _, err := dns.ReadResolvConf(writeFile(t, "resolv.conf", "nameserver example.com\n")); err == nil {
+		t.Fatalf("ReadResolvConf should fail on invalid name servers")
+	}
+}
+
+func TestResolvConfNameList(t *testing.T) {
+	c := &dns.ResolvConf{Search: []string{"example.com", "example.net"}, NDots: 1}
+
+	var cases = []struct {
+		ndots    int
+		name     string
+		expected []string
+	}{
+		{1, "www", []string{"www.example.com", "www.example.net", "www"}},
+		{1, "www.corp", []string{"www.corp", "www.corp.example.com", "www.corp.example.net"}},
+		{1, "www.corp.", []string{"www.corp"}},
+		{2, "www.corp", []string{"www.corp.example.com", "www.corp.example.net", "www.corp"}},
+		{0, "www", []string{"www", "www.example.com", "www.example.net"}},
+	}
+
+	for i, tc := range cases {
+		c.NDots = tc.ndots
+		if actual := c.NameList(tc.name); !reflect.DeepEqual(actual, tc.expected) {
+			t.Fatalf("unexpected name list. case=%d actual=%v expected=%v", i, actual, tc.expected)
+		}
+	}
+}
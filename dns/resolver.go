@@ -0,0 +1,417 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// errNoSuchHost is the description of the errors of the lookups of names
+	// that do not exist or hold no record of the type, as in the net package
+	errNoSuchHost = "no such host"
+	errTimeout    = "i/o timeout"
+	errCanceled   = "operation was canceled"
+	errMalformed  = "cannot unmarshal DNS message"
+)
+
+// Resolver looks up names with the methods of net.Resolver, building the
+// queries and interpreting the responses. Its methods are safe for concurrent
+// use. A lookup returning early because its context is done leaves the query
+// running until the querier gives up
+type Resolver struct {
+	// Querier sends the queries. When nil, a Stub configured from
+	// /etc/resolv.conf and /etc/hosts is used
+	Querier Querier
+	// Config holds the search list and the ndots option used to expand
+	// relative names. When nil, the configuration of the Querier is used if it
+	// is a Stub, otherwise names are only tried as is
+	Config *ResolvConf
+	// Validator validates the responses of the lookups whose records are only
+	// usable when secure, as the TLSA records checked by VerifyTLSA. The
+	// Querier must then answer with the DNSSEC records of the responses
+	Validator *Validator
+
+	once    sync.Once
+	stub    *Stub
+	stubErr error
+}
+
+// LookupHost returns the addresses of the host, as strings
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	ips, err := r.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, ip.String())
+	}
+
+	return addrs, nil
+}
+
+// LookupIP returns the addresses of the host for the network, "ip", "ip4" or
+// "ip6". With "ip", the A and AAAA records are queried in parallel and the
+// IPv4 addresses come first
+func (r *Resolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	var types []QType
+	switch network {
+	case "ip":
+		types = []QType{QType(AType), QType(AAAAType)}
+	case "ip4":
+		types = []QType{QType(AType)}
+	case "ip6":
+		types = []QType{QType(AAAAType)}
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if (network == "ip4" && ip.To4() == nil) || (network == "ip6" && ip.To4() != nil) {
+			return nil, &net.DNSError{Err: errNoSuchHost, Name: host, IsNotFound: true}
+		}
+		return []net.IP{ip}, nil
+	}
+
+	type result struct {
+		records []ResourceRecord
+		err     error
+	}
+	results := make([]chan result, len(types))
+	for i, t := range types {
+		results[i] = make(chan result, 1)
+		go func(c chan result, t QType) {
+			records, _, err := r.lookupRecords(ctx, host, t)
+			c <- result{records, err}
+		}(results[i], t)
+	}
+
+	ips := make([]net.IP, 0)
+	var lookupErr error
+	for _, c := range results {
+		res := <-c
+		if res.err != nil {
+			// a failure is reported rather than a name without records
+			if lookupErr == nil || isNotFound(lookupErr) {
+				lookupErr = res.err
+			}
+			continue
+		}
+
+		for _, rr := range res.records {
+			ips = append(ips, net.IP(rr.Data))
+		}
+	}
+
+	if len(ips) == 0 {
+		return nil, lookupErr
+	}
+
+	return ips, nil
+}
+
+// LookupCNAME returns the canonical name of the host, following the CNAME
+// records of its A or AAAA answers. Hosts without CNAME record are their own
+// canonical name, as long as they have addresses
+func (r *Resolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	var lookupErr error
+	for _, t := range []QType{QType(AType), QType(AAAAType)} {
+		m, err := r.lookup(ctx, host, t)
+		if err == nil {
+			target := cnameTarget(m.Question.Name, m.Answers)
+			if !target.Equal(m.Question.Name) || len(rrset(m.Answers, target, Type(t))) > 0 {
+				return nameToString(target), nil
+			}
+			err = notFound(host)
+		}
+
+		if lookupErr == nil || isNotFound(lookupErr) {
+			lookupErr = err
+		}
+	}
+
+	return "", lookupErr
+}
+
+// LookupMX returns the mail exchanges of the name, sorted by preference. The
+// exchanges of a same preference are in random order (RFC 5321 section 5.1)
+func (r *Resolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	records, _, err := r.lookupRecords(ctx, name, QType(MXType))
+	if err != nil {
+		return nil, err
+	}
+
+	mxs := make([]*net.MX, 0, len(records))
+	for _, rr := range records {
+		mx, err := rr.MX()
+		if err != nil {
+			return nil, malformed(name, err)
+		}
+		mxs = append(mxs, &net.MX{Host: nameToString(mx.Exchange), Pref: mx.Preference})
+	}
+
+	rand.Shuffle(len(mxs), func(i, j int) { mxs[i], mxs[j] = mxs[j], mxs[i] })
+	sort.SliceStable(mxs, func(i, j int) bool { return mxs[i].Pref < mxs[j].Pref })
+
+	return mxs, nil
+}
+
+// LookupSRV returns the canonical name of _service._proto.name and its SRV
+// records, sorted by priority and ordered by weighted random selection within
+// a priority (RFC 2782). The name is looked up directly when service and proto
+// are empty
+func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if service != "" || proto != "" {
+		name = "_" + service + "._" + proto + "." + name
+	}
+
+	records, cname, err := r.lookupRecords(ctx, name, QType(SRVType))
+	if err != nil {
+		return "", nil, err
+	}
+
+	srvs := make([]SRV, 0, len(records))
+	for _, rr := range records {
+		srv, err := rr.SRV()
+		if err != nil {
+			return "", nil, malformed(name, err)
+		}
+		srvs = append(srvs, srv)
+	}
+
+	addrs := make([]*net.SRV, 0, len(srvs))
+	for _, srv := range OrderSRV(srvs) {
+		addrs = append(addrs, &net.SRV{
+			Target:   nameToString(srv.Target),
+			Port:     srv.Port,
+			Priority: srv.Priority,
+			Weight:   srv.Weight,
+		})
+	}
+
+	return nameToString(cname), addrs, nil
+}
+
+// LookupNAPTR returns the NAPTR records of the name, in the order they must be
+// processed
+func (r *Resolver) LookupNAPTR(ctx context.Context, name string) ([]NAPTR, error) {
+	records, _, err := r.lookupRecords(ctx, name, QType(NAPTRType))
+	if err != nil {
+		return nil, err
+	}
+
+	naptrs := make([]NAPTR, 0, len(records))
+	for _, rr := range records {
+		naptr, err := rr.NAPTR()
+		if err != nil {
+			return nil, malformed(name, err)
+		}
+		naptrs = append(naptrs, naptr)
+	}
+
+	return OrderNAPTR(naptrs), nil
+}
+
+// LookupTXT returns the TXT records of the name, the character strings of each
+// record being concatenated
+func (r *Resolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, _, err := r.lookupRecords(ctx, name, QType(TXTType))
+	if err != nil {
+		return nil, err
+	}
+
+	txts := make([]string, 0, len(records))
+	for _, rr := range records {
+		txt, err := rr.TXT()
+		if err != nil {
+			return nil, malformed(name, err)
+		}
+		txts = append(txts, txt.Value())
+	}
+
+	return txts, nil
+}
+
+// LookupNS returns the name servers of the name
+func (r *Resolver) LookupNS(ctx context.Context, name string) ([]*net.NS, error) {
+	records, _, err := r.lookupRecords(ctx, name, QType(NSType))
+	if err != nil {
+		return nil, err
+	}
+
+	nss := make([]*net.NS, 0, len(records))
+	for _, rr := range records {
+		host := Name{}
+		if _, err := host.fromBytes(rr.Data, 0); err != nil {
+			return nil, malformed(name, err)
+		}
+		nss = append(nss, &net.NS{Host: nameToString(host)})
+	}
+
+	return nss, nil
+}
+
+// LookupAddr returns the names of the address, from the PTR records of its
+// reverse name
+func (r *Resolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, &net.DNSError{Err: "unrecognized address", Name: addr}
+	}
+
+	reverse, err := ReverseName(ip)
+	if err != nil {
+		return nil, &net.DNSError{UnwrapErr: err, Err: err.Error(), Name: addr}
+	}
+
+	records, _, err := r.lookupRecords(ctx, nameToString(reverse), QType(PTRType))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(records))
+	for _, rr := range records {
+		target := Name{}
+		if _, err := target.fromBytes(rr.Data, 0); err != nil {
+			return nil, malformed(addr, err)
+		}
+		names = append(names, nameToString(target))
+	}
+
+	return names, nil
+}
+
+// ReverseName returns the name of the in-addr.arpa or ip6.arpa domains holding
+// the PTR records of the address
+func ReverseName(ip net.IP) (Name, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return NewName(fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", ip4[3], ip4[2], ip4[1], ip4[0]))
+	}
+
+	if len(ip) != net.IPv6len {
+		return Name{}, fmt.Errorf("failed to build reverse name, invalid address length %d", len(ip))
+	}
+
+	var b strings.Builder
+	for i := len(ip) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "%x.%x.", ip[i]&0x0F, ip[i]>>4)
+	}
+	b.WriteString("ip6.arpa")
+
+	return NewName(b.String())
+}
+
+// lookupRecords returns the records of the type answering the name, at the end
+// of the CNAME chain of the answers, along with the name they are owned by
+func (r *Resolver) lookupRecords(ctx context.Context, name string, t QType) ([]ResourceRecord, Name, error) {
+	m, err := r.lookup(ctx, name, t)
+	if err != nil {
+		return nil, Name{}, err
+	}
+
+	target := cnameTarget(m.Question.Name, m.Answers)
+	records := rrset(m.Answers, target, Type(t))
+	if len(records) == 0 {
+		return nil, Name{}, notFound(name)
+	}
+
+	return records, target, nil
+}
+
+// lookup resolves the name, expanded with the search list, until the context is
+// done. Names that do not exist are reported as errors
+func (r *Resolver) lookup(ctx context.Context, name string, t QType) (Message, error) {
+	type result struct {
+		m   Message
+		err error
+	}
+	c := make(chan result, 1)
+	go func() {
+		m, err := r.resolve(name, t)
+		c <- result{m, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return Message{}, dnsError(name, ctx.Err())
+	case res := <-c:
+		if res.err != nil {
+			return Message{}, dnsError(name, res.err)
+		}
+		if res.m.Header.RCode == NameErrorRCode {
+			return Message{}, notFound(name)
+		}
+		return res.m, nil
+	}
+}
+
+// resolve resolves the name with the querier and the configuration
+func (r *Resolver) resolve(name string, t QType) (Message, error) {
+	q := r.Querier
+	if q == nil {
+		r.once.Do(func() {
+			r.stub, r.stubErr = NewStub("/etc/resolv.conf", "/etc/hosts")
+		})
+		if r.stubErr != nil {
+			return Message{}, r.stubErr
+		}
+		q = r.stub
+	}
+
+	config := r.Config
+	if s, ok := q.(*Stub); ok && config == nil {
+		return s.Lookup(name, t)
+	}
+	if config == nil {
+		config = &ResolvConf{}
+	}
+
+	return search(q, config, name, t)
+}
+
+// dnsError returns the error of a lookup as a net.DNSError, unless it already
+// is one
+func dnsError(name string, err error) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return err
+	}
+
+	e := &net.DNSError{UnwrapErr: err, Err: err.Error(), Name: name}
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		e.Err, e.IsTimeout = errTimeout, true
+	case errors.Is(err, context.Canceled):
+		e.Err = errCanceled
+	case errors.As(err, &netErr):
+		e.IsTimeout, e.IsTemporary = netErr.Timeout(), true
+	default:
+		e.IsTemporary = true
+	}
+
+	return e
+}
+
+// malformed returns the error of a lookup whose answer holds invalid data
+func malformed(name string, err error) error {
+	return &net.DNSError{UnwrapErr: err, Err: errMalformed, Name: name}
+}
+
+// notFound returns the error of a lookup of a name that does not exist or holds
+// no record of the type
+func notFound(name string) error {
+	return &net.DNSError{Err: errNoSuchHost, Name: name, IsNotFound: true}
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
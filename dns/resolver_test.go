@@ -0,0 +1,206 @@
+package dns_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func mxRecord(t *testing.T, name string, preference uint16, exchange string) dns.ResourceRecord {
+	mx := dns.MX{Preference: preference, Exchange: mustName(t, exchange)}
+	return dns.NewResourceRecord(mustName(t, name), dns.MXType, dns.INClass, 300, mx.ToBytes())
+}
+
+func srvRecord(t *testing.T, name string, priority, weight, port uint16, target string) dns.ResourceRecord {
+	srv := dns.SRV{Priority: priority, Weight: weight, Port: port, Target: mustName(t, target)}
+	return dns.NewResourceRecord(mustName(t, name), dns.SRVType, dns.INClass, 300, srv.ToBytes())
+}
+
+func naptrRecord(t *testing.T, name string, presentation string) dns.ResourceRecord {
+	naptr, err := dns.ParseNAPTR(presentation)
+	if err != nil {
+		t.Fatalf("ParseNAPTR failed with error %s", err.Error())
+	}
+	return dns.NewResourceRecord(mustName(t, name), dns.NAPTRType, dns.INClass, 300, naptr.ToBytes())
+}
+
+func testResolver(t *testing.T) *dns.Resolver {
+	z := mustZone(t, "example.com",
+		aRecord(t, "www.example.com", "192.0.2.1"),
+		dns.NewResourceRecord(mustName(t, "www.example.com"), dns.AAAAType, dns.INClass, 300,
+			net.ParseIP("2001:db8::1")),
+		nameRecord(t, "alias.example.com", dns.CNAMEType, "www.example.com"),
+		nameRecord(t, "example.com", dns.NSType, "ns1.example.com"),
+		mxRecord(t, "example.com", 20, "mx2.example.com"),
+		mxRecord(t, "example.com", 10, "mx1.example.com"),
+		srvRecord(t, "_sip._tcp.example.com", 20, 0, 5060, "backup.example.com"),
+		srvRecord(t, "_sip._tcp.example.com", 10, 60, 5060, "sip1.example.com"),
+		srvRecord(t, "_sip._tcp.example.com", 10, 40, 5060, "sip2.example.com"),
+		dns.NewResourceRecord(mustName(t, "example.com"), dns.TXTType, dns.INClass, 300,
+			[]byte("\x05hello\x06 world")),
+		aRecord(t, "v4.example.com", "192.0.2.2"),
+		naptrRecord(t, "example.com", `100 20 "S" "SIP+D2T" "" _sip._tcp.example.com.`),
+		naptrRecord(t, "example.com", `100 10 "S" "SIP+D2U" "" _sip._udp.example.com.`),
+	)
+	reverse := mustZone(t, "2.0.192.in-addr.arpa",
+		nameRecord(t, "1.2.0.192.in-addr.arpa", dns.PTRType, "www.example.com"))
+
+	addr := startServer(t, zonesHandler(mustZone(t, "."), z, reverse))
+	stub := &dns.Stub{Config: &dns.ResolvConf{
+		Servers:  []string{addr},
+		Search:   []string{"example.com"},
+		NDots:    1,
+		Timeout:  2 * time.Second,
+		Attempts: 1,
+	}}
+
+	return &dns.Resolver{Querier: stub}
+}
+
+func TestResolverLookupIP(t *testing.T) {
+	r := testResolver(t)
+
+	var cases = []struct {
+		network  string
+		host     string
+		expected []string
+	}{
+		{"ip", "www.example.com", []string{"192.0.2.1", "2001:db8::1"}},
+		{"ip4", "www.example.com", []string{"192.0.2.1"}},
+		{"ip6", "www.example.com", []string{"2001:db8::1"}},
+		// relative names are expanded with the search list
+		{"ip", "www", []string{"192.0.2.1", "2001:db8::1"}},
+		{"ip", "alias.example.com", []string{"192.0.2.1", "2001:db8::1"}},
+		{"ip", "v4.example.com", []string{"192.0.2.2"}},
+		{"ip", "192.0.2.9", []string{"192.0.2.9"}},
+	}
+
+	for i, c := range cases {
+		ips, err := r.LookupIP(context.Background(), c.network, c.host)
+		if err != nil {
+			t.Fatalf("LookupIP failed. case=%d err=%s", i, err.Error())
+		}
+
+		if len(ips) != len(c.expected) {
+			t.Fatalf("unexpected address count. case=%d actual=%v", i, ips)
+		}
+		for j, ip := range ips {
+			if ip.String() != c.expected[j] {
+				t.Fatalf("unexpected address. case=%d actual=%s expected=%s", i, ip, c.expected[j])
+			}
+		}
+	}
+
+	_, err := r.LookupIP(context.Background(), "ip6", "v4.example.com")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Fatalf("expected a not found error for a name without AAAA record. err=%v", err)
+	}
+
+	_, err = r.LookupHost(context.Background(), "nothere.example.com")
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound || dnsErr.Name != "nothere.example.com" {
+		t.Fatalf("expected a not found error for a missing name. err=%v", err)
+	}
+}
+
+func TestResolverLookups(t *testing.T) {
+	r := testResolver(t)
+	ctx := context.Background()
+
+	cname, err := r.LookupCNAME(ctx, "alias.example.com")
+	if err != nil || cname != "www.example.com." {
+		t.Fatalf("unexpected canonical name. actual=%s err=%v", cname, err)
+	}
+
+	cname, err = r.LookupCNAME(ctx, "www.example.com")
+	if err != nil || cname != "www.example.com." {
+		t.Fatalf("unexpected canonical name. actual=%s err=%v", cname, err)
+	}
+
+	mxs, err := r.LookupMX(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("LookupMX failed with error %s", err.Error())
+	}
+	if len(mxs) != 2 || mxs[0].Host != "mx1.example.com." || mxs[1].Pref != 20 {
+		t.Fatalf("unexpected mail exchanges. actual=%v", mxs)
+	}
+
+	cname, srvs, err := r.LookupSRV(ctx, "sip", "tcp", "example.com")
+	if err != nil {
+		t.Fatalf("LookupSRV failed with error %s", err.Error())
+	}
+	if cname != "_sip._tcp.example.com." || len(srvs) != 3 || srvs[0].Priority != 10 ||
+		srvs[1].Priority != 10 || srvs[2].Target != "backup.example.com." {
+		t.Fatalf("unexpected services. cname=%s actual=%v", cname, srvs)
+	}
+
+	naptrs, err := r.LookupNAPTR(ctx, "example.com")
+	if err != nil || len(naptrs) != 2 || naptrs[0].Services != "SIP+D2U" {
+		t.Fatalf("unexpected NAPTR records. actual=%v err=%v", naptrs, err)
+	}
+
+	txts, err := r.LookupTXT(ctx, "example.com")
+	if err != nil || len(txts) != 1 || txts[0] != "hello world" {
+		t.Fatalf("unexpected texts. actual=%v err=%v", txts, err)
+	}
+
+	nss, err := r.LookupNS(ctx, "example.com")
+	if err != nil || len(nss) != 1 || nss[0].Host != "ns1.example.com." {
+		t.Fatalf("unexpected name servers. actual=%v err=%v", nss, err)
+	}
+
+	names, err := r.LookupAddr(ctx, "192.0.2.1")
+	if err != nil || len(names) != 1 || names[0] != "www.example.com." {
+		t.Fatalf("unexpected names. actual=%v err=%v", names, err)
+	}
+}
+
+func TestResolverContext(t *testing.T) {
+	var failing int32
+	var count int32
+	addr := startServer(t, delayedHandler(time.Second, &failing, &count))
+	r := &dns.Resolver{Querier: &dns.Stub{Config: &dns.ResolvConf{
+		Servers:  []string{addr},
+		Timeout:  2 * time.Second,
+		Attempts: 1,
+	}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := r.LookupIP(ctx, "ip", "www.example.com")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsTimeout || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a timeout error. err=%v", err)
+	}
+
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("lookup did not return when the context expired. elapsed=%s", time.Since(start))
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	var cases = []struct {
+		ip       string
+		expected string
+	}{
+		{"192.0.2.1", "1.2.0.192.in-addr.arpa"},
+		{"2001:db8::1", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa"},
+	}
+
+	for i, c := range cases {
+		n, err := dns.ReverseName(net.ParseIP(c.ip))
+		if err != nil {
+			t.Fatalf("ReverseName failed. case=%d err=%s", i, err.Error())
+		}
+
+		if n.GetName() != c.expected {
+			t.Fatalf("unexpected name. case=%d actual=%s expected=%s", i, n.GetName(), c.expected)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package dns
 
 import (
+	"bytes"
 	"fmt"
 )
 
@@ -37,13 +38,70 @@ const (
 	MXType Type = 15
 	// TXTType is the RR type representing text strings
 	TXTType Type = 16
+	// SIGType is the RR type representing a signature, used by SIG(0) to sign
+	// messages (RFC 2931)
+	SIGType Type = 24
+	// KEYType is the RR type representing a public key
+	KEYType Type = 25
 	// AAAAType is the RR type representing a ipv6 host address
 	AAAAType Type = 28
+	// SRVType is the RR type representing the location of a service (RFC 2782)
+	SRVType Type = 33
+	// NAPTRType is the RR type representing a naming authority pointer, rewriting
+	// a name into a URI or another name (RFC 3403)
+	NAPTRType Type = 35
+	// DNAMEType is the RR type representing the redirection of a subtree of
+	// the domain name space (RFC 6672)
+	DNAMEType Type = 39
+	// OPTType is the RR type of the pseudo record carrying the EDNS parameters
+	// of a message (RFC 6891)
+	OPTType Type = 41
+	// DSType is the RR type representing a delegation signer
+	DSType Type = 43
+	// SSHFPType is the RR type representing the fingerprint of a SSH host key
+	// (RFC 4255)
+	SSHFPType Type = 44
+	// RRSIGType is the RR type representing a DNSSEC signature over a RRset
+	RRSIGType Type = 46
+	// NSECType is the RR type representing the next secure name of a zone
+	NSECType Type = 47
+	// DNSKEYType is the RR type representing a DNSSEC public key of a zone
+	DNSKEYType Type = 48
+	// NSEC3Type is the RR type representing the next hashed secure name of a zone
+	NSEC3Type Type = 50
+	// NSEC3PARAMType is the RR type representing the NSEC3 parameters of a zone
+	NSEC3PARAMType Type = 51
+	// TLSAType is the RR type representing the association of a TLS server
+	// certificate with a domain (RFC 6698)
+	TLSAType Type = 52
+	// CDSType is the RR type representing the child copy of a DS record
+	CDSType Type = 59
+	// CDNSKEYType is the RR type representing the child copy of a DNSKEY record
+	// to publish in the parent zone
+	CDNSKEYType Type = 60
+	// OPENPGPKEYType is the RR type representing an OpenPGP public key (RFC 7929)
+	OPENPGPKEYType Type = 61
+	// SVCBType is the RR type representing the location and parameters of a
+	// service (RFC 9460)
+	SVCBType Type = 64
+	// HTTPSType is the RR type representing the location and parameters of a
+	// HTTPS service (RFC 9460)
+	HTTPSType Type = 65
+	// NXNAMEType is the type listed by the NSEC records of compact denial to
+	// tell their owner does not exist (RFC 9824)
+	NXNAMEType Type = 128
+	// TSIGType is the RR type representing a transaction signature
+	TSIGType Type = 250
 	// CAAType is the RR type representing a DNS Certification Authority Authorization
 	CAAType Type = 257
+	// ANYType is the type used by dynamic updates (RFC 2136) to match the records
+	// of every type owned by a name
+	ANYType Type = 255
 )
 
 const (
+	// IXFRQType is the query type requesting an incremental transfer of a zone
+	IXFRQType QType = 251
 	// AXFRQType is the query type requesting a transfer of an entire zone
 	AXFRQType QType = 252
 	// MAILBQType is the query type requesting for mailbox-related records (MB, MG or MR)
@@ -63,6 +121,9 @@ const (
 	CHClass Class = 3
 	// HSClass is the class representing the Hesiod
 	HSClass Class = 4
+	// NONEClass is the class used by dynamic updates (RFC 2136) to require the
+	// absence of records or to delete a record
+	NONEClass Class = 254
 	// ANYClass is the class representing any class
 	ANYClass Class = 255
 )
@@ -105,10 +166,54 @@ func extractType(left, right byte) (Type, error) {
 		return MXType, nil
 	case 16:
 		return TXTType, nil
+	case 24:
+		return SIGType, nil
+	case 25:
+		return KEYType, nil
 	case 28:
 		return AAAAType, nil
+	case 33:
+		return SRVType, nil
+	case 35:
+		return NAPTRType, nil
+	case 39:
+		return DNAMEType, nil
+	case 41:
+		return OPTType, nil
+	case 43:
+		return DSType, nil
+	case 44:
+		return SSHFPType, nil
+	case 46:
+		return RRSIGType, nil
+	case 47:
+		return NSECType, nil
+	case 48:
+		return DNSKEYType, nil
+	case 50:
+		return NSEC3Type, nil
+	case 51:
+		return NSEC3PARAMType, nil
+	case 52:
+		return TLSAType, nil
+	case 59:
+		return CDSType, nil
+	case 60:
+		return CDNSKEYType, nil
+	case 61:
+		return OPENPGPKEYType, nil
+	case 64:
+		return SVCBType, nil
+	case 65:
+		return HTTPSType, nil
+	case 128:
+		return NXNAMEType, nil
+	case 250:
+		return TSIGType, nil
 	case 257:
 		return CAAType, nil
+	case 255:
+		return ANYType, nil
 	default:
 		return 0, fmt.Errorf("failed to extract type. invalid value 0x%x", value)
 	}
@@ -155,10 +260,54 @@ func (t QType) String() string {
 		return "MX"
 	case QType(TXTType):
 		return "TXT"
+	case QType(SIGType):
+		return "SIG"
+	case QType(KEYType):
+		return "KEY"
 	case QType(AAAAType):
 		return "AAAA"
+	case QType(SRVType):
+		return "SRV"
+	case QType(NAPTRType):
+		return "NAPTR"
+	case QType(DNAMEType):
+		return "DNAME"
+	case QType(OPTType):
+		return "OPT"
+	case QType(DSType):
+		return "DS"
+	case QType(SSHFPType):
+		return "SSHFP"
+	case QType(RRSIGType):
+		return "RRSIG"
+	case QType(NSECType):
+		return "NSEC"
+	case QType(DNSKEYType):
+		return "DNSKEY"
+	case QType(NSEC3Type):
+		return "NSEC3"
+	case QType(NSEC3PARAMType):
+		return "NSEC3PARAM"
+	case QType(TLSAType):
+		return "TLSA"
+	case QType(CDSType):
+		return "CDS"
+	case QType(CDNSKEYType):
+		return "CDNSKEY"
+	case QType(OPENPGPKEYType):
+		return "OPENPGPKEY"
+	case QType(SVCBType):
+		return "SVCB"
+	case QType(HTTPSType):
+		return "HTTPS"
+	case QType(NXNAMEType):
+		return "NXNAME"
+	case QType(TSIGType):
+		return "TSIG"
 	case QType(CAAType):
 		return "CAA"
+	case IXFRQType:
+		return "IXFR"
 	case AXFRQType:
 		return "AXFRQ"
 	case MAILBQType:
@@ -175,6 +324,8 @@ func (t QType) String() string {
 func extractQType(left, right byte) (QType, error) {
 	value := uint16(left)<<8 | uint16(right)
 	switch value {
+	case 251:
+		return IXFRQType, nil
 	case 252:
 		return AXFRQType, nil
 	case 253:
@@ -202,6 +353,8 @@ func (c Class) String() string {
 		return "CH"
 	case HSClass:
 		return "HS"
+	case NONEClass:
+		return "NONE"
 	case ANYClass:
 		return "ANY"
 	default:
@@ -220,6 +373,8 @@ func extractClass(left, right byte) (Class, error) {
 		return CHClass, nil
 	case 4:
 		return HSClass, nil
+	case 254:
+		return NONEClass, nil
 	case 255:
 		return ANYClass, nil
 	default:
@@ -273,6 +428,25 @@ func (rr ResourceRecord) stringLines() []string {
 	}
 }
 
+// NewResourceRecord builds a resource record holding the given raw data
+func NewResourceRecord(name Name, t Type, class Class, ttl int32, data []byte) ResourceRecord {
+	return ResourceRecord{
+		Name:       name,
+		Type:       t,
+		Class:      class,
+		TTL:        ttl,
+		DataLength: uint16(len(data)),
+		Data:       data,
+	}
+}
+
+// sameRecord reports whether both resource records are identical, disregarding
+// their TTL as described in RFC 2181 section 5
+func sameRecord(a, b ResourceRecord) bool {
+	return a.Name.Equal(b.Name) && a.Type == b.Type && a.Class == b.Class &&
+		bytes.Equal(a.Data, b.Data)
+}
+
 func resourceRecordFromBytes(data []byte, offset int) (ResourceRecord, int, error) {
 	n := 0
 	name := Name{}
@@ -283,6 +457,10 @@ func resourceRecordFromBytes(data []byte, offset int) (ResourceRecord, int, erro
 	n += bytesRead
 	offset += bytesRead
 
+	if offset+10 > len(data) {
+		return ResourceRecord{}, 0, fmt.Errorf("failed to parse resource record, unexpected end of data. offset=%d", offset)
+	}
+
 	rtype, err := extractType(data[offset], data[offset+1])
 	if err != nil {
 		return ResourceRecord{}, 0, err
@@ -290,9 +468,13 @@ func resourceRecordFromBytes(data []byte, offset int) (ResourceRecord, int, erro
 	n += 2
 	offset += 2
 
-	class, err := extractClass(data[offset], data[offset+1])
-	if err != nil {
-		return ResourceRecord{}, 0, err
+	// the class of an OPT record holds the UDP payload size of the sender
+	class := Class(catBytes(data[offset], data[offset+1]))
+	if rtype != OPTType {
+		class, err = extractClass(data[offset], data[offset+1])
+		if err != nil {
+			return ResourceRecord{}, 0, err
+		}
 	}
 	n += 2
 	offset += 2
@@ -305,7 +487,15 @@ func resourceRecordFromBytes(data []byte, offset int) (ResourceRecord, int, erro
 	n += 2
 	offset += 2
 
-	rdata := data[offset : offset+int(dataLength)]
+	if offset+int(dataLength) > len(data) {
+		return ResourceRecord{}, 0, fmt.Errorf("failed to parse resource record, data exceeds message. offset=%d length=%d",
+			offset, dataLength)
+	}
+
+	rdata, err := decompressData(data, offset, int(dataLength), rtype)
+	if err != nil {
+		return ResourceRecord{}, 0, err
+	}
 	n += int(dataLength)
 
 	return ResourceRecord{
@@ -313,7 +503,60 @@ func resourceRecordFromBytes(data []byte, offset int) (ResourceRecord, int, erro
 		Type:       rtype,
 		Class:      class,
 		TTL:        ttl,
-		DataLength: dataLength,
+		DataLength: uint16(len(rdata)),
 		Data:       rdata,
 	}, n, nil
 }
+
+// decompressData returns a copy of the record data in which the domain names
+// that may be compressed (RFC 3597 section 4) are expanded, so that the data
+// can be interpreted without the rest of the message
+func decompressData(data []byte, offset, length int, t Type) ([]byte, error) {
+	var prefix, names, suffix int
+	switch t {
+	case NSType, MDType, MFType, CNAMEType, MBType, MGType, MRType, PTRType:
+		names = 1
+	case MINFOType:
+		names = 2
+	case MXType:
+		prefix, names = 2, 1
+	case SRVType:
+		prefix, names = 6, 1
+	case SOAType:
+		names, suffix = 2, 20
+	default:
+		rdata := make([]byte, length)
+		copy(rdata, data[offset:offset+length])
+		return rdata, nil
+	}
+
+	end := offset + length
+	if length == 0 {
+		// dynamic updates use empty data to match any record
+		return []byte{}, nil
+	}
+
+	if length < prefix+suffix {
+		return nil, fmt.Errorf("failed to parse %s data, invalid length %d", t, length)
+	}
+
+	rdata := make([]byte, 0, length)
+	rdata = append(rdata, data[offset:offset+prefix]...)
+	offset += prefix
+
+	for i := 0; i < names; i++ {
+		name := Name{}
+		bytesRead, err := name.fromBytes(data[:end], offset)
+		if err != nil {
+			return nil, err
+		}
+		rdata = append(rdata, name.ToBytes()...)
+		offset += bytesRead
+	}
+
+	if end-offset != suffix {
+		return nil, fmt.Errorf("failed to parse %s data, invalid length %d", t, length)
+	}
+
+	return append(rdata, data[offset:end]...), nil
+}
@@ -0,0 +1,178 @@
+package dns
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SigningKey is a private key signing the RRsets of a zone. Its public key is
+// published in a DNSKEY record owned by the apex of the zone
+type SigningKey struct {
+	Zone Name
+	// Flags are the flags of the DNSKEY record, ZoneKeyFlag and SEPFlag for a
+	// key signing key, ZoneKeyFlag only for a zone signing key
+	Flags uint16
+	// Signer is a RSA, ECDSA P-256, ECDSA P-384 or Ed25519 private key
+	Signer crypto.Signer
+}
+
+// DNSKEY returns the data of the DNSKEY record publishing the public key
+func (k *SigningKey) DNSKEY() (DNSKEY, error) {
+	algorithm, publicKey, err := encodePublicKey(k.Signer.Public())
+	if err != nil {
+		return DNSKEY{}, err
+	}
+
+	return DNSKEY{Flags: k.Flags, Protocol: 3, Algorithm: algorithm, PublicKey: publicKey}, nil
+}
+
+// ToDS returns the data of the DS record the parent of the zone owner publishes
+// to authenticate the key (RFC 4034 section 5.1.4)
+func (k *DNSKEY) ToDS(owner Name, digestType DigestType) (DS, error) {
+	var h hash.Hash
+	switch digestType {
+	case SHA1DigestType:
+		h = sha1.New()
+	case SHA256DigestType:
+		h = sha256.New()
+	case SHA384DigestType:
+		h = sha512.New384()
+	default:
+		return DS{}, fmt.Errorf("unsupported digest type %d", uint8(digestType))
+	}
+
+	h.Write(owner.ToBytes())
+	h.Write(k.ToBytes())
+
+	return DS{
+		KeyTag:     k.KeyTag(),
+		Algorithm:  k.Algorithm,
+		DigestType: digestType,
+		Digest:     h.Sum(nil),
+	}, nil
+}
+
+// SignRRset signs the RRset with the key, returning the RRSIG record covering
+// it. The records must share their owner, type and class
+func SignRRset(rrs []ResourceRecord, key SigningKey, inception, expiration time.Time) (ResourceRecord, error) {
+	if len(rrs) == 0 {
+		return ResourceRecord{}, fmt.Errorf("failed to sign RRset, RRset is empty")
+	}
+
+	k, err := key.DNSKEY()
+	if err != nil {
+		return ResourceRecord{}, err
+	}
+
+	owner := rrs[0].Name
+	labels := owner.LabelCount()
+	if strings.HasPrefix(owner.GetName(), "*.") {
+		labels--
+	}
+
+	s := RRSIG{
+		TypeCovered: rrs[0].Type,
+		Algorithm:   k.Algorithm,
+		Labels:      uint8(labels),
+		OriginalTTL: uint32(rrs[0].TTL),
+		Expiration:  uint32(expiration.Unix()),
+		Inception:   uint32(inception.Unix()),
+		KeyTag:      k.KeyTag(),
+		SignerName:  key.Zone,
+	}
+
+	s.Signature, err = sign(key.Signer, k.Algorithm, signedRRsetData(&s, rrs))
+	if err != nil {
+		return ResourceRecord{}, err
+	}
+
+	return NewResourceRecord(owner, RRSIGType, rrs[0].Class, rrs[0].TTL, s.ToBytes()), nil
+}
+
+// VerifyRRset verifies the signature of the RRset made with the key, checking
+// the signature is valid at the time now (RFC 4035 section 5.3)
+func VerifyRRset(rrs []ResourceRecord, sig RRSIG, key DNSKEY, now time.Time) error {
+	if len(rrs) == 0 {
+		return fmt.Errorf("failed to verify RRset, RRset is empty")
+	}
+
+	owner := rrs[0].Name
+	switch {
+	case rrs[0].Type != sig.TypeCovered:
+		return fmt.Errorf("RRSIG covers type %s instead of %s", sig.TypeCovered, rrs[0].Type)
+	case !owner.IsSubdomainOf(sig.SignerName):
+		return fmt.Errorf("RRSIG signer %s is not an ancestor of %s", sig.SignerName.GetName(), owner.GetName())
+	case int(sig.Labels) > owner.LabelCount():
+		return fmt.Errorf("RRSIG labels %d exceed the labels of %s", sig.Labels, owner.GetName())
+	case key.Flags&ZoneKeyFlag == 0 || key.Flags&RevokeFlag != 0 || key.Protocol != 3:
+		return fmt.Errorf("DNSKEY %d cannot sign zone data", key.KeyTag())
+	case key.Algorithm != sig.Algorithm || key.KeyTag() != sig.KeyTag:
+		return fmt.Errorf("DNSKEY %d did not make the RRSIG", key.KeyTag())
+	}
+
+	t := uint32(now.Unix())
+	if SerialLess(t, sig.Inception) {
+		return fmt.Errorf("RRSIG of %s %s is not yet valid. inception=%s", owner.GetName(), sig.TypeCovered,
+			timeToString(sig.Inception))
+	}
+
+	if SerialLess(sig.Expiration, t) {
+		return fmt.Errorf("RRSIG of %s %s expired. expiration=%s", owner.GetName(), sig.TypeCovered,
+			timeToString(sig.Expiration))
+	}
+
+	pub, err := (*KEY)(&key).publicKey()
+	if err != nil {
+		return err
+	}
+
+	if !verify(pub, sig.Algorithm, signedRRsetData(&sig, rrs), sig.Signature) {
+		return fmt.Errorf("RRSIG of %s %s does not match the data", owner.GetName(), sig.TypeCovered)
+	}
+
+	return nil
+}
+
+// signedRRsetData returns the data a RRSIG signs, made of its own data without
+// the signature followed by the RRset in canonical form and order (RFC 4034
+// section 3.1.8.1)
+func signedRRsetData(sig *RRSIG, rrs []ResourceRecord) []byte {
+	owner := rrs[0].Name
+	if int(sig.Labels) < owner.LabelCount() {
+		// the RRset was expanded from a wildcard
+		labels := strings.Split(owner.GetName(), ".")
+		owner, _ = NewName("*." + strings.Join(labels[len(labels)-int(sig.Labels):], "."))
+	}
+
+	prefix := make([]byte, 0)
+	prefix = append(prefix, owner.ToBytes()...)
+	prefix = appendUint16(prefix, uint16(rrs[0].Type))
+	prefix = appendUint16(prefix, uint16(rrs[0].Class))
+	prefix = appendUint32(prefix, sig.OriginalTTL)
+
+	rdatas := make([][]byte, 0, len(rrs))
+	for _, rr := range rrs {
+		rdatas = append(rdatas, rr.Data)
+	}
+	sort.Slice(rdatas, func(i, j int) bool { return bytes.Compare(rdatas[i], rdatas[j]) < 0 })
+
+	data := (*SIG)(sig).signedBytes()
+	for i, rdata := range rdatas {
+		if i > 0 && bytes.Equal(rdata, rdatas[i-1]) {
+			continue
+		}
+		data = append(data, prefix...)
+		data = appendUint16(data, uint16(len(rdata)))
+		data = append(data, rdata...)
+	}
+
+	return data
+}
@@ -0,0 +1,296 @@
+package dns
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultRetry is the delay between two attempts to load a zone that has never
+// been transferred
+const defaultRetry = 60 * time.Second
+
+// Secondary maintains a copy of a zone transferred from its primaries. It
+// honours the refresh, retry and expire fields of the SOA of the zone, stops
+// serving the zone once it expired and persists it to disk so that it survives
+// restarts
+type Secondary struct {
+	Origin Name
+	// Primaries are the addresses of the primaries of the zone, ie:
+	// "192.0.2.1:53". They are tried in order
+	Primaries []string
+	// AllowNotifyFrom lists the addresses NOTIFY messages are accepted from, in
+	// addition to the addresses of the primaries
+	AllowNotifyFrom []net.IP
+	// Client is used to transfer the zone
+	Client Client
+	// Path is the file the zone is persisted to. The zone is not persisted if
+	// empty. The modification time of the file records the last successful
+	// refresh
+	Path string
+	// ErrorLog logs the failures to persist the zone, which are retried on the
+	// next refresh. Defaults to the standard logger of the log package
+	ErrorLog *log.Logger
+
+	mu          sync.RWMutex
+	zone        *Zone
+	lastRefresh time.Time
+	// unsaved is set when the zone on disk is older than the copy in memory.
+	// It is only accessed by the refresh loop
+	unsaved bool
+
+	notify chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// Start loads the zone persisted on disk, if any, and starts maintaining it in
+// the background
+func (s *Secondary) Start() error {
+	if s.Path != "" {
+		if err := s.load(); err != nil {
+			return err
+		}
+	}
+
+	s.notify = make(chan struct{}, 1)
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.run()
+	return nil
+}
+
+// Stop stops maintaining the zone. It does nothing if the secondary was not
+// started
+func (s *Secondary) Stop() {
+	if s.stop == nil {
+		return
+	}
+
+	close(s.stop)
+	<-s.done
+}
+
+// Notify schedules an immediate refresh of the zone, as done when a NOTIFY
+// message is received
+func (s *Secondary) Notify() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Zone returns the copy of the zone, or nil if it has never been transferred
+func (s *Secondary) Zone() *Zone {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.zone
+}
+
+// Expired reports whether the zone should no longer be served, either because
+// it has never been transferred or because it could not be refreshed within
+// the expire interval of its SOA
+func (s *Secondary) Expired() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.zone == nil {
+		return true
+	}
+
+	soa, err := s.zone.SOA().SOA()
+	if err != nil {
+		return true
+	}
+
+	expire := time.Duration(soa.Expire) * time.Second
+	return time.Since(s.lastRefresh) > expire
+}
+
+// ServeDNS implements the Handler interface. Queries are answered from the copy
+// of the zone, with a ServerFailure rcode once it expired. NOTIFY messages from
+// allowed sources trigger a refresh
+func (s *Secondary) ServeDNS(w ResponseWriter, r *Message) {
+	resp := NewResponse(r)
+
+	if r.Header.Opcode == NotifyOpcode {
+		if r.Header.QuestionCount == 0 || !r.Question.Name.Equal(s.Origin) {
+			resp.Header.RCode = FormatErrorRCode
+		} else if !sourceAllowed(w.RemoteAddr(), s.AllowNotifyFrom, s.Primaries) {
+			resp.Header.RCode = RefusedRCode
+		} else {
+			s.Notify()
+		}
+		w.WriteMessage(resp)
+		return
+	}
+
+	if s.Expired() {
+		resp.Header.RCode = ServerFailureRCode
+		w.WriteMessage(resp)
+		return
+	}
+
+	h := ZoneHandler{Zone: s.Zone()}
+	h.ServeDNS(w, r)
+}
+
+func (s *Secondary) run() {
+	defer close(s.done)
+
+	for {
+		wait := s.refresh()
+		if wait < time.Second {
+			wait = time.Second
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-s.notify:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// refresh checks the zone against the primaries, transferring it when needed,
+// and returns the delay before the next check
+func (s *Secondary) refresh() time.Duration {
+	zone := s.Zone()
+
+	for _, primary := range s.Primaries {
+		var updated bool
+		var err error
+		if zone == nil {
+			zone, err = s.Client.AXFR(s.Origin, primary)
+			updated = true
+		} else {
+			updated, err = s.Client.Refresh(zone, primary)
+		}
+
+		if err != nil {
+			continue
+		}
+
+		now := time.Now()
+		s.mu.Lock()
+		s.zone = zone
+		s.lastRefresh = now
+		s.mu.Unlock()
+
+		if s.Path != "" {
+			if err := s.persist(zone, updated || s.unsaved, now); err != nil {
+				logf(s.ErrorLog, "failed to persist zone %s to %s. %s", nameToString(s.Origin), s.Path, err.Error())
+				s.unsaved = true
+			} else {
+				s.unsaved = false
+			}
+		}
+
+		soa, _ := zone.SOA().SOA()
+		return time.Duration(soa.Refresh) * time.Second
+	}
+
+	if zone == nil {
+		return defaultRetry
+	}
+
+	soa, _ := zone.SOA().SOA()
+	return time.Duration(soa.Retry) * time.Second
+}
+
+// persist writes the zone to disk when it changed, and records the time of the
+// refresh as the modification time of the file
+func (s *Secondary) persist(z *Zone, updated bool, refreshed time.Time) error {
+	if updated {
+		if err := saveZone(s.Path, z); err != nil {
+			return err
+		}
+	}
+
+	return os.Chtimes(s.Path, refreshed, refreshed)
+}
+
+// logf logs to logger, or to the standard logger if nil
+func logf(logger *log.Logger, format string, args ...interface{}) {
+	if logger == nil {
+		log.Printf(format, args...)
+		return
+	}
+
+	logger.Printf(format, args...)
+}
+
+func (s *Secondary) load() error {
+	info, err := os.Stat(s.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	z, err := loadZone(s.Path, s.Origin)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.zone = z
+	s.lastRefresh = info.ModTime()
+	return nil
+}
+
+// saveZone atomically writes the records of the zone to path, in wire format
+func saveZone(path string, z *Zone) error {
+	data := make([]byte, 0)
+	for _, rr := range z.Records() {
+		data = append(data, rr.ToBytes()...)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadZone reads a zone written by saveZone
+func loadZone(path string, origin Name) (*Zone, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]ResourceRecord, 0)
+	for offset := 0; offset < len(data); {
+		rr, bytesRead, err := resourceRecordFromBytes(data, offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load zone from %s. %s", path, err.Error())
+		}
+
+		records = append(records, rr)
+		offset += bytesRead
+	}
+
+	return NewZone(origin, records)
+}
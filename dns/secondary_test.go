@@ -0,0 +1,187 @@
+package dns_test
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+// shortSOARecord returns a SOA record whose refresh, retry and expire intervals
+// are short enough for tests
+func shortSOARecord(t *testing.T, origin string, serial uint32) dns.ResourceRecord {
+	soa := dns.SOA{
+		MName:   mustName(t, "ns1."+origin),
+		RName:   mustName(t, "hostmaster."+origin),
+		Serial:  serial,
+		Refresh: 1,
+		Retry:   1,
+		Expire:  2,
+		Minimum: 300,
+	}
+
+	return dns.NewResourceRecord(mustName(t, origin), dns.SOAType, dns.INClass, 3600, soa.ToBytes())
+}
+
+func waitFor(t *testing.T, condition func() bool, message string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal(message)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func query(t *testing.T, addr string, name string, qtype dns.QType) dns.Message {
+	m := &dns.Message{
+		Header:   dns.Header{Opcode: dns.QueryOpcode, QuestionCount: 1},
+		Question: dns.Question{Name: mustName(t, name), Type: qtype, Class: dns.INClass},
+	}
+
+	c := dns.Client{Timeout: time.Second}
+	resp, err := c.Exchange(m, addr)
+	if err != nil {
+		t.Fatalf("Exchange failed with error %s", err.Error())
+	}
+
+	return resp
+}
+
+func TestSecondary(t *testing.T) {
+	dir := t.TempDir()
+	primary, err := dns.NewZone(mustName(t, "example.com"), []dns.ResourceRecord{
+		shortSOARecord(t, "example.com", 1),
+		aRecord(t, "www.example.com", "192.0.2.1"),
+	})
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+
+	primaryServer := &dns.Server{Handler: &dns.ZoneHandler{Zone: primary}}
+	primaryAddr := startServerWith(t, primaryServer)
+
+	s := &dns.Secondary{
+		Origin:    mustName(t, "example.com"),
+		Primaries: []string{primaryAddr},
+		Client:    dns.Client{Timeout: time.Second},
+		Path:      filepath.Join(dir, "example.com.zone"),
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed with error %s", err.Error())
+	}
+	secondaryAddr := startServer(t, s)
+
+	waitFor(t, func() bool { return !s.Expired() }, "zone was not transferred")
+
+	resp := query(t, secondaryAddr, "www.example.com", dns.QType(dns.AType))
+	if resp.Header.RCode != dns.NoErrorRCode || len(resp.Answers) != 1 {
+		t.Fatalf("unexpected response. rcode=%s answers=%d", resp.Header.RCode, len(resp.Answers))
+	}
+
+	err = primary.Apply(dns.Diff{
+		From:  shortSOARecord(t, "example.com", 1),
+		To:    shortSOARecord(t, "example.com", 2),
+		Added: []dns.ResourceRecord{aRecord(t, "ftp.example.com", "192.0.2.2")},
+	})
+	if err != nil {
+		t.Fatalf("Apply failed with error %s", err.Error())
+	}
+
+	n := dns.Notifier{Secondaries: []string{secondaryAddr}, Client: dns.Client{Timeout: time.Second}}
+	if err := n.Notify(primary); err != nil {
+		t.Fatalf("Notify failed with error %s", err.Error())
+	}
+	waitFor(t, func() bool { return s.Zone().Serial() == 2 }, "zone was not refreshed")
+
+	primaryServer.Close()
+	waitFor(t, s.Expired, "zone did not expire")
+
+	resp = query(t, secondaryAddr, "www.example.com", dns.QType(dns.AType))
+	if resp.Header.RCode != dns.ServerFailureRCode {
+		t.Fatalf("expired zone should not be served. rcode=%s", resp.Header.RCode)
+	}
+	s.Stop()
+
+	restarted := &dns.Secondary{
+		Origin: mustName(t, "example.com"),
+		Path:   filepath.Join(dir, "example.com.zone"),
+	}
+	if err := restarted.Start(); err != nil {
+		t.Fatalf("Start failed with error %s", err.Error())
+	}
+	defer restarted.Stop()
+
+	if restarted.Zone() == nil || restarted.Zone().Serial() != 2 {
+		t.Fatal("zone was not loaded from disk")
+	}
+	assertSameRecords(t, restarted.Zone().Records(), primary.Records())
+}
+
+// lockedBuffer is a buffer safe for concurrent use, that loggers write to
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSecondaryPersistFailure(t *testing.T) {
+	primary, err := dns.NewZone(mustName(t, "example.com"), []dns.ResourceRecord{
+		shortSOARecord(t, "example.com", 1),
+		aRecord(t, "www.example.com", "192.0.2.1"),
+	})
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+	primaryAddr := startServer(t, &dns.ZoneHandler{Zone: primary})
+
+	// the zone cannot be persisted until the directory exists
+	dir := filepath.Join(t.TempDir(), "zones")
+	var logs lockedBuffer
+	s := &dns.Secondary{
+		Origin:    mustName(t, "example.com"),
+		Primaries: []string{primaryAddr},
+		Client:    dns.Client{Timeout: time.Second},
+		Path:      filepath.Join(dir, "example.com.zone"),
+		ErrorLog:  log.New(&logs, "", 0),
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed with error %s", err.Error())
+	}
+	defer s.Stop()
+
+	waitFor(t, func() bool { return strings.Contains(logs.String(), "failed to persist zone example.com.") },
+		"persist failure was not logged")
+
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatalf("Mkdir failed with error %s", err.Error())
+	}
+
+	// the zone did not change, it is saved by the next refresh anyway
+	waitFor(t, func() bool {
+		_, err := os.Stat(s.Path)
+		return err == nil
+	}, "zone was not persisted on the next refresh")
+}
+
+func TestSecondaryStopBeforeStart(t *testing.T) {
+	s := &dns.Secondary{Origin: mustName(t, "example.com"), Primaries: []string{"192.0.2.53:53"}}
+	s.Stop()
+}
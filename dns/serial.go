@@ -0,0 +1,26 @@
+package dns
+
+import (
+	"fmt"
+)
+
+// serialHalf is 2^(SERIAL_BITS - 1), the limit of the serial number arithmetic
+// defined in RFC 1982 for 32 bits serials
+const serialHalf uint32 = 1 << 31
+
+// SerialLess reports whether the serial a precedes the serial b according to the
+// sequence space arithmetic of RFC 1982. Serials that are exactly 2^31 apart
+// cannot be compared and are reported as not preceding each other
+func SerialLess(a, b uint32) bool {
+	return a != b && b-a < serialHalf
+}
+
+// SerialAdd adds n to the serial s according to the sequence space arithmetic
+// of RFC 1982. n cannot exceed 2^31-1
+func SerialAdd(s, n uint32) (uint32, error) {
+	if n >= serialHalf {
+		return s, fmt.Errorf("serial increment cannot exceed 2^31-1. increment=%d", n)
+	}
+
+	return s + n, nil
+}
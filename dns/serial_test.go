@@ -0,0 +1,46 @@
+package dns_test
+
+import (
+	"testing"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func TestSerialLess(t *testing.T) {
+	var cases = []struct {
+		a, b     uint32
+		expected bool
+	}{
+		{1, 2, true},
+		{2, 1, false},
+		{1, 1, false},
+		{4294967295, 0, true},
+		{0, 4294967295, false},
+		{0, 2147483647, true},
+		{0, 2147483648, false},
+		{2147483648, 0, false},
+	}
+
+	for _, c := range cases {
+		actual := dns.SerialLess(c.a, c.b)
+		if actual != c.expected {
+			t.Fatalf("SerialLess returned unexpected result. a=%d b=%d actual=%v expected=%v",
+				c.a, c.b, actual, c.expected)
+		}
+	}
+}
+
+func TestSerialAdd(t *testing.T) {
+	s, err := dns.SerialAdd(4294967295, 2)
+	if err != nil {
+		t.Fatalf("SerialAdd failed with error %s", err.Error())
+	}
+
+	if s != 1 {
+		t.Fatalf("SerialAdd returned unexpected result. actual=%d expected=1", s)
+	}
+
+	if _, err := dns.SerialAdd(1, 2147483648); err == nil {
+		t.Fatal("SerialAdd should return an error if the increment exceeds 2^31-1")
+	}
+}
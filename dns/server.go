@@ -0,0 +1,477 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxUDPMessageSize is the largest message carried over UDP (RFC 1035 section
+// 4.2.1)
+const maxUDPMessageSize = 512
+
+// Handler responds to DNS requests
+type Handler interface {
+	ServeDNS(w ResponseWriter, r *Message)
+}
+
+// HandlerFunc is an adapter allowing the use of an ordinary function as a
+// Handler
+type HandlerFunc func(w ResponseWriter, r *Message)
+
+// ServeDNS calls f(w, r)
+func (f HandlerFunc) ServeDNS(w ResponseWriter, r *Message) {
+	f(w, r)
+}
+
+// ResponseWriter is used by a Handler to answer a request. Over TCP, a handler
+// may write several messages, as done by zone transfers
+type ResponseWriter interface {
+	// WriteMessage sends a message to the client
+	WriteMessage(m *Message) error
+	// RemoteAddr returns the address of the client
+	RemoteAddr() net.Addr
+	// Network returns the network the request was received on, "udp" or "tcp"
+	Network() string
+	// TSIGKeyName returns the name of the TSIG key that signed the request, or
+	// an empty string if the request was not signed. Responses to signed
+	// requests are signed with the same key
+	TSIGKeyName() string
+	// SIG0SignerName returns the name of the signer of a request signed with
+	// SIG(0), or an empty string if the request was not signed
+	SIG0SignerName() string
+}
+
+// Server serves DNS requests over UDP and TCP
+type Server struct {
+	// Addr is the address to listen on, ie: ":53"
+	Addr string
+	// Handler answers the requests
+	Handler Handler
+	// Timeout bounds the time a TCP connection may stay idle. Defaults to 10
+	// seconds
+	Timeout time.Duration
+	// Keyring holds the TSIG keys signed requests are verified with. Signed
+	// requests are rejected if nil
+	Keyring *Keyring
+	// SIG0Keys provides the public keys SIG(0) signed requests are verified
+	// with. Signed requests are rejected if nil
+	SIG0Keys KeySource
+
+	mu        sync.Mutex
+	conns     []net.PacketConn
+	listeners []net.Listener
+}
+
+// ListenAndServe listens on Addr over both UDP and TCP and serves requests
+// until the server is closed
+func (s *Server) ListenAndServe() error {
+	pc, err := net.ListenPacket("udp", s.Addr)
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		pc.Close()
+		return err
+	}
+
+	errs := make(chan error, 2)
+	go func() { errs <- s.ServeUDP(pc) }()
+	go func() { errs <- s.ServeTCP(ln) }()
+
+	err = <-errs
+	s.Close()
+	<-errs
+	return err
+}
+
+// ServeUDP serves the requests received on pc until the server is closed
+func (s *Server) ServeUDP(pc net.PacketConn) error {
+	s.mu.Lock()
+	s.conns = append(s.conns, pc)
+	s.mu.Unlock()
+
+	for {
+		buf := make([]byte, 65535)
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if isClosedError(err) {
+				return nil
+			}
+			return err
+		}
+
+		go s.serveUDPRequest(pc, addr, buf[:n])
+	}
+}
+
+func (s *Server) serveUDPRequest(pc net.PacketConn, addr net.Addr, data []byte) {
+	w := &udpResponseWriter{pc: pc, addr: addr}
+	r, _, err := MessageFromBytes(data)
+	if err != nil {
+		replyFormatError(w, data)
+		return
+	}
+
+	if r.Header.QR {
+		return
+	}
+
+	w.size = maxUDPSize(&r)
+	if errResp := s.authenticate(data, &r, &w.sig); errResp != nil {
+		w.WriteMessage(errResp)
+		return
+	}
+
+	s.Handler.ServeDNS(w, &r)
+}
+
+// ServeTCP serves the requests received on the connections accepted by ln until
+// the server is closed
+func (s *Server) ServeTCP(ln net.Listener) error {
+	s.mu.Lock()
+	s.listeners = append(s.listeners, ln)
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if isClosedError(err) {
+				return nil
+			}
+			return err
+		}
+
+		go s.serveTCPConn(conn)
+	}
+}
+
+func (s *Server) serveTCPConn(conn net.Conn) {
+	defer conn.Close()
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	for {
+		conn.SetDeadline(time.Now().Add(timeout))
+		data, err := readTCPMessage(conn)
+		if err != nil {
+			return
+		}
+
+		w := &tcpResponseWriter{conn: conn}
+		r, _, err := MessageFromBytes(data)
+		if err != nil {
+			replyFormatError(w, data)
+			return
+		}
+
+		if r.Header.QR {
+			return
+		}
+
+		if errResp := s.authenticate(data, &r, &w.sig); errResp != nil {
+			w.WriteMessage(errResp)
+			continue
+		}
+
+		s.Handler.ServeDNS(w, &r)
+	}
+}
+
+// requestSignature records how a request was signed
+type requestSignature struct {
+	// tsig signs the responses to a request signed with TSIG
+	tsig *tsigState
+	// sig0Signer is the signer of a request signed with SIG(0)
+	sig0Signer string
+}
+
+// authenticate verifies the TSIG or SIG(0) record ending a request, if any, and
+// removes it from the request. It records the signature of the request in sig,
+// and returns the error response to send when the verification failed
+func (s *Server) authenticate(data []byte, r *Message, sig *requestSignature) *Message {
+	last := len(r.Additional) - 1
+	if last < 0 {
+		return nil
+	}
+
+	switch r.Additional[last].Type {
+	case TSIGType:
+		rr := r.Additional[last]
+		r.Additional = r.Additional[:last]
+		state, errResp := s.verifyTSIG(data, r, rr)
+		sig.tsig = state
+		return errResp
+	case SIGType:
+		r.Additional = r.Additional[:last]
+		if s.SIG0Keys == nil {
+			resp := NewResponse(r)
+			resp.Header.RCode = NotAuthRCode
+			return resp
+		}
+
+		signature, err := VerifySIG0(data, s.SIG0Keys, nil, time.Now())
+		if err != nil {
+			resp := NewResponse(r)
+			resp.Header.RCode = NotAuthRCode
+			return resp
+		}
+		sig.sig0Signer = signature.SignerName.GetName()
+	}
+
+	return nil
+}
+
+// verifyTSIG verifies the TSIG record rr that ended a request. It returns the
+// state signing the responses, and the error response to send when the
+// verification failed
+func (s *Server) verifyTSIG(data []byte, r *Message, rr ResourceRecord) (*tsigState, *Message) {
+	now := time.Now()
+	t, key, err := verifyTSIG(data, s.Keyring, nil, nil, false, now)
+	if err == nil {
+		return &tsigState{key: key, mac: t.MAC}, nil
+	}
+
+	resp := NewResponse(r)
+	tsigErr, ok := err.(TSIGError)
+	if !ok {
+		resp.Header.RCode = FormatErrorRCode
+		return nil, resp
+	}
+
+	resp.Header.RCode = NotAuthRCode
+	if tsigErr == BadTimeTSIGError {
+		// RFC 8945 section 5.2.3: the response is signed and carries the time
+		// of the server
+		otherData := appendUint16(make([]byte, 0, 6), uint16(uint64(now.Unix())>>32))
+		otherData = appendUint32(otherData, uint32(now.Unix()))
+		return &tsigState{key: key, mac: t.MAC, err: tsigErr, otherData: otherData}, resp
+	}
+
+	unsigned := TSIG{
+		Algorithm:  t.Algorithm,
+		TimeSigned: t.TimeSigned,
+		Fudge:      t.Fudge,
+		OriginalID: r.Header.ID,
+		Error:      tsigErr,
+	}
+	resp.Additional = []ResourceRecord{NewResourceRecord(rr.Name, TSIGType, ANYClass, 0, unsigned.ToBytes())}
+	return nil, resp
+}
+
+// tsigState signs the responses to a signed request. The first response is
+// signed along with the MAC of the request, the next ones, sent during zone
+// transfers, along with the MAC of the previous response
+type tsigState struct {
+	key        TSIGKey
+	mac        []byte
+	timersOnly bool
+	err        TSIGError
+	otherData  []byte
+}
+
+func (t *tsigState) sign(data []byte) ([]byte, error) {
+	signed, mac, err := signTSIG(data, t.key, t.mac, nil, t.timersOnly, TSIG{
+		TimeSigned: uint64(time.Now().Unix()),
+		Fudge:      defaultFudge,
+		Error:      t.err,
+		OtherData:  t.otherData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	t.mac = mac
+	t.timersOnly = true
+	return signed, nil
+}
+
+func (t *tsigState) keyName() string {
+	if t == nil || t.err != 0 {
+		return ""
+	}
+
+	return t.key.Name.GetName()
+}
+
+// replyFormatError answers a request that could not be parsed with a
+// FormatError rcode, provided its header is readable
+func replyFormatError(w ResponseWriter, data []byte) {
+	if len(data) < 12 || extractQR(data[2]) {
+		return
+	}
+
+	opcode, err := extractOpcode(data[2])
+	if err != nil {
+		opcode = QueryOpcode
+	}
+
+	w.WriteMessage(&Message{
+		Header: Header{
+			ID:     catBytes(data[0], data[1]),
+			QR:     true,
+			Opcode: opcode,
+			RCode:  FormatErrorRCode,
+		},
+	})
+}
+
+// Close stops the server, closing its connections and listeners
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for _, pc := range s.conns {
+		if closeErr := pc.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	for _, ln := range s.listeners {
+		if closeErr := ln.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+
+	s.conns = nil
+	s.listeners = nil
+	return err
+}
+
+type udpResponseWriter struct {
+	pc   net.PacketConn
+	addr net.Addr
+	sig  requestSignature
+	// size is the largest response the client can receive
+	size int
+}
+
+func (w *udpResponseWriter) WriteMessage(m *Message) error {
+	size := w.size
+	if size == 0 {
+		size = maxUDPMessageSize
+	}
+
+	data := m.ToBytes()
+	if len(data) > size {
+		data = truncate(m).ToBytes()
+	}
+
+	if w.sig.tsig != nil {
+		signed, err := w.sig.tsig.sign(data)
+		if err != nil {
+			return err
+		}
+		data = signed
+	}
+
+	_, err := w.pc.WriteTo(data, w.addr)
+	return err
+}
+
+func (w *udpResponseWriter) TSIGKeyName() string {
+	return w.sig.tsig.keyName()
+}
+
+func (w *udpResponseWriter) SIG0SignerName() string {
+	return w.sig.sig0Signer
+}
+
+func (w *udpResponseWriter) RemoteAddr() net.Addr {
+	return w.addr
+}
+
+func (w *udpResponseWriter) Network() string {
+	return "udp"
+}
+
+// truncate returns a copy of the message stripped of its records but its OPT
+// record, with the TC bit set so that the client retries over TCP
+func truncate(m *Message) *Message {
+	header := m.Header
+	header.TC = true
+
+	truncated := &Message{
+		Header:   header,
+		Question: m.Question,
+	}
+	for _, rr := range m.Additional {
+		if rr.Type == OPTType {
+			truncated.Additional = append(truncated.Additional, rr)
+		}
+	}
+
+	return truncated
+}
+
+type tcpResponseWriter struct {
+	conn net.Conn
+	sig  requestSignature
+}
+
+func (w *tcpResponseWriter) WriteMessage(m *Message) error {
+	data := m.ToBytes()
+	if w.sig.tsig != nil {
+		signed, err := w.sig.tsig.sign(data)
+		if err != nil {
+			return err
+		}
+		data = signed
+	}
+
+	return writeTCPMessage(w.conn, data)
+}
+
+func (w *tcpResponseWriter) TSIGKeyName() string {
+	return w.sig.tsig.keyName()
+}
+
+func (w *tcpResponseWriter) SIG0SignerName() string {
+	return w.sig.sig0Signer
+}
+
+func (w *tcpResponseWriter) RemoteAddr() net.Addr {
+	return w.conn.RemoteAddr()
+}
+
+func (w *tcpResponseWriter) Network() string {
+	return "tcp"
+}
+
+// writeTCPMessage writes a message prefixed by its two bytes length, as done
+// over TCP (RFC 1035 section 4.2.2)
+func writeTCPMessage(w io.Writer, data []byte) error {
+	if len(data) > 65535 {
+		return fmt.Errorf("message cannot exceed 65535 bytes over TCP. length=%d", len(data))
+	}
+
+	_, err := w.Write(append(appendUint16(make([]byte, 0, len(data)+2), uint16(len(data))), data...))
+	return err
+}
+
+// readTCPMessage reads a message prefixed by its two bytes length
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	length := make([]byte, 2)
+	if _, err := io.ReadFull(r, length); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, catBytes(length[0], length[1]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func isClosedError(err error) bool {
+	return errors.Is(err, net.ErrClosed)
+}
@@ -0,0 +1,285 @@
+package dns
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SRV is the data of a SRV resource record (RFC 2782), locating the server of
+// a service
+type SRV struct {
+	// Priority orders the targets, lower values being tried first
+	Priority uint16
+	// Weight spreads the load over the targets of a same priority
+	Weight uint16
+	Port   uint16
+	// Target is the host of the service, the root telling the service is not
+	// available
+	Target Name
+}
+
+// ToBytes returns the byte array form of the SRV data
+func (s *SRV) ToBytes() []byte {
+	data := make([]byte, 0, 6)
+
+	data = appendUint16(data, s.Priority)
+	data = appendUint16(data, s.Weight)
+	data = appendUint16(data, s.Port)
+
+	return append(data, s.Target.ToBytes()...)
+}
+
+func (s *SRV) String() string {
+	return fmt.Sprintf("%d %d %d %s", s.Priority, s.Weight, s.Port, nameToString(s.Target))
+}
+
+// SRV returns the data of a SRV resource record
+func (rr ResourceRecord) SRV() (SRV, error) {
+	if rr.Type != SRVType {
+		return SRV{}, fmt.Errorf("resource record is not a SRV record. type=%s", rr.Type)
+	}
+
+	if len(rr.Data) < 7 {
+		return SRV{}, fmt.Errorf("failed to parse SRV data, invalid length %d", len(rr.Data))
+	}
+
+	target := Name{}
+	n, err := target.fromBytes(rr.Data, 6)
+	if err != nil {
+		return SRV{}, err
+	}
+	if 6+n != len(rr.Data) {
+		return SRV{}, fmt.Errorf("failed to parse SRV data, invalid length %d", len(rr.Data))
+	}
+
+	return SRV{
+		Priority: catBytes(rr.Data[0], rr.Data[1]),
+		Weight:   catBytes(rr.Data[2], rr.Data[3]),
+		Port:     catBytes(rr.Data[4], rr.Data[5]),
+		Target:   target,
+	}, nil
+}
+
+// ParseSRV parses the presentation form of SRV data, ie:
+// "10 60 5060 sip.example.com."
+func ParseSRV(s string) (SRV, error) {
+	fields, err := presentationFields(s)
+	if err != nil {
+		return SRV{}, err
+	}
+
+	if len(fields) != 4 {
+		return SRV{}, fmt.Errorf("failed to parse SRV data, invalid field count %d", len(fields))
+	}
+
+	values, err := parseUint16Fields("SRV", fields[:3])
+	if err != nil {
+		return SRV{}, err
+	}
+
+	target, err := NewName(fields[3])
+	if err != nil {
+		return SRV{}, err
+	}
+
+	return SRV{Priority: values[0], Weight: values[1], Port: values[2], Target: target}, nil
+}
+
+// OrderSRV returns the SRV records in the order their targets should be tried:
+// by priority, the records of a same priority being ordered by the weighted
+// random selection of RFC 2782
+func OrderSRV(records []SRV) []SRV {
+	ordered := make([]SRV, len(records))
+	copy(ordered, records)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Priority < ordered[j].Priority })
+
+	for start := 0; start < len(ordered); {
+		end := start
+		for end < len(ordered) && ordered[end].Priority == ordered[start].Priority {
+			end++
+		}
+		shuffleByWeight(ordered[start:end])
+		start = end
+	}
+
+	return ordered
+}
+
+// shuffleByWeight orders the records by repeatedly picking one at random with
+// a probability proportional to its weight, zero weights having a small chance
+// of being picked first
+func shuffleByWeight(records []SRV) {
+	// RFC 2782 places the zero weights first so that they may be selected
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Weight == 0 && records[j].Weight != 0 })
+
+	for i := range records {
+		total := 0
+		for _, rr := range records[i:] {
+			total += int(rr.Weight)
+		}
+
+		pick := rand.IntN(total + 1)
+		for j := i; j < len(records); j++ {
+			pick -= int(records[j].Weight)
+			if pick <= 0 {
+				picked := records[j]
+				copy(records[i+1:j+1], records[i:j])
+				records[i] = picked
+				break
+			}
+		}
+	}
+}
+
+// NAPTR is the data of a NAPTR resource record (RFC 3403), rewriting a domain
+// name into a URI or into the name of a next lookup
+type NAPTR struct {
+	// Order is the order the records must be processed in, lower values first
+	Order uint16
+	// Preference orders the records of a same order
+	Preference uint16
+	// Flags controls the rewriting, ie: "S" for a SRV lookup of the
+	// replacement, "U" for a terminal URI produced by the regular expression
+	Flags string
+	// Services names the service and protocol, ie: "SIP+D2U"
+	Services string
+	// Regexp is the substitution expression applied to the name. It is
+	// exclusive with Replacement
+	Regexp string
+	// Replacement is the next name to look up, the root when Regexp is used
+	Replacement Name
+}
+
+// ToBytes returns the byte array form of the NAPTR data
+func (n *NAPTR) ToBytes() []byte {
+	data := make([]byte, 0, 4)
+
+	data = appendUint16(data, n.Order)
+	data = appendUint16(data, n.Preference)
+	data = appendCharacterString(data, n.Flags)
+	data = appendCharacterString(data, n.Services)
+	data = appendCharacterString(data, n.Regexp)
+
+	return append(data, n.Replacement.ToBytes()...)
+}
+
+func (n *NAPTR) String() string {
+	fields := []string{
+		fmt.Sprintf("%d", n.Order),
+		fmt.Sprintf("%d", n.Preference),
+		quoteString(n.Flags),
+		quoteString(n.Services),
+		quoteString(n.Regexp),
+		nameToString(n.Replacement),
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// NAPTR returns the data of a NAPTR resource record
+func (rr ResourceRecord) NAPTR() (NAPTR, error) {
+	if rr.Type != NAPTRType {
+		return NAPTR{}, fmt.Errorf("resource record is not a NAPTR record. type=%s", rr.Type)
+	}
+
+	if len(rr.Data) < 4 {
+		return NAPTR{}, fmt.Errorf("failed to parse NAPTR data, invalid length %d", len(rr.Data))
+	}
+
+	n := NAPTR{Order: catBytes(rr.Data[0], rr.Data[1]), Preference: catBytes(rr.Data[2], rr.Data[3])}
+	offset := 4
+	for _, field := range []*string{&n.Flags, &n.Services, &n.Regexp} {
+		if offset >= len(rr.Data) || offset+1+int(rr.Data[offset]) > len(rr.Data) {
+			return NAPTR{}, fmt.Errorf("failed to parse NAPTR data, invalid length %d", len(rr.Data))
+		}
+		*field = string(rr.Data[offset+1 : offset+1+int(rr.Data[offset])])
+		offset += 1 + int(rr.Data[offset])
+	}
+
+	bytesRead, err := n.Replacement.fromBytes(rr.Data, offset)
+	if err != nil {
+		return NAPTR{}, err
+	}
+	if offset+bytesRead != len(rr.Data) {
+		return NAPTR{}, fmt.Errorf("failed to parse NAPTR data, invalid length %d", len(rr.Data))
+	}
+
+	return n, nil
+}
+
+// ParseNAPTR parses the presentation form of NAPTR data, ie:
+// `100 10 "S" "SIP+D2U" "" _sip._udp.example.com.`
+func ParseNAPTR(s string) (NAPTR, error) {
+	fields, err := presentationFields(s)
+	if err != nil {
+		return NAPTR{}, err
+	}
+
+	if len(fields) != 6 {
+		return NAPTR{}, fmt.Errorf("failed to parse NAPTR data, invalid field count %d", len(fields))
+	}
+
+	values, err := parseUint16Fields("NAPTR", fields[:2])
+	if err != nil {
+		return NAPTR{}, err
+	}
+
+	for _, field := range fields[2:5] {
+		if len(field) > 255 {
+			return NAPTR{}, fmt.Errorf("failed to parse NAPTR data, character string exceeds 255 bytes. length=%d", len(field))
+		}
+	}
+
+	replacement, err := NewName(fields[5])
+	if err != nil {
+		return NAPTR{}, err
+	}
+
+	return NAPTR{
+		Order:       values[0],
+		Preference:  values[1],
+		Flags:       fields[2],
+		Services:    fields[3],
+		Regexp:      fields[4],
+		Replacement: replacement,
+	}, nil
+}
+
+// OrderNAPTR returns the NAPTR records in the order they must be processed: by
+// order, then by preference
+func OrderNAPTR(records []NAPTR) []NAPTR {
+	ordered := make([]NAPTR, len(records))
+	copy(ordered, records)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Order != ordered[j].Order {
+			return ordered[i].Order < ordered[j].Order
+		}
+		return ordered[i].Preference < ordered[j].Preference
+	})
+
+	return ordered
+}
+
+// appendCharacterString appends a character string prefixed by its length. The
+// string must not exceed 255 bytes
+func appendCharacterString(data []byte, s string) []byte {
+	return append(append(data, byte(len(s))), s...)
+}
+
+// parseUint16Fields parses the 16 bits integer fields of the presentation form
+// of data of the type
+func parseUint16Fields(t string, fields []string) ([]uint16, error) {
+	values := make([]uint16, 0, len(fields))
+	for _, field := range fields {
+		value, err := strconv.ParseUint(field, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s data, invalid integer %s", t, field)
+		}
+		values = append(values, uint16(value))
+	}
+
+	return values, nil
+}
@@ -0,0 +1,128 @@
+package dns_test
+
+import (
+	"testing"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func TestSRV(t *testing.T) {
+	var cases = []struct {
+		presentation string
+		expected     string
+		valid        bool
+	}{
+		{"10 60 5060 sip.example.com.", "10 60 5060 sip.example.com.", true},
+		{"0 0 0 .", "0 0 0 .", true},
+		{"10 60 5060", "", false},
+		{"10 60 65536 sip.example.com.", "", false},
+		{"10 -1 5060 sip.example.com.", "", false},
+	}
+
+	for i, c := range cases {
+		srv, err := dns.ParseSRV(c.presentation)
+		if (err == nil) != c.valid {
+			t.Fatalf("unexpected ParseSRV result. case=%d err=%v", i, err)
+		}
+		if !c.valid {
+			continue
+		}
+
+		rr := dns.NewResourceRecord(mustName(t, "_sip._udp.example.com"), dns.SRVType, dns.INClass, 300, srv.ToBytes())
+		parsed, err := rr.SRV()
+		if err != nil {
+			t.Fatalf("SRV failed. case=%d err=%s", i, err.Error())
+		}
+
+		if parsed.String() != c.expected {
+			t.Fatalf("unexpected SRV. case=%d actual=%s expected=%s", i, parsed.String(), c.expected)
+		}
+	}
+}
+
+func TestNAPTR(t *testing.T) {
+	var cases = []struct {
+		presentation string
+		expected     string
+		regexp       string
+		valid        bool
+	}{
+		{`100 10 "S" "SIP+D2U" "" _sip._udp.example.com.`,
+			`100 10 "S" "SIP+D2U" "" _sip._udp.example.com.`, "", true},
+		{`100 20 "u" "E2U+sip" "!^.*$!sip:info@example.com!" .`,
+			`100 20 "u" "E2U+sip" "!^.*$!sip:info@example.com!" .`, "!^.*$!sip:info@example.com!", true},
+		// escapes are decoded, and encoded back when printed
+		{`1 1 "U" "E2U+x" "!^\\d\"\065!\009!" .`,
+			`1 1 "U" "E2U+x" "!^\\d\"A!\009!" .`, "!^\\d\"A!\t!", true},
+		{`100 10 "S" "SIP+D2U" "" `, "", "", false},
+		{`100 10 "S" "SIP+D2U" "" ".`, "", "", false},
+		{`100 10 "S" "SIP+D2U" "\256" .`, "", "", false},
+	}
+
+	for i, c := range cases {
+		naptr, err := dns.ParseNAPTR(c.presentation)
+		if (err == nil) != c.valid {
+			t.Fatalf("unexpected ParseNAPTR result. case=%d err=%v", i, err)
+		}
+		if !c.valid {
+			continue
+		}
+
+		rr := dns.NewResourceRecord(mustName(t, "example.com"), dns.NAPTRType, dns.INClass, 300, naptr.ToBytes())
+		parsed, err := rr.NAPTR()
+		if err != nil {
+			t.Fatalf("NAPTR failed. case=%d err=%s", i, err.Error())
+		}
+
+		if parsed.String() != c.expected || parsed.Regexp != c.regexp {
+			t.Fatalf("unexpected NAPTR. case=%d actual=%s expected=%s", i, parsed.String(), c.expected)
+		}
+	}
+
+	rr := dns.NewResourceRecord(mustName(t, "example.com"), dns.NAPTRType, dns.INClass, 300, []byte{0, 1, 0, 1, 5, 'S'})
+	if _, err := rr.NAPTR(); err == nil {
+		t.Fatalf("expected an error for truncated NAPTR data")
+	}
+}
+
+func TestOrderSRV(t *testing.T) {
+	records := []dns.SRV{
+		{Priority: 20, Weight: 0, Port: 1, Target: mustName(t, "backup.example.com")},
+		{Priority: 10, Weight: 0, Port: 2, Target: mustName(t, "zero.example.com")},
+		{Priority: 10, Weight: 90, Port: 3, Target: mustName(t, "heavy.example.com")},
+		{Priority: 10, Weight: 10, Port: 4, Target: mustName(t, "light.example.com")},
+	}
+
+	first := make(map[uint16]int)
+	for i := 0; i < 1000; i++ {
+		ordered := dns.OrderSRV(records)
+		if len(ordered) != len(records) || ordered[3].Port != 1 {
+			t.Fatalf("records not ordered by priority. actual=%v", ordered)
+		}
+		first[ordered[0].Port]++
+	}
+
+	// the heavy target is picked first about 9 times out of 10, the target
+	// of weight zero only when the random pick is zero
+	if first[3] < 800 || first[4] < 50 || first[2] > 50 {
+		t.Fatalf("unexpected weighted selection. first=%v", first)
+	}
+
+	if records[0].Port != 1 {
+		t.Fatalf("OrderSRV modified its argument")
+	}
+}
+
+func TestOrderNAPTR(t *testing.T) {
+	ordered := dns.OrderNAPTR([]dns.NAPTR{
+		{Order: 200, Preference: 10, Services: "c"},
+		{Order: 100, Preference: 20, Services: "b"},
+		{Order: 100, Preference: 10, Services: "a"},
+	})
+
+	for i, expected := range []string{"a", "b", "c"} {
+		if ordered[i].Services != expected {
+			t.Fatalf("unexpected order. index=%d actual=%s expected=%s", i, ordered[i].Services, expected)
+		}
+	}
+}
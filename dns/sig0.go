@@ -0,0 +1,209 @@
+package dns
+
+import (
+	"crypto"
+	"fmt"
+	"time"
+)
+
+// SIG is the data of a SIG resource record. SIG(0) records (RFC 2931) cover
+// no type and sign the message they end
+type SIG struct {
+	TypeCovered Type
+	Algorithm   Algorithm
+	Labels      uint8
+	OriginalTTL uint32
+	// Expiration and Inception bound the validity of the signature, in seconds
+	// since epoch modulo 2^32
+	Expiration uint32
+	Inception  uint32
+	KeyTag     uint16
+	SignerName Name
+	Signature  []byte
+}
+
+// ToBytes returns the byte array form of the SIG data
+func (s *SIG) ToBytes() []byte {
+	return append(s.signedBytes(), s.Signature...)
+}
+
+// signedBytes returns the byte array form of the SIG data without the
+// signature, which is part of the signed data
+func (s *SIG) signedBytes() []byte {
+	data := make([]byte, 0, 0)
+
+	data = appendUint16(data, uint16(s.TypeCovered))
+	data = append(data, byte(s.Algorithm), s.Labels)
+	data = appendUint32(data, s.OriginalTTL)
+	data = appendUint32(data, s.Expiration)
+	data = appendUint32(data, s.Inception)
+	data = appendUint16(data, s.KeyTag)
+	data = append(data, s.SignerName.ToBytes()...)
+
+	return data
+}
+
+// SIG returns the data of a SIG resource record
+func (rr ResourceRecord) SIG() (SIG, error) {
+	if rr.Type != SIGType {
+		return SIG{}, fmt.Errorf("resource record is not a SIG record. type=%s", rr.Type)
+	}
+
+	return sigFromBytes(rr.Data)
+}
+
+func sigFromBytes(data []byte) (SIG, error) {
+	if len(data) < 18 {
+		return SIG{}, fmt.Errorf("failed to parse SIG data, invalid length %d", len(data))
+	}
+
+	signer := Name{}
+	bytesRead, err := signer.fromBytes(data, 18)
+	if err != nil {
+		return SIG{}, err
+	}
+
+	return SIG{
+		TypeCovered: Type(catBytes(data[0], data[1])),
+		Algorithm:   Algorithm(data[2]),
+		Labels:      data[3],
+		OriginalTTL: readUint32(data, 4),
+		Expiration:  readUint32(data, 8),
+		Inception:   readUint32(data, 12),
+		KeyTag:      catBytes(data[16], data[17]),
+		SignerName:  signer,
+		Signature:   data[18+bytesRead:],
+	}, nil
+}
+
+// SIG0Key is a private key signing messages with SIG(0). Its public key is
+// published in a KEY record owned by Name
+type SIG0Key struct {
+	Name Name
+	// Signer is an ECDSA P-256 or an Ed25519 private key
+	Signer crypto.Signer
+}
+
+// KEY returns the data of the KEY record publishing the public key
+func (k *SIG0Key) KEY() (KEY, error) {
+	algorithm, publicKey, err := encodePublicKey(k.Signer.Public())
+	if err != nil {
+		return KEY{}, err
+	}
+
+	return KEY{Protocol: 3, Algorithm: algorithm, PublicKey: publicKey}, nil
+}
+
+// KeySource provides the public keys SIG(0) signatures are verified with
+type KeySource interface {
+	// PublicKeys returns the keys published by the signer
+	PublicKeys(signer Name) []KEY
+}
+
+// PublicKeys returns the keys published by the KEY records of the zone owned by
+// signer
+func (z *Zone) PublicKeys(signer Name) []KEY {
+	keys := make([]KEY, 0)
+	for _, rr := range z.Lookup(signer, KEYType) {
+		if key, err := rr.KEY(); err == nil {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// SignSIG0 signs an encoded message with the key, appending a SIG(0) record to
+// it. A response is signed along with the signed request it answers
+func SignSIG0(data []byte, key SIG0Key, request []byte, now time.Time) ([]byte, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("failed to sign message, invalid data length. length=%d", len(data))
+	}
+
+	k, err := key.KEY()
+	if err != nil {
+		return nil, err
+	}
+
+	s := SIG{
+		Algorithm:  k.Algorithm,
+		Expiration: uint32(now.Unix() + defaultFudge),
+		Inception:  uint32(now.Unix() - defaultFudge),
+		KeyTag:     k.KeyTag(),
+		SignerName: key.Name,
+	}
+
+	signed := make([]byte, 0)
+	signed = append(signed, s.signedBytes()...)
+	signed = append(signed, request...)
+	signed = append(signed, data...)
+
+	s.Signature, err = sign(key.Signer, k.Algorithm, signed)
+	if err != nil {
+		return nil, err
+	}
+
+	root, _ := NewName(".")
+	rr := NewResourceRecord(root, SIGType, ANYClass, 0, s.ToBytes())
+	result := make([]byte, 0, len(data)+int(rr.DataLength)+11)
+	result = append(result, data...)
+	result = append(result, rr.ToBytes()...)
+
+	arcount := catBytes(data[10], data[11]) + 1
+	result[10], result[11] = byte(arcount>>8), byte(arcount&0xFF)
+
+	return result, nil
+}
+
+// VerifySIG0 verifies the SIG(0) record ending an encoded message against the
+// keys the signer published. A response is verified along with the signed
+// request it answers. It returns the verified record
+func VerifySIG0(data []byte, keys KeySource, request []byte, now time.Time) (SIG, error) {
+	offset, err := lastRecordOffset(data)
+	if err != nil {
+		return SIG{}, err
+	}
+
+	rr, _, err := resourceRecordFromBytes(data, offset)
+	if err != nil {
+		return SIG{}, err
+	}
+
+	s, err := rr.SIG()
+	if err != nil {
+		return SIG{}, err
+	}
+
+	if rr.Name.GetName() != "." || rr.Class != ANYClass || rr.TTL != 0 || s.TypeCovered != 0 {
+		return s, fmt.Errorf("failed to verify SIG(0), record is not a SIG(0) record")
+	}
+
+	t := uint32(now.Unix())
+	if SerialLess(t, s.Inception) || SerialLess(s.Expiration, t) {
+		return s, fmt.Errorf("failed to verify SIG(0), signature is not valid at this time. inception=%d expiration=%d",
+			s.Inception, s.Expiration)
+	}
+
+	msg := make([]byte, offset)
+	copy(msg, data[:offset])
+	arcount := catBytes(msg[10], msg[11]) - 1
+	msg[10], msg[11] = byte(arcount>>8), byte(arcount&0xFF)
+
+	signed := make([]byte, 0)
+	signed = append(signed, s.signedBytes()...)
+	signed = append(signed, request...)
+	signed = append(signed, msg...)
+
+	for _, key := range keys.PublicKeys(s.SignerName) {
+		if key.Algorithm != s.Algorithm || key.KeyTag() != s.KeyTag {
+			continue
+		}
+
+		pub, err := key.publicKey()
+		if err == nil && verify(pub, s.Algorithm, signed, s.Signature) {
+			return s, nil
+		}
+	}
+
+	return s, fmt.Errorf("failed to verify SIG(0), no key of %s matches the signature", s.SignerName.GetName())
+}
@@ -0,0 +1,130 @@
+package dns_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func keyRecord(t *testing.T, key dns.SIG0Key) dns.ResourceRecord {
+	k, err := key.KEY()
+	if err != nil {
+		t.Fatalf("KEY failed with error %s", err.Error())
+	}
+
+	return dns.NewResourceRecord(key.Name, dns.KEYType, dns.INClass, 300, k.ToBytes())
+}
+
+func TestSIG0Update(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed with error %s", err.Error())
+	}
+
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed with error %s", err.Error())
+	}
+
+	keys := []dns.SIG0Key{
+		{Name: mustName(t, "ecdsa.example.com"), Signer: ecdsaKey},
+		{Name: mustName(t, "ed25519.example.com"), Signer: ed25519Key},
+	}
+
+	z, err := dns.NewZone(mustName(t, "example.com"), []dns.ResourceRecord{
+		soaRecord(t, "example.com", 1),
+		keyRecord(t, keys[0]),
+		keyRecord(t, keys[1]),
+	})
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+
+	addr := startServerWith(t, &dns.Server{
+		Handler: &dns.UpdateHandler{
+			Zone:         z,
+			AllowSigners: []string{"ecdsa.example.com", "ed25519.example.com"},
+		},
+		SIG0Keys: z,
+	})
+
+	for _, key := range keys {
+		u := dns.NewUpdate(mustName(t, "example.com"))
+		u.Insert(aRecord(t, "host."+key.Name.GetName(), "192.0.2.1"))
+
+		c := dns.Client{Timeout: time.Second, SIG0Key: &key}
+		resp, err := c.Exchange(&u.Message, addr)
+		if err != nil {
+			t.Fatalf("Exchange failed with error %s", err.Error())
+		}
+
+		if resp.Header.RCode != dns.NoErrorRCode {
+			t.Fatalf("signed update was not applied. signer=%s rcode=%s", key.Name.GetName(), resp.Header.RCode)
+		}
+	}
+
+	// the public key of this signer is not published in the zone
+	unknown := dns.SIG0Key{Name: mustName(t, "ecdsa.example.com"), Signer: ed25519Key}
+	u := dns.NewUpdate(mustName(t, "example.com"))
+	u.Insert(aRecord(t, "ftp.example.com", "192.0.2.1"))
+
+	c := dns.Client{Timeout: time.Second, SIG0Key: &unknown}
+	resp, err := c.Exchange(&u.Message, addr)
+	if err != nil {
+		t.Fatalf("Exchange failed with error %s", err.Error())
+	}
+
+	if resp.Header.RCode != dns.NotAuthRCode {
+		t.Fatalf("unexpected rcode. actual=%s expected=%s", resp.Header.RCode, dns.NotAuthRCode)
+	}
+}
+
+func TestVerifySIG0(t *testing.T) {
+	_, signer, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed with error %s", err.Error())
+	}
+
+	key := dns.SIG0Key{Name: mustName(t, "key.example.com"), Signer: signer}
+	z, err := dns.NewZone(mustName(t, "example.com"), []dns.ResourceRecord{
+		soaRecord(t, "example.com", 1),
+		keyRecord(t, key),
+	})
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+
+	m := dns.Message{
+		Header:   dns.Header{ID: 42, QuestionCount: 1},
+		Question: dns.Question{Name: mustName(t, "example.com"), Type: dns.QType(dns.SOAType), Class: dns.INClass},
+	}
+
+	now := time.Now()
+	signed, err := dns.SignSIG0(m.ToBytes(), key, nil, now)
+	if err != nil {
+		t.Fatalf("SignSIG0 failed with error %s", err.Error())
+	}
+
+	sig, err := dns.VerifySIG0(signed, z, nil, now)
+	if err != nil {
+		t.Fatalf("VerifySIG0 failed with error %s", err.Error())
+	}
+
+	if !sig.SignerName.Equal(key.Name) || sig.Algorithm != dns.ED25519Algorithm {
+		t.Fatalf("unexpected SIG record. signer=%s algorithm=%s", sig.SignerName.GetName(), sig.Algorithm)
+	}
+
+	if _, err := dns.VerifySIG0(signed, z, nil, now.Add(time.Hour)); err == nil {
+		t.Fatal("expired signatures should fail verification")
+	}
+
+	signed[13] ^= 0xFF
+	if _, err := dns.VerifySIG0(signed, z, nil, now); err == nil {
+		t.Fatal("tampered message should fail verification")
+	}
+}
@@ -0,0 +1,412 @@
+package dns
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultInceptionOffset backdates the inception of the signatures so that
+	// resolvers with a late clock accept them
+	defaultInceptionOffset = time.Hour
+	// defaultSignatureValidity is the validity of the signatures made by a
+	// ZoneSigner without an explicit expiration
+	defaultSignatureValidity = 30 * 24 * time.Hour
+)
+
+// ZoneSigner signs zones offline. It adds the DNSKEY, CDS and CDNSKEY records
+// of its keys and a NSEC or NSEC3 chain to the zone, then signs every
+// authoritative RRset. The signed zone can be written to a master file with
+// WriteZone
+type ZoneSigner struct {
+	// Keys sign the zone. Keys with the SEP flag are key signing keys, signing
+	// the DNSKEY, CDS and CDNSKEY RRsets, the other keys sign the rest of the
+	// zone. Without keys of one kind, the keys of the other kind sign everything
+	Keys []SigningKey
+	// NSEC3 holds the hash parameters of a NSEC3 chain, the OptOutFlag leaving
+	// unsigned delegations out of the chain. A NSEC chain is built when nil
+	NSEC3 *NSEC3PARAM
+	// Inception is the start of the validity of the signatures. Defaults to an
+	// hour ago
+	Inception time.Time
+	// Expiration is the end of the validity of the signatures. Defaults to 30
+	// days from now
+	Expiration time.Time
+}
+
+func (s *ZoneSigner) inception() time.Time {
+	if s.Inception.IsZero() {
+		return time.Now().Add(-defaultInceptionOffset)
+	}
+
+	return s.Inception
+}
+
+func (s *ZoneSigner) expiration() time.Time {
+	if s.Expiration.IsZero() {
+		return time.Now().Add(defaultSignatureValidity)
+	}
+
+	return s.Expiration
+}
+
+// Sign returns the signed copy of the zone. The DNSSEC records of the zone, but
+// its DNSKEY records, are replaced: the DNSKEY records of keys not signing the
+// zone, pre-published or about to be removed, are kept
+func (s *ZoneSigner) Sign(z *Zone) (*Zone, error) {
+	origin := z.Origin()
+	ksks, zsks, err := s.splitKeys(origin)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]ResourceRecord, 0)
+	for _, rr := range z.Records() {
+		switch rr.Type {
+		case RRSIGType, NSECType, NSEC3Type, NSEC3PARAMType, CDSType, CDNSKEYType:
+		default:
+			records = append(records, rr)
+		}
+	}
+
+	soa := records[0]
+	keyRecords, err := s.keyRecords(origin, ksks, soa.TTL)
+	if err != nil {
+		return nil, err
+	}
+	for _, rr := range keyRecords {
+		if indexOfRecord(records, rr) < 0 {
+			records = append(records, rr)
+		}
+	}
+
+	// the TTL of the denial records is the negative caching TTL (RFC 9077)
+	ttl := negativeSOA(soa).TTL
+	zd := newZoneData(origin, records)
+	var chain []ResourceRecord
+	if s.NSEC3 == nil {
+		chain = zd.nsecChain(ttl)
+	} else {
+		chain, err = zd.nsec3Chain(*s.NSEC3, ttl)
+		if err != nil {
+			return nil, err
+		}
+	}
+	records = append(records, chain...)
+
+	inception, expiration := s.inception(), s.expiration()
+	signed := make([]ResourceRecord, 0, 2*len(records))
+	signed = append(signed, records...)
+	for _, set := range groupRRsets(records) {
+		if !zd.signs(set[0]) {
+			continue
+		}
+
+		keys := zsks
+		if set[0].Name.Equal(origin) && isKeyType(set[0].Type) {
+			keys = ksks
+		}
+
+		for _, key := range keys {
+			sig, err := SignRRset(set, key, inception, expiration)
+			if err != nil {
+				return nil, err
+			}
+			signed = append(signed, sig)
+		}
+	}
+
+	return NewZone(origin, signed)
+}
+
+// splitKeys splits the keys into key signing keys and zone signing keys
+func (s *ZoneSigner) splitKeys(origin Name) ([]SigningKey, []SigningKey, error) {
+	if len(s.Keys) == 0 {
+		return nil, nil, fmt.Errorf("failed to sign zone %s, no keys", origin.GetName())
+	}
+
+	ksks, zsks := make([]SigningKey, 0), make([]SigningKey, 0)
+	for _, key := range s.Keys {
+		if !key.Zone.Equal(origin) {
+			return nil, nil, fmt.Errorf("failed to sign zone %s, key belongs to zone %s",
+				origin.GetName(), key.Zone.GetName())
+		}
+
+		if key.Flags&SEPFlag != 0 {
+			ksks = append(ksks, key)
+		} else {
+			zsks = append(zsks, key)
+		}
+	}
+
+	if len(ksks) == 0 {
+		ksks = zsks
+	}
+	if len(zsks) == 0 {
+		zsks = ksks
+	}
+
+	return ksks, zsks, nil
+}
+
+// keyRecords returns the DNSKEY records of the keys, and the CDS and CDNSKEY
+// records asking the parent to publish the DS records of the key signing keys
+// (RFC 7344)
+func (s *ZoneSigner) keyRecords(origin Name, ksks []SigningKey, ttl int32) ([]ResourceRecord, error) {
+	records := make([]ResourceRecord, 0)
+	for _, key := range s.Keys {
+		k, err := key.DNSKEY()
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, NewResourceRecord(origin, DNSKEYType, INClass, ttl, k.ToBytes()))
+	}
+
+	for _, key := range ksks {
+		k, err := key.DNSKEY()
+		if err != nil {
+			return nil, err
+		}
+
+		ds, err := k.ToDS(origin, SHA256DigestType)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, NewResourceRecord(origin, CDSType, INClass, ttl, ds.ToBytes()))
+		records = append(records, NewResourceRecord(origin, CDNSKEYType, INClass, ttl, k.ToBytes()))
+	}
+
+	return records, nil
+}
+
+func isKeyType(t Type) bool {
+	return t == DNSKEYType || t == CDSType || t == CDNSKEYType
+}
+
+// zoneData indexes the names of a zone being signed with the types they own
+type zoneData struct {
+	origin Name
+	// names are the names of the zone in canonical order
+	names []Name
+	types map[string][]Type
+	// cuts are the delegation points of the zone
+	cuts []Name
+}
+
+func newZoneData(origin Name, records []ResourceRecord) *zoneData {
+	zd := &zoneData{origin: origin, types: make(map[string][]Type)}
+	for _, rr := range records {
+		if !rr.Name.IsSubdomainOf(origin) {
+			continue
+		}
+
+		key := rr.Name.GetName()
+		types, ok := zd.types[key]
+		if !ok {
+			zd.names = append(zd.names, rr.Name)
+		}
+		if hasType(types, rr.Type) {
+			continue
+		}
+		zd.types[key] = append(types, rr.Type)
+
+		if rr.Type == NSType && !rr.Name.Equal(origin) {
+			zd.cuts = append(zd.cuts, rr.Name)
+		}
+	}
+
+	sort.Slice(zd.names, func(i, j int) bool { return CanonicalCompare(zd.names[i], zd.names[j]) < 0 })
+	return zd
+}
+
+// isCut reports whether name is a delegation point
+func (zd *zoneData) isCut(name Name) bool {
+	for _, cut := range zd.cuts {
+		if cut.Equal(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isGlue reports whether name is below a delegation point, its records not
+// being authoritative
+func (zd *zoneData) isGlue(name Name) bool {
+	for _, cut := range zd.cuts {
+		if name.IsSubdomainOf(cut) && !name.Equal(cut) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// signs reports whether the RRset of the record is signed. At a delegation
+// point, only the DS and NSEC RRsets are authoritative (RFC 4035 section 2.2)
+func (zd *zoneData) signs(rr ResourceRecord) bool {
+	if !rr.Name.IsSubdomainOf(zd.origin) || zd.isGlue(rr.Name) {
+		return false
+	}
+
+	if zd.isCut(rr.Name) {
+		return rr.Type == DSType || rr.Type == NSECType
+	}
+
+	return true
+}
+
+// chainTypes returns the types listed by the NSEC or NSEC3 record of name,
+// except the type of the chain itself
+func (zd *zoneData) chainTypes(name Name) []Type {
+	types := zd.types[name.GetName()]
+	if !zd.isCut(name) {
+		return append(append([]Type{}, types...), RRSIGType)
+	}
+
+	cutTypes := []Type{NSType}
+	if hasType(types, DSType) {
+		cutTypes = append(cutTypes, DSType, RRSIGType)
+	}
+
+	return cutTypes
+}
+
+// nsecChain returns the NSEC records linking the names of the zone (RFC 4035
+// section 2.3)
+func (zd *zoneData) nsecChain(ttl int32) []ResourceRecord {
+	names := make([]Name, 0, len(zd.names))
+	for _, name := range zd.names {
+		if !zd.isGlue(name) {
+			names = append(names, name)
+		}
+	}
+
+	records := make([]ResourceRecord, 0, len(names))
+	for i, name := range names {
+		types := zd.chainTypes(name)
+		if !hasType(types, RRSIGType) {
+			// the NSEC record of an unsigned delegation is signed
+			types = append(types, RRSIGType)
+		}
+
+		nsec := NSEC{NextDomain: names[(i+1)%len(names)], Types: append(types, NSECType)}
+		records = append(records, NewResourceRecord(name, NSECType, INClass, ttl, nsec.ToBytes()))
+	}
+
+	return records
+}
+
+// nsec3Chain returns the NSEC3PARAM record of the zone and the NSEC3 records
+// linking the hashes of its names, empty non-terminals included (RFC 5155
+// section 7.1)
+func (zd *zoneData) nsec3Chain(params NSEC3PARAM, ttl int32) ([]ResourceRecord, error) {
+	optOut := params.Flags&OptOutFlag != 0
+
+	type hashedName struct {
+		hash  []byte
+		types []Type
+	}
+	hashed := make(map[string]hashedName)
+	// owners holds the name of each hash
+	owners := make(map[string]string)
+	add := func(name Name, types []Type) error {
+		if h, ok := hashed[name.GetName()]; ok {
+			if types != nil && h.types == nil {
+				hashed[name.GetName()] = hashedName{h.hash, types}
+			}
+			return nil
+		}
+
+		hash := NSEC3Hash(name, params.Iterations, params.Salt)
+		if other, ok := owners[string(hash)]; ok {
+			return fmt.Errorf("failed to build NSEC3 chain, hash collision between %s and %s",
+				name.GetName(), other)
+		}
+
+		hashed[name.GetName()] = hashedName{hash, types}
+		owners[string(hash)] = name.GetName()
+		return nil
+	}
+
+	for _, name := range zd.names {
+		if zd.isGlue(name) {
+			continue
+		}
+
+		types := zd.chainTypes(name)
+		if optOut && zd.isCut(name) && !hasType(types, DSType) {
+			continue
+		}
+
+		if name.Equal(zd.origin) {
+			types = append(types, NSEC3PARAMType)
+		}
+		if err := add(name, types); err != nil {
+			return nil, err
+		}
+
+		// the empty non-terminals between the name and the origin
+		for parent, ok := parentName(name); ok && !parent.Equal(zd.origin) &&
+			parent.IsSubdomainOf(zd.origin); parent, ok = parentName(parent) {
+			if err := add(parent, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	hashes := make([]hashedName, 0, len(hashed))
+	for _, h := range hashed {
+		hashes = append(hashes, h)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i].hash, hashes[j].hash) < 0 })
+
+	// the NSEC3PARAM record has no flags (RFC 5155 section 4.1.2)
+	param := NSEC3PARAM{HashAlgorithm: SHA1NSEC3Hash, Iterations: params.Iterations, Salt: params.Salt}
+	records := []ResourceRecord{NewResourceRecord(zd.origin, NSEC3PARAMType, INClass, ttl, param.ToBytes())}
+	for i, h := range hashes {
+		nsec3 := NSEC3{
+			HashAlgorithm:   SHA1NSEC3Hash,
+			Flags:           params.Flags & OptOutFlag,
+			Iterations:      params.Iterations,
+			Salt:            params.Salt,
+			NextHashedOwner: hashes[(i+1)%len(hashes)].hash,
+			Types:           h.types,
+		}
+
+		owner, err := NewName(strings.ToLower(base32Hex.EncodeToString(h.hash)) + "." + zd.origin.GetName())
+		if zd.origin.GetName() == "." {
+			owner, err = NewName(strings.ToLower(base32Hex.EncodeToString(h.hash)))
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, NewResourceRecord(owner, NSEC3Type, INClass, ttl, nsec3.ToBytes()))
+	}
+
+	return records, nil
+}
+
+// groupRRsets groups the records by owner name, type and class, keeping the
+// order of their first record
+func groupRRsets(records []ResourceRecord) [][]ResourceRecord {
+	index := make(map[string]int)
+	sets := make([][]ResourceRecord, 0)
+	for _, rr := range records {
+		key := fmt.Sprintf("%s/%d/%d", rr.Name.GetName(), rr.Type, rr.Class)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(sets)
+			sets = append(sets, []ResourceRecord{rr})
+			continue
+		}
+		sets[i] = append(sets[i], rr)
+	}
+
+	return sets
+}
@@ -0,0 +1,182 @@
+package dns_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+// unsignedZone returns a zone with a secure delegation, an insecure delegation
+// and an empty non-terminal, b.example.com
+func unsignedZone(t *testing.T) *dns.Zone {
+	ds := dns.DS{KeyTag: 1, Algorithm: dns.ED25519Algorithm, DigestType: dns.SHA256DigestType, Digest: make([]byte, 32)}
+	z, err := dns.NewZone(mustName(t, "example.com"), []dns.ResourceRecord{
+		soaRecord(t, "example.com", 1),
+		nameRecord(t, "example.com", dns.NSType, "ns1.example.com"),
+		aRecord(t, "ns1.example.com", "192.0.2.1"),
+		aRecord(t, "www.example.com", "192.0.2.2"),
+		aRecord(t, "a.b.example.com", "192.0.2.3"),
+		nameRecord(t, "secure.example.com", dns.NSType, "ns.secure.example.com"),
+		dns.NewResourceRecord(mustName(t, "secure.example.com"), dns.DSType, dns.INClass, 3600, ds.ToBytes()),
+		aRecord(t, "ns.secure.example.com", "192.0.2.4"),
+		nameRecord(t, "insecure.example.com", dns.NSType, "ns.insecure.example.com"),
+		aRecord(t, "ns.insecure.example.com", "192.0.2.5"),
+	})
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+
+	return z
+}
+
+// signers returns the RRSIG records covering the RRset, after checking they
+// verify with one of the keys
+func signers(t *testing.T, records []dns.ResourceRecord, name string, rtype dns.Type, keys []dns.SigningKey) []uint16 {
+	rrs := make([]dns.ResourceRecord, 0)
+	tags := make([]uint16, 0)
+	for _, rr := range records {
+		if !rr.Name.Equal(mustName(t, name)) {
+			continue
+		}
+
+		if rr.Type == rtype {
+			rrs = append(rrs, rr)
+		}
+
+		if rr.Type != dns.RRSIGType {
+			continue
+		}
+
+		sig, err := rr.RRSIG()
+		if err != nil {
+			t.Fatalf("RRSIG failed with error %s", err.Error())
+		}
+		if sig.TypeCovered == rtype {
+			tags = append(tags, sig.KeyTag)
+		}
+	}
+
+	for _, tag := range tags {
+		for _, key := range keys {
+			k, _ := key.DNSKEY()
+			if k.KeyTag() != tag {
+				continue
+			}
+
+			sig := signatureOf(t, records, name, rtype, tag)
+			if err := dns.VerifyRRset(rrs, sig, k, time.Now()); err != nil {
+				t.Fatalf("VerifyRRset failed. name=%s type=%s err=%s", name, rtype, err.Error())
+			}
+		}
+	}
+
+	return tags
+}
+
+func signatureOf(t *testing.T, records []dns.ResourceRecord, name string, rtype dns.Type, tag uint16) dns.RRSIG {
+	for _, rr := range records {
+		if rr.Type != dns.RRSIGType || !rr.Name.Equal(mustName(t, name)) {
+			continue
+		}
+
+		sig, _ := rr.RRSIG()
+		if sig.TypeCovered == rtype && sig.KeyTag == tag {
+			return sig
+		}
+	}
+
+	t.Fatalf("signature missing. name=%s type=%s tag=%d", name, rtype, tag)
+	return dns.RRSIG{}
+}
+
+func TestZoneSigner(t *testing.T) {
+	ksk := signingKey(t, "example.com", dns.ECDSAP256SHA256Algorithm)
+	zsk := signingKey(t, "example.com", dns.ED25519Algorithm)
+	zsk.Flags = dns.ZoneKeyFlag
+	keys := []dns.SigningKey{ksk, zsk}
+	k, _ := ksk.DNSKEY()
+	z, _ := zsk.DNSKEY()
+	kskTag, zskTag := k.KeyTag(), z.KeyTag()
+
+	var cases = []struct {
+		nsec3  *dns.NSEC3PARAM
+		optOut bool
+	}{
+		{nil, false},
+		{&dns.NSEC3PARAM{HashAlgorithm: dns.SHA1NSEC3Hash, Iterations: 0, Salt: []byte{0xaa, 0xbb}}, false},
+		{&dns.NSEC3PARAM{HashAlgorithm: dns.SHA1NSEC3Hash, Flags: dns.OptOutFlag, Iterations: 5}, true},
+	}
+
+	for i, c := range cases {
+		s := dns.ZoneSigner{Keys: keys, NSEC3: c.nsec3}
+		signed, err := s.Sign(unsignedZone(t))
+		if err != nil {
+			t.Fatalf("Sign failed. case=%d err=%s", i, err.Error())
+		}
+		records := signed.Records()
+
+		var expected = []struct {
+			name  string
+			rtype dns.Type
+			tags  []uint16
+		}{
+			{"example.com", dns.DNSKEYType, []uint16{kskTag}},
+			{"example.com", dns.CDSType, []uint16{kskTag}},
+			{"example.com", dns.CDNSKEYType, []uint16{kskTag}},
+			{"example.com", dns.SOAType, []uint16{zskTag}},
+			{"www.example.com", dns.AType, []uint16{zskTag}},
+			{"secure.example.com", dns.DSType, []uint16{zskTag}},
+			{"secure.example.com", dns.NSType, []uint16{}},
+			{"ns.secure.example.com", dns.AType, []uint16{}},
+			{"insecure.example.com", dns.NSType, []uint16{}},
+		}
+		for _, e := range expected {
+			tags := signers(t, records, e.name, e.rtype, keys)
+			if len(tags) != len(e.tags) || (len(tags) == 1 && tags[0] != e.tags[0]) {
+				t.Fatalf("unexpected signatures. case=%d name=%s type=%s actual=%v expected=%v",
+					i, e.name, e.rtype, tags, e.tags)
+			}
+		}
+
+		for _, name := range []string{"nothere.example.com", "a.www.example.com", "c.b.example.com"} {
+			if err := dns.ProveNameError(mustName(t, name), records); err != nil {
+				t.Fatalf("ProveNameError failed. case=%d name=%s err=%s", i, name, err.Error())
+			}
+		}
+
+		if err := dns.ProveNameError(mustName(t, "www.example.com"), records); err == nil {
+			t.Fatalf("ProveNameError should fail for an existing name. case=%d", i)
+		}
+
+		for _, name := range []string{"www.example.com", "b.example.com"} {
+			if _, err := dns.ProveNoData(mustName(t, name), dns.AAAAType, records); err != nil {
+				t.Fatalf("ProveNoData failed. case=%d name=%s err=%s", i, name, err.Error())
+			}
+		}
+
+		optOut, err := dns.ProveNoData(mustName(t, "insecure.example.com"), dns.DSType, records)
+		if err != nil || optOut != c.optOut {
+			t.Fatalf("unexpected DS proof. case=%d optOut=%t err=%v", i, optOut, err)
+		}
+	}
+}
+
+func TestZoneSignerResign(t *testing.T) {
+	key := signingKey(t, "example.com", dns.ED25519Algorithm)
+	s := dns.ZoneSigner{Keys: []dns.SigningKey{key}}
+	signed, err := s.Sign(unsignedZone(t))
+	if err != nil {
+		t.Fatalf("Sign failed with error %s", err.Error())
+	}
+
+	resigned, err := s.Sign(signed)
+	if err != nil {
+		t.Fatalf("Sign failed with error %s", err.Error())
+	}
+
+	if len(resigned.Records()) != len(signed.Records()) {
+		t.Fatalf("resigning changed the record count. actual=%d expected=%d",
+			len(resigned.Records()), len(signed.Records()))
+	}
+}
@@ -0,0 +1,183 @@
+package dns
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Stub resolves names as the C library does: from a hosts file first, then by
+// sending recursive queries to the name servers of a resolv.conf. It
+// implements the Querier interface
+type Stub struct {
+	Config *ResolvConf
+	// Hosts answers the queries it holds addresses for. It may be nil
+	Hosts *Hosts
+	// Client sends the queries, its timeout being replaced by the one of the
+	// configuration
+	Client Client
+
+	next uint32
+}
+
+// NewStub returns a stub configured from the resolv.conf and hosts files at the
+// paths, ie: "/etc/resolv.conf" and "/etc/hosts". Missing files are handled as
+// the C library does: the default configuration is used, and no name is
+// answered from the hosts file
+func NewStub(resolvConfPath, hostsPath string) (*Stub, error) {
+	config, err := ReadResolvConf(resolvConfPath)
+	if os.IsNotExist(err) {
+		config, err = DefaultResolvConf(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hosts, err := ReadHosts(hostsPath)
+	if os.IsNotExist(err) {
+		hosts, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stub{Config: config, Hosts: hosts}, nil
+}
+
+// Lookup resolves the name from the hosts file, or else with the name servers,
+// relative names being tried with the domains of the search list as done by
+// NameList. The first response holding records of the type is returned.
+// Otherwise a NODATA response is preferred to the failures, themselves
+// preferred to a NXDOMAIN response
+func (s *Stub) Lookup(name string, t QType) (Message, error) {
+	if n, err := NewName(strings.TrimSuffix(name, ".")); err == nil {
+		if m, ok := s.fromHosts(n, t); ok {
+			return m, nil
+		}
+	}
+
+	return search(QuerierFunc(s.exchange), s.Config, name, t)
+}
+
+// search resolves the names of the name list of name with the querier
+func search(q Querier, config *ResolvConf, name string, t QType) (Message, error) {
+	var nodata, nxdomain *Message
+	var lastErr error
+	for _, candidate := range config.NameList(name) {
+		n, err := NewName(candidate)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		resp, err := q.Query(n, t)
+		switch {
+		case err != nil:
+			lastErr = err
+		case resp.Header.RCode == NameErrorRCode:
+			nxdomain = &resp
+		case resp.Header.RCode != NoErrorRCode:
+			lastErr = fmt.Errorf("failed to resolve %s %s. rcode=%s", candidate, t, resp.Header.RCode)
+		case isNegative(&resp):
+			if nodata == nil {
+				nodata = &resp
+			}
+		default:
+			return resp, nil
+		}
+	}
+
+	switch {
+	case nodata != nil:
+		return *nodata, nil
+	case lastErr != nil:
+		return Message{}, lastErr
+	case nxdomain != nil:
+		return *nxdomain, nil
+	default:
+		return Message{}, fmt.Errorf("failed to resolve %s %s, empty name list", name, t)
+	}
+}
+
+// Query answers from the hosts file, or sends a recursive query for the name
+// and type to the name servers. Each attempt tries the name servers in order,
+// or from the next one in turn with the rotate option, until one of them
+// answers with a rcode other than SERVFAIL, NOTIMP or REFUSED
+func (s *Stub) Query(name Name, t QType) (Message, error) {
+	if m, ok := s.fromHosts(name, t); ok {
+		return m, nil
+	}
+
+	return s.exchange(name, t)
+}
+
+// fromHosts returns the response built from the hosts file, if it holds
+// records of the name and type
+func (s *Stub) fromHosts(name Name, t QType) (Message, bool) {
+	if s.Hosts == nil {
+		return Message{}, false
+	}
+
+	records := s.Hosts.records(name, t)
+	if len(records) == 0 {
+		return Message{}, false
+	}
+
+	m := Message{
+		Header:   Header{QR: true, RD: true, RA: true, QuestionCount: 1},
+		Question: Question{Name: name, Type: t, Class: INClass},
+		Answers:  records,
+	}
+	return m, true
+}
+
+// exchange sends the query to the name servers
+func (s *Stub) exchange(name Name, t QType) (Message, error) {
+	servers := s.Config.Servers
+	if len(servers) == 0 {
+		return Message{}, fmt.Errorf("failed to resolve %s %s, no name server configured", name.GetName(), t)
+	}
+
+	start := 0
+	if s.Config.Rotate {
+		start = int(atomic.AddUint32(&s.next, 1)-1) % len(servers)
+	}
+
+	client := s.Client
+	client.Timeout = s.Config.Timeout
+	var last *Message
+	var lastErr error
+	for attempt := 0; attempt < max(s.Config.Attempts, 1); attempt++ {
+		for i := range servers {
+			q := &Message{
+				Header:   Header{Opcode: QueryOpcode, RD: true, QuestionCount: 1},
+				Question: Question{Name: name, Type: t, Class: INClass},
+			}
+			if s.Config.EDNS0 {
+				opt := EDNS{UDPSize: defaultEDNSUDPSize}
+				q.Additional = []ResourceRecord{opt.ToRecord()}
+			}
+
+			resp, err := client.Exchange(q, servers[(start+i)%len(servers)])
+			if err != nil {
+				lastErr = err
+				continue
+			}
+
+			switch resp.Header.RCode {
+			case ServerFailureRCode, NotImplementedRCode, RefusedRCode:
+				last = &resp
+				continue
+			}
+
+			return resp, nil
+		}
+	}
+
+	if last != nil {
+		return *last, nil
+	}
+
+	return Message{}, fmt.Errorf("failed to resolve %s %s. err=%s", name.GetName(), t, lastErr.Error())
+}
@@ -0,0 +1,122 @@
+package dns_test
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func TestReadHosts(t *testing.T) {
+	h, err := dns.ReadHosts(writeFile(t, "hosts", `127.0.0.1	localhost
+::1		localhost ip6-localhost
+192.0.2.1	Host.Example.com host # the host
+192.0.2.2	host.example.com
+# 192.0.2.3	commented.example.com
+invalid		invalid.example.com
+`))
+	if err != nil {
+		t.Fatalf("ReadHosts failed with error %s", err.Error())
+	}
+
+	var cases = []struct {
+		name     string
+		expected []string
+	}{
+		{"localhost", []string{"127.0.0.1", "::1"}},
+		{"HOST.example.com.", []string{"192.0.2.1", "192.0.2.2"}},
+		{"host", []string{"192.0.2.1"}},
+		{"commented.example.com", []string{}},
+		{"invalid.example.com", []string{}},
+	}
+
+	for i, c := range cases {
+		ips := h.Lookup(c.name)
+		if len(ips) != len(c.expected) {
+			t.Fatalf("unexpected address count. case=%d actual=%d expected=%d", i, len(ips), len(c.expected))
+		}
+
+		for j, ip := range ips {
+			if ip.String() != c.expected[j] {
+				t.Fatalf("unexpected address. case=%d actual=%s expected=%s", i, ip, c.expected[j])
+			}
+		}
+	}
+
+	names := h.LookupAddr(net.ParseIP("192.0.2.1"))
+	if len(names) != 2 || names[0] != "host.example.com" {
+		t.Fatalf("unexpected names. actual=%v", names)
+	}
+}
+
+func TestStub(t *testing.T) {
+	z, err := dns.NewZone(mustName(t, "example.com"), []dns.ResourceRecord{
+		soaRecord(t, "example.com", 1),
+		aRecord(t, "www.example.com", "192.0.2.1"),
+		aRecord(t, "www.corp.example.com", "192.0.2.2"),
+		aRecord(t, "mail.example.com", "192.0.2.3"),
+	})
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+
+	var queries int32
+	addr := startServer(t, countingHandler(zonesHandler(mustZone(t, "."), z), &queries))
+	refused := startServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		resp := dns.NewResponse(r)
+		resp.Header.RCode = dns.RefusedRCode
+		w.WriteMessage(resp)
+	}))
+
+	stub, err := dns.NewStub(writeFile(t, "resolv.conf", "search corp.example.com example.com\n"),
+		writeFile(t, "hosts", "192.0.2.10 mail.example.com mail\n192.0.2.11 gateway\n"))
+	if err != nil {
+		t.Fatalf("NewStub failed with error %s", err.Error())
+	}
+	// the name servers of resolv.conf listen on port 53
+	stub.Config.Servers = []string{refused, addr}
+
+	var cases = []struct {
+		name    string
+		qtype   dns.QType
+		rcode   dns.RCode
+		address string
+		queries int32
+	}{
+		// www.corp.example.com then www.example.com
+		{"www", dns.QType(dns.AType), dns.NoErrorRCode, "192.0.2.2", 1},
+		{"www.example.com", dns.QType(dns.AType), dns.NoErrorRCode, "192.0.2.1", 1},
+		// the hosts file is read first
+		{"mail.example.com", dns.QType(dns.AType), dns.NoErrorRCode, "192.0.2.10", 0},
+		{"gateway", dns.QType(dns.AType), dns.NoErrorRCode, "192.0.2.11", 0},
+		// no IPv6 address in the hosts file, the search list is tried after
+		// the NODATA response
+		{"mail.example.com", dns.QType(dns.AAAAType), dns.NoErrorRCode, "", 3},
+		{"10.2.0.192.in-addr.arpa", dns.QType(dns.PTRType), dns.NoErrorRCode, "", 0},
+		{"nothere", dns.QType(dns.AType), dns.NameErrorRCode, "", 3},
+		{"nothere.example.com.", dns.QType(dns.AType), dns.NameErrorRCode, "", 1},
+	}
+
+	for i, c := range cases {
+		atomic.StoreInt32(&queries, 0)
+		resp, err := stub.Lookup(c.name, c.qtype)
+		if err != nil {
+			t.Fatalf("Lookup failed. case=%d err=%s", i, err.Error())
+		}
+
+		if resp.Header.RCode != c.rcode || atomic.LoadInt32(&queries) != c.queries {
+			t.Fatalf("unexpected response. case=%d rcode=%s queries=%d", i, resp.Header.RCode,
+				atomic.LoadInt32(&queries))
+		}
+
+		if c.address != "" && (len(resp.Answers) != 1 || net.IP(resp.Answers[0].Data).String() != c.address) {
+			t.Fatalf("unexpected answers. case=%d answers=%d", i, len(resp.Answers))
+		}
+
+		// the canonical name comes first, then the aliases
+		if c.qtype == dns.QType(dns.PTRType) && (len(resp.Answers) != 2 || resp.Answers[0].Type != dns.PTRType) {
+			t.Fatalf("unexpected answers. case=%d answers=%d", i, len(resp.Answers))
+		}
+	}
+}
@@ -0,0 +1,505 @@
+package dns
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MandatoryKey lists the keys a client must understand to use the record
+	MandatoryKey SvcParamKey = 0
+	// ALPNKey lists the protocol identifiers supported by the service
+	ALPNKey SvcParamKey = 1
+	// NoDefaultALPNKey tells the default protocol of the scheme is not
+	// supported
+	NoDefaultALPNKey SvcParamKey = 2
+	// PortKey is the port of the service
+	PortKey SvcParamKey = 3
+	// IPv4HintKey lists IPv4 addresses of the service
+	IPv4HintKey SvcParamKey = 4
+	// ECHKey is the TLS encrypted client hello configuration list
+	ECHKey SvcParamKey = 5
+	// IPv6HintKey lists IPv6 addresses of the service
+	IPv6HintKey SvcParamKey = 6
+	// DOHPathKey is the URI template of a DNS over HTTPS service (RFC 9461)
+	DOHPathKey SvcParamKey = 7
+)
+
+// svcParamKeyNames are the presentation names of the registered keys
+var svcParamKeyNames = map[SvcParamKey]string{
+	MandatoryKey:     "mandatory",
+	ALPNKey:          "alpn",
+	NoDefaultALPNKey: "no-default-alpn",
+	PortKey:          "port",
+	IPv4HintKey:      "ipv4hint",
+	ECHKey:           "ech",
+	IPv6HintKey:      "ipv6hint",
+	DOHPathKey:       "dohpath",
+}
+
+// SvcParamKey identifies a parameter of a SVCB or HTTPS record
+type SvcParamKey uint16
+
+func (k SvcParamKey) String() string {
+	if name, ok := svcParamKeyNames[k]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("key%d", uint16(k))
+}
+
+// parseSvcParamKey parses the presentation form of a key, its name or the
+// generic keyNNNNN notation
+func parseSvcParamKey(s string) (SvcParamKey, error) {
+	for k, name := range svcParamKeyNames {
+		if s == name {
+			return k, nil
+		}
+	}
+
+	if number, ok := strings.CutPrefix(s, "key"); ok {
+		value, err := strconv.ParseUint(number, 10, 16)
+		if err == nil && (number == "0" || !strings.HasPrefix(number, "0")) {
+			return SvcParamKey(value), nil
+		}
+	}
+
+	return 0, fmt.Errorf("failed to parse SVCB data, invalid key %s", s)
+}
+
+// SvcParam is a parameter of a SVCB or HTTPS record, holding its value in wire
+// format
+type SvcParam struct {
+	Key   SvcParamKey
+	Value []byte
+}
+
+// SVCB is the data of a SVCB or HTTPS resource record (RFC 9460), giving the
+// location and parameters of a service
+type SVCB struct {
+	// Priority orders the records, zero marking the AliasMode records
+	// which only alias the owner to the target
+	Priority uint16
+	// Target is the name of the service, the root standing for the owner
+	// in ServiceMode
+	Target Name
+	// Params are the parameters of the service, in increasing key order
+	Params []SvcParam
+}
+
+// ToBytes returns the byte array form of the SVCB data
+func (s *SVCB) ToBytes() []byte {
+	data := appendUint16(make([]byte, 0, 2), s.Priority)
+	data = append(data, s.Target.ToBytes()...)
+
+	for _, p := range s.Params {
+		data = appendUint16(data, uint16(p.Key))
+		data = appendUint16(data, uint16(len(p.Value)))
+		data = append(data, p.Value...)
+	}
+
+	return data
+}
+
+func (s *SVCB) String() string {
+	fields := []string{fmt.Sprintf("%d", s.Priority), nameToString(s.Target)}
+	for _, p := range s.Params {
+		fields = append(fields, p.String())
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// Param returns the value of the parameter of the key
+func (s *SVCB) Param(key SvcParamKey) ([]byte, bool) {
+	for _, p := range s.Params {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// Mandatory returns the keys a client must understand to use the record
+func (s *SVCB) Mandatory() []SvcParamKey {
+	value, _ := s.Param(MandatoryKey)
+	keys := make([]SvcParamKey, 0, len(value)/2)
+	for i := 0; i+1 < len(value); i += 2 {
+		keys = append(keys, SvcParamKey(catBytes(value[i], value[i+1])))
+	}
+
+	return keys
+}
+
+// ALPN returns the protocol identifiers supported by the service, ie: "h2"
+func (s *SVCB) ALPN() []string {
+	value, _ := s.Param(ALPNKey)
+	ids, _ := txtStrings(value)
+	return ids
+}
+
+// NoDefaultALPN reports whether the default protocol of the scheme is not
+// supported by the service
+func (s *SVCB) NoDefaultALPN() bool {
+	_, ok := s.Param(NoDefaultALPNKey)
+	return ok
+}
+
+// Port returns the port of the service, if given
+func (s *SVCB) Port() (uint16, bool) {
+	value, ok := s.Param(PortKey)
+	if !ok || len(value) != 2 {
+		return 0, false
+	}
+
+	return catBytes(value[0], value[1]), true
+}
+
+// IPv4Hint returns the IPv4 addresses hinted for the service
+func (s *SVCB) IPv4Hint() []net.IP {
+	value, _ := s.Param(IPv4HintKey)
+	return splitIPs(value, net.IPv4len)
+}
+
+// IPv6Hint returns the IPv6 addresses hinted for the service
+func (s *SVCB) IPv6Hint() []net.IP {
+	value, _ := s.Param(IPv6HintKey)
+	return splitIPs(value, net.IPv6len)
+}
+
+// ECH returns the TLS encrypted client hello configuration list of the
+// service, if given
+func (s *SVCB) ECH() []byte {
+	value, _ := s.Param(ECHKey)
+	return value
+}
+
+// DOHPath returns the URI template of a DNS over HTTPS service, if given
+func (s *SVCB) DOHPath() (string, bool) {
+	value, ok := s.Param(DOHPathKey)
+	return string(value), ok
+}
+
+func splitIPs(value []byte, length int) []net.IP {
+	ips := make([]net.IP, 0, len(value)/length)
+	for i := 0; i+length <= len(value); i += length {
+		ips = append(ips, net.IP(value[i:i+length]))
+	}
+
+	return ips
+}
+
+// Validate checks the parameters are in strictly increasing key order, that the
+// values of the registered keys are well formed, and that the keys listed as
+// mandatory are present (RFC 9460 section 8)
+func (s *SVCB) Validate() error {
+	for i, p := range s.Params {
+		if i > 0 && p.Key <= s.Params[i-1].Key {
+			return fmt.Errorf("invalid SVCB data, keys not in strictly increasing order. key=%s", p.Key)
+		}
+
+		if err := validateSvcParam(p); err != nil {
+			return err
+		}
+	}
+
+	mandatory := s.Mandatory()
+	for i, key := range mandatory {
+		switch {
+		case key == MandatoryKey:
+			return fmt.Errorf("invalid SVCB data, mandatory lists itself")
+		case i > 0 && key <= mandatory[i-1]:
+			return fmt.Errorf("invalid SVCB data, mandatory keys not in strictly increasing order. key=%s", key)
+		}
+
+		if _, ok := s.Param(key); !ok {
+			return fmt.Errorf("invalid SVCB data, mandatory key is missing. key=%s", key)
+		}
+	}
+
+	if _, ok := s.Param(ALPNKey); s.NoDefaultALPN() && !ok {
+		return fmt.Errorf("invalid SVCB data, no-default-alpn requires alpn")
+	}
+
+	return nil
+}
+
+// validateSvcParam checks the value of a parameter of a registered key
+func validateSvcParam(p SvcParam) error {
+	var valid bool
+	switch p.Key {
+	case MandatoryKey:
+		valid = len(p.Value) > 0 && len(p.Value)%2 == 0
+	case ALPNKey:
+		ids, err := txtStrings(p.Value)
+		valid = err == nil && len(ids) > 0
+		for _, id := range ids {
+			valid = valid && id != ""
+		}
+	case NoDefaultALPNKey:
+		valid = len(p.Value) == 0
+	case PortKey:
+		valid = len(p.Value) == 2
+	case IPv4HintKey:
+		valid = len(p.Value) > 0 && len(p.Value)%net.IPv4len == 0
+	case IPv6HintKey:
+		valid = len(p.Value) > 0 && len(p.Value)%net.IPv6len == 0
+	case DOHPathKey:
+		// the template must be relative and expand the dns variable (RFC 9461)
+		valid = utf8.Valid(p.Value) && strings.HasPrefix(string(p.Value), "/") &&
+			strings.Contains(string(p.Value), "{?dns}")
+	default:
+		valid = true
+	}
+
+	if !valid {
+		return fmt.Errorf("invalid SVCB data, malformed %s value", p.Key)
+	}
+
+	return nil
+}
+
+// String returns the presentation form of the parameter, key=value
+func (p SvcParam) String() string {
+	switch p.Key {
+	case MandatoryKey:
+		keys := make([]string, 0, len(p.Value)/2)
+		for i := 0; i+1 < len(p.Value); i += 2 {
+			keys = append(keys, SvcParamKey(catBytes(p.Value[i], p.Value[i+1])).String())
+		}
+		return p.Key.String() + "=" + strings.Join(keys, ",")
+	case ALPNKey:
+		ids, err := txtStrings(p.Value)
+		if err != nil {
+			break
+		}
+		// commas and backslashes inside an identifier are escaped, then the
+		// list is escaped as a character string (RFC 9460 appendix A.1)
+		for i, id := range ids {
+			ids[i] = strings.NewReplacer(`\`, `\\`, `,`, `\,`).Replace(id)
+		}
+		return p.Key.String() + "=" + quoteString(strings.Join(ids, ","))
+	case NoDefaultALPNKey:
+		if len(p.Value) == 0 {
+			return p.Key.String()
+		}
+	case PortKey:
+		if len(p.Value) == 2 {
+			return fmt.Sprintf("%s=%d", p.Key, catBytes(p.Value[0], p.Value[1]))
+		}
+	case IPv4HintKey, IPv6HintKey:
+		length := net.IPv4len
+		if p.Key == IPv6HintKey {
+			length = net.IPv6len
+		}
+		if len(p.Value)%length != 0 {
+			break
+		}
+
+		ips := make([]string, 0)
+		for _, ip := range splitIPs(p.Value, length) {
+			ips = append(ips, ip.String())
+		}
+		return p.Key.String() + "=" + strings.Join(ips, ",")
+	case ECHKey:
+		return p.Key.String() + "=" + base64.StdEncoding.EncodeToString(p.Value)
+	case DOHPathKey:
+		return p.Key.String() + "=" + quoteString(string(p.Value))
+	}
+
+	if len(p.Value) == 0 {
+		return p.Key.String()
+	}
+
+	// unknown keys and malformed values use the generic form
+	return fmt.Sprintf("key%d=%s", uint16(p.Key), quoteString(string(p.Value)))
+}
+
+// parseSvcParam parses the presentation form of a parameter, key or key=value,
+// the value being stripped of its quotes and escapes
+func parseSvcParam(field string) (SvcParam, error) {
+	name, value, hasValue := strings.Cut(field, "=")
+	key, err := parseSvcParamKey(name)
+	if err != nil {
+		return SvcParam{}, err
+	}
+
+	p := SvcParam{Key: key}
+	if !hasValue || value == "" {
+		if _, registered := svcParamKeyNames[key]; registered && key != NoDefaultALPNKey {
+			return SvcParam{}, fmt.Errorf("failed to parse SVCB data, missing %s value", key)
+		}
+		p.Value = []byte{}
+		return p, nil
+	}
+
+	switch key {
+	case MandatoryKey:
+		keys := make([]SvcParamKey, 0)
+		for _, name := range strings.Split(value, ",") {
+			k, err := parseSvcParamKey(name)
+			if err != nil {
+				return SvcParam{}, err
+			}
+			keys = append(keys, k)
+		}
+
+		// the keys may be listed in any order, and are sorted on the wire
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		p.Value = make([]byte, 0, 2*len(keys))
+		for _, k := range keys {
+			p.Value = appendUint16(p.Value, uint16(k))
+		}
+	case ALPNKey:
+		p.Value = make([]byte, 0)
+		for _, id := range splitValueList(value) {
+			if len(id) > 255 {
+				return SvcParam{}, fmt.Errorf("failed to parse SVCB data, alpn identifier exceeds 255 bytes")
+			}
+			p.Value = appendCharacterString(p.Value, id)
+		}
+	case NoDefaultALPNKey:
+		return SvcParam{}, fmt.Errorf("failed to parse SVCB data, no-default-alpn takes no value")
+	case PortKey:
+		port, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return SvcParam{}, fmt.Errorf("failed to parse SVCB data, invalid port %s", value)
+		}
+		p.Value = appendUint16(nil, uint16(port))
+	case IPv4HintKey, IPv6HintKey:
+		p.Value = make([]byte, 0)
+		for _, addr := range strings.Split(value, ",") {
+			ip := net.ParseIP(addr)
+			if key == IPv4HintKey {
+				ip = ip.To4()
+			} else if !strings.Contains(addr, ":") {
+				ip = nil
+			}
+			if ip == nil {
+				return SvcParam{}, fmt.Errorf("failed to parse SVCB data, invalid %s address %s", key, addr)
+			}
+			p.Value = append(p.Value, ip...)
+		}
+	case ECHKey:
+		p.Value, err = base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return SvcParam{}, fmt.Errorf("failed to parse SVCB data, invalid ech value")
+		}
+	default:
+		p.Value = []byte(value)
+	}
+
+	return p, validateSvcParam(p)
+}
+
+// splitValueList splits a comma separated list in which commas and
+// backslashes are escaped (RFC 9460 appendix A.1)
+func splitValueList(s string) []string {
+	items := make([]string, 0)
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case s[i] == ',':
+			items = append(items, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return append(items, b.String())
+}
+
+// ParseSVCB parses the presentation form of SVCB or HTTPS data, ie:
+// `1 . alpn=h2,h3 port=8443 ipv4hint=192.0.2.1`. The parameters may be given in
+// any order, and are sorted by key
+func ParseSVCB(s string) (SVCB, error) {
+	fields, err := presentationFields(s)
+	if err != nil {
+		return SVCB{}, err
+	}
+
+	if len(fields) < 2 {
+		return SVCB{}, fmt.Errorf("failed to parse SVCB data, invalid field count %d", len(fields))
+	}
+
+	values, err := parseUint16Fields("SVCB", fields[:1])
+	if err != nil {
+		return SVCB{}, err
+	}
+
+	target, err := NewName(fields[1])
+	if err != nil {
+		return SVCB{}, err
+	}
+
+	svcb := SVCB{Priority: values[0], Target: target, Params: make([]SvcParam, 0, len(fields)-2)}
+	for _, field := range fields[2:] {
+		p, err := parseSvcParam(field)
+		if err != nil {
+			return SVCB{}, err
+		}
+
+		if _, ok := svcb.Param(p.Key); ok {
+			return SVCB{}, fmt.Errorf("failed to parse SVCB data, duplicate key %s", p.Key)
+		}
+		svcb.Params = append(svcb.Params, p)
+	}
+	sort.Slice(svcb.Params, func(i, j int) bool { return svcb.Params[i].Key < svcb.Params[j].Key })
+
+	if err := svcb.Validate(); err != nil {
+		return SVCB{}, err
+	}
+
+	return svcb, nil
+}
+
+// SVCB returns the data of a SVCB or HTTPS resource record, failing if it is
+// not valid
+func (rr ResourceRecord) SVCB() (SVCB, error) {
+	if rr.Type != SVCBType && rr.Type != HTTPSType {
+		return SVCB{}, fmt.Errorf("resource record is not a SVCB record. type=%s", rr.Type)
+	}
+
+	if len(rr.Data) < 3 {
+		return SVCB{}, fmt.Errorf("failed to parse SVCB data, invalid length %d", len(rr.Data))
+	}
+
+	svcb := SVCB{Priority: catBytes(rr.Data[0], rr.Data[1]), Params: make([]SvcParam, 0)}
+	n, err := svcb.Target.fromBytes(rr.Data, 2)
+	if err != nil {
+		return SVCB{}, err
+	}
+
+	for offset := 2 + n; offset < len(rr.Data); {
+		if offset+4 > len(rr.Data) {
+			return SVCB{}, fmt.Errorf("failed to parse SVCB data, invalid length %d", len(rr.Data))
+		}
+
+		length := int(catBytes(rr.Data[offset+2], rr.Data[offset+3]))
+		if offset+4+length > len(rr.Data) {
+			return SVCB{}, fmt.Errorf("failed to parse SVCB data, invalid length %d", len(rr.Data))
+		}
+
+		svcb.Params = append(svcb.Params, SvcParam{
+			Key:   SvcParamKey(catBytes(rr.Data[offset], rr.Data[offset+1])),
+			Value: rr.Data[offset+4 : offset+4+length],
+		})
+		offset += 4 + length
+	}
+
+	if err := svcb.Validate(); err != nil {
+		return SVCB{}, err
+	}
+
+	return svcb, nil
+}
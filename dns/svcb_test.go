@@ -0,0 +1,141 @@
+package dns_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func TestSVCB(t *testing.T) {
+	// test vectors of RFC 9460 appendix D
+	var cases = []struct {
+		presentation string
+		wire         string
+		expected     string
+	}{
+		{"0 foo.example.com.", "0000" + "03666f6f076578616d706c6503636f6d00", "0 foo.example.com."},
+		{"1 .", "000100", "1 ."},
+		{"16 foo.example.com. port=53", "0010" + "03666f6f076578616d706c6503636f6d00" + "000300020035",
+			"16 foo.example.com. port=53"},
+		{"1 foo.example.com. key667=hello", "0001" + "03666f6f076578616d706c6503636f6d00" + "029b000568656c6c6f",
+			`1 foo.example.com. key667="hello"`},
+		{`1 foo.example.com. key667="hello\210qoo"`,
+			"0001" + "03666f6f076578616d706c6503636f6d00" + "029b000968656c6c6fd2716f6f",
+			`1 foo.example.com. key667="hello\210qoo"`},
+		{`1 foo.example.com. ipv6hint="2001:db8::1,2001:db8::53:1"`,
+			"0001" + "03666f6f076578616d706c6503636f6d00" + "00060020" +
+				"20010db8000000000000000000000001" + "20010db8000000000000000000530001",
+			"1 foo.example.com. ipv6hint=2001:db8::1,2001:db8::53:1"},
+		{"16 foo.example.org. alpn=h2,h3-19 mandatory=ipv4hint,alpn ipv4hint=192.0.2.1",
+			"0010" + "03666f6f076578616d706c65036f726700" + "000000040001" + "0004" +
+				"00010009" + "02683205" + "68332d3139" + "00040004c0000201",
+			`16 foo.example.org. mandatory=alpn,ipv4hint alpn="h2,h3-19" ipv4hint=192.0.2.1`},
+		{`16 foo.example.org. alpn="f\\\\oo\\,bar,h2"`,
+			"0010" + "03666f6f076578616d706c65036f726700" + "0001000c" + "08665c6f6f2c626172" + "026832",
+			`16 foo.example.org. alpn="f\\\\oo\\,bar,h2"`},
+		{`1 . alpn=h3 no-default-alpn ech=AEX+DQBB dohpath=/dns-query{?dns}`,
+			"000100" + "00010003026833" + "00020000" + "0005000600" + "45fe0d0041" +
+				"00070010" + hex.EncodeToString([]byte("/dns-query{?dns}")),
+			`1 . alpn="h3" no-default-alpn ech=AEX+DQBB dohpath="/dns-query{?dns}"`},
+	}
+
+	for i, c := range cases {
+		svcb, err := dns.ParseSVCB(c.presentation)
+		if err != nil {
+			t.Fatalf("ParseSVCB failed. case=%d err=%s", i, err.Error())
+		}
+
+		if hex.EncodeToString(svcb.ToBytes()) != c.wire {
+			t.Fatalf("unexpected wire form. case=%d actual=%x expected=%s", i, svcb.ToBytes(), c.wire)
+		}
+
+		rr := dns.NewResourceRecord(mustName(t, "example.com"), dns.HTTPSType, dns.INClass, 300, svcb.ToBytes())
+		parsed, err := rr.SVCB()
+		if err != nil {
+			t.Fatalf("SVCB failed. case=%d err=%s", i, err.Error())
+		}
+
+		if parsed.String() != c.expected {
+			t.Fatalf("unexpected presentation form. case=%d actual=%s expected=%s", i, parsed.String(), c.expected)
+		}
+
+		reparsed, err := dns.ParseSVCB(parsed.String())
+		if err != nil || hex.EncodeToString(reparsed.ToBytes()) != c.wire {
+			t.Fatalf("presentation form does not round trip. case=%d err=%v", i, err)
+		}
+	}
+}
+
+func TestSVCBInvalid(t *testing.T) {
+	// failure cases of RFC 9460 appendix D.3, and malformed values
+	var cases = []string{
+		"1 foo.example.com. key123=abc key123=def",
+		"1 foo.example.com. mandatory",
+		"1 foo.example.com. alpn",
+		"1 foo.example.com. port",
+		"1 foo.example.com. ipv4hint",
+		"1 foo.example.com. ipv6hint",
+		"1 foo.example.com. no-default-alpn=abc",
+		"1 foo.example.com. mandatory=key123",
+		"1 foo.example.com. mandatory=mandatory",
+		"1 foo.example.com. ipv6hint=192.0.2.1",
+		"1 foo.example.com. ipv4hint=2001:db8::1",
+		"1 foo.example.com. no-default-alpn",
+		"1 foo.example.com. port=65536",
+		"1 foo.example.com. port=53 key3=53",
+		"1 foo.example.com. dohpath=/dns-query",
+		"1 foo.example.com. key065=abc",
+		"1 foo.example.com. unknown=abc",
+		"1",
+	}
+
+	for i, c := range cases {
+		if _, err := dns.ParseSVCB(c); err == nil {
+			t.Fatalf("expected an error. case=%d presentation=%s", i, c)
+		}
+	}
+
+	// keys out of order on the wire
+	data, _ := hex.DecodeString("000100" + "000300020035" + "00010003026833")
+	rr := dns.NewResourceRecord(mustName(t, "example.com"), dns.SVCBType, dns.INClass, 300, data)
+	if _, err := rr.SVCB(); err == nil {
+		t.Fatalf("expected an error for keys out of order")
+	}
+}
+
+func TestSVCBParams(t *testing.T) {
+	svcb, err := dns.ParseSVCB("1 svc.example.com. alpn=h2,h3 port=8443 ipv4hint=192.0.2.1,192.0.2.2 " +
+		"ipv6hint=2001:db8::1 mandatory=port dohpath=/q{?dns}")
+	if err != nil {
+		t.Fatalf("ParseSVCB failed with error %s", err.Error())
+	}
+
+	if alpn := svcb.ALPN(); len(alpn) != 2 || alpn[0] != "h2" || alpn[1] != "h3" {
+		t.Fatalf("unexpected alpn. actual=%v", alpn)
+	}
+
+	if port, ok := svcb.Port(); !ok || port != 8443 {
+		t.Fatalf("unexpected port. actual=%d", port)
+	}
+
+	if hints := svcb.IPv4Hint(); len(hints) != 2 || hints[1].String() != "192.0.2.2" {
+		t.Fatalf("unexpected ipv4hint. actual=%v", hints)
+	}
+
+	if hints := svcb.IPv6Hint(); len(hints) != 1 || hints[0].String() != "2001:db8::1" {
+		t.Fatalf("unexpected ipv6hint. actual=%v", hints)
+	}
+
+	if mandatory := svcb.Mandatory(); len(mandatory) != 1 || mandatory[0] != dns.PortKey {
+		t.Fatalf("unexpected mandatory keys. actual=%v", mandatory)
+	}
+
+	if path, ok := svcb.DOHPath(); !ok || path != "/q{?dns}" {
+		t.Fatalf("unexpected dohpath. actual=%s", path)
+	}
+
+	if svcb.NoDefaultALPN() || svcb.ECH() != nil {
+		t.Fatalf("unexpected parameters")
+	}
+}
@@ -0,0 +1,257 @@
+package dns
+
+import (
+	"fmt"
+	"log"
+)
+
+// maxTransferMessageSize is the size above which a zone transfer response is
+// split into another message
+const maxTransferMessageSize = 16384
+
+// TransferHandler answers the AXFR and IXFR (RFC 1995) requests for a zone, as
+// well as the SOA queries secondaries use to check its serial. Incremental
+// transfers are served from the journal when it holds the history the client
+// needs, full transfers are sent otherwise
+type TransferHandler struct {
+	Zone *Zone
+	// Journal records the changes of the zone. It may be nil, in which case
+	// every IXFR request is answered with a full transfer
+	Journal *Journal
+	// AllowKeys lists the TSIG keys transfers must be signed with. Transfers
+	// are allowed to anyone if empty
+	AllowKeys []string
+	// ErrorLog logs the transfers that failed to be sent. Defaults to the
+	// standard logger of the log package
+	ErrorLog *log.Logger
+}
+
+// ServeDNS implements the Handler interface
+func (h *TransferHandler) ServeDNS(w ResponseWriter, r *Message) {
+	resp := NewResponse(r)
+	resp.Header.AA = true
+
+	if r.Header.QuestionCount == 0 || !r.Question.Name.Equal(h.Zone.Origin()) {
+		resp.Header.RCode = RefusedRCode
+		w.WriteMessage(resp)
+		return
+	}
+
+	if r.Question.Type != QType(SOAType) && len(h.AllowKeys) > 0 && !nameAllowed(w.TSIGKeyName(), h.AllowKeys) {
+		resp.Header.RCode = RefusedRCode
+		w.WriteMessage(resp)
+		return
+	}
+
+	var records []ResourceRecord
+	switch r.Question.Type {
+	case QType(SOAType):
+		resp.Answers = []ResourceRecord{h.Zone.SOA()}
+		w.WriteMessage(resp)
+		return
+	case AXFRQType:
+		if w.Network() != "tcp" {
+			resp.Header.RCode = RefusedRCode
+			w.WriteMessage(resp)
+			return
+		}
+		records = axfrRecords(h.Zone)
+	case IXFRQType:
+		serial, ok := requestSerial(r)
+		if !ok {
+			resp.Header.RCode = FormatErrorRCode
+			w.WriteMessage(resp)
+			return
+		}
+		records = ixfrRecords(h.Zone, h.Journal, serial)
+	default:
+		resp.Header.RCode = NotImplementedRCode
+		w.WriteMessage(resp)
+		return
+	}
+
+	if w.Network() != "tcp" {
+		resp.Answers = records
+		if len(resp.ToBytes()) > maxUDPMessageSize {
+			// RFC 1995 section 2: a single SOA tells the client to retry over TCP
+			resp.Answers = []ResourceRecord{h.Zone.SOA()}
+		}
+		w.WriteMessage(resp)
+		return
+	}
+
+	if err := writeTransfer(w, resp, records); err != nil {
+		logf(h.ErrorLog, "failed to send transfer of zone %s to %v. %s", nameToString(h.Zone.Origin()),
+			w.RemoteAddr(), err.Error())
+	}
+}
+
+// writeTransfer sends the records of a zone transfer, split across as many
+// messages as needed
+func writeTransfer(w ResponseWriter, resp *Message, records []ResourceRecord) error {
+	size := len(resp.ToBytes())
+	resp.Answers = make([]ResourceRecord, 0)
+
+	for _, rr := range records {
+		rrSize := len(rr.ToBytes())
+		if len(resp.Answers) > 0 && size+rrSize > maxTransferMessageSize {
+			if err := w.WriteMessage(resp); err != nil {
+				return err
+			}
+			resp.Answers = make([]ResourceRecord, 0)
+			size = len(resp.ToBytes())
+		}
+
+		resp.Answers = append(resp.Answers, rr)
+		size += rrSize
+	}
+
+	return w.WriteMessage(resp)
+}
+
+// requestSerial returns the serial of the SOA record found in the authority
+// section of an IXFR request
+func requestSerial(r *Message) (uint32, bool) {
+	for _, rr := range r.Authority {
+		if rr.Type != SOAType {
+			continue
+		}
+
+		soa, err := rr.SOA()
+		if err != nil {
+			return 0, false
+		}
+		return soa.Serial, true
+	}
+
+	return 0, false
+}
+
+// axfrRecords returns the answer records of a full zone transfer: the SOA, the
+// records of the zone and the SOA again
+func axfrRecords(z *Zone) []ResourceRecord {
+	records := z.Records()
+	return append(records, records[0])
+}
+
+// ixfrRecords returns the answer records of an incremental zone transfer for a
+// client holding serial: a single SOA if the client is up to date, a condensed
+// difference sequence if the journal holds the history since serial, and a full
+// zone transfer otherwise
+func ixfrRecords(z *Zone, j *Journal, serial uint32) []ResourceRecord {
+	records := z.Records()
+	soa := records[0]
+	current := soaSerial(soa)
+	if current == serial || SerialLess(current, serial) {
+		return []ResourceRecord{soa}
+	}
+
+	if j == nil {
+		return append(records, soa)
+	}
+
+	diffs, ok := j.Since(serial)
+	if !ok {
+		return append(records, soa)
+	}
+
+	d := condense(diffs)
+	if soaSerial(d.To) != current {
+		// the zone changed while the journal was read
+		return append(records, soa)
+	}
+
+	answers := make([]ResourceRecord, 0, len(d.Deleted)+len(d.Added)+4)
+	answers = append(answers, soa, d.From)
+	answers = append(answers, d.Deleted...)
+	answers = append(answers, d.To)
+	answers = append(answers, d.Added...)
+	return append(answers, soa)
+}
+
+// ApplyTransfer atomically updates the zone with the answer records of an AXFR
+// or IXFR response. A full transfer replaces the content of the zone, while the
+// difference sequences of an incremental transfer are applied in order
+func (z *Zone) ApplyTransfer(records []ResourceRecord) error {
+	if len(records) == 0 || records[0].Type != SOAType {
+		return fmt.Errorf("failed to apply transfer, response must start with a SOA record")
+	}
+
+	serial := soaSerial(records[0])
+	if len(records) == 1 {
+		current := z.Serial()
+		if current == serial || SerialLess(serial, current) {
+			return nil
+		}
+		return fmt.Errorf("failed to apply transfer, server requires a full transfer over TCP. serial=%d", serial)
+	}
+
+	last := records[len(records)-1]
+	if last.Type != SOAType || soaSerial(last) != serial {
+		return fmt.Errorf("failed to apply transfer, response must end with the SOA record")
+	}
+
+	if len(records) == 2 || records[1].Type != SOAType {
+		return z.Replace(records[:len(records)-1])
+	}
+
+	diffs, err := diffsFromRecords(records[1 : len(records)-1])
+	if err != nil {
+		return err
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	soa := z.soa
+	current := z.records
+	for _, d := range diffs {
+		current, err = applyDiff(soa, current, d)
+		if err != nil {
+			return err
+		}
+		soa = d.To
+	}
+
+	if soaSerial(soa) != serial {
+		return fmt.Errorf("failed to apply transfer, differences end at serial %d instead of %d",
+			soaSerial(soa), serial)
+	}
+
+	z.soa = soa
+	z.records = current
+	return nil
+}
+
+// diffsFromRecords parses the difference sequences of an IXFR response, each of
+// them being made of the old SOA, the deleted records, the new SOA and the
+// added records
+func diffsFromRecords(records []ResourceRecord) ([]Diff, error) {
+	diffs := make([]Diff, 0)
+
+	i := 0
+	for i < len(records) {
+		d := Diff{From: records[i], Deleted: make([]ResourceRecord, 0), Added: make([]ResourceRecord, 0)}
+		i++
+
+		for i < len(records) && records[i].Type != SOAType {
+			d.Deleted = append(d.Deleted, records[i])
+			i++
+		}
+
+		if i == len(records) {
+			return nil, fmt.Errorf("failed to parse IXFR difference, missing new SOA record")
+		}
+		d.To = records[i]
+		i++
+
+		for i < len(records) && records[i].Type != SOAType {
+			d.Added = append(d.Added, records[i])
+			i++
+		}
+
+		diffs = append(diffs, d)
+	}
+
+	return diffs, nil
+}
@@ -0,0 +1,305 @@
+package dns_test
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func mustName(t *testing.T, name string) dns.Name {
+	n, err := dns.NewName(name)
+	if err != nil {
+		t.Fatalf("NewName failed for name %s with error %s", name, err.Error())
+	}
+
+	return n
+}
+
+func soaRecord(t *testing.T, origin string, serial uint32) dns.ResourceRecord {
+	soa := dns.SOA{
+		MName:   mustName(t, "ns1."+origin),
+		RName:   mustName(t, "hostmaster."+origin),
+		Serial:  serial,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minimum: 300,
+	}
+
+	return dns.NewResourceRecord(mustName(t, origin), dns.SOAType, dns.INClass, 3600, soa.ToBytes())
+}
+
+func aRecord(t *testing.T, name string, ip string) dns.ResourceRecord {
+	return dns.NewResourceRecord(mustName(t, name), dns.AType, dns.INClass, 300, net.ParseIP(ip).To4())
+}
+
+func startServer(t *testing.T, handler dns.Handler) string {
+	return startServerWith(t, &dns.Server{Handler: handler})
+}
+
+func startServerWith(t *testing.T, s *dns.Server) string {
+	var pc net.PacketConn
+	var ln net.Listener
+	// the UDP port picked may be in use over TCP, another one is tried then
+	for attempt := 0; ln == nil; attempt++ {
+		var err error
+		pc, err = net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen on udp. err=%s", err.Error())
+		}
+
+		ln, err = net.Listen("tcp", pc.LocalAddr().String())
+		if err != nil {
+			pc.Close()
+			if attempt == 10 {
+				t.Fatalf("failed to listen on tcp. err=%s", err.Error())
+			}
+		}
+	}
+
+	go s.ServeUDP(pc)
+	go s.ServeTCP(ln)
+	t.Cleanup(func() { s.Close() })
+
+	return pc.LocalAddr().String()
+}
+
+func assertSameRecords(t *testing.T, actual, expected []dns.ResourceRecord) {
+	if len(actual) != len(expected) {
+		t.Fatalf("unexpected record count. actual=%d expected=%d", len(actual), len(expected))
+	}
+
+	for _, e := range expected {
+		found := false
+		for _, a := range actual {
+			if a.Name.Equal(e.Name) && a.Type == e.Type && string(a.Data) == string(e.Data) {
+				found = true
+			}
+		}
+
+		if !found {
+			t.Fatalf("record missing. name=%s type=%s data=%v", e.Name.GetName(), e.Type, e.Data)
+		}
+	}
+}
+
+// primaryZone returns a zone at serial 3 along with a journal holding its
+// changes since serial 1
+func primaryZone(t *testing.T) (*dns.Zone, *dns.Journal) {
+	z, err := dns.NewZone(mustName(t, "example.com"), []dns.ResourceRecord{
+		soaRecord(t, "example.com", 1),
+		aRecord(t, "www.example.com", "192.0.2.1"),
+		aRecord(t, "mail.example.com", "192.0.2.2"),
+	})
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+
+	j := dns.NewJournal(10)
+	diffs := []dns.Diff{
+		{
+			From:    soaRecord(t, "example.com", 1),
+			To:      soaRecord(t, "example.com", 2),
+			Deleted: []dns.ResourceRecord{aRecord(t, "www.example.com", "192.0.2.1")},
+			Added:   []dns.ResourceRecord{aRecord(t, "www.example.com", "192.0.2.10")},
+		},
+		{
+			From:    soaRecord(t, "example.com", 2),
+			To:      soaRecord(t, "example.com", 3),
+			Deleted: []dns.ResourceRecord{aRecord(t, "www.example.com", "192.0.2.10")},
+			Added:   []dns.ResourceRecord{aRecord(t, "ftp.example.com", "192.0.2.3")},
+		},
+	}
+
+	for _, d := range diffs {
+		if err := z.Apply(d); err != nil {
+			t.Fatalf("Apply failed with error %s", err.Error())
+		}
+		if err := j.Append(d); err != nil {
+			t.Fatalf("Append failed with error %s", err.Error())
+		}
+	}
+
+	return z, j
+}
+
+func TestJournalAppend_discontinuity(t *testing.T) {
+	j := dns.NewJournal(0)
+	err := j.Append(dns.Diff{From: soaRecord(t, "example.com", 1), To: soaRecord(t, "example.com", 2)})
+	if err != nil {
+		t.Fatalf("Append failed with error %s", err.Error())
+	}
+
+	err = j.Append(dns.Diff{From: soaRecord(t, "example.com", 3), To: soaRecord(t, "example.com", 4)})
+	if err == nil {
+		t.Fatal("Append should return an error if the diff does not follow the last one")
+	}
+}
+
+func TestJournalSince(t *testing.T) {
+	_, j := primaryZone(t)
+
+	if diffs, ok := j.Since(2); !ok || len(diffs) != 1 {
+		t.Fatalf("Since returned unexpected diffs. ok=%v count=%d", ok, len(diffs))
+	}
+
+	if _, ok := j.Since(0); ok {
+		t.Fatal("Since should report missing history")
+	}
+}
+
+func TestIXFR(t *testing.T) {
+	primary, j := primaryZone(t)
+	addr := startServer(t, &dns.TransferHandler{Zone: primary, Journal: j})
+
+	secondary, err := dns.NewZone(mustName(t, "example.com"), []dns.ResourceRecord{
+		soaRecord(t, "example.com", 1),
+		aRecord(t, "www.example.com", "192.0.2.1"),
+		aRecord(t, "mail.example.com", "192.0.2.2"),
+	})
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+
+	c := dns.Client{}
+	if err := c.IXFR(secondary, addr); err != nil {
+		t.Fatalf("IXFR failed with error %s", err.Error())
+	}
+
+	if secondary.Serial() != 3 {
+		t.Fatalf("IXFR did not update the serial. actual=%d expected=3", secondary.Serial())
+	}
+	assertSameRecords(t, secondary.Records(), primary.Records())
+
+	// up to date zones are left untouched
+	if err := c.IXFR(secondary, addr); err != nil {
+		t.Fatalf("IXFR failed with error %s", err.Error())
+	}
+	assertSameRecords(t, secondary.Records(), primary.Records())
+}
+
+func TestIXFR_fallbackToAXFR(t *testing.T) {
+	primary, _ := primaryZone(t)
+	addr := startServer(t, &dns.TransferHandler{Zone: primary, Journal: dns.NewJournal(0)})
+
+	secondary, err := dns.NewZone(mustName(t, "example.com"), []dns.ResourceRecord{
+		soaRecord(t, "example.com", 1),
+		aRecord(t, "old.example.com", "192.0.2.99"),
+	})
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+
+	c := dns.Client{}
+	if err := c.IXFR(secondary, addr); err != nil {
+		t.Fatalf("IXFR failed with error %s", err.Error())
+	}
+
+	assertSameRecords(t, secondary.Records(), primary.Records())
+}
+
+func TestAXFR(t *testing.T) {
+	primary, _ := primaryZone(t)
+	addr := startServer(t, &dns.TransferHandler{Zone: primary})
+
+	c := dns.Client{}
+	z, err := c.AXFR(mustName(t, "example.com"), addr)
+	if err != nil {
+		t.Fatalf("AXFR failed with error %s", err.Error())
+	}
+
+	assertSameRecords(t, z.Records(), primary.Records())
+}
+
+func TestExchange_questionMismatch(t *testing.T) {
+	forged := func(r *dns.Message, change func(q *dns.Question)) *dns.Message {
+		resp := dns.NewResponse(r)
+		change(&resp.Question)
+		resp.Answers = []dns.ResourceRecord{aRecord(t, resp.Question.Name.GetName(), "192.0.2.66")}
+		return resp
+	}
+
+	var cases = []func(q *dns.Question){
+		func(q *dns.Question) { q.Name = mustName(t, "evil.example.com") },
+		func(q *dns.Question) { q.Type = dns.QType(dns.AAAAType) },
+		func(q *dns.Question) { q.Class = dns.CHClass },
+	}
+
+	for i, change := range cases {
+		// the forged response is written before the genuine one
+		addr := startServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+			w.WriteMessage(forged(r, change))
+			if w.Network() == "udp" {
+				resp := dns.NewResponse(r)
+				resp.Answers = []dns.ResourceRecord{aRecord(t, "www.example.com", "192.0.2.1")}
+				w.WriteMessage(resp)
+			}
+		}))
+
+		c := dns.Client{}
+		q, _ := dns.NewQuestion("www.example.com")
+		q.Question.Type = dns.QType(dns.AType)
+		q.Question.Class = dns.INClass
+		resp, err := c.Exchange(q, addr)
+		if err != nil {
+			t.Fatalf("Exchange failed. case=%d err=%s", i, err.Error())
+		}
+
+		if len(resp.Answers) != 1 || string(resp.Answers[0].Data) != string(net.ParseIP("192.0.2.1").To4()) {
+			t.Fatalf("forged response accepted over udp. case=%d", i)
+		}
+
+		if _, err := c.ExchangeTCP(q, addr); err == nil {
+			t.Fatalf("forged response accepted over tcp. case=%d", i)
+		}
+	}
+}
+
+// brokenWriter fails to write the messages of a TCP connection
+type brokenWriter struct {
+	messageRecorder
+}
+
+func (w *brokenWriter) WriteMessage(m *dns.Message) error {
+	return fmt.Errorf("connection reset by peer")
+}
+
+func (w *brokenWriter) Network() string { return "tcp" }
+
+func TestTransferHandler_writeFailure(t *testing.T) {
+	primary, _ := primaryZone(t)
+	var logs bytes.Buffer
+	h := &dns.TransferHandler{Zone: primary, ErrorLog: log.New(&logs, "", 0)}
+
+	q, _ := dns.NewQuestion("example.com")
+	q.Question.Type = dns.AXFRQType
+	h.ServeDNS(&brokenWriter{}, q)
+
+	if !strings.Contains(logs.String(), "failed to send transfer of zone example.com.") {
+		t.Fatalf("transfer failure was not logged. logs=%q", logs.String())
+	}
+}
+
+func TestApplyTransfer_serialMismatch(t *testing.T) {
+	z, err := dns.NewZone(mustName(t, "example.com"), []dns.ResourceRecord{soaRecord(t, "example.com", 5)})
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+
+	records := []dns.ResourceRecord{
+		soaRecord(t, "example.com", 3),
+		soaRecord(t, "example.com", 1),
+		soaRecord(t, "example.com", 3),
+		aRecord(t, "www.example.com", "192.0.2.1"),
+		soaRecord(t, "example.com", 3),
+	}
+
+	if err := z.ApplyTransfer(records); err == nil {
+		t.Fatal("ApplyTransfer should return an error if the differences do not start at the zone serial")
+	}
+}
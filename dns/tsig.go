@@ -0,0 +1,458 @@
+package dns
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// HMACMD5 is the legacy TSIG algorithm, kept for interoperability
+	HMACMD5 = "hmac-md5.sig-alg.reg.int"
+	// HMACSHA256 is the TSIG algorithm using HMAC-SHA256
+	HMACSHA256 = "hmac-sha256"
+	// HMACSHA384 is the TSIG algorithm using HMAC-SHA384
+	HMACSHA384 = "hmac-sha384"
+	// HMACSHA512 is the TSIG algorithm using HMAC-SHA512
+	HMACSHA512 = "hmac-sha512"
+)
+
+const (
+	// BadSigTSIGError reports a MAC that failed verification
+	BadSigTSIGError TSIGError = 16
+	// BadKeyTSIGError reports an unknown key or algorithm
+	BadKeyTSIGError TSIGError = 17
+	// BadTimeTSIGError reports a signature time outside of the fudge window
+	BadTimeTSIGError TSIGError = 18
+	// BadTruncTSIGError reports a MAC truncated beyond the allowed length
+	BadTruncTSIGError TSIGError = 22
+)
+
+// defaultFudge is the number of seconds of clock skew allowed between the
+// signer and the verifier
+const defaultFudge = 300
+
+// maxUnsignedMessages is the number of consecutive unsigned messages allowed
+// in a signed zone transfer (RFC 8945 section 5.3.1)
+const maxUnsignedMessages = 99
+
+// TSIGError is the error of a transaction signature, carried by the TSIG record
+// of the response
+type TSIGError uint16
+
+func (e TSIGError) Error() string {
+	switch e {
+	case 0:
+		return "no error"
+	case BadSigTSIGError:
+		return "bad signature"
+	case BadKeyTSIGError:
+		return "bad key"
+	case BadTimeTSIGError:
+		return "bad time"
+	case BadTruncTSIGError:
+		return "bad truncation"
+	default:
+		return fmt.Sprintf("unknown TSIG error %d", uint16(e))
+	}
+}
+
+// TSIG is the data of a TSIG resource record (RFC 8945), authenticating the
+// message it ends
+type TSIG struct {
+	Algorithm Name
+	// TimeSigned is the signature time, in seconds since epoch. Only the 48 low
+	// bits are transmitted
+	TimeSigned uint64
+	// Fudge is the number of seconds of error permitted in TimeSigned
+	Fudge      uint16
+	MAC        []byte
+	OriginalID uint16
+	Error      TSIGError
+	OtherData  []byte
+}
+
+// ToBytes returns the byte array form of the TSIG data
+func (t *TSIG) ToBytes() []byte {
+	data := make([]byte, 0, 0)
+
+	data = append(data, t.Algorithm.ToBytes()...)
+	data = appendUint16(data, uint16(t.TimeSigned>>32))
+	data = appendUint32(data, uint32(t.TimeSigned))
+	data = appendUint16(data, t.Fudge)
+	data = appendUint16(data, uint16(len(t.MAC)))
+	data = append(data, t.MAC...)
+	data = appendUint16(data, t.OriginalID)
+	data = appendUint16(data, uint16(t.Error))
+	data = appendUint16(data, uint16(len(t.OtherData)))
+	data = append(data, t.OtherData...)
+
+	return data
+}
+
+// TSIG returns the data of a TSIG resource record
+func (rr ResourceRecord) TSIG() (TSIG, error) {
+	if rr.Type != TSIGType {
+		return TSIG{}, fmt.Errorf("resource record is not a TSIG record. type=%s", rr.Type)
+	}
+
+	return tsigFromBytes(rr.Data)
+}
+
+func tsigFromBytes(data []byte) (TSIG, error) {
+	algorithm := Name{}
+	offset, err := algorithm.fromBytes(data, 0)
+	if err != nil {
+		return TSIG{}, err
+	}
+
+	if offset+10 > len(data) {
+		return TSIG{}, fmt.Errorf("failed to parse TSIG data, invalid length %d", len(data))
+	}
+
+	timeSigned := uint64(catBytes(data[offset], data[offset+1]))<<32 | uint64(readUint32(data, offset+2))
+	fudge := catBytes(data[offset+6], data[offset+7])
+	macSize := int(catBytes(data[offset+8], data[offset+9]))
+	offset += 10
+
+	if offset+macSize+6 > len(data) {
+		return TSIG{}, fmt.Errorf("failed to parse TSIG data, invalid length %d", len(data))
+	}
+
+	mac := data[offset : offset+macSize]
+	offset += macSize
+
+	originalID := catBytes(data[offset], data[offset+1])
+	tsigError := TSIGError(catBytes(data[offset+2], data[offset+3]))
+	otherLength := int(catBytes(data[offset+4], data[offset+5]))
+	offset += 6
+
+	if offset+otherLength != len(data) {
+		return TSIG{}, fmt.Errorf("failed to parse TSIG data, invalid length %d", len(data))
+	}
+
+	return TSIG{
+		Algorithm:  algorithm,
+		TimeSigned: timeSigned,
+		Fudge:      fudge,
+		MAC:        mac,
+		OriginalID: originalID,
+		Error:      tsigError,
+		OtherData:  data[offset:],
+	}, nil
+}
+
+// TSIGKey is a secret shared by two parties to sign their messages
+type TSIGKey struct {
+	Name Name
+	// Algorithm is one of HMACSHA256, HMACSHA384, HMACSHA512 or HMACMD5
+	Algorithm string
+	Secret    []byte
+}
+
+func (k *TSIGKey) hash() (hash.Hash, error) {
+	switch strings.TrimSuffix(strings.ToLower(k.Algorithm), ".") {
+	case HMACMD5:
+		return hmac.New(md5.New, k.Secret), nil
+	case HMACSHA256:
+		return hmac.New(sha256.New, k.Secret), nil
+	case HMACSHA384:
+		return hmac.New(sha512.New384, k.Secret), nil
+	case HMACSHA512:
+		return hmac.New(sha512.New, k.Secret), nil
+	default:
+		return nil, fmt.Errorf("unsupported TSIG algorithm %s", k.Algorithm)
+	}
+}
+
+// Keyring holds the TSIG keys known to a client or a server. It is safe for
+// concurrent use
+type Keyring struct {
+	mu   sync.RWMutex
+	keys map[string]TSIGKey
+}
+
+// NewKeyring builds a keyring holding the keys
+func NewKeyring(keys ...TSIGKey) *Keyring {
+	k := &Keyring{keys: make(map[string]TSIGKey)}
+	for _, key := range keys {
+		k.Add(key)
+	}
+
+	return k
+}
+
+// Add adds a key to the keyring, replacing the key of the same name
+func (k *Keyring) Add(key TSIGKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys[key.Name.GetName()] = key
+}
+
+// Key returns the key named name
+func (k *Keyring) Key(name Name) (TSIGKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[name.GetName()]
+	return key, ok
+}
+
+// SignTSIG signs an encoded message with the key, appending a TSIG record to
+// it. A response is signed along with the MAC of the request. It returns the
+// signed message and its MAC
+func SignTSIG(data []byte, key TSIGKey, requestMAC []byte, now time.Time) ([]byte, []byte, error) {
+	return signTSIG(data, key, requestMAC, nil, false, TSIG{
+		TimeSigned: uint64(now.Unix()),
+		Fudge:      defaultFudge,
+	})
+}
+
+// VerifyTSIG verifies the TSIG record ending an encoded message against the keys
+// of the keyring. A response is verified along with the MAC of the request. The
+// returned error is a TSIGError when the signature is invalid
+func VerifyTSIG(data []byte, keyring *Keyring, requestMAC []byte, now time.Time) (TSIG, error) {
+	t, _, err := verifyTSIG(data, keyring, requestMAC, nil, false, now)
+	return t, err
+}
+
+// signTSIG signs an encoded message. The subsequent messages of a zone transfer
+// are signed over the MAC of the previous message, the unsigned messages sent
+// since then and the timers of the signature only (RFC 8945 section 5.3.1)
+func signTSIG(data []byte, key TSIGKey, prevMAC []byte, unsigned []byte, timersOnly bool, t TSIG) ([]byte, []byte, error) {
+	if len(data) < 12 {
+		return nil, nil, fmt.Errorf("failed to sign message, invalid data length. length=%d", len(data))
+	}
+
+	algorithm, err := NewName(key.Algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t.Algorithm = algorithm
+	t.OriginalID = catBytes(data[0], data[1])
+
+	mac, err := tsigMAC(key, prevMAC, unsigned, data, t, timersOnly)
+	if err != nil {
+		return nil, nil, err
+	}
+	t.MAC = mac
+
+	rr := NewResourceRecord(key.Name, TSIGType, ANYClass, 0, t.ToBytes())
+	signed := make([]byte, 0, len(data)+int(rr.DataLength)+len(key.Name.ToBytes())+10)
+	signed = append(signed, data...)
+	signed = append(signed, rr.ToBytes()...)
+
+	arcount := catBytes(data[10], data[11]) + 1
+	signed[10], signed[11] = byte(arcount>>8), byte(arcount&0xFF)
+
+	return signed, mac, nil
+}
+
+// verifyTSIG verifies the TSIG record ending an encoded message, returning the
+// record and the key that signed it
+func verifyTSIG(data []byte, keyring *Keyring, prevMAC []byte, unsigned []byte, timersOnly bool, now time.Time) (TSIG, TSIGKey, error) {
+	offset, err := lastRecordOffset(data)
+	if err != nil {
+		return TSIG{}, TSIGKey{}, err
+	}
+
+	rr, _, err := resourceRecordFromBytes(data, offset)
+	if err != nil {
+		return TSIG{}, TSIGKey{}, err
+	}
+
+	t, err := rr.TSIG()
+	if err != nil {
+		return TSIG{}, TSIGKey{}, err
+	}
+
+	if keyring == nil {
+		return t, TSIGKey{}, BadKeyTSIGError
+	}
+
+	key, ok := keyring.Key(rr.Name)
+	if !ok || !strings.EqualFold(strings.TrimSuffix(key.Algorithm, "."), t.Algorithm.GetName()) {
+		return t, TSIGKey{}, BadKeyTSIGError
+	}
+
+	if len(t.MAC) == 0 {
+		// errors that prevent signing are reported unsigned
+		if t.Error != 0 {
+			return t, key, t.Error
+		}
+		return t, key, BadSigTSIGError
+	}
+
+	msg := make([]byte, offset)
+	copy(msg, data[:offset])
+	msg[0], msg[1] = byte(t.OriginalID>>8), byte(t.OriginalID&0xFF)
+	arcount := catBytes(msg[10], msg[11]) - 1
+	msg[10], msg[11] = byte(arcount>>8), byte(arcount&0xFF)
+
+	expected, err := tsigMAC(key, prevMAC, unsigned, msg, t, timersOnly)
+	if err != nil {
+		return t, key, BadKeyTSIGError
+	}
+
+	// RFC 8945 section 5.2.2.1: truncated MACs must keep at least 10 bytes and
+	// half of the MAC
+	if len(t.MAC) < len(expected) && (len(t.MAC) < 10 || len(t.MAC) < len(expected)/2) {
+		return t, key, BadTruncTSIGError
+	}
+
+	if len(t.MAC) > len(expected) || !hmac.Equal(t.MAC, expected[:len(t.MAC)]) {
+		return t, key, BadSigTSIGError
+	}
+
+	if t.Error != 0 {
+		return t, key, t.Error
+	}
+
+	signed := int64(t.TimeSigned)
+	if delta := now.Unix() - signed; delta > int64(t.Fudge) || -delta > int64(t.Fudge) {
+		return t, key, BadTimeTSIGError
+	}
+
+	return t, key, nil
+}
+
+func tsigMAC(key TSIGKey, prevMAC []byte, unsigned []byte, msg []byte, t TSIG, timersOnly bool) ([]byte, error) {
+	h, err := key.hash()
+	if err != nil {
+		return nil, err
+	}
+
+	if prevMAC != nil {
+		h.Write(appendUint16(make([]byte, 0, 2), uint16(len(prevMAC))))
+		h.Write(prevMAC)
+	}
+	h.Write(unsigned)
+	h.Write(msg)
+
+	variables := make([]byte, 0, 0)
+	if !timersOnly {
+		variables = append(variables, key.Name.ToBytes()...)
+		variables = appendUint16(variables, uint16(ANYClass))
+		variables = appendUint32(variables, 0)
+		variables = append(variables, t.Algorithm.ToBytes()...)
+	}
+	variables = appendUint16(variables, uint16(t.TimeSigned>>32))
+	variables = appendUint32(variables, uint32(t.TimeSigned))
+	variables = appendUint16(variables, t.Fudge)
+	if !timersOnly {
+		variables = appendUint16(variables, uint16(t.Error))
+		variables = appendUint16(variables, uint16(len(t.OtherData)))
+		variables = append(variables, t.OtherData...)
+	}
+	h.Write(variables)
+
+	return h.Sum(nil), nil
+}
+
+// hasTSIG reports whether an encoded message ends with a TSIG record
+func hasTSIG(data []byte) bool {
+	offset, err := lastRecordOffset(data)
+	if err != nil {
+		return false
+	}
+
+	rr, _, err := resourceRecordFromBytes(data, offset)
+	return err == nil && rr.Type == TSIGType
+}
+
+// lastRecordOffset returns the offset of the last record of an encoded message,
+// where its TSIG or SIG(0) record is expected
+func lastRecordOffset(data []byte) (int, error) {
+	if len(data) < 12 {
+		return 0, fmt.Errorf("failed to find last record, invalid data length. length=%d", len(data))
+	}
+
+	questions := int(catBytes(data[4], data[5]))
+	records := int(catBytes(data[6], data[7])) + int(catBytes(data[8], data[9])) +
+		int(catBytes(data[10], data[11]))
+	if catBytes(data[10], data[11]) == 0 {
+		return 0, fmt.Errorf("failed to find last record, additional section is empty")
+	}
+
+	offset := 12
+	for i := 0; i < questions; i++ {
+		n, err := skipName(data, offset)
+		if err != nil {
+			return 0, err
+		}
+		offset += n + 4
+	}
+
+	for i := 0; i < records-1; i++ {
+		n, err := skipName(data, offset)
+		if err != nil {
+			return 0, err
+		}
+		offset += n + 10
+		if offset > len(data) {
+			return 0, fmt.Errorf("failed to find last record, unexpected end of data")
+		}
+		offset += int(catBytes(data[offset-2], data[offset-1]))
+	}
+
+	if offset >= len(data) {
+		return 0, fmt.Errorf("failed to find last record, unexpected end of data")
+	}
+
+	return offset, nil
+}
+
+// skipName returns the number of bytes taken by the possibly compressed name
+// found at offset
+func skipName(data []byte, offset int) (int, error) {
+	n := 0
+	for {
+		if offset+n >= len(data) {
+			return 0, fmt.Errorf("failed to parse name, unexpected end of data. offset=%d", offset+n)
+		}
+
+		length := data[offset+n]
+		if length == 0 {
+			return n + 1, nil
+		}
+
+		if isPointer(length) {
+			return n + 2, nil
+		}
+
+		n += int(length) + 1
+	}
+}
+
+// stripTSIG removes the TSIG record ending the additional section of a message
+func stripTSIG(m *Message) {
+	last := len(m.Additional) - 1
+	if last >= 0 && m.Additional[last].Type == TSIGType {
+		m.Additional = m.Additional[:last]
+	}
+}
+
+// nameAllowed reports whether name, the name of the key or of the signer of a
+// request, is one of the allowed names
+func nameAllowed(name string, allowed []string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, a := range allowed {
+		n, err := NewName(a)
+		if err == nil && n.GetName() == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,121 @@
+package dns_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func tsigKey(t *testing.T, name string, secret string) dns.TSIGKey {
+	return dns.TSIGKey{Name: mustName(t, name), Algorithm: dns.HMACSHA256, Secret: []byte(secret)}
+}
+
+func TestTSIGTransfer(t *testing.T) {
+	records := []dns.ResourceRecord{soaRecord(t, "example.com", 1)}
+	for i := 0; i < 1000; i++ {
+		records = append(records, aRecord(t, fmt.Sprintf("host%d.example.com", i), "192.0.2.1"))
+	}
+
+	z, err := dns.NewZone(mustName(t, "example.com"), records)
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+
+	key := tsigKey(t, "transfer.example.com", "secret")
+	addr := startServerWith(t, &dns.Server{
+		Handler: &dns.TransferHandler{Zone: z, AllowKeys: []string{"transfer.example.com."}},
+		Keyring: dns.NewKeyring(key),
+	})
+
+	c := dns.Client{TSIGKey: &key}
+	secondary, err := c.AXFR(mustName(t, "example.com"), addr)
+	if err != nil {
+		t.Fatalf("AXFR failed with error %s", err.Error())
+	}
+	assertSameRecords(t, secondary.Records(), records)
+
+	c = dns.Client{}
+	if _, err := c.AXFR(mustName(t, "example.com"), addr); err == nil {
+		t.Fatal("unsigned transfers should be refused")
+	}
+
+	wrongKey := tsigKey(t, "transfer.example.com", "wrong secret")
+	c = dns.Client{TSIGKey: &wrongKey}
+	if _, err := c.AXFR(mustName(t, "example.com"), addr); err == nil {
+		t.Fatal("transfers signed with the wrong secret should fail")
+	}
+}
+
+func TestTSIGUpdate(t *testing.T) {
+	z, _ := primaryZone(t)
+	key := tsigKey(t, "update.example.com", "secret")
+	addr := startServerWith(t, &dns.Server{
+		Handler: &dns.UpdateHandler{Zone: z, AllowKeys: []string{"update.example.com"}},
+		Keyring: dns.NewKeyring(key),
+	})
+
+	u := dns.NewUpdate(mustName(t, "example.com"))
+	u.Insert(aRecord(t, "new.example.com", "192.0.2.2"))
+
+	c := dns.Client{Timeout: time.Second, TSIGKey: &key}
+	resp, err := c.Exchange(&u.Message, addr)
+	if err != nil {
+		t.Fatalf("Exchange failed with error %s", err.Error())
+	}
+
+	if resp.Header.RCode != dns.NoErrorRCode || len(z.Lookup(mustName(t, "new.example.com"), dns.AType)) != 1 {
+		t.Fatalf("signed update was not applied. rcode=%s", resp.Header.RCode)
+	}
+
+	if rcode := sendUpdate(t, addr, u); rcode != dns.RefusedRCode {
+		t.Fatalf("unexpected rcode. actual=%s expected=%s", rcode, dns.RefusedRCode)
+	}
+}
+
+func TestVerifyTSIG(t *testing.T) {
+	key := tsigKey(t, "key.example.com", "secret")
+	keyring := dns.NewKeyring(key)
+	m := dns.Message{
+		Header:   dns.Header{ID: 42, QuestionCount: 1},
+		Question: dns.Question{Name: mustName(t, "example.com"), Type: dns.QType(dns.SOAType), Class: dns.INClass},
+	}
+
+	now := time.Now()
+	signed, mac, err := dns.SignTSIG(m.ToBytes(), key, nil, now)
+	if err != nil {
+		t.Fatalf("SignTSIG failed with error %s", err.Error())
+	}
+
+	tsig, err := dns.VerifyTSIG(signed, keyring, nil, now)
+	if err != nil {
+		t.Fatalf("VerifyTSIG failed with error %s", err.Error())
+	}
+
+	if string(tsig.MAC) != string(mac) || tsig.OriginalID != 42 {
+		t.Fatalf("unexpected TSIG record. id=%d", tsig.OriginalID)
+	}
+
+	var cases = []struct {
+		data    []byte
+		keyring *dns.Keyring
+		now     time.Time
+		err     error
+	}{
+		{signed, keyring, now.Add(10 * time.Minute), dns.BadTimeTSIGError},
+		{signed, dns.NewKeyring(), now, dns.BadKeyTSIGError},
+		{signed, dns.NewKeyring(tsigKey(t, "key.example.com", "other")), now, dns.BadSigTSIGError},
+	}
+
+	for _, c := range cases {
+		if _, err := dns.VerifyTSIG(c.data, c.keyring, nil, c.now); err != c.err {
+			t.Fatalf("unexpected error. actual=%v expected=%v", err, c.err)
+		}
+	}
+
+	signed[len(signed)-10] ^= 0xFF
+	if _, err := dns.VerifyTSIG(signed, keyring, nil, now); err != dns.BadSigTSIGError {
+		t.Fatalf("tampered message should fail verification. err=%v", err)
+	}
+}
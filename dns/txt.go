@@ -0,0 +1,100 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxCharacterStringLength is the maximum length of a character string
+const MaxCharacterStringLength = 255
+
+// TXT is the data of a TXT resource record, a list of character strings whose
+// concatenation is the value of the record
+type TXT struct {
+	Strings []string
+}
+
+// NewTXT returns the TXT data holding the value, split in character strings of
+// at most MaxCharacterStringLength bytes
+func NewTXT(value string) TXT {
+	return TXT{Strings: splitCharacterStrings(value)}
+}
+
+// Value returns the concatenation of the character strings
+func (t *TXT) Value() string {
+	return strings.Join(t.Strings, "")
+}
+
+// ToBytes returns the byte array form of the TXT data. The character strings
+// longer than MaxCharacterStringLength bytes are split, and data without any
+// string holds a single empty one, so that the encoding is always valid
+func (t *TXT) ToBytes() []byte {
+	data := make([]byte, 0, len(t.Strings)+len(t.Value()))
+	for _, s := range t.Strings {
+		for _, part := range splitCharacterStrings(s) {
+			data = appendCharacterString(data, part)
+		}
+	}
+
+	if len(data) == 0 {
+		data = append(data, 0)
+	}
+
+	return data
+}
+
+func (t *TXT) String() string {
+	strs := make([]string, 0, len(t.Strings))
+	for _, s := range t.Strings {
+		strs = append(strs, quoteString(s))
+	}
+
+	return strings.Join(strs, " ")
+}
+
+// TXT returns the data of a TXT resource record
+func (rr ResourceRecord) TXT() (TXT, error) {
+	if rr.Type != TXTType {
+		return TXT{}, fmt.Errorf("resource record is not a TXT record. type=%s", rr.Type)
+	}
+
+	strs, err := txtStrings(rr.Data)
+	if err != nil {
+		return TXT{}, err
+	}
+
+	return TXT{Strings: strs}, nil
+}
+
+// ParseTXT parses the presentation form of TXT data, ie:
+// `"v=spf1 ip4:192.0.2.0/24" " -all"`
+func ParseTXT(s string) (TXT, error) {
+	fields, err := presentationFields(s)
+	if err != nil {
+		return TXT{}, err
+	}
+
+	if len(fields) == 0 {
+		return TXT{}, fmt.Errorf("failed to parse TXT data, invalid field count %d", len(fields))
+	}
+
+	for _, field := range fields {
+		if len(field) > MaxCharacterStringLength {
+			return TXT{}, fmt.Errorf("failed to parse TXT data, invalid character string length %d", len(field))
+		}
+	}
+
+	return TXT{Strings: fields}, nil
+}
+
+// splitCharacterStrings splits the value in character strings of at most
+// MaxCharacterStringLength bytes
+func splitCharacterStrings(value string) []string {
+	strs := make([]string, 0, len(value)/MaxCharacterStringLength+1)
+	for len(value) > MaxCharacterStringLength {
+		strs = append(strs, value[:MaxCharacterStringLength])
+		value = value[MaxCharacterStringLength:]
+	}
+
+	return append(strs, value)
+}
@@ -0,0 +1,94 @@
+package dns_test
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func txtRecord(t *testing.T, name string, value string) dns.ResourceRecord {
+	txt := dns.NewTXT(value)
+	return dns.NewResourceRecord(mustName(t, name), dns.TXTType, dns.INClass, 300, txt.ToBytes())
+}
+
+func TestTXT(t *testing.T) {
+	long := strings.Repeat("a", 300)
+
+	var cases = []struct {
+		txt      dns.TXT
+		wire     string
+		expected []string
+	}{
+		{dns.NewTXT("hello"), "0568656c6c6f", []string{"hello"}},
+		{dns.NewTXT(""), "00", []string{""}},
+		{dns.TXT{}, "00", []string{""}},
+		{dns.TXT{Strings: []string{"a", "", "b"}}, "0161" + "00" + "0162", []string{"a", "", "b"}},
+		// long values are split in strings of 255 bytes
+		{dns.NewTXT(long), "ff" + strings.Repeat("61", 255) + "2d" + strings.Repeat("61", 45),
+			[]string{long[:255], long[255:]}},
+		{dns.TXT{Strings: []string{long}}, "ff" + strings.Repeat("61", 255) + "2d" + strings.Repeat("61", 45),
+			[]string{long[:255], long[255:]}},
+	}
+
+	for i, c := range cases {
+		if hex.EncodeToString(c.txt.ToBytes()) != c.wire {
+			t.Fatalf("unexpected wire form. case=%d actual=%x expected=%s", i, c.txt.ToBytes(), c.wire)
+		}
+
+		rr := dns.NewResourceRecord(mustName(t, "example.com"), dns.TXTType, dns.INClass, 300, c.txt.ToBytes())
+		parsed, err := rr.TXT()
+		if err != nil {
+			t.Fatalf("TXT failed. case=%d err=%s", i, err.Error())
+		}
+
+		if len(parsed.Strings) != len(c.expected) {
+			t.Fatalf("unexpected strings. case=%d actual=%v", i, parsed.Strings)
+		}
+		for j := range c.expected {
+			if parsed.Strings[j] != c.expected[j] {
+				t.Fatalf("unexpected string. case=%d index=%d actual=%s", i, j, parsed.Strings[j])
+			}
+		}
+
+		if parsed.Value() != c.txt.Value() {
+			t.Fatalf("unexpected value. case=%d actual=%s expected=%s", i, parsed.Value(), c.txt.Value())
+		}
+	}
+
+	rr := dns.NewResourceRecord(mustName(t, "example.com"), dns.TXTType, dns.INClass, 300, []byte{5, 'a'})
+	if _, err := rr.TXT(); err == nil {
+		t.Fatalf("expected an error for a truncated string")
+	}
+}
+
+func TestParseTXT(t *testing.T) {
+	var cases = []struct {
+		presentation string
+		expected     string
+		valid        bool
+	}{
+		{`"v=spf1 ip4:192.0.2.0/24" " -all"`, `"v=spf1 ip4:192.0.2.0/24" " -all"`, true},
+		{`hello world`, `"hello" "world"`, true},
+		{`"say \"hi\"\010" ""`, `"say \"hi\"\010" ""`, true},
+		{`"` + strings.Repeat("a", 255) + `"`, `"` + strings.Repeat("a", 255) + `"`, true},
+		{`"` + strings.Repeat("a", 256) + `"`, "", false},
+		{`"unterminated`, "", false},
+		{``, "", false},
+	}
+
+	for i, c := range cases {
+		txt, err := dns.ParseTXT(c.presentation)
+		if (err == nil) != c.valid {
+			t.Fatalf("unexpected ParseTXT result. case=%d err=%v", i, err)
+		}
+		if !c.valid {
+			continue
+		}
+
+		if txt.String() != c.expected {
+			t.Fatalf("unexpected TXT. case=%d actual=%s expected=%s", i, txt.String(), c.expected)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package dns
+
+import (
+	"log"
+	"net"
+	"sync"
+)
+
+// Update is a dynamic update message (RFC 2136). Its question holds the zone to
+// update, its answer section the prerequisites and its authority section the
+// changes to apply
+type Update struct {
+	Message
+}
+
+// NewUpdate builds an empty dynamic update message for the zone
+func NewUpdate(zone Name) *Update {
+	return &Update{Message{
+		Header:   Header{Opcode: UpdateOpcode, QuestionCount: 1},
+		Question: Question{Name: zone, Type: QType(SOAType), Class: INClass},
+	}}
+}
+
+// RequireNameInUse requires at least one record to be owned by name
+func (u *Update) RequireNameInUse(name Name) {
+	u.Answers = append(u.Answers, NewResourceRecord(name, ANYType, ANYClass, 0, nil))
+}
+
+// RequireNameNotInUse requires no record to be owned by name
+func (u *Update) RequireNameNotInUse(name Name) {
+	u.Answers = append(u.Answers, NewResourceRecord(name, ANYType, NONEClass, 0, nil))
+}
+
+// RequireRRsetExists requires records of type t to be owned by name
+func (u *Update) RequireRRsetExists(name Name, t Type) {
+	u.Answers = append(u.Answers, NewResourceRecord(name, t, ANYClass, 0, nil))
+}
+
+// RequireRRsetNotExists requires no record of type t to be owned by name
+func (u *Update) RequireRRsetNotExists(name Name, t Type) {
+	u.Answers = append(u.Answers, NewResourceRecord(name, t, NONEClass, 0, nil))
+}
+
+// RequireRRsetEquals requires the RRsets the records belong to to hold exactly
+// these records
+func (u *Update) RequireRRsetEquals(rrs ...ResourceRecord) {
+	for _, rr := range rrs {
+		rr.TTL = 0
+		u.Answers = append(u.Answers, rr)
+	}
+}
+
+// Insert adds the records to the zone
+func (u *Update) Insert(rrs ...ResourceRecord) {
+	u.Authority = append(u.Authority, rrs...)
+}
+
+// RemoveRRset deletes the records of type t owned by name
+func (u *Update) RemoveRRset(name Name, t Type) {
+	u.Authority = append(u.Authority, NewResourceRecord(name, t, ANYClass, 0, nil))
+}
+
+// RemoveName deletes every record owned by name
+func (u *Update) RemoveName(name Name) {
+	u.Authority = append(u.Authority, NewResourceRecord(name, ANYType, ANYClass, 0, nil))
+}
+
+// Remove deletes the records from the zone
+func (u *Update) Remove(rrs ...ResourceRecord) {
+	for _, rr := range rrs {
+		u.Authority = append(u.Authority, NewResourceRecord(rr.Name, rr.Type, NONEClass, 0, rr.Data))
+	}
+}
+
+// UpdateHandler processes the dynamic updates (RFC 2136) of a zone. The
+// prerequisites are checked and the changes applied atomically, the serial of
+// the zone being incremented unless the update sets the SOA record itself.
+// Other requests are passed to the next handler
+type UpdateHandler struct {
+	Zone *Zone
+	// Journal records the applied changes, for incremental transfers. It may
+	// be nil
+	Journal *Journal
+	// AllowFrom lists the addresses updates are accepted from
+	AllowFrom []net.IP
+	// AllowKeys lists the TSIG keys updates are accepted from, whatever their
+	// source
+	AllowKeys []string
+	// AllowSigners lists the SIG(0) signers updates are accepted from, whatever
+	// their source. Other updates are refused
+	AllowSigners []string
+	// Notifier notifies the secondaries once the zone changed. It may be nil
+	Notifier *Notifier
+	// Next handles the requests that are not updates. If nil, they are answered
+	// with a NotImplemented rcode
+	Next Handler
+	// ErrorLog logs the changes the journal failed to record. Defaults to the
+	// standard logger of the log package
+	ErrorLog *log.Logger
+
+	mu sync.Mutex
+}
+
+// ServeDNS implements the Handler interface
+func (h *UpdateHandler) ServeDNS(w ResponseWriter, r *Message) {
+	if r.Header.Opcode != UpdateOpcode {
+		if h.Next != nil {
+			h.Next.ServeDNS(w, r)
+			return
+		}
+
+		resp := NewResponse(r)
+		resp.Header.RCode = NotImplementedRCode
+		w.WriteMessage(resp)
+		return
+	}
+
+	resp := NewResponse(r)
+	if !sourceAllowed(w.RemoteAddr(), h.AllowFrom, nil) && !nameAllowed(w.TSIGKeyName(), h.AllowKeys) &&
+		!nameAllowed(w.SIG0SignerName(), h.AllowSigners) {
+		resp.Header.RCode = RefusedRCode
+		w.WriteMessage(resp)
+		return
+	}
+
+	resp.Header.RCode = h.update(r)
+	w.WriteMessage(resp)
+}
+
+func (h *UpdateHandler) update(r *Message) RCode {
+	if r.Header.QuestionCount != 1 || r.Question.Type != QType(SOAType) {
+		return FormatErrorRCode
+	}
+
+	origin := h.Zone.Origin()
+	if !r.Question.Name.Equal(origin) {
+		return NotAuthRCode
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	records := h.Zone.Records()
+	if rcode := checkPrerequisites(origin, records, r.Answers); rcode != NoErrorRCode {
+		return rcode
+	}
+
+	if rcode := prescanUpdates(origin, r.Authority); rcode != NoErrorRCode {
+		return rcode
+	}
+
+	updated := applyUpdates(origin, records, r.Authority)
+	d, changed := updateDiff(records, updated)
+	if !changed {
+		return NoErrorRCode
+	}
+
+	if err := h.Zone.Apply(d); err != nil {
+		return ServerFailureRCode
+	}
+
+	// a journal missing a change would serve wrong incremental transfers: it
+	// is reset so that the secondaries fall back to full transfers
+	if h.Journal != nil {
+		if err := h.Journal.Append(d); err != nil {
+			logf(h.ErrorLog, "failed to journal update of zone %s. %s", nameToString(origin), err.Error())
+			h.Journal.Reset()
+		}
+	}
+
+	if h.Notifier != nil {
+		go h.Notifier.Notify(h.Zone)
+	}
+
+	return NoErrorRCode
+}
+
+// checkPrerequisites checks the prerequisite section of an update against the
+// records of the zone (RFC 2136 section 3.2)
+func checkPrerequisites(origin Name, records []ResourceRecord, prerequisites []ResourceRecord) RCode {
+	valueDependent := make([]ResourceRecord, 0)
+
+	for _, rr := range prerequisites {
+		if rr.TTL != 0 {
+			return FormatErrorRCode
+		}
+
+		if !rr.Name.IsSubdomainOf(origin) {
+			return NotZoneRCode
+		}
+
+		switch rr.Class {
+		case ANYClass:
+			if len(rr.Data) != 0 {
+				return FormatErrorRCode
+			}
+			if rr.Type == ANYType {
+				if len(ownedBy(records, rr.Name)) == 0 {
+					return NameErrorRCode
+				}
+			} else if len(rrset(records, rr.Name, rr.Type)) == 0 {
+				return NXRRSetRCode
+			}
+		case NONEClass:
+			if len(rr.Data) != 0 {
+				return FormatErrorRCode
+			}
+			if rr.Type == ANYType {
+				if len(ownedBy(records, rr.Name)) > 0 {
+					return YXDomainRCode
+				}
+			} else if len(rrset(records, rr.Name, rr.Type)) > 0 {
+				return YXRRSetRCode
+			}
+		case INClass:
+			valueDependent = append(valueDependent, rr)
+		default:
+			return FormatErrorRCode
+		}
+	}
+
+	for _, rr := range valueDependent {
+		expected := rrset(valueDependent, rr.Name, rr.Type)
+		actual := rrset(records, rr.Name, rr.Type)
+		if len(expected) != len(actual) {
+			return NXRRSetRCode
+		}
+
+		for _, e := range expected {
+			if indexOfRecord(actual, e) < 0 {
+				return NXRRSetRCode
+			}
+		}
+	}
+
+	return NoErrorRCode
+}
+
+// prescanUpdates checks the update section of an update is well formed (RFC
+// 2136 section 3.4.1)
+func prescanUpdates(origin Name, updates []ResourceRecord) RCode {
+	for _, rr := range updates {
+		if !rr.Name.IsSubdomainOf(origin) {
+			return NotZoneRCode
+		}
+
+		switch rr.Class {
+		case INClass:
+			if rr.Type == ANYType {
+				return FormatErrorRCode
+			}
+		case ANYClass:
+			if rr.TTL != 0 || len(rr.Data) != 0 {
+				return FormatErrorRCode
+			}
+		case NONEClass:
+			if rr.TTL != 0 || rr.Type == ANYType {
+				return FormatErrorRCode
+			}
+		default:
+			return FormatErrorRCode
+		}
+	}
+
+	return NoErrorRCode
+}
+
+// applyUpdates returns the records of the zone once the update section is
+// applied (RFC 2136 section 3.4.2). The SOA record stays first
+func applyUpdates(origin Name, records []ResourceRecord, updates []ResourceRecord) []ResourceRecord {
+	updated := make([]ResourceRecord, len(records))
+	copy(updated, records)
+
+	for _, rr := range updates {
+		apex := rr.Name.Equal(origin)
+
+		switch rr.Class {
+		case INClass:
+			updated = insertRecord(origin, updated, rr)
+		case ANYClass:
+			updated = removeRecords(updated, func(r ResourceRecord) bool {
+				if !r.Name.Equal(rr.Name) || (rr.Type != ANYType && r.Type != rr.Type) {
+					return false
+				}
+				return !apex || (r.Type != SOAType && r.Type != NSType)
+			})
+		case NONEClass:
+			if rr.Type == SOAType {
+				continue
+			}
+			if apex && rr.Type == NSType && len(rrset(updated, rr.Name, NSType)) == 1 {
+				continue
+			}
+			target := NewResourceRecord(rr.Name, rr.Type, INClass, 0, rr.Data)
+			updated = removeRecords(updated, func(r ResourceRecord) bool {
+				return sameRecord(r, target)
+			})
+		}
+	}
+
+	return updated
+}
+
+func insertRecord(origin Name, records []ResourceRecord, rr ResourceRecord) []ResourceRecord {
+	if rr.Type == SOAType {
+		if rr.Name.Equal(origin) && SerialLess(soaSerial(records[0]), soaSerial(rr)) {
+			records[0] = rr
+		}
+		return records
+	}
+
+	for i, r := range records {
+		if !r.Name.Equal(rr.Name) {
+			continue
+		}
+
+		if (r.Type == CNAMEType) != (rr.Type == CNAMEType) {
+			// CNAME records cannot coexist with other data
+			return records
+		}
+
+		if rr.Type == CNAMEType || sameRecord(r, rr) {
+			records[i] = rr
+			return records
+		}
+	}
+
+	return append(records, rr)
+}
+
+func removeRecords(records []ResourceRecord, match func(ResourceRecord) bool) []ResourceRecord {
+	kept := make([]ResourceRecord, 0, len(records))
+	for _, rr := range records {
+		if !match(rr) {
+			kept = append(kept, rr)
+		}
+	}
+
+	return kept
+}
+
+func rrset(records []ResourceRecord, name Name, t Type) []ResourceRecord {
+	set := make([]ResourceRecord, 0)
+	for _, rr := range records {
+		if rr.Type == t && rr.Name.Equal(name) {
+			set = append(set, rr)
+		}
+	}
+
+	return set
+}
+
+// updateDiff returns the difference between the records of the zone before and
+// after an update, bumping the serial of the zone if the update did not set it.
+// It reports whether the update changed the zone
+func updateDiff(before, after []ResourceRecord) (Diff, bool) {
+	d := Diff{
+		From:    before[0],
+		To:      after[0],
+		Deleted: make([]ResourceRecord, 0),
+		Added:   make([]ResourceRecord, 0),
+	}
+
+	for _, rr := range before[1:] {
+		if !containsExactRecord(after[1:], rr) {
+			d.Deleted = append(d.Deleted, rr)
+		}
+	}
+
+	for _, rr := range after[1:] {
+		if !containsExactRecord(before[1:], rr) {
+			d.Added = append(d.Added, rr)
+		}
+	}
+
+	soaChanged := soaSerial(d.From) != soaSerial(d.To)
+	if len(d.Deleted) == 0 && len(d.Added) == 0 && !soaChanged {
+		return d, false
+	}
+
+	if !soaChanged {
+		soa, err := d.From.SOA()
+		if err != nil {
+			return d, false
+		}
+		soa.Serial, _ = SerialAdd(soa.Serial, 1)
+		d.To = NewResourceRecord(d.From.Name, SOAType, d.From.Class, d.From.TTL, soa.ToBytes())
+	}
+
+	return d, true
+}
+
+// containsExactRecord reports whether the records contain rr, TTL included
+func containsExactRecord(records []ResourceRecord, rr ResourceRecord) bool {
+	for _, r := range records {
+		if sameRecord(r, rr) && r.TTL == rr.TTL {
+			return true
+		}
+	}
+
+	return false
+}
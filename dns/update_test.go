@@ -0,0 +1,157 @@
+package dns_test
+
+import (
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func sendUpdate(t *testing.T, addr string, u *dns.Update) dns.RCode {
+	t.Helper()
+	c := dns.Client{Timeout: time.Second}
+	resp, err := c.Exchange(&u.Message, addr)
+	if err != nil {
+		t.Fatalf("Exchange failed with error %s", err.Error())
+	}
+
+	return resp.Header.RCode
+}
+
+func TestUpdateHandler(t *testing.T) {
+	z, err := dns.NewZone(mustName(t, "example.com"), []dns.ResourceRecord{
+		soaRecord(t, "example.com", 1),
+		nameRecord(t, "example.com", dns.NSType, "ns1.example.com"),
+		aRecord(t, "www.example.com", "192.0.2.1"),
+	})
+	if err != nil {
+		t.Fatalf("NewZone failed with error %s", err.Error())
+	}
+
+	j := dns.NewJournal(0)
+	addr := startServer(t, &dns.UpdateHandler{
+		Zone:      z,
+		Journal:   j,
+		AllowFrom: []net.IP{net.ParseIP("127.0.0.1")},
+		Next:      &dns.ZoneHandler{Zone: z, Journal: j},
+	})
+
+	u := dns.NewUpdate(mustName(t, "example.com"))
+	u.RequireNameNotInUse(mustName(t, "ftp.example.com"))
+	u.Insert(aRecord(t, "ftp.example.com", "192.0.2.2"))
+	if rcode := sendUpdate(t, addr, u); rcode != dns.NoErrorRCode {
+		t.Fatalf("update failed. rcode=%s", rcode)
+	}
+
+	if z.Serial() != 2 {
+		t.Fatalf("serial was not incremented. serial=%d", z.Serial())
+	}
+
+	if len(z.Lookup(mustName(t, "ftp.example.com"), dns.AType)) != 1 {
+		t.Fatal("record was not inserted")
+	}
+
+	if diffs, ok := j.Since(1); !ok || len(diffs) != 1 || len(diffs[0].Added) != 1 {
+		t.Fatal("update was not journaled")
+	}
+
+	// prerequisites are not met anymore
+	if rcode := sendUpdate(t, addr, u); rcode != dns.YXDomainRCode {
+		t.Fatalf("unexpected rcode. actual=%s expected=%s", rcode, dns.YXDomainRCode)
+	}
+
+	u = dns.NewUpdate(mustName(t, "example.com"))
+	u.RequireRRsetExists(mustName(t, "mail.example.com"), dns.MXType)
+	u.RemoveName(mustName(t, "www.example.com"))
+	if rcode := sendUpdate(t, addr, u); rcode != dns.NXRRSetRCode {
+		t.Fatalf("unexpected rcode. actual=%s expected=%s", rcode, dns.NXRRSetRCode)
+	}
+
+	u = dns.NewUpdate(mustName(t, "example.com"))
+	u.RequireRRsetEquals(aRecord(t, "www.example.com", "192.0.2.1"))
+	u.RemoveRRset(mustName(t, "www.example.com"), dns.AType)
+	u.Remove(nameRecord(t, "example.com", dns.NSType, "ns1.example.com"))
+	if rcode := sendUpdate(t, addr, u); rcode != dns.NoErrorRCode {
+		t.Fatalf("update failed. rcode=%s", rcode)
+	}
+
+	if len(z.Lookup(mustName(t, "www.example.com"), dns.AType)) != 0 {
+		t.Fatal("RRset was not removed")
+	}
+
+	if len(z.Lookup(mustName(t, "example.com"), dns.NSType)) != 1 {
+		t.Fatal("the last NS record of the apex should not be removed")
+	}
+
+	u = dns.NewUpdate(mustName(t, "example.com"))
+	u.Insert(aRecord(t, "www.example.org", "192.0.2.3"))
+	if rcode := sendUpdate(t, addr, u); rcode != dns.NotZoneRCode {
+		t.Fatalf("unexpected rcode. actual=%s expected=%s", rcode, dns.NotZoneRCode)
+	}
+
+	u = dns.NewUpdate(mustName(t, "example.org"))
+	u.Insert(aRecord(t, "www.example.org", "192.0.2.3"))
+	if rcode := sendUpdate(t, addr, u); rcode != dns.NotAuthRCode {
+		t.Fatalf("unexpected rcode. actual=%s expected=%s", rcode, dns.NotAuthRCode)
+	}
+
+	resp := query(t, addr, "ftp.example.com", dns.QType(dns.AType))
+	if len(resp.Answers) != 1 {
+		t.Fatal("queries should be passed to the next handler")
+	}
+}
+
+func TestUpdateHandler_journalFailure(t *testing.T) {
+	z := mustZone(t, "example.com", aRecord(t, "www.example.com", "192.0.2.1"))
+
+	// the journal holds changes the zone does not follow
+	j := dns.NewJournal(0)
+	if err := j.Append(dns.Diff{From: soaRecord(t, "example.com", 5), To: soaRecord(t, "example.com", 6)}); err != nil {
+		t.Fatalf("Append failed with error %s", err.Error())
+	}
+
+	var logs lockedBuffer
+	addr := startServer(t, &dns.UpdateHandler{
+		Zone:      z,
+		Journal:   j,
+		AllowFrom: []net.IP{net.ParseIP("127.0.0.1")},
+		ErrorLog:  log.New(&logs, "", 0),
+	})
+
+	for i, ip := range []string{"192.0.2.2", "192.0.2.3"} {
+		u := dns.NewUpdate(mustName(t, "example.com"))
+		u.Insert(aRecord(t, "ftp.example.com", ip))
+		if rcode := sendUpdate(t, addr, u); rcode != dns.NoErrorRCode {
+			t.Fatalf("update failed. update=%d rcode=%s", i, rcode)
+		}
+	}
+
+	if !strings.Contains(logs.String(), "failed to journal update of zone example.com.") {
+		t.Fatalf("journal failure was not logged. logs=%q", logs.String())
+	}
+
+	// the journal was reset: transfers from the older serials are full ones
+	if _, ok := j.Since(5); ok {
+		t.Fatal("journal was not reset")
+	}
+	if _, ok := j.Since(1); ok {
+		t.Fatal("journal should not hold the change it failed to record")
+	}
+	if diffs, ok := j.Since(2); !ok || len(diffs) != 1 {
+		t.Fatal("update following the reset was not journaled")
+	}
+}
+
+func TestUpdateHandler_refused(t *testing.T) {
+	z, _ := primaryZone(t)
+	addr := startServer(t, &dns.UpdateHandler{Zone: z})
+
+	u := dns.NewUpdate(mustName(t, "example.com"))
+	u.Insert(aRecord(t, "ftp.example.com", "192.0.2.2"))
+	if rcode := sendUpdate(t, addr, u); rcode != dns.RefusedRCode {
+		t.Fatalf("unexpected rcode. actual=%s expected=%s", rcode, dns.RefusedRCode)
+	}
+}
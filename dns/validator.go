@@ -0,0 +1,617 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// IndeterminateStatus is the status of data no trust anchor covers
+	IndeterminateStatus SecurityStatus = iota
+	// InsecureStatus is the status of data proven to belong to an unsigned zone
+	InsecureStatus
+	// SecureStatus is the status of data whose signatures chain up to a trust
+	// anchor
+	SecureStatus
+	// BogusStatus is the status of data that should be signed but whose
+	// signatures are missing, expired or invalid
+	BogusStatus
+)
+
+// SecurityStatus is the outcome of the validation of DNSSEC signed data (RFC
+// 4035 section 4.3)
+type SecurityStatus int
+
+func (s SecurityStatus) String() string {
+	switch s {
+	case IndeterminateStatus:
+		return "Indeterminate"
+	case InsecureStatus:
+		return "Insecure"
+	case SecureStatus:
+		return "Secure"
+	case BogusStatus:
+		return "Bogus"
+	default:
+		return "Unknown"
+	}
+}
+
+// Querier answers the queries a validator sends to fetch the DNSKEY and DS
+// records of the zones it validates data from
+type Querier interface {
+	Query(name Name, t QType) (Message, error)
+}
+
+// QuerierFunc is an adapter allowing the use of an ordinary function as a
+// Querier
+type QuerierFunc func(name Name, t QType) (Message, error)
+
+// Query calls f(name, t)
+func (f QuerierFunc) Query(name Name, t QType) (Message, error) {
+	return f(name, t)
+}
+
+// RootTrustAnchors returns the DS records of the key signing keys of the root
+// zone, KSK-2017 and KSK-2024
+func RootTrustAnchors() []ResourceRecord {
+	root, _ := NewName(".")
+	anchors := []DS{
+		{KeyTag: 20326, Algorithm: RSASHA256Algorithm, DigestType: SHA256DigestType,
+			Digest: mustDecodeHex("E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D")},
+		{KeyTag: 38696, Algorithm: RSASHA256Algorithm, DigestType: SHA256DigestType,
+			Digest: mustDecodeHex("683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16")},
+	}
+
+	records := make([]ResourceRecord, 0, len(anchors))
+	for _, ds := range anchors {
+		records = append(records, NewResourceRecord(root, DSType, INClass, 0, ds.ToBytes()))
+	}
+
+	return records
+}
+
+// Validator validates the DNSSEC signatures of responses (RFC 4035 section 5),
+// walking the chain of DS and DNSKEY records from a trust anchor down to the
+// zone that signed the data
+type Validator struct {
+	// TrustAnchors are the DS or DNSKEY records of the keys trusted without
+	// validation, usually RootTrustAnchors
+	TrustAnchors []ResourceRecord
+	// Querier fetches the DNSKEY, DS and SOA records needed by the validation
+	Querier Querier
+	// Now returns the time the validity of the signatures is checked against.
+	// Defaults to time.Now
+	Now func() time.Time
+}
+
+func (v *Validator) now() time.Time {
+	if v.Now == nil {
+		return time.Now()
+	}
+
+	return v.Now()
+}
+
+// Validate validates the RRsets of the answer and authority sections of a
+// response. The returned error explains the Bogus and Indeterminate statuses
+func (v *Validator) Validate(m *Message) (SecurityStatus, error) {
+	va := &validation{v: v, now: v.now(), zones: make(map[string]zoneKeys)}
+	return va.message(m)
+}
+
+// zoneKeys is the outcome of the validation of the DNSKEY RRset of a zone,
+// holding its keys when secure
+type zoneKeys struct {
+	status SecurityStatus
+	keys   []DNSKEY
+	err    error
+}
+
+// validation holds the state of a call to Validate, caching the keys of the
+// zones validated so far
+type validation struct {
+	v     *Validator
+	now   time.Time
+	zones map[string]zoneKeys
+}
+
+func (va *validation) message(m *Message) (SecurityStatus, error) {
+	records := make([]ResourceRecord, 0, len(m.Answers)+len(m.Authority))
+	records = append(records, m.Answers...)
+	for _, rr := range m.Authority {
+		// the NS records of a delegation are not signed by the parent zone
+		if rr.Type != NSType {
+			records = append(records, rr)
+		}
+	}
+
+	if m.Header.QuestionCount == 0 {
+		return va.records(records)
+	}
+
+	// the status of the response is the one of the zone holding the name the
+	// CNAME chain ends with, the DS records and the delegations of a zone being
+	// held by its parent. The RRsets outside of that zone and of the chain prove
+	// nothing about the question and are ignored, so that an insecure RRset
+	// added to the response does not lower the status of a secure one
+	chain := cnameChain(m.Question.Name, m.Answers)
+	qname := chain[len(chain)-1]
+	holder, delegated := delegationCut(m, qname)
+	if !delegated {
+		holder = qname
+	}
+	if parent, ok := parentName(holder); ok && (delegated || m.Question.Type == QType(DSType)) {
+		holder = parent
+	}
+
+	zone, zoneStatus, reason := va.zoneStatus(holder)
+	result := zoneStatus
+	validated := 0
+	for _, set := range groupRRsets(records) {
+		if set[0].Type == RRSIGType {
+			continue
+		}
+
+		owner := set[0].Name
+		inZone := zoneStatus != IndeterminateStatus && owner.IsSubdomainOf(zone)
+		if !inZone && !(isAnswer(m, set[0]) && containsName(chain, owner)) {
+			continue
+		}
+
+		status, err := va.rrset(set, records)
+		if status == BogusStatus {
+			return status, err
+		}
+		if inZone && zoneStatus == SecureStatus && status != SecureStatus {
+			return BogusStatus, fmt.Errorf("RRset %s %s of secure zone %s is %s. %v", owner.GetName(), set[0].Type,
+				zone.GetName(), status, err)
+		}
+		validated++
+
+		if status == IndeterminateStatus || (status == InsecureStatus && result == SecureStatus) {
+			result, reason = status, err
+		}
+	}
+
+	if zoneStatus == SecureStatus {
+		if validated == 0 {
+			return BogusStatus, fmt.Errorf("response for %s holds no signed data", m.Question.Name.GetName())
+		}
+		// the denial of existence is only proven by the records of the zone
+		denial := *m
+		denial.Authority = make([]ResourceRecord, 0, len(m.Authority))
+		for _, rr := range m.Authority {
+			if rr.Name.IsSubdomainOf(zone) {
+				denial.Authority = append(denial.Authority, rr)
+			}
+		}
+
+		if err := proveDenial(&denial); errors.Is(err, ErrNSEC3Iterations) {
+			return InsecureStatus, err
+		} else if err != nil {
+			return BogusStatus, err
+		}
+	}
+
+	return result, reason
+}
+
+// records validates the RRsets of a response without question, whose status
+// is the lowest of their statuses
+func (va *validation) records(records []ResourceRecord) (SecurityStatus, error) {
+	result := SecureStatus
+	var reason error
+	for _, set := range groupRRsets(records) {
+		if set[0].Type == RRSIGType {
+			continue
+		}
+
+		status, err := va.rrset(set, records)
+		if status == BogusStatus {
+			return status, err
+		}
+
+		if status == IndeterminateStatus || (status == InsecureStatus && result == SecureStatus) {
+			result, reason = status, err
+		}
+	}
+
+	return result, reason
+}
+
+// isAnswer reports whether the record is in the answer section of the message
+func isAnswer(m *Message, rr ResourceRecord) bool {
+	return indexOfRecord(m.Answers, rr) >= 0
+}
+
+func containsName(names []Name, name Name) bool {
+	for _, n := range names {
+		if n.Equal(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// proveDenial checks a secure response proves the absence of the data it does
+// not hold: the name of a NXDOMAIN response, the type of a NODATA response, the
+// DS records of an insecure referral and the names answered by wildcards
+func proveDenial(m *Message) error {
+	if m.Header.QuestionCount == 0 {
+		return nil
+	}
+
+	for _, rr := range m.Answers {
+		if rr.Type != RRSIGType || strings.HasPrefix(rr.Name.GetName(), "*.") {
+			continue
+		}
+
+		sig, err := rr.RRSIG()
+		if err == nil && int(sig.Labels) < rr.Name.LabelCount() {
+			if err := ProveWildcardAnswer(rr.Name, sig.Labels, m.Authority); err != nil {
+				return err
+			}
+		}
+	}
+
+	qname := cnameTarget(m.Question.Name, m.Answers)
+	switch {
+	case m.Header.RCode == NameErrorRCode:
+		return ProveNameError(qname, m.Authority)
+	case m.Header.RCode != NoErrorRCode || m.Question.Type >= IXFRQType:
+		return nil
+	case len(rrset(m.Answers, qname, Type(m.Question.Type))) > 0:
+		return nil
+	}
+
+	if cut, ok := delegationCut(m, qname); ok {
+		if len(rrset(m.Authority, cut, DSType)) > 0 {
+			return nil
+		}
+		return ProveInsecureDelegation(cut, m.Authority)
+	}
+
+	_, err := ProveNoData(qname, Type(m.Question.Type), m.Authority)
+	return err
+}
+
+// delegationCut returns the zone cut a referral for qname delegates to: the
+// owner of its NS records, which must enclose qname
+func delegationCut(m *Message, qname Name) (Name, bool) {
+	if m.Header.RCode != NoErrorRCode || len(rrset(m.Answers, qname, Type(m.Question.Type))) > 0 {
+		return Name{}, false
+	}
+
+	for _, rr := range m.Authority {
+		if rr.Type == SOAType {
+			return Name{}, false
+		}
+	}
+
+	for _, rr := range m.Authority {
+		if rr.Type == NSType && qname.IsSubdomainOf(rr.Name) {
+			return rr.Name, true
+		}
+	}
+
+	return Name{}, false
+}
+
+// cnameTarget follows the CNAME records of the answers from name, returning the
+// name the chain ends with
+func cnameTarget(name Name, answers []ResourceRecord) Name {
+	chain := cnameChain(name, answers)
+	return chain[len(chain)-1]
+}
+
+// cnameChain follows the CNAME records of the answers from name, returning the
+// names of the chain, name included
+func cnameChain(name Name, answers []ResourceRecord) []Name {
+	chain := []Name{name}
+	for i := 0; i < len(answers); i++ {
+		cname := rrset(answers, name, CNAMEType)
+		if len(cname) == 0 {
+			break
+		}
+
+		target := Name{}
+		if _, err := target.fromBytes(cname[0].Data, 0); err != nil {
+			break
+		}
+		name = target
+		chain = append(chain, name)
+	}
+
+	return chain
+}
+
+// rrset validates a RRset against the RRSIG records found among records
+func (va *validation) rrset(set []ResourceRecord, records []ResourceRecord) (SecurityStatus, error) {
+	owner := set[0].Name
+	sigs := coveringSignatures(set, records)
+	if len(sigs) == 0 {
+		status, err := va.nameStatus(owner)
+		if status == SecureStatus {
+			return BogusStatus, fmt.Errorf("RRset %s %s is not signed", owner.GetName(), set[0].Type)
+		}
+		return status, err
+	}
+
+	var reason error
+	unsecured := false
+	for _, sig := range sigs {
+		if set[0].Type == DSType && sig.SignerName.Equal(owner) {
+			// DS records are signed by the parent zone
+			reason = fmt.Errorf("DS RRset of %s is signed by the child zone", owner.GetName())
+			continue
+		}
+
+		if !owner.IsSubdomainOf(sig.SignerName) {
+			reason = fmt.Errorf("RRSIG signer %s is not an ancestor of %s", sig.SignerName.GetName(), owner.GetName())
+			continue
+		}
+
+		// the signer name is chosen by whoever made the signature, so a signer
+		// that is not secure proves nothing about the zone of the owner
+		zone := va.keys(sig.SignerName)
+		if zone.status != SecureStatus {
+			reason = fmt.Errorf("RRSIG signer %s is %s. %v", sig.SignerName.GetName(), zone.status, zone.err)
+			unsecured = true
+			continue
+		}
+
+		for _, key := range zone.keys {
+			if key.Algorithm != sig.Algorithm || key.KeyTag() != sig.KeyTag {
+				continue
+			}
+
+			if reason = VerifyRRset(set, sig, key, va.now); reason == nil {
+				return SecureStatus, nil
+			}
+		}
+
+		if reason == nil {
+			reason = fmt.Errorf("no DNSKEY of %s matches the RRSIG of %s %s", sig.SignerName.GetName(),
+				owner.GetName(), set[0].Type)
+		}
+	}
+
+	if unsecured {
+		// the data is only allowed to be unsigned when the zone actually
+		// enclosing the owner is not secure
+		if status, err := va.nameStatus(owner); status != SecureStatus {
+			return status, err
+		}
+	}
+
+	return BogusStatus, reason
+}
+
+// nameStatus returns the status of the zone holding name, to tell whether its
+// data must be signed
+func (va *validation) nameStatus(name Name) (SecurityStatus, error) {
+	_, status, err := va.zoneStatus(name)
+	return status, err
+}
+
+// zoneStatus returns the zone holding name and its status. The zone is unknown
+// when the status is Indeterminate
+func (va *validation) zoneStatus(name Name) (Name, SecurityStatus, error) {
+	resp, err := va.v.Querier.Query(name, QType(SOAType))
+	if err != nil {
+		return Name{}, IndeterminateStatus, fmt.Errorf("failed to find the zone of %s. %s", name.GetName(), err.Error())
+	}
+
+	for _, rr := range append(resp.Answers, resp.Authority...) {
+		if rr.Type == SOAType && name.IsSubdomainOf(rr.Name) {
+			zone := va.keys(rr.Name)
+			return rr.Name, zone.status, zone.err
+		}
+	}
+
+	return Name{}, IndeterminateStatus, fmt.Errorf("failed to find the zone of %s", name.GetName())
+}
+
+// keys returns the validated keys of a zone
+func (va *validation) keys(zone Name) zoneKeys {
+	if k, ok := va.zones[zone.GetName()]; ok {
+		return k
+	}
+
+	// guards against validation loops while the keys are fetched
+	va.zones[zone.GetName()] = zoneKeys{
+		status: IndeterminateStatus,
+		err:    fmt.Errorf("validation of the keys of %s depends on itself", zone.GetName()),
+	}
+
+	k := va.fetchKeys(zone)
+	va.zones[zone.GetName()] = k
+	return k
+}
+
+func (va *validation) fetchKeys(zone Name) zoneKeys {
+	anchorDS := make([]DS, 0)
+	anchorKeys := make([]DNSKEY, 0)
+	covered := false
+	for _, rr := range va.v.TrustAnchors {
+		covered = covered || zone.IsSubdomainOf(rr.Name)
+		if !rr.Name.Equal(zone) {
+			continue
+		}
+
+		if ds, err := rr.DS(); err == nil {
+			anchorDS = append(anchorDS, ds)
+		} else if key, err := rr.DNSKEY(); err == nil {
+			anchorKeys = append(anchorKeys, key)
+		}
+	}
+
+	if len(anchorDS) > 0 || len(anchorKeys) > 0 {
+		return va.dnskeys(zone, anchorDS, anchorKeys)
+	}
+
+	if !covered {
+		return zoneKeys{status: IndeterminateStatus, err: fmt.Errorf("no trust anchor covers %s", zone.GetName())}
+	}
+
+	resp, err := va.v.Querier.Query(zone, QType(DSType))
+	if err != nil {
+		return zoneKeys{status: IndeterminateStatus,
+			err: fmt.Errorf("failed to fetch the DS records of %s. %s", zone.GetName(), err.Error())}
+	}
+
+	dsSet := rrset(resp.Answers, zone, DSType)
+	if len(dsSet) == 0 {
+		// the parent zone must prove the absence of DS records at a zone cut for
+		// the zone to be insecure. Any other name is not a zone
+		status, err := va.message(&resp)
+		if status != SecureStatus {
+			return zoneKeys{status: status, err: err}
+		}
+
+		if err := ProveInsecureDelegation(zone, resp.Authority); errors.Is(err, ErrNSEC3Iterations) {
+			return zoneKeys{status: InsecureStatus, err: err}
+		} else if err != nil {
+			return zoneKeys{status: BogusStatus, err: err}
+		}
+		return zoneKeys{status: InsecureStatus}
+	}
+
+	if status, err := va.rrset(dsSet, resp.Answers); status != SecureStatus {
+		return zoneKeys{status: status, err: err}
+	}
+
+	ds := make([]DS, 0, len(dsSet))
+	for _, rr := range dsSet {
+		if d, err := rr.DS(); err == nil {
+			ds = append(ds, d)
+		}
+	}
+
+	return va.dnskeys(zone, ds, nil)
+}
+
+// dnskeys validates the DNSKEY RRset of a zone, which must be signed by a key
+// either authenticated by the DS records or trusted as an anchor
+func (va *validation) dnskeys(zone Name, ds []DS, anchors []DNSKEY) zoneKeys {
+	resp, err := va.v.Querier.Query(zone, QType(DNSKEYType))
+	if err != nil {
+		return zoneKeys{status: IndeterminateStatus,
+			err: fmt.Errorf("failed to fetch the DNSKEY records of %s. %s", zone.GetName(), err.Error())}
+	}
+
+	set := rrset(resp.Answers, zone, DNSKEYType)
+	keys := make([]DNSKEY, 0, len(set))
+	for _, rr := range set {
+		if key, err := rr.DNSKEY(); err == nil {
+			keys = append(keys, key)
+		}
+	}
+
+	trusted := make([]DNSKEY, 0)
+	supported := false
+	for _, key := range keys {
+		if dsMatches(zone, key, ds, &supported) || containsKey(anchors, key) {
+			trusted = append(trusted, key)
+		}
+	}
+
+	if len(trusted) == 0 {
+		if len(anchors) == 0 && !supported {
+			// RFC 4035 section 5.2: a zone authenticated only with unsupported
+			// algorithms is treated as unsigned
+			return zoneKeys{status: InsecureStatus}
+		}
+		return zoneKeys{status: BogusStatus, err: fmt.Errorf("no DNSKEY of %s matches its DS records", zone.GetName())}
+	}
+
+	reason := fmt.Errorf("DNSKEY RRset of %s is not signed by a trusted key", zone.GetName())
+	for _, sig := range coveringSignatures(set, resp.Answers) {
+		for _, key := range trusted {
+			if key.Algorithm != sig.Algorithm || key.KeyTag() != sig.KeyTag {
+				continue
+			}
+
+			err := VerifyRRset(set, sig, key, va.now)
+			if err == nil {
+				return zoneKeys{status: SecureStatus, keys: keys}
+			}
+			reason = err
+		}
+	}
+
+	return zoneKeys{status: BogusStatus, err: reason}
+}
+
+// dsMatches reports whether one of the DS records authenticates the key. It
+// records in supported whether one of them uses a supported algorithm
+func dsMatches(zone Name, key DNSKEY, ds []DS, supported *bool) bool {
+	for _, d := range ds {
+		if !supportedAlgorithm(d.Algorithm) {
+			continue
+		}
+
+		digest, err := key.ToDS(zone, d.DigestType)
+		if err != nil {
+			continue
+		}
+		*supported = true
+
+		if d.KeyTag == digest.KeyTag && d.Algorithm == key.Algorithm && bytes.Equal(d.Digest, digest.Digest) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func supportedAlgorithm(a Algorithm) bool {
+	switch a {
+	case RSASHA256Algorithm, ECDSAP256SHA256Algorithm, ECDSAP384SHA384Algorithm, ED25519Algorithm:
+		return true
+	default:
+		return false
+	}
+}
+
+func containsKey(keys []DNSKEY, key DNSKEY) bool {
+	for _, k := range keys {
+		if bytes.Equal(k.ToBytes(), key.ToBytes()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// coveringSignatures returns the RRSIG records among records that cover the
+// RRset
+func coveringSignatures(set []ResourceRecord, records []ResourceRecord) []RRSIG {
+	sigs := make([]RRSIG, 0)
+	for _, rr := range records {
+		if rr.Type != RRSIGType || rr.Class != set[0].Class || !rr.Name.Equal(set[0].Name) {
+			continue
+		}
+
+		if sig, err := rr.RRSIG(); err == nil && sig.TypeCovered == set[0].Type {
+			sigs = append(sigs, sig)
+		}
+	}
+
+	return sigs
+}
+
+func mustDecodeHex(s string) []byte {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return data
+}
@@ -0,0 +1,220 @@
+package dns_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+// signingKey generates a key signing the zone with the algorithm
+func signingKey(t *testing.T, zone string, algorithm dns.Algorithm) dns.SigningKey {
+	var signer crypto.Signer
+	var err error
+	switch algorithm {
+	case dns.RSASHA256Algorithm:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case dns.ECDSAP256SHA256Algorithm:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case dns.ECDSAP384SHA384Algorithm:
+		signer, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case dns.ED25519Algorithm:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatalf("failed to generate key. algorithm=%s err=%s", algorithm, err.Error())
+	}
+
+	return dns.SigningKey{Zone: mustName(t, zone), Flags: dns.ZoneKeyFlag | dns.SEPFlag, Signer: signer}
+}
+
+// signed returns the RRset followed by its RRSIG made with the key
+func signed(t *testing.T, key dns.SigningKey, rrs ...dns.ResourceRecord) []dns.ResourceRecord {
+	now := time.Now()
+	sig, err := dns.SignRRset(rrs, key, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("SignRRset failed with error %s", err.Error())
+	}
+
+	return append(rrs, sig)
+}
+
+func dnskeyRecord(t *testing.T, key dns.SigningKey) dns.ResourceRecord {
+	k, err := key.DNSKEY()
+	if err != nil {
+		t.Fatalf("DNSKEY failed with error %s", err.Error())
+	}
+
+	return dns.NewResourceRecord(key.Zone, dns.DNSKEYType, dns.INClass, 3600, k.ToBytes())
+}
+
+func dsRecord(t *testing.T, key dns.SigningKey) dns.ResourceRecord {
+	k, err := key.DNSKEY()
+	if err != nil {
+		t.Fatalf("DNSKEY failed with error %s", err.Error())
+	}
+
+	ds, err := k.ToDS(key.Zone, dns.SHA256DigestType)
+	if err != nil {
+		t.Fatalf("ToDS failed with error %s", err.Error())
+	}
+
+	return dns.NewResourceRecord(key.Zone, dns.DSType, dns.INClass, 3600, ds.ToBytes())
+}
+
+func rootSOA(t *testing.T) dns.ResourceRecord {
+	soa := dns.SOA{
+		MName:   mustName(t, "a.root-servers.net"),
+		RName:   mustName(t, "nstld.verisign-grs.com"),
+		Serial:  1,
+		Refresh: 1800,
+		Retry:   900,
+		Expire:  604800,
+		Minimum: 86400,
+	}
+
+	return dns.NewResourceRecord(mustName(t, "."), dns.SOAType, dns.INClass, 86400, soa.ToBytes())
+}
+
+// fakeQuerier answers queries from canned responses keyed by name and type
+type fakeQuerier map[string]dns.Message
+
+func (q fakeQuerier) add(name string, t dns.QType, answers []dns.ResourceRecord, authority []dns.ResourceRecord) {
+	q[fmt.Sprintf("%s/%s", name, t)] = dns.Message{Answers: answers, Authority: authority}
+}
+
+func (q fakeQuerier) Query(name dns.Name, t dns.QType) (dns.Message, error) {
+	m, ok := q[fmt.Sprintf("%s/%s", name.GetName(), t)]
+	if !ok {
+		return dns.Message{}, fmt.Errorf("no response for %s %s", name.GetName(), t)
+	}
+
+	m.Header.QuestionCount = 1
+	m.Question = dns.Question{Name: name, Type: t, Class: dns.INClass}
+	return m, nil
+}
+
+func TestValidator(t *testing.T) {
+	root := signingKey(t, ".", dns.ECDSAP256SHA256Algorithm)
+	q := fakeQuerier{}
+	q.add(".", dns.QType(dns.DNSKEYType), signed(t, root, dnskeyRecord(t, root)), nil)
+	q.add(".", dns.QType(dns.SOAType), signed(t, root, rootSOA(t)), nil)
+
+	children := map[string]dns.Algorithm{
+		"ed25519": dns.ED25519Algorithm,
+		"rsa":     dns.RSASHA256Algorithm,
+		"p384":    dns.ECDSAP384SHA384Algorithm,
+	}
+	keys := make(map[string]dns.SigningKey)
+	for zone, algorithm := range children {
+		key := signingKey(t, zone, algorithm)
+		keys[zone] = key
+		q.add(zone, dns.QType(dns.DSType), signed(t, root, dsRecord(t, key)), nil)
+		q.add(zone, dns.QType(dns.DNSKEYType), signed(t, key, dnskeyRecord(t, key)), nil)
+	}
+
+	insecure := dns.NSEC{NextDomain: mustName(t, "p384"), Types: []dns.Type{dns.NSType, dns.RRSIGType, dns.NSECType}}
+	q.add("insecure", dns.QType(dns.DSType), nil, append(signed(t, root, rootSOA(t)),
+		signed(t, root, dns.NewResourceRecord(mustName(t, "insecure"), dns.NSECType, dns.INClass, 86400, insecure.ToBytes()))...))
+	q.add("www.insecure", dns.QType(dns.SOAType), nil, []dns.ResourceRecord{soaRecord(t, "insecure", 1)})
+	q.add("www.ed25519", dns.QType(dns.SOAType), nil, signed(t, keys["ed25519"], soaRecord(t, "ed25519", 1)))
+
+	// a forged RRset signed with a key published at a name of a signed zone that
+	// is not a zone cut, hoping for its DS NODATA proof to make it insecure
+	forger := signingKey(t, "www.ed25519", dns.ED25519Algorithm)
+	notCut := dns.NSEC{NextDomain: mustName(t, "ed25519"), Types: []dns.Type{dns.AType, dns.RRSIGType, dns.NSECType}}
+	q.add("www.ed25519", dns.QType(dns.DSType), nil, append(signed(t, keys["ed25519"], soaRecord(t, "ed25519", 1)),
+		signed(t, keys["ed25519"], dns.NewResourceRecord(mustName(t, "www.ed25519"), dns.NSECType, dns.INClass, 300,
+			notCut.ToBytes()))...))
+	q.add("www.ed25519", dns.QType(dns.DNSKEYType), signed(t, forger, dnskeyRecord(t, forger)), nil)
+	forged := signed(t, forger, aRecord(t, "www.ed25519", "192.0.2.66"))
+
+	tampered := signed(t, keys["rsa"], aRecord(t, "www.rsa", "192.0.2.1"))
+	tampered[0] = aRecord(t, "www.rsa", "192.0.2.2")
+
+	expired, err := dns.SignRRset([]dns.ResourceRecord{aRecord(t, "www.p384", "192.0.2.1")}, keys["p384"],
+		time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("SignRRset failed with error %s", err.Error())
+	}
+
+	anchors := []dns.ResourceRecord{dsRecord(t, root)}
+	var cases = []struct {
+		answers []dns.ResourceRecord
+		anchors []dns.ResourceRecord
+		status  dns.SecurityStatus
+	}{
+		{signed(t, keys["ed25519"], aRecord(t, "www.ed25519", "192.0.2.1")), anchors, dns.SecureStatus},
+		{signed(t, keys["rsa"], aRecord(t, "www.rsa", "192.0.2.1")), anchors, dns.SecureStatus},
+		{signed(t, keys["p384"], aRecord(t, "www.p384", "192.0.2.1")), anchors, dns.SecureStatus},
+		{[]dns.ResourceRecord{aRecord(t, "www.insecure", "192.0.2.1")}, anchors, dns.InsecureStatus},
+		{[]dns.ResourceRecord{aRecord(t, "www.ed25519", "192.0.2.1")}, anchors, dns.BogusStatus},
+		{tampered, anchors, dns.BogusStatus},
+		{[]dns.ResourceRecord{aRecord(t, "www.p384", "192.0.2.1"), expired}, anchors, dns.BogusStatus},
+		{signed(t, keys["rsa"], aRecord(t, "www.ed25519", "192.0.2.1")), anchors, dns.BogusStatus},
+		{forged, anchors, dns.BogusStatus},
+		// the signatures following one made by an unsecure signer are checked
+		{append(forged, signed(t, keys["ed25519"], aRecord(t, "www.ed25519", "192.0.2.66"))[1]), anchors, dns.SecureStatus},
+		{signed(t, signingKey(t, "insecure", dns.ED25519Algorithm), aRecord(t, "www.insecure", "192.0.2.1")),
+			anchors, dns.InsecureStatus},
+		{signed(t, keys["ed25519"], aRecord(t, "www.ed25519", "192.0.2.1")), nil, dns.IndeterminateStatus},
+	}
+
+	for i, c := range cases {
+		v := dns.Validator{TrustAnchors: c.anchors, Querier: q}
+		status, err := v.Validate(&dns.Message{Answers: c.answers})
+		if status != c.status {
+			t.Fatalf("unexpected status. case=%d actual=%s expected=%s err=%v", i, status, c.status, err)
+		}
+
+		if status == dns.BogusStatus && err == nil {
+			t.Fatalf("bogus results should carry a reason. case=%d", i)
+		}
+	}
+
+	// the status of a response is the one of the zone holding its question:
+	// an unsigned RRset of another zone does not make a forged denial insecure
+	soa := signed(t, keys["ed25519"], soaRecord(t, "ed25519", 1))
+	foreign := aRecord(t, "www.insecure", "192.0.2.66")
+	// the denial of a zone using too many NSEC3 iterations is not checked
+	costly := dns.NSEC3{HashAlgorithm: dns.SHA1NSEC3Hash, Iterations: 500, NextHashedOwner: make([]byte, 20)}
+	costlyDenial := append(signed(t, keys["ed25519"], soaRecord(t, "ed25519", 1)), signed(t, keys["ed25519"],
+		dns.NewResourceRecord(mustName(t, "0p9mhaveqvm6t7vbl5lop2u3t2rp3tom.ed25519"), dns.NSEC3Type, dns.INClass, 300,
+			costly.ToBytes()))...)
+	var responses = []struct {
+		name      string
+		rcode     dns.RCode
+		answers   []dns.ResourceRecord
+		authority []dns.ResourceRecord
+		status    dns.SecurityStatus
+	}{
+		{"www.ed25519", dns.NameErrorRCode, nil, soa, dns.BogusStatus},
+		{"www.ed25519", dns.NameErrorRCode, nil, append(soa, foreign), dns.BogusStatus},
+		{"www.ed25519", dns.NoErrorRCode, nil, append(soa, foreign), dns.BogusStatus},
+		{"www.ed25519", dns.NoErrorRCode, signed(t, keys["ed25519"], aRecord(t, "www.ed25519", "192.0.2.1")),
+			[]dns.ResourceRecord{foreign}, dns.SecureStatus},
+		{"www.insecure", dns.NoErrorRCode, []dns.ResourceRecord{foreign}, soa, dns.InsecureStatus},
+		{"www.ed25519", dns.NameErrorRCode, nil, costlyDenial, dns.InsecureStatus},
+	}
+
+	for i, r := range responses {
+		m := dns.Message{
+			Header:    dns.Header{QuestionCount: 1, RCode: r.rcode},
+			Question:  dns.Question{Name: mustName(t, r.name), Type: dns.QType(dns.AType), Class: dns.INClass},
+			Answers:   r.answers,
+			Authority: r.authority,
+		}
+
+		v := dns.Validator{TrustAnchors: anchors, Querier: q}
+		if status, err := v.Validate(&m); status != r.status {
+			t.Fatalf("unexpected status. response=%d actual=%s expected=%s err=%v", i, status, r.status, err)
+		}
+	}
+}
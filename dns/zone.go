@@ -0,0 +1,192 @@
+package dns
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Zone holds the resource records of a zone in memory. A zone always contains
+// exactly one SOA record, owned by its origin. It is safe for concurrent use
+type Zone struct {
+	origin Name
+
+	mu      sync.RWMutex
+	soa     ResourceRecord
+	records []ResourceRecord // every record but the SOA
+}
+
+// NewZone builds a zone from its records, which must contain exactly one SOA
+// record owned by the origin
+func NewZone(origin Name, records []ResourceRecord) (*Zone, error) {
+	z := &Zone{origin: origin}
+	if err := z.Replace(records); err != nil {
+		return nil, err
+	}
+
+	return z, nil
+}
+
+// Origin returns the name of the zone
+func (z *Zone) Origin() Name {
+	return z.origin
+}
+
+// SOA returns the SOA record of the zone
+func (z *Zone) SOA() ResourceRecord {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+
+	return z.soa
+}
+
+// Serial returns the serial of the zone
+func (z *Zone) Serial() uint32 {
+	soa := z.SOA()
+	return soaSerial(soa)
+}
+
+// Records returns a copy of the records of the zone, starting with its SOA
+func (z *Zone) Records() []ResourceRecord {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+
+	records := make([]ResourceRecord, 0, len(z.records)+1)
+	records = append(records, z.soa)
+	records = append(records, z.records...)
+	return records
+}
+
+// Lookup returns the records of the zone owned by name and of the given type
+func (z *Zone) Lookup(name Name, t Type) []ResourceRecord {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+
+	if t == SOAType {
+		if z.soa.Name.Equal(name) {
+			return []ResourceRecord{z.soa}
+		}
+		return nil
+	}
+
+	records := make([]ResourceRecord, 0)
+	for _, rr := range z.records {
+		if rr.Type == t && rr.Name.Equal(name) {
+			records = append(records, rr)
+		}
+	}
+
+	return records
+}
+
+// Replace atomically replaces every record of the zone
+func (z *Zone) Replace(records []ResourceRecord) error {
+	soa, others, err := splitZoneRecords(z.origin, records)
+	if err != nil {
+		return err
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	z.soa = soa
+	z.records = others
+	return nil
+}
+
+// Apply atomically applies a difference to the zone. The zone serial must match
+// the serial of the From SOA of the difference
+func (z *Zone) Apply(d Diff) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	records, err := applyDiff(z.soa, z.records, d)
+	if err != nil {
+		return err
+	}
+
+	z.soa = d.To
+	z.records = records
+	return nil
+}
+
+func applyDiff(soa ResourceRecord, records []ResourceRecord, d Diff) ([]ResourceRecord, error) {
+	if d.From.Type != SOAType || d.To.Type != SOAType {
+		return nil, fmt.Errorf("failed to apply diff, boundaries must be SOA records")
+	}
+
+	if soaSerial(soa) != soaSerial(d.From) {
+		return nil, fmt.Errorf("failed to apply diff, serial mismatch. zone=%d diff=%d",
+			soaSerial(soa), soaSerial(d.From))
+	}
+
+	updated := make([]ResourceRecord, len(records))
+	copy(updated, records)
+
+	for _, deleted := range d.Deleted {
+		index := indexOfRecord(updated, deleted)
+		if index < 0 {
+			return nil, fmt.Errorf("failed to apply diff, deleted record not in zone. name=%s type=%s",
+				deleted.Name.GetName(), deleted.Type)
+		}
+		updated = append(updated[:index], updated[index+1:]...)
+	}
+
+	for _, added := range d.Added {
+		if added.Type == SOAType {
+			return nil, fmt.Errorf("failed to apply diff, SOA records cannot be added")
+		}
+
+		if indexOfRecord(updated, added) < 0 {
+			updated = append(updated, added)
+		}
+	}
+
+	return updated, nil
+}
+
+func splitZoneRecords(origin Name, records []ResourceRecord) (ResourceRecord, []ResourceRecord, error) {
+	var soa ResourceRecord
+	soaCount := 0
+	others := make([]ResourceRecord, 0, len(records))
+
+	for _, rr := range records {
+		if rr.Type != SOAType {
+			others = append(others, rr)
+			continue
+		}
+
+		if !rr.Name.Equal(origin) {
+			return ResourceRecord{}, nil, fmt.Errorf("SOA record is not owned by the zone origin. name=%s origin=%s",
+				rr.Name.GetName(), origin.GetName())
+		}
+
+		soa = rr
+		soaCount++
+	}
+
+	if soaCount != 1 {
+		return ResourceRecord{}, nil, fmt.Errorf("zone must contain exactly one SOA record. count=%d", soaCount)
+	}
+
+	return soa, others, nil
+}
+
+func indexOfRecord(records []ResourceRecord, rr ResourceRecord) int {
+	for i, r := range records {
+		if sameRecord(r, rr) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// soaSerial returns the serial of a SOA record, or 0 if its data is invalid
+func soaSerial(rr ResourceRecord) uint32 {
+	soa, err := rr.SOA()
+	if err != nil {
+		return 0
+	}
+
+	return soa.Serial
+}
@@ -0,0 +1,105 @@
+package dns
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// WriteZone writes the records of the zone to w in the master file format of
+// RFC 1035 section 5, one record per line with its absolute owner name, TTL,
+// class and type. The data of types without a presentation form in this
+// package is written in the generic form of RFC 3597 section 5
+func WriteZone(w io.Writer, z *Zone) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "$ORIGIN %s\n", nameToString(z.Origin()))
+	for _, rr := range z.Records() {
+		fmt.Fprintf(bw, "%s\t%d\t%s\t%s\t%s\n", nameToString(rr.Name), rr.TTL, rr.Class, typeToString(rr.Type),
+			dataToString(rr))
+	}
+
+	// the errors of the writes are returned by Flush
+	return bw.Flush()
+}
+
+// dataToString returns the presentation form of the record data, falling back
+// to the generic form when the data cannot be parsed
+func dataToString(rr ResourceRecord) string {
+	switch rr.Type {
+	case AType, AAAAType:
+		if (rr.Type == AType && len(rr.Data) == 4) || (rr.Type == AAAAType && len(rr.Data) == 16) {
+			return net.IP(rr.Data).String()
+		}
+	case NSType, CNAMEType, PTRType, DNAMEType:
+		var target Name
+		if n, err := target.fromBytes(rr.Data, 0); err == nil && n == len(rr.Data) {
+			return nameToString(target)
+		}
+	default:
+		if data, err := recordData(rr); data != nil && err == nil {
+			return data.String()
+		}
+	}
+
+	return fmt.Sprintf("\\# %d %s", len(rr.Data), strings.ToUpper(hex.EncodeToString(rr.Data)))
+}
+
+// recordData returns the parsed data of the record, or nil if its type has no
+// presentation form
+func recordData(rr ResourceRecord) (fmt.Stringer, error) {
+	switch rr.Type {
+	case SOAType:
+		d, err := rr.SOA()
+		return &d, err
+	case MXType:
+		d, err := rr.MX()
+		return &d, err
+	case TXTType:
+		d, err := rr.TXT()
+		return &d, err
+	case SRVType:
+		d, err := rr.SRV()
+		return &d, err
+	case NAPTRType:
+		d, err := rr.NAPTR()
+		return &d, err
+	case DSType, CDSType:
+		d, err := rr.DS()
+		return &d, err
+	case SSHFPType:
+		d, err := rr.SSHFP()
+		return &d, err
+	case RRSIGType:
+		d, err := rr.RRSIG()
+		return &d, err
+	case NSECType:
+		d, err := rr.NSEC()
+		return &d, err
+	case DNSKEYType, CDNSKEYType:
+		d, err := rr.DNSKEY()
+		return &d, err
+	case NSEC3Type:
+		d, err := rr.NSEC3()
+		return &d, err
+	case NSEC3PARAMType:
+		d, err := rr.NSEC3PARAM()
+		return &d, err
+	case TLSAType:
+		d, err := rr.TLSA()
+		return &d, err
+	case OPENPGPKEYType:
+		d, err := rr.OPENPGPKEY()
+		return &d, err
+	case SVCBType, HTTPSType:
+		d, err := rr.SVCB()
+		return &d, err
+	case CAAType:
+		d, err := rr.CAA()
+		return &d, err
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,81 @@
+package dns_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jordanabderrachid/dns/dns"
+)
+
+func TestWriteZone(t *testing.T) {
+	z := mustZone(t, "example.com",
+		nameRecord(t, "example.com", dns.NSType, "ns1.example.com"),
+		aRecord(t, "www.example.com", "192.0.2.1"),
+		nameRecord(t, "ftp.example.com", dns.CNAMEType, "www.example.com"),
+		txtRecord(t, "example.com", `v=spf1 "quoted" -all`),
+		dns.NewResourceRecord(mustName(t, "host.example.com"), dns.HINFOType, dns.INClass, 300, []byte{1, 'a', 1, 'b'}),
+		// a truncated A record is written in the generic form
+		dns.NewResourceRecord(mustName(t, "bad.example.com"), dns.AType, dns.INClass, 300, []byte{192, 0, 2}),
+	)
+
+	var buf bytes.Buffer
+	if err := dns.WriteZone(&buf, z); err != nil {
+		t.Fatalf("WriteZone failed with error %s", err.Error())
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(z.Records())+1 || lines[0] != "$ORIGIN example.com." {
+		t.Fatalf("unexpected zone file. actual=%q", buf.String())
+	}
+
+	var expected = []string{
+		"example.com.\t300\tIN\tNS\tns1.example.com.",
+		"www.example.com.\t300\tIN\tA\t192.0.2.1",
+		"ftp.example.com.\t300\tIN\tCNAME\twww.example.com.",
+		"example.com.\t300\tIN\tTXT\t\"v=spf1 \\\"quoted\\\" -all\"",
+		"host.example.com.\t300\tIN\tHINFO\t\\# 4 01610162",
+		"bad.example.com.\t300\tIN\tA\t\\# 3 C00002",
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(buf.String(), e+"\n") {
+			t.Fatalf("missing record line. expected=%q actual=%q", e, buf.String())
+		}
+	}
+}
+
+func TestWriteSignedZone(t *testing.T) {
+	ksk := signingKey(t, "example.com", dns.ED25519Algorithm)
+	s := dns.ZoneSigner{
+		Keys:  []dns.SigningKey{ksk},
+		NSEC3: &dns.NSEC3PARAM{HashAlgorithm: dns.SHA1NSEC3Hash, Iterations: 0, Salt: []byte{0xaa, 0xbb}},
+	}
+	signed, err := s.Sign(unsignedZone(t))
+	if err != nil {
+		t.Fatalf("Sign failed with error %s", err.Error())
+	}
+
+	// the NSEC3PARAM record is cached like the NSEC3 records
+	params := signed.Lookup(mustName(t, "example.com"), dns.NSEC3PARAMType)
+	nsec3 := countType(signed.Records(), dns.NSEC3Type)
+	if len(params) != 1 || nsec3 == 0 || params[0].TTL == 0 {
+		t.Fatalf("unexpected NSEC3PARAM records. actual=%v", params)
+	}
+	for _, rr := range signed.Records() {
+		if rr.Type == dns.NSEC3Type && rr.TTL != params[0].TTL {
+			t.Fatalf("unexpected NSEC3PARAM TTL. actual=%d expected=%d", params[0].TTL, rr.TTL)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := dns.WriteZone(&buf, signed); err != nil {
+		t.Fatalf("WriteZone failed with error %s", err.Error())
+	}
+
+	for _, e := range []string{"\tIN\tNSEC3PARAM\t1 0 0 AABB\n", "\tIN\tRRSIG\tSOA 15 2 3600 ", "\tIN\tDNSKEY\t257 3 15 "} {
+		if !strings.Contains(buf.String(), e) || strings.Contains(buf.String(), "\\#") {
+			t.Fatalf("unexpected signed zone file. expected=%q actual=%q", e, buf.String())
+		}
+	}
+}